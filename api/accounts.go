@@ -0,0 +1,77 @@
+package api
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+
+	"github.com/alienxp03/teya-ledger/handler/transaction"
+)
+
+func (a *APIImpl) openAccount(w http.ResponseWriter, r *http.Request) {
+	userID := requestUserID(r)
+
+	// The body is optional, an account without currencies holds the default currency
+	var req OpenAccountRequest
+	if err := a.parseBody(r, &req); err != nil && !errors.Is(err, io.EOF) {
+		a.respondError(w, http.StatusBadRequest, err, fmt.Sprintf("Invalid body request %+v", err))
+		return
+	}
+
+	account, err := a.transactioner.OpenAccount(userID, transaction.OpenAccountRequest{Currencies: req.Currencies})
+	if err != nil {
+		a.respondError(w, http.StatusInternalServerError, err, fmt.Sprintf("Failed to open account: %+v", err))
+		return
+	}
+
+	a.respond(w, http.StatusOK, AccountResponse{Account: newAccount(*account)})
+}
+
+func (a *APIImpl) getAccounts(w http.ResponseWriter, r *http.Request) {
+	userID := requestUserID(r)
+
+	result, err := a.transactioner.GetAccounts(userID)
+	if err != nil {
+		a.respondError(w, http.StatusBadRequest, err, fmt.Sprintf("Failed to get accounts: %+v", err))
+		return
+	}
+
+	resp := GetAccountsResponse{Accounts: []Account{}}
+	for _, account := range result.Accounts {
+		resp.Accounts = append(resp.Accounts, newAccount(account))
+	}
+	a.respond(w, http.StatusOK, resp)
+}
+
+func (a *APIImpl) getAccount(w http.ResponseWriter, r *http.Request) {
+	userID := requestUserID(r)
+	if err := a.checkAccountNumber(r.PathValue("accountNumber")); err != nil {
+		a.respondError(w, http.StatusBadRequest, err, "")
+		return
+	}
+
+	account, err := a.transactioner.GetAccount(userID, r.PathValue("accountNumber"))
+	if err != nil {
+		a.respondError(w, http.StatusBadRequest, err, fmt.Sprintf("Failed to get account: %+v", err))
+		return
+	}
+
+	a.respond(w, http.StatusOK, AccountResponse{Account: newAccount(*account)})
+}
+
+func (a *APIImpl) closeAccount(w http.ResponseWriter, r *http.Request) {
+	userID := requestUserID(r)
+	if err := a.checkAccountNumber(r.PathValue("accountNumber")); err != nil {
+		a.respondError(w, http.StatusBadRequest, err, "")
+		return
+	}
+
+	account, err := a.transactioner.CloseAccount(userID, r.PathValue("accountNumber"))
+	if err != nil {
+		a.respondError(w, http.StatusBadRequest, err, fmt.Sprintf("Failed to close account: %+v", err))
+		return
+	}
+
+	a.respond(w, http.StatusOK, AccountResponse{Account: newAccount(*account)})
+}
@@ -0,0 +1,176 @@
+package api
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/alienxp03/teya-ledger/handler/transaction"
+	"github.com/alienxp03/teya-ledger/types"
+)
+
+// requireRole rejects requests whose principal does not have role, or a role above it, with 403
+func (a *APIImpl) requireRole(role string, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		principal, ok := PrincipalFrom(r.Context())
+		if !ok || !principal.HasRole(role) {
+			err := types.NewForbidden(types.ErrorCodeInsufficientRole, fmt.Sprintf("the %s role is required", role))
+			a.respondError(w, http.StatusForbidden, err, err.Error())
+			return
+		}
+
+		next.ServeHTTP(w, r)
+	})
+}
+
+// requestOperator is the support or admin user an authenticated request is made by
+func requestOperator(r *http.Request) transaction.Operator {
+	principal, ok := PrincipalFrom(r.Context())
+	if !ok {
+		return transaction.Operator{}
+	}
+	return transaction.Operator{UserID: principal.UserID, Role: principal.Role}
+}
+
+func (a *APIImpl) searchTransactions(w http.ResponseWriter, r *http.Request) {
+	params, err := a.getTransactionsParams(r)
+	if err != nil {
+		a.respondError(w, http.StatusBadRequest, err, fmt.Sprintf("Invalid query %+v", err))
+		return
+	}
+
+	result, err := a.admin.SearchTransactions(transaction.SearchTransactionsRequest{
+		UserID:                 r.URL.Query().Get("userID"),
+		GetTransactionsRequest: *params,
+	})
+	if err != nil {
+		a.respondError(w, http.StatusBadRequest, err, fmt.Sprintf("Failed to search transactions %+v", err))
+		return
+	}
+
+	resp := SearchTransactionsResponse{Transactions: []AccountTransaction{}}
+	for _, transaction := range result.Transactions {
+		resp.Transactions = append(resp.Transactions, newAccountTransaction(transaction))
+	}
+	resp.NextCursor = result.NextCursor
+	resp.HasMore = result.HasMore
+
+	if result.HasMore {
+		w.Header().Set("Link", nextPageLink(r, result.NextCursor))
+	}
+
+	a.respond(w, http.StatusOK, resp)
+}
+
+func (a *APIImpl) getAccountTransaction(w http.ResponseWriter, r *http.Request) {
+	transaction, err := a.admin.FindTransaction(r.PathValue("transactionID"))
+	if err != nil {
+		a.respondError(w, http.StatusBadRequest, err, fmt.Sprintf("Failed to get transaction: %+v", err))
+		return
+	}
+
+	a.respond(w, http.StatusOK, GetAccountTransactionResponse{Transaction: newAccountTransaction(*transaction)})
+}
+
+func (a *APIImpl) overrideStatus(w http.ResponseWriter, r *http.Request) {
+	var req OverrideStatusRequest
+	if err := a.parseBody(r, &req); err != nil {
+		a.respondError(w, http.StatusBadRequest, err, fmt.Sprintf("Invalid body request %+v", err))
+		return
+	}
+
+	transaction, err := a.admin.OverrideStatus(requestOperator(r), r.PathValue("transactionID"), transaction.UpdateStatusRequest{
+		Status: req.Status,
+		Reason: req.Reason,
+	})
+	if err != nil {
+		a.respondError(w, http.StatusBadRequest, err, fmt.Sprintf("Failed to override transaction status: %+v", err))
+		return
+	}
+
+	a.respond(w, http.StatusOK, GetAccountTransactionResponse{Transaction: newAccountTransaction(*transaction)})
+}
+
+func (a *APIImpl) freezeAccount(w http.ResponseWriter, r *http.Request) {
+	a.changeAccountStatus(w, r, a.admin.FreezeAccount)
+}
+
+func (a *APIImpl) unfreezeAccount(w http.ResponseWriter, r *http.Request) {
+	a.changeAccountStatus(w, r, a.admin.UnfreezeAccount)
+}
+
+func (a *APIImpl) changeAccountStatus(w http.ResponseWriter, r *http.Request, change func(transaction.Operator, string, transaction.ChangeAccountStatusRequest) (*transaction.Account, error)) {
+	if err := a.checkAccountNumber(r.PathValue("accountNumber")); err != nil {
+		a.respondError(w, http.StatusBadRequest, err, "")
+		return
+	}
+
+	var req ChangeAccountStatusRequest
+	if err := a.parseBody(r, &req); err != nil {
+		a.respondError(w, http.StatusBadRequest, err, fmt.Sprintf("Invalid body request %+v", err))
+		return
+	}
+
+	account, err := change(requestOperator(r), r.PathValue("accountNumber"), transaction.ChangeAccountStatusRequest{Reason: req.Reason})
+	if err != nil {
+		a.respondError(w, http.StatusBadRequest, err, fmt.Sprintf("Failed to change account status: %+v", err))
+		return
+	}
+
+	a.respond(w, http.StatusOK, ChangeAccountStatusResponse{Account: newAccount(*account)})
+}
+
+func (a *APIImpl) getAuditEntries(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	limit, err := strconv.Atoi(query.Get("limit"))
+	if err != nil {
+		limit = 0
+	}
+
+	result, err := a.admin.GetAuditEntries(transaction.GetAuditEntriesRequest{
+		OperatorID: query.Get("operatorID"),
+		TargetType: query.Get("targetType"),
+		TargetID:   query.Get("targetID"),
+		Limit:      limit,
+	})
+	if err != nil {
+		a.respondError(w, http.StatusBadRequest, err, fmt.Sprintf("Failed to get audit entries: %+v", err))
+		return
+	}
+
+	resp := GetAuditEntriesResponse{Entries: []AuditEntry{}}
+	for _, entry := range result.Entries {
+		resp.Entries = append(resp.Entries, AuditEntry{
+			ID:         entry.ID,
+			OperatorID: entry.OperatorID,
+			Role:       entry.Role,
+			Action:     entry.Action,
+			TargetType: entry.TargetType,
+			TargetID:   entry.TargetID,
+			Reason:     entry.Reason,
+			Details:    entry.Details,
+			CreatedAt:  entry.CreatedAt.Format(time.RFC3339Nano),
+		})
+	}
+	a.respond(w, http.StatusOK, resp)
+}
+
+func newAccountTransaction(transaction transaction.AccountTransaction) AccountTransaction {
+	return AccountTransaction{
+		Transaction:   newTransaction(transaction.Transaction),
+		UserID:        transaction.UserID,
+		AccountNumber: transaction.AccountNumber,
+	}
+}
+
+func newAccount(account transaction.Account) Account {
+	return Account{
+		AccountNumber: account.Number,
+		UserID:        account.UserID,
+		Status:        account.Status,
+		Currencies:    account.Currencies,
+		CreatedAt:     account.CreatedAt.Format(time.RFC3339),
+		UpdatedAt:     account.UpdatedAt.Format(time.RFC3339),
+	}
+}
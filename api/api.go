@@ -2,25 +2,89 @@ package api
 
 import (
 	"net/http"
+	"time"
 
+	"github.com/alienxp03/teya-ledger/handler/account"
+	"github.com/alienxp03/teya-ledger/handler/apikey"
 	"github.com/alienxp03/teya-ledger/handler/transaction"
+	"github.com/alienxp03/teya-ledger/types"
 	"github.com/go-playground/validator/v10"
 )
 
-var validate = validator.New()
-
-const (
-	HeaderUserID = "userID"
-)
+// newValidator registers the `currency` tag, accepting the ISO 4217 codes known to the ledger, and
+// the `account_number` tag, rejecting numbers that are not valid numbers of accountNumbers
+func newValidator(accountNumbers *account.Scheme) *validator.Validate {
+	v := validator.New()
+	v.RegisterValidation("currency", func(fl validator.FieldLevel) bool {
+		_, ok := types.LookupCurrency(fl.Field().String())
+		return ok
+	})
+	v.RegisterValidation("account_number", func(fl validator.FieldLevel) bool {
+		return accountNumbers.Validate(fl.Field().String()) == nil
+	})
+	return v
+}
 
 type APIImpl struct {
 	transactioner transaction.Transactioner
+	keys          apikey.KeyManager
+	tokens        TokenVerifier
+	admin         transaction.Administrator
+
+	accountNumbers *account.Scheme
+	validate       *validator.Validate
+
+	idempotencyKeys IdempotencyStore
+	idempotencyTTL  time.Duration
 
 	mux *http.ServeMux
 }
 
-func New(transactioner transaction.Transactioner) *APIImpl {
-	return &APIImpl{
-		transactioner: transactioner,
+// Option configures optional features of an APIImpl
+type Option func(*APIImpl)
+
+// WithIdempotency stores the responses to requests sent with an Idempotency-Key header
+// in store for ttl, replaying them to retries of the request
+func WithIdempotency(store IdempotencyStore, ttl time.Duration) Option {
+	return func(a *APIImpl) {
+		a.idempotencyKeys = store
+		a.idempotencyTTL = ttl
+	}
+}
+
+// WithJWT also authenticates requests with signed JWTs checked by verifier
+func WithJWT(verifier TokenVerifier) Option {
+	return func(a *APIImpl) {
+		a.tokens = verifier
+	}
+}
+
+// WithAdministrator serves the /api/v1/admin routes, letting support and admin users act on
+// the data of every user through admin
+func WithAdministrator(admin transaction.Administrator) Option {
+	return func(a *APIImpl) {
+		a.admin = admin
+	}
+}
+
+// WithAccountNumbers checks the check digits of the account numbers sent to deposits and
+// withdrawals against scheme, account.Default() otherwise
+func WithAccountNumbers(scheme *account.Scheme) Option {
+	return func(a *APIImpl) {
+		a.accountNumbers = scheme
+	}
+}
+
+// New serves the ledger API, authenticating requests with the API keys of keys
+func New(transactioner transaction.Transactioner, keys apikey.KeyManager, opts ...Option) *APIImpl {
+	a := &APIImpl{
+		transactioner:  transactioner,
+		keys:           keys,
+		accountNumbers: account.Default(),
+	}
+	for _, opt := range opts {
+		opt(a)
 	}
+	a.validate = newValidator(a.accountNumbers)
+	return a
 }
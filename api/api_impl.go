@@ -1,23 +1,61 @@
 package api
 
 import (
+	"errors"
 	"fmt"
+	"io"
 	"net/http"
+	"net/url"
 	"path"
 	"strconv"
+	"strings"
 	"time"
 
 	"github.com/alienxp03/teya-ledger/handler/transaction"
+	"github.com/alienxp03/teya-ledger/storage"
+	"github.com/alienxp03/teya-ledger/types"
 )
 
 func (a *APIImpl) setupRoutes() {
 	a.mux = http.NewServeMux()
 
-	a.mux.Handle("POST /api/v1/deposits", AuthMiddleware(http.HandlerFunc(a.createDeposit)))
-	a.mux.Handle("POST /api/v1/withdrawals", AuthMiddleware(http.HandlerFunc(a.createWithdrawal)))
-	a.mux.Handle("GET /api/v1/balances", AuthMiddleware(http.HandlerFunc(a.getBalance)))
-	a.mux.Handle("GET /api/v1/transactions", AuthMiddleware(http.HandlerFunc(a.getTransactions)))
-	a.mux.Handle("GET /api/v1/transactions/{transactionID}", AuthMiddleware(http.HandlerFunc(a.getTransaction)))
+	a.handle("POST /api/v1/deposits", types.ScopeDepositsWrite, a.idempotent(http.HandlerFunc(a.createDeposit)))
+	a.handle("POST /api/v1/withdrawals", types.ScopeWithdrawalsWrite, a.idempotent(http.HandlerFunc(a.createWithdrawal)))
+	a.handle("POST /api/v1/transfers", types.ScopeTransfersWrite, a.idempotent(http.HandlerFunc(a.createTransfer)))
+	a.handle("POST /api/v1/conversions/quotes", types.ScopeConversionsWrite, a.idempotent(http.HandlerFunc(a.createQuote)))
+	a.handle("POST /api/v1/conversions", types.ScopeConversionsWrite, a.idempotent(http.HandlerFunc(a.createConversion)))
+	a.handle("POST /api/v1/accounts", types.ScopeAccountsWrite, a.idempotent(http.HandlerFunc(a.openAccount)))
+	a.handle("GET /api/v1/accounts", types.ScopeAccountsRead, http.HandlerFunc(a.getAccounts))
+	a.handle("GET /api/v1/accounts/{accountNumber}", types.ScopeAccountsRead, http.HandlerFunc(a.getAccount))
+	a.handle("POST /api/v1/accounts/{accountNumber}/close", types.ScopeAccountsWrite, a.idempotent(http.HandlerFunc(a.closeAccount)))
+	a.handle("GET /api/v1/balances", types.ScopeBalancesRead, http.HandlerFunc(a.getBalance))
+	a.handle("GET /api/v1/balances/history", types.ScopeBalancesRead, http.HandlerFunc(a.getBalanceHistory))
+	a.handle("GET /api/v1/transactions", types.ScopeTransactionsRead, http.HandlerFunc(a.getTransactions))
+	a.handle("GET /api/v1/transactions/{transactionID}", types.ScopeTransactionsRead, http.HandlerFunc(a.getTransaction))
+	a.handle("POST /api/v1/transactions/{transactionID}/cancel", types.ScopeTransactionsWrite, a.idempotent(http.HandlerFunc(a.cancelTransaction)))
+	a.handle("POST /api/v1/transactions/{transactionID}/reversals", types.ScopeTransactionsWrite, a.idempotent(http.HandlerFunc(a.createReversal)))
+	a.handle("POST /api/v1/holds", types.ScopeHoldsWrite, a.idempotent(http.HandlerFunc(a.createHold)))
+	a.handle("GET /api/v1/holds/{holdID}", types.ScopeHoldsRead, http.HandlerFunc(a.getHold))
+	a.handle("POST /api/v1/holds/{holdID}/capture", types.ScopeHoldsWrite, a.idempotent(http.HandlerFunc(a.captureHold)))
+	a.handle("POST /api/v1/holds/{holdID}/void", types.ScopeHoldsWrite, a.idempotent(http.HandlerFunc(a.voidHold)))
+	a.handle("POST /api/v1/api-keys", types.ScopeAPIKeysWrite, a.idempotent(http.HandlerFunc(a.createAPIKey)))
+	a.handle("GET /api/v1/api-keys", types.ScopeAPIKeysRead, http.HandlerFunc(a.getAPIKeys))
+	a.handle("POST /api/v1/api-keys/{keyID}/rotate", types.ScopeAPIKeysWrite, a.idempotent(http.HandlerFunc(a.rotateAPIKey)))
+	a.handle("POST /api/v1/api-keys/{keyID}/revoke", types.ScopeAPIKeysWrite, a.idempotent(http.HandlerFunc(a.revokeAPIKey)))
+
+	if a.admin != nil {
+		a.handle("GET /api/v1/admin/transactions", types.ScopeAdminRead, a.requireRole(types.RoleSupport, http.HandlerFunc(a.searchTransactions)))
+		a.handle("GET /api/v1/admin/transactions/{transactionID}", types.ScopeAdminRead, a.requireRole(types.RoleSupport, http.HandlerFunc(a.getAccountTransaction)))
+		a.handle("POST /api/v1/admin/transactions/{transactionID}/status", types.ScopeAdminWrite, a.requireRole(types.RoleAdmin, a.idempotent(http.HandlerFunc(a.overrideStatus))))
+		a.handle("POST /api/v1/admin/accounts/{accountNumber}/freeze", types.ScopeAdminWrite, a.requireRole(types.RoleAdmin, a.idempotent(http.HandlerFunc(a.freezeAccount))))
+		a.handle("POST /api/v1/admin/accounts/{accountNumber}/unfreeze", types.ScopeAdminWrite, a.requireRole(types.RoleAdmin, a.idempotent(http.HandlerFunc(a.unfreezeAccount))))
+		a.handle("GET /api/v1/admin/audit", types.ScopeAdminRead, a.requireRole(types.RoleAdmin, http.HandlerFunc(a.getAuditEntries)))
+	}
+}
+
+// handle routes authenticated requests granted scope to handler
+func (a *APIImpl) handle(pattern string, scope string, handler http.Handler) {
+	a.mux.Handle(pattern, a.AuthMiddleware(a.requireScope(scope, handler)))
 }
 
 func (a *APIImpl) ServeHTTP(w http.ResponseWriter, r *http.Request) {
@@ -27,9 +65,9 @@ func (a *APIImpl) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 }
 
 func (a *APIImpl) createDeposit(w http.ResponseWriter, r *http.Request) {
-	userID, _ := r.Context().Value(HeaderUserID).(string)
+	userID := requestUserID(r)
 
-	params, err := createDepositParams(r)
+	params, err := a.createDepositParams(r)
 	if err != nil {
 		a.respondError(w, http.StatusBadRequest, err, fmt.Sprintf("Invalid body request %+v", err))
 		return
@@ -42,24 +80,16 @@ func (a *APIImpl) createDeposit(w http.ResponseWriter, r *http.Request) {
 	}
 
 	resp := CreateDepositResponse{
-		Transaction: Transaction{
-			TransactionID: result.Transaction.TransactionID,
-			Status:        result.Transaction.Status,
-			Amount:        result.Transaction.Amount,
-			Currency:      result.Transaction.Currency,
-			Description:   result.Transaction.Description,
-			CreatedAt:     result.Transaction.CreatedAt.Format(time.RFC3339),
-			UpdatedAt:     result.Transaction.UpdatedAt.Format(time.RFC3339),
-		},
+		Transaction: newTransaction(result.Transaction),
 	}
 
 	a.respond(w, http.StatusOK, resp)
 }
 
 func (a *APIImpl) createWithdrawal(w http.ResponseWriter, r *http.Request) {
-	userID, _ := r.Context().Value(HeaderUserID).(string)
+	userID := requestUserID(r)
 
-	params, err := createWithdrawalParams(r)
+	params, err := a.createWithdrawalParams(r)
 	if err != nil {
 		a.respondError(w, http.StatusBadRequest, err, fmt.Sprintf("Invalid body request %+v", err))
 		return
@@ -72,14 +102,88 @@ func (a *APIImpl) createWithdrawal(w http.ResponseWriter, r *http.Request) {
 	}
 
 	resp := CreateWithdrawalResponse{
-		Transaction: Transaction{
-			TransactionID: result.Transaction.TransactionID,
-			Status:        result.Transaction.Status,
-			Amount:        result.Transaction.Amount,
-			Currency:      result.Transaction.Currency,
-			Description:   result.Transaction.Description,
-			CreatedAt:     result.Transaction.CreatedAt.Format(time.RFC3339),
-			UpdatedAt:     result.Transaction.UpdatedAt.Format(time.RFC3339),
+		Transaction: newTransaction(result.Transaction),
+	}
+
+	a.respond(w, http.StatusOK, resp)
+}
+
+func (a *APIImpl) createTransfer(w http.ResponseWriter, r *http.Request) {
+	userID := requestUserID(r)
+
+	params, err := a.createTransferParams(r)
+	if err != nil {
+		a.respondError(w, http.StatusBadRequest, err, fmt.Sprintf("Invalid body request %+v", err))
+		return
+	}
+
+	result, err := a.transactioner.CreateTransfer(userID, *params)
+	if err != nil {
+		a.respondError(w, http.StatusBadRequest, err, fmt.Sprintf("Failed to create transfer: %+v", err))
+		return
+	}
+
+	resp := CreateTransferResponse{
+		Transfer: Transfer{
+			TransferID: result.TransferID,
+			Debit:      newTransaction(result.Debit),
+			Credit:     newTransaction(result.Credit),
+		},
+	}
+
+	a.respond(w, http.StatusOK, resp)
+}
+
+func (a *APIImpl) createQuote(w http.ResponseWriter, r *http.Request) {
+	userID := requestUserID(r)
+
+	params, err := a.createQuoteParams(r)
+	if err != nil {
+		a.respondError(w, http.StatusBadRequest, err, fmt.Sprintf("Invalid body request %+v", err))
+		return
+	}
+
+	result, err := a.transactioner.CreateQuote(userID, *params)
+	if err != nil {
+		a.respondError(w, http.StatusBadRequest, err, fmt.Sprintf("Failed to create quote: %+v", err))
+		return
+	}
+
+	resp := CreateQuoteResponse{
+		Quote: Quote{
+			QuoteID:       result.Quote.QuoteID,
+			AccountNumber: result.Quote.AccountNumber,
+			Source:        result.Quote.Source,
+			Target:        result.Quote.Target,
+			Rate:          result.Quote.Rate,
+			Spread:        result.Quote.Spread,
+			ExpiresAt:     result.Quote.ExpiresAt.Format(time.RFC3339),
+		},
+	}
+
+	a.respond(w, http.StatusOK, resp)
+}
+
+func (a *APIImpl) createConversion(w http.ResponseWriter, r *http.Request) {
+	userID := requestUserID(r)
+
+	params, err := a.createConversionParams(r)
+	if err != nil {
+		a.respondError(w, http.StatusBadRequest, err, fmt.Sprintf("Invalid body request %+v", err))
+		return
+	}
+
+	result, err := a.transactioner.CreateConversion(userID, *params)
+	if err != nil {
+		a.respondError(w, http.StatusBadRequest, err, fmt.Sprintf("Failed to create conversion: %+v", err))
+		return
+	}
+
+	resp := CreateConversionResponse{
+		Conversion: Conversion{
+			ConversionID: result.ConversionID,
+			Debit:        newTransaction(result.Debit),
+			Credit:       newTransaction(result.Credit),
 		},
 	}
 
@@ -87,8 +191,12 @@ func (a *APIImpl) createWithdrawal(w http.ResponseWriter, r *http.Request) {
 }
 
 func (a *APIImpl) getTransactions(w http.ResponseWriter, r *http.Request) {
-	userID, _ := r.Context().Value(HeaderUserID).(string)
-	params := getTransactionsParams(r)
+	userID := requestUserID(r)
+	params, err := a.getTransactionsParams(r)
+	if err != nil {
+		a.respondError(w, http.StatusBadRequest, err, fmt.Sprintf("Invalid query %+v", err))
+		return
+	}
 
 	result, err := a.transactioner.GetTransactions(userID, *params)
 	if err != nil {
@@ -99,26 +207,33 @@ func (a *APIImpl) getTransactions(w http.ResponseWriter, r *http.Request) {
 	resp := GetTransactionsResponse{}
 	transactions := []Transaction{}
 	for _, transaction := range result.Transactions {
-		transactions = append(transactions, Transaction{
-			TransactionID: transaction.TransactionID,
-			Status:        transaction.Status,
-			Amount:        transaction.Amount,
-			Currency:      transaction.Currency,
-			Description:   transaction.Description,
-			CreatedAt:     transaction.CreatedAt.Format(time.RFC3339),
-			UpdatedAt:     transaction.UpdatedAt.Format(time.RFC3339),
-		})
+		transactions = append(transactions, newTransaction(transaction))
 	}
 
 	resp.Transactions = transactions
+	resp.NextCursor = result.NextCursor
+	resp.HasMore = result.HasMore
+
+	if result.HasMore {
+		w.Header().Set("Link", nextPageLink(r, result.NextCursor))
+	}
 
 	a.respond(w, http.StatusOK, resp)
 }
 
 func (a *APIImpl) getBalance(w http.ResponseWriter, r *http.Request) {
-	userID, _ := r.Context().Value(HeaderUserID).(string)
+	if r.URL.Query().Has("asOf") {
+		a.getBalanceAt(w, r)
+		return
+	}
 
-	req := getBalancesParams(r)
+	userID := requestUserID(r)
+
+	req, err := a.getBalancesParams(r)
+	if err != nil {
+		a.respondError(w, http.StatusBadRequest, err, fmt.Sprintf("Invalid query %+v", err))
+		return
+	}
 
 	resp, err := a.transactioner.GetBalance(userID, *req)
 	if err != nil {
@@ -126,75 +241,214 @@ func (a *APIImpl) getBalance(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	result := GetBalanceResponse{
-		Balance: Balance{Amount: resp.Amount, Currency: resp.Currency},
+	result := GetBalanceResponse{Balances: []Balance{}}
+	for _, balance := range resp.Balances {
+		currency, _ := types.LookupCurrency(balance.Ledger.Currency)
+		result.Balances = append(result.Balances, Balance{
+			Currency:  balance.Ledger.Currency,
+			Exponent:  currency.Exponent,
+			Ledger:    balance.Ledger.Amount,
+			Available: balance.Available.Amount,
+		})
 	}
 
 	a.respond(w, http.StatusOK, result)
 }
 
-func getTransactionsParams(r *http.Request) *transaction.GetTransactionsRequest {
-	limit, err := strconv.Atoi(r.URL.Query().Get("limit"))
+func (a *APIImpl) getTransactionsParams(r *http.Request) (*transaction.GetTransactionsRequest, error) {
+	query := r.URL.Query()
+	params := GetTransactionsRequest{
+		AccountNumber:     query.Get("accountNumber"),
+		Status:            query.Get("status"),
+		Type:              query.Get("type"),
+		MinAmount:         query.Get("minAmount"),
+		MaxAmount:         query.Get("maxAmount"),
+		From:              query.Get("from"),
+		To:                query.Get("to"),
+		Description:       query.Get("description"),
+		Tag:               query.Get("tag"),
+		ExternalReference: query.Get("externalReference"),
+		CounterpartyName:  query.Get("counterpartyName"),
+		CategoryCode:      query.Get("categoryCode"),
+		SortBy:            query.Get("sortBy"),
+		Order:             query.Get("order"),
+		Limit:             query.Get("limit"),
+		Page:              query.Get("page"),
+		Cursor:            query.Get("cursor"),
+	}
+	if err := a.validate.Struct(params); err != nil {
+		if err := fieldError(err); err != nil {
+			return nil, err
+		}
+		return nil, types.NewBadRequest(types.ErrorInvalidParams, fmt.Sprintf("invalid query: %v", err))
+	}
+
+	limit, err := strconv.Atoi(params.Limit)
 	if err != nil {
 		limit = 0
 	}
 
-	page, err := strconv.Atoi(r.URL.Query().Get("page"))
+	page, err := strconv.Atoi(params.Page)
 	if err != nil {
 		page = 0
 	}
 
 	req := &transaction.GetTransactionsRequest{
-		AccountNumber: r.URL.Query().Get("accountNumber"),
-		Limit:         limit,
-		Page:          page,
+		AccountNumber:     params.AccountNumber,
+		Status:            params.Status,
+		Type:              params.Type,
+		Description:       params.Description,
+		Tag:               params.Tag,
+		Metadata:          metadataParams(query),
+		ExternalReference: params.ExternalReference,
+		CounterpartyName:  params.CounterpartyName,
+		CategoryCode:      params.CategoryCode,
+		SortBy:            params.SortBy,
+		SortOrder:         params.Order,
+		Limit:             limit,
+		Page:              page,
+		Cursor:            params.Cursor,
 	}
 
-	return req
+	if req.MinAmount, err = parseOptionalInt(params.MinAmount); err != nil {
+		return nil, types.NewBadRequest(types.ErrorInvalidParams, "invalid minAmount")
+	}
+	if req.MaxAmount, err = parseOptionalInt(params.MaxAmount); err != nil {
+		return nil, types.NewBadRequest(types.ErrorInvalidParams, "invalid maxAmount")
+	}
+
+	// Date formats are checked by the validate tags above
+	if params.From != "" {
+		req.CreatedFrom, _ = time.Parse(time.RFC3339, params.From)
+	}
+	if params.To != "" {
+		req.CreatedTo, _ = time.Parse(time.RFC3339, params.To)
+	}
+
+	return req, nil
+}
+
+// metadataParams collects the metadata[key]=value query parameters, nil when there are none
+func metadataParams(query url.Values) map[string]string {
+	var metadata map[string]string
+	for name, values := range query {
+		key, ok := strings.CutPrefix(name, "metadata[")
+		if !ok || !strings.HasSuffix(key, "]") {
+			continue
+		}
+		if metadata == nil {
+			metadata = map[string]string{}
+		}
+		metadata[strings.TrimSuffix(key, "]")] = values[0]
+	}
+	return metadata
 }
 
-func createDepositParams(r *http.Request) (*transaction.CreateDepositRequest, error) {
+func (a *APIImpl) createDepositParams(r *http.Request) (*transaction.CreateDepositRequest, error) {
 	var req CreateDepositRequest
-	if err := parseBody(r, &req); err != nil {
+	if err := a.parseBody(r, &req); err != nil {
+		return nil, err
+	}
+	amount, err := requestMoney(req.Amount, req.Currency)
+	if err != nil {
 		return nil, err
 	}
 
 	result := &transaction.CreateDepositRequest{
 		TransactionID: req.TransactionID,
 		AccountNumber: req.AccountNumber,
-		Amount:        req.Amount,
-		Currency:      req.Currency,
+		Amount:        amount,
 		Description:   req.Description,
+		Details:       newDetails(req.Metadata, req.Tags, req.Counterparty, req.ExternalReference),
 	}
 	return result, nil
 }
 
-func createWithdrawalParams(r *http.Request) (*transaction.CreateWithdrawalRequest, error) {
+func (a *APIImpl) createWithdrawalParams(r *http.Request) (*transaction.CreateWithdrawalRequest, error) {
 	var req CreateWithdrawalRequest
-	if err := parseBody(r, &req); err != nil {
+	if err := a.parseBody(r, &req); err != nil {
+		return nil, err
+	}
+	amount, err := requestMoney(req.Amount, req.Currency)
+	if err != nil {
 		return nil, err
 	}
 
 	result := &transaction.CreateWithdrawalRequest{
 		TransactionID: req.TransactionID,
 		AccountNumber: req.AccountNumber,
-		Amount:        req.Amount,
-		Currency:      req.Currency,
+		Amount:        amount,
 		Description:   req.Description,
+		Details:       newDetails(req.Metadata, req.Tags, req.Counterparty, req.ExternalReference),
+	}
+	return result, nil
+}
+
+func (a *APIImpl) createTransferParams(r *http.Request) (*transaction.CreateTransferRequest, error) {
+	var req CreateTransferRequest
+	if err := a.parseBody(r, &req); err != nil {
+		return nil, err
+	}
+	amount, err := requestMoney(req.Amount, req.Currency)
+	if err != nil {
+		return nil, err
+	}
+
+	result := &transaction.CreateTransferRequest{
+		TransferID:        req.TransferID,
+		FromAccountNumber: req.FromAccountNumber,
+		ToAccountNumber:   req.ToAccountNumber,
+		Amount:            amount,
+		Description:       req.Description,
+	}
+	return result, nil
+}
+
+func (a *APIImpl) createQuoteParams(r *http.Request) (*transaction.CreateQuoteRequest, error) {
+	var req CreateQuoteRequest
+	if err := a.parseBody(r, &req); err != nil {
+		return nil, err
+	}
+	amount, err := requestMoney(req.Amount, req.From)
+	if err != nil {
+		return nil, err
+	}
+
+	result := &transaction.CreateQuoteRequest{
+		AccountNumber: req.AccountNumber,
+		Amount:        amount,
+		To:            req.To,
+	}
+	return result, nil
+}
+
+func (a *APIImpl) createConversionParams(r *http.Request) (*transaction.CreateConversionRequest, error) {
+	var req CreateConversionRequest
+	if err := a.parseBody(r, &req); err != nil {
+		return nil, err
+	}
+
+	result := &transaction.CreateConversionRequest{
+		ConversionID: req.ConversionID,
+		QuoteID:      req.QuoteID,
+		Description:  req.Description,
 	}
 	return result, nil
 }
 
-func getBalancesParams(r *http.Request) *transaction.GetBalanceRequest {
+func (a *APIImpl) getBalancesParams(r *http.Request) (*transaction.GetBalanceRequest, error) {
 	req := &transaction.GetBalanceRequest{
 		AccountNumber: r.URL.Query().Get("accountNumber"),
 	}
+	if err := a.checkAccountNumber(req.AccountNumber); err != nil {
+		return nil, err
+	}
 
-	return req
+	return req, nil
 }
 
 func (a *APIImpl) getTransaction(w http.ResponseWriter, r *http.Request) {
-	userID, _ := r.Context().Value(HeaderUserID).(string)
+	userID := requestUserID(r)
 	transactionID := path.Base(r.URL.Path)
 
 	transaction, err := a.transactioner.GetTransaction(userID, transactionID)
@@ -205,16 +459,267 @@ func (a *APIImpl) getTransaction(w http.ResponseWriter, r *http.Request) {
 	fmt.Printf("etransaction get: %+v\n", transaction)
 
 	result := GetTransactionResponse{
-		Transaction: Transaction{
-			TransactionID: transaction.TransactionID,
-			Status:        transaction.Status,
-			Amount:        transaction.Amount,
-			Currency:      transaction.Currency,
-			Description:   transaction.Description,
-			CreatedAt:     transaction.CreatedAt.Format(time.RFC3339),
-			UpdatedAt:     transaction.UpdatedAt.Format(time.RFC3339),
-		},
+		Transaction: newTransaction(*transaction),
 	}
 
 	a.respond(w, http.StatusOK, result)
 }
+
+func (a *APIImpl) cancelTransaction(w http.ResponseWriter, r *http.Request) {
+	userID := requestUserID(r)
+
+	params, err := a.cancelTransactionParams(r)
+	if err != nil {
+		a.respondError(w, http.StatusBadRequest, err, fmt.Sprintf("Invalid body request %+v", err))
+		return
+	}
+
+	transaction, err := a.transactioner.CancelTransaction(userID, r.PathValue("transactionID"), *params)
+	if err != nil {
+		a.respondError(w, http.StatusBadRequest, err, fmt.Sprintf("Failed to cancel transaction: %+v", err))
+		return
+	}
+
+	a.respond(w, http.StatusOK, CancelTransactionResponse{Transaction: newTransaction(*transaction)})
+}
+
+// cancelTransactionParams accepts an empty body since the reason is optional
+func (a *APIImpl) cancelTransactionParams(r *http.Request) (*transaction.CancelTransactionRequest, error) {
+	var req CancelTransactionRequest
+	if err := a.parseBody(r, &req); err != nil && !errors.Is(err, io.EOF) {
+		return nil, err
+	}
+
+	return &transaction.CancelTransactionRequest{Reason: req.Reason}, nil
+}
+
+func (a *APIImpl) createReversal(w http.ResponseWriter, r *http.Request) {
+	userID := requestUserID(r)
+
+	params, err := a.createReversalParams(r)
+	if err != nil {
+		a.respondError(w, http.StatusBadRequest, err, fmt.Sprintf("Invalid body request %+v", err))
+		return
+	}
+
+	result, err := a.transactioner.ReverseTransaction(userID, r.PathValue("transactionID"), *params)
+	if err != nil {
+		a.respondError(w, http.StatusBadRequest, err, fmt.Sprintf("Failed to reverse transaction: %+v", err))
+		return
+	}
+
+	a.respond(w, http.StatusOK, CreateReversalResponse{
+		Reversal: newTransaction(result.Reversal),
+		Original: newTransaction(result.Original),
+	})
+}
+
+func (a *APIImpl) createReversalParams(r *http.Request) (*transaction.CreateReversalRequest, error) {
+	var req CreateReversalRequest
+	if err := a.parseBody(r, &req); err != nil {
+		return nil, err
+	}
+	amount, err := optionalMoney(req.Amount, req.Currency)
+	if err != nil {
+		return nil, err
+	}
+
+	result := &transaction.CreateReversalRequest{
+		TransactionID: req.TransactionID,
+		Amount:        amount,
+		Description:   req.Description,
+	}
+	return result, nil
+}
+
+func (a *APIImpl) createHold(w http.ResponseWriter, r *http.Request) {
+	userID := requestUserID(r)
+
+	params, err := a.createHoldParams(r)
+	if err != nil {
+		a.respondError(w, http.StatusBadRequest, err, fmt.Sprintf("Invalid body request %+v", err))
+		return
+	}
+
+	result, err := a.transactioner.CreateHold(userID, *params)
+	if err != nil {
+		a.respondError(w, http.StatusBadRequest, err, fmt.Sprintf("Failed to create hold: %+v", err))
+		return
+	}
+
+	a.respond(w, http.StatusOK, CreateHoldResponse{Hold: newHold(result.Hold)})
+}
+
+func (a *APIImpl) getHold(w http.ResponseWriter, r *http.Request) {
+	userID := requestUserID(r)
+
+	hold, err := a.transactioner.GetHold(userID, r.PathValue("holdID"))
+	if err != nil {
+		a.respondError(w, http.StatusBadRequest, err, fmt.Sprintf("Failed to get hold: %+v", err))
+		return
+	}
+
+	a.respond(w, http.StatusOK, GetHoldResponse{Hold: newHold(*hold)})
+}
+
+func (a *APIImpl) captureHold(w http.ResponseWriter, r *http.Request) {
+	userID := requestUserID(r)
+
+	params, err := a.captureHoldParams(r)
+	if err != nil {
+		a.respondError(w, http.StatusBadRequest, err, fmt.Sprintf("Invalid body request %+v", err))
+		return
+	}
+
+	result, err := a.transactioner.CaptureHold(userID, r.PathValue("holdID"), *params)
+	if err != nil {
+		a.respondError(w, http.StatusBadRequest, err, fmt.Sprintf("Failed to capture hold: %+v", err))
+		return
+	}
+
+	a.respond(w, http.StatusOK, CaptureHoldResponse{
+		Hold:        newHold(result.Hold),
+		Transaction: newTransaction(result.Transaction),
+	})
+}
+
+func (a *APIImpl) voidHold(w http.ResponseWriter, r *http.Request) {
+	userID := requestUserID(r)
+
+	hold, err := a.transactioner.VoidHold(userID, r.PathValue("holdID"))
+	if err != nil {
+		a.respondError(w, http.StatusBadRequest, err, fmt.Sprintf("Failed to void hold: %+v", err))
+		return
+	}
+
+	a.respond(w, http.StatusOK, VoidHoldResponse{Hold: newHold(*hold)})
+}
+
+func (a *APIImpl) createHoldParams(r *http.Request) (*transaction.CreateHoldRequest, error) {
+	var req CreateHoldRequest
+	if err := a.parseBody(r, &req); err != nil {
+		return nil, err
+	}
+	amount, err := requestMoney(req.Amount, req.Currency)
+	if err != nil {
+		return nil, err
+	}
+
+	result := &transaction.CreateHoldRequest{
+		HoldID:        req.HoldID,
+		AccountNumber: req.AccountNumber,
+		Amount:        amount,
+		Description:   req.Description,
+	}
+	return result, nil
+}
+
+func (a *APIImpl) captureHoldParams(r *http.Request) (*transaction.CaptureHoldRequest, error) {
+	var req CaptureHoldRequest
+	if err := a.parseBody(r, &req); err != nil {
+		return nil, err
+	}
+	amount, err := optionalMoney(req.Amount, req.Currency)
+	if err != nil {
+		return nil, err
+	}
+
+	result := &transaction.CaptureHoldRequest{
+		TransactionID: req.TransactionID,
+		Amount:        amount,
+		Description:   req.Description,
+	}
+	return result, nil
+}
+
+func newHold(hold transaction.Hold) Hold {
+	return Hold{
+		HoldID:         hold.HoldID,
+		AccountNumber:  hold.AccountNumber,
+		Amount:         hold.Amount.Amount,
+		Currency:       hold.Amount.Currency,
+		CapturedAmount: hold.Captured.Amount,
+		Status:         hold.Status,
+		Description:    hold.Description,
+		ExpiresAt:      hold.ExpiresAt.Format(time.RFC3339),
+		CreatedAt:      hold.CreatedAt.Format(time.RFC3339),
+		UpdatedAt:      hold.UpdatedAt.Format(time.RFC3339),
+	}
+}
+
+func newTransaction(transaction transaction.Transaction) Transaction {
+	return Transaction{
+		TransactionID:     transaction.TransactionID,
+		Type:              transaction.Type,
+		Status:            transaction.Status,
+		StatusReason:      transaction.StatusReason,
+		Amount:            transaction.Amount.Amount,
+		Currency:          transaction.Amount.Currency,
+		Description:       transaction.Description,
+		TransferID:        transaction.TransferID,
+		ConversionID:      transaction.ConversionID,
+		Rate:              transaction.Rate,
+		Spread:            transaction.Spread,
+		HoldID:            transaction.HoldID,
+		ReversalOf:        transaction.ReversalOf,
+		Metadata:          transaction.Metadata,
+		Tags:              transaction.Tags,
+		Counterparty:      newCounterparty(transaction.Counterparty),
+		ExternalReference: transaction.ExternalReference,
+		CreatedAt:         transaction.CreatedAt.Format(time.RFC3339),
+		UpdatedAt:         transaction.UpdatedAt.Format(time.RFC3339),
+		StatusHistory:     newStatusHistory(transaction.StatusHistory),
+		Reversals:         newReversals(transaction.Reversals),
+	}
+}
+
+// newDetails turns the details sent with a deposit or withdrawal into the ones stored with it
+func newDetails(metadata map[string]string, tags []string, counterparty *Counterparty, externalReference string) storage.Details {
+	details := storage.Details{Metadata: metadata, Tags: tags, ExternalReference: externalReference}
+	if counterparty != nil {
+		details.Counterparty = storage.Counterparty{Name: counterparty.Name, Reference: counterparty.Reference, CategoryCode: counterparty.CategoryCode}
+	}
+	return details
+}
+
+// newCounterparty returns nil for a transaction without a counterparty
+func newCounterparty(counterparty storage.Counterparty) *Counterparty {
+	if counterparty == (storage.Counterparty{}) {
+		return nil
+	}
+	return &Counterparty{Name: counterparty.Name, Reference: counterparty.Reference, CategoryCode: counterparty.CategoryCode}
+}
+
+func newReversals(reversals []transaction.Reversal) []Reversal {
+	if len(reversals) == 0 {
+		return nil
+	}
+
+	result := []Reversal{}
+	for _, reversal := range reversals {
+		result = append(result, Reversal{
+			TransactionID: reversal.TransactionID,
+			Amount:        reversal.Amount.Amount,
+			Currency:      reversal.Amount.Currency,
+			CreatedAt:     reversal.CreatedAt.Format(time.RFC3339Nano),
+		})
+	}
+	return result
+}
+
+func newStatusHistory(changes []transaction.StatusChange) []StatusChange {
+	if len(changes) == 0 {
+		return nil
+	}
+
+	result := []StatusChange{}
+	for _, change := range changes {
+		result = append(result, StatusChange{
+			From:      change.From,
+			To:        change.To,
+			Reason:    change.Reason,
+			CreatedAt: change.CreatedAt.Format(time.RFC3339Nano),
+		})
+	}
+	return result
+}
@@ -2,15 +2,24 @@ package api
 
 import (
 	"bytes"
+	"context"
 	"encoding/json"
 	"errors"
+	"fmt"
+	"math"
 	"net/http"
 	"net/http/httptest"
+	"strings"
 	"testing"
+	"time"
 
+	"github.com/alienxp03/teya-ledger/handler/apikey"
+	"github.com/alienxp03/teya-ledger/handler/jwt"
 	"github.com/alienxp03/teya-ledger/handler/transaction"
 	"github.com/alienxp03/teya-ledger/storage"
+	"github.com/alienxp03/teya-ledger/types"
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 )
 
 func TestGetTransactions(t *testing.T) {
@@ -22,12 +31,13 @@ func TestGetTransactions(t *testing.T) {
 	}
 
 	tests := []struct {
-		name    string
-		args    args
-		reqBody map[string]interface{}
-		setup   setup
-		want    GetTransactionsResponse
-		wantErr bool
+		name     string
+		args     args
+		reqBody  map[string]interface{}
+		setup    setup
+		want     GetTransactionsResponse
+		wantLink string
+		wantErr  bool
 	}{
 		{
 			name:    "success",
@@ -36,14 +46,36 @@ func TestGetTransactions(t *testing.T) {
 			setup: func() setup {
 				mockTransactioner := &MockTransactioner{
 					GetTransactionsFunc: func(userID string, req transaction.GetTransactionsRequest) (*transaction.GetTransactionsResponse, error) {
-						return &transaction.GetTransactionsResponse{Transactions: []transaction.Transaction{{Amount: 100}}}, nil
+						return &transaction.GetTransactionsResponse{Transactions: []transaction.Transaction{{Amount: types.NewMoney(100, "MYR")}}}, nil
+					},
+				}
+				return setup{mockTransactioner}
+			}(),
+			want: GetTransactionsResponse{
+				Transactions: []Transaction{{Amount: 100, Currency: "MYR", CreatedAt: "0001-01-01T00:00:00Z", UpdatedAt: "0001-01-01T00:00:00Z"}},
+			},
+		},
+		{
+			name: "has more pages",
+			args: args{userToken: "USER_TOKEN_1"},
+			setup: func() setup {
+				mockTransactioner := &MockTransactioner{
+					GetTransactionsFunc: func(userID string, req transaction.GetTransactionsRequest) (*transaction.GetTransactionsResponse, error) {
+						return &transaction.GetTransactionsResponse{
+							Transactions: []transaction.Transaction{{Amount: types.NewMoney(100, "MYR")}},
+							NextCursor:   "next-cursor",
+							HasMore:      true,
+						}, nil
 					},
 				}
 				return setup{mockTransactioner}
 			}(),
 			want: GetTransactionsResponse{
-				Transactions: []Transaction{{Amount: 100, CreatedAt: "0001-01-01T00:00:00Z", UpdatedAt: "0001-01-01T00:00:00Z"}},
+				Transactions: []Transaction{{Amount: 100, Currency: "MYR", CreatedAt: "0001-01-01T00:00:00Z", UpdatedAt: "0001-01-01T00:00:00Z"}},
+				NextCursor:   "next-cursor",
+				HasMore:      true,
 			},
+			wantLink: `</api/v1/transactions?accountNumber=ACCOUNT_NUMBER_1&cursor=next-cursor&limit=1>; rel="next"`,
 		},
 		{
 			name:    "logic error",
@@ -62,12 +94,12 @@ func TestGetTransactions(t *testing.T) {
 	}
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			api := New(tt.setup.mockTransactioner)
+			api := New(tt.setup.mockTransactioner, testKeys(t))
 
 			reqBodyBytes, _ := json.Marshal(tt.reqBody)
-			req, _ := http.NewRequest("GET", "/api/v1/transactions", bytes.NewBuffer(reqBodyBytes))
+			req, _ := http.NewRequest("GET", "/api/v1/transactions?accountNumber=ACCOUNT_NUMBER_1&limit=1&page=1", bytes.NewBuffer(reqBodyBytes))
 			req.Header.Set("Content-Type", "application/json")
-			req.Header.Set("Authorization", tt.args.userToken)
+			req.Header.Set("Authorization", "Bearer "+tt.args.userToken)
 			rr := httptest.NewRecorder()
 			api.ServeHTTP(rr, req)
 
@@ -76,6 +108,7 @@ func TestGetTransactions(t *testing.T) {
 				return
 			}
 			assert.Equal(t, http.StatusOK, rr.Code)
+			assert.Equal(t, tt.wantLink, rr.Header().Get("Link"))
 			var resp GetTransactionsResponse
 			json.Unmarshal(rr.Body.Bytes(), &resp)
 			assert.Equal(t, tt.want, resp)
@@ -83,6 +116,76 @@ func TestGetTransactions(t *testing.T) {
 	}
 }
 
+func TestGetTransactionsParams(t *testing.T) {
+	minAmount, maxAmount := int64(-500), int64(1000)
+
+	tests := []struct {
+		name    string
+		query   string
+		want    *transaction.GetTransactionsRequest
+		wantErr bool
+	}{
+		{
+			name:  "defaults",
+			query: "accountNumber=ACCOUNT_NUMBER_1",
+			want:  &transaction.GetTransactionsRequest{AccountNumber: "ACCOUNT_NUMBER_1"},
+		},
+		{
+			name:  "filters and sort",
+			query: "accountNumber=ACCOUNT_NUMBER_1&status=completed&type=withdrawal&minAmount=-500&maxAmount=1000&from=2025-01-01T00:00:00Z&to=2025-02-01T00:00:00%2B08:00&description=coffee&sortBy=amount&order=asc&limit=5&page=2",
+			want: &transaction.GetTransactionsRequest{
+				AccountNumber: "ACCOUNT_NUMBER_1",
+				Status:        "completed",
+				Type:          "withdrawal",
+				MinAmount:     &minAmount,
+				MaxAmount:     &maxAmount,
+				CreatedFrom:   time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC),
+				CreatedTo:     time.Date(2025, 2, 1, 0, 0, 0, 0, time.FixedZone("", 8*60*60)),
+				Description:   "coffee",
+				SortBy:        "amount",
+				SortOrder:     "asc",
+				Limit:         5,
+				Page:          2,
+			},
+		},
+		{
+			name:    "invalid type",
+			query:   "accountNumber=ACCOUNT_NUMBER_1&type=refund",
+			wantErr: true,
+		},
+		{
+			name:    "invalid amount",
+			query:   "accountNumber=ACCOUNT_NUMBER_1&minAmount=ten",
+			wantErr: true,
+		},
+		{
+			name:    "invalid date",
+			query:   "accountNumber=ACCOUNT_NUMBER_1&from=2025-01-01",
+			wantErr: true,
+		},
+		{
+			name:    "invalid sort",
+			query:   "accountNumber=ACCOUNT_NUMBER_1&sortBy=description&order=up",
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req, _ := http.NewRequest("GET", "/api/v1/transactions?"+tt.query, nil)
+
+			got, err := New(&MockTransactioner{}, nil).getTransactionsParams(req)
+			if tt.wantErr {
+				assert.Error(t, err)
+				return
+			}
+			assert.NoError(t, err)
+			assert.Equal(t, tt.want.CreatedTo.Unix(), got.CreatedTo.Unix())
+			got.CreatedTo = tt.want.CreatedTo
+			assert.Equal(t, tt.want, got)
+		})
+	}
+}
+
 func TestCreateDeposit(t *testing.T) {
 	type args struct {
 		userToken string
@@ -109,8 +212,7 @@ func TestCreateDeposit(t *testing.T) {
 						return &transaction.CreateDepositResponse{Transaction: transaction.Transaction{
 							TransactionID: "idempotency-key",
 							Status:        "pending",
-							Amount:        100,
-							Currency:      "MYR",
+							Amount:        types.NewMoney(100, "MYR"),
 							Description:   "description",
 						}}, nil
 					},
@@ -141,7 +243,7 @@ func TestCreateDeposit(t *testing.T) {
 		{
 			name:    "invalid currency",
 			args:    args{userToken: "USER_TOKEN_1"},
-			reqBody: map[string]interface{}{"transactionID": "idempotency-key", "accountNumber": "ACCOUNT_NUMBER_1", "amount": 100, "currency": "USD", "description": "description"},
+			reqBody: map[string]interface{}{"transactionID": "idempotency-key", "accountNumber": "ACCOUNT_NUMBER_1", "amount": 100, "currency": "XYZ", "description": "description"},
 			setup: func() setup {
 				return setup{&MockTransactioner{}}
 			}(),
@@ -164,12 +266,12 @@ func TestCreateDeposit(t *testing.T) {
 	}
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			api := New(tt.setup.mockTransactioner)
+			api := New(tt.setup.mockTransactioner, testKeys(t))
 
 			reqBodyBytes, _ := json.Marshal(tt.reqBody)
 			req, _ := http.NewRequest("POST", "/api/v1/deposits", bytes.NewBuffer(reqBodyBytes))
 			req.Header.Set("Content-Type", "application/json")
-			req.Header.Set("Authorization", tt.args.userToken)
+			req.Header.Set("Authorization", "Bearer "+tt.args.userToken)
 			w := httptest.NewRecorder()
 			api.ServeHTTP(w, req)
 
@@ -211,8 +313,7 @@ func TestCreateWithdrawal(t *testing.T) {
 						return &transaction.CreateWithdrawalResponse{Transaction: transaction.Transaction{
 							TransactionID: "idempotency-key",
 							Status:        "pending",
-							Amount:        -100,
-							Currency:      "MYR",
+							Amount:        types.NewMoney(-100, "MYR"),
 							Description:   "withdrawal description",
 						}}, nil
 					},
@@ -243,7 +344,16 @@ func TestCreateWithdrawal(t *testing.T) {
 		{
 			name:    "invalid currency",
 			args:    args{userToken: "USER_TOKEN_1"},
-			reqBody: map[string]interface{}{"transactionID": "idempotency-key", "accountNumber": "ACCOUNT_NUMBER_1", "amount": 100, "currency": "USD", "description": "withdrawal description"},
+			reqBody: map[string]interface{}{"transactionID": "idempotency-key", "accountNumber": "ACCOUNT_NUMBER_1", "amount": 100, "currency": "XYZ", "description": "withdrawal description"},
+			setup: func() setup {
+				return setup{&MockTransactioner{}}
+			}(),
+			wantErr: true,
+		},
+		{
+			name:    "amount that cannot be negated",
+			args:    args{userToken: "USER_TOKEN_1"},
+			reqBody: map[string]interface{}{"transactionID": "idempotency-key", "accountNumber": "ACCOUNT_NUMBER_1", "amount": int64(math.MinInt64), "currency": "MYR", "description": "withdrawal description"},
 			setup: func() setup {
 				return setup{&MockTransactioner{}}
 			}(),
@@ -266,12 +376,12 @@ func TestCreateWithdrawal(t *testing.T) {
 	}
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			api := New(tt.setup.mockTransactioner)
+			api := New(tt.setup.mockTransactioner, testKeys(t))
 
 			reqBodyBytes, _ := json.Marshal(tt.reqBody)
 			req, _ := http.NewRequest("POST", "/api/v1/withdrawals", bytes.NewBuffer(reqBodyBytes))
 			req.Header.Set("Content-Type", "application/json")
-			req.Header.Set("Authorization", tt.args.userToken)
+			req.Header.Set("Authorization", "Bearer "+tt.args.userToken)
 			w := httptest.NewRecorder()
 			api.ServeHTTP(w, req)
 
@@ -287,7 +397,7 @@ func TestCreateWithdrawal(t *testing.T) {
 	}
 }
 
-func TestGetBalance(t *testing.T) {
+func TestCreateTransfer(t *testing.T) {
 	type args struct {
 		userToken string
 	}
@@ -300,49 +410,58 @@ func TestGetBalance(t *testing.T) {
 		args    args
 		reqBody map[string]interface{}
 		setup   setup
-		want    GetBalanceResponse
+		want    CreateTransferResponse
 		wantErr bool
 	}{
 		{
 			name:    "success",
 			args:    args{userToken: "USER_TOKEN_1"},
-			reqBody: map[string]interface{}{"accountNumber": "ACCOUNT_NUMBER_1"},
+			reqBody: map[string]interface{}{"transferID": "transfer-key", "fromAccountNumber": "ACCOUNT_NUMBER_1", "toAccountNumber": "ACCOUNT_NUMBER_2", "amount": 100, "currency": "MYR", "description": "rent"},
 			setup: func() setup {
 				mockTransactioner := &MockTransactioner{
-					GetBalanceFunc: func(userID string, req transaction.GetBalanceRequest) (*transaction.GetBalanceResponse, error) {
-						return &transaction.GetBalanceResponse{
-							Amount:   1000,
-							Currency: "MYR",
+					CreateTransferFunc: func(userID string, req transaction.CreateTransferRequest) (*transaction.CreateTransferResponse, error) {
+						return &transaction.CreateTransferResponse{
+							TransferID: "transfer-key",
+							Debit:      transaction.Transaction{TransactionID: "transfer-key-debit", Amount: types.NewMoney(-100, "MYR"), TransferID: "transfer-key"},
+							Credit:     transaction.Transaction{TransactionID: "transfer-key-credit", Amount: types.NewMoney(100, "MYR"), TransferID: "transfer-key"},
 						}, nil
 					},
 				}
 				return setup{mockTransactioner}
 			}(),
-			want: GetBalanceResponse{
-				Balance: Balance{Amount: 1000, Currency: "MYR"},
+			want: CreateTransferResponse{
+				Transfer: Transfer{
+					TransferID: "transfer-key",
+					Debit:      Transaction{TransactionID: "transfer-key-debit", Amount: -100, Currency: "MYR", TransferID: "transfer-key", CreatedAt: "0001-01-01T00:00:00Z", UpdatedAt: "0001-01-01T00:00:00Z"},
+					Credit:     Transaction{TransactionID: "transfer-key-credit", Amount: 100, Currency: "MYR", TransferID: "transfer-key", CreatedAt: "0001-01-01T00:00:00Z", UpdatedAt: "0001-01-01T00:00:00Z"},
+				},
 			},
 		},
 		{
-			name:    "invalid account",
+			name:    "negative amount",
 			args:    args{userToken: "USER_TOKEN_1"},
-			reqBody: map[string]interface{}{"accountNumber": "INVALID_ACCOUNT"},
+			reqBody: map[string]interface{}{"transferID": "transfer-key", "fromAccountNumber": "ACCOUNT_NUMBER_1", "toAccountNumber": "ACCOUNT_NUMBER_2", "amount": -100, "currency": "MYR", "description": "rent"},
 			setup: func() setup {
-				mockTransactioner := &MockTransactioner{
-					GetBalanceFunc: func(userID string, req transaction.GetBalanceRequest) (*transaction.GetBalanceResponse, error) {
-						return nil, errors.New("account not found")
-					},
-				}
-				return setup{mockTransactioner}
+				return setup{&MockTransactioner{}}
+			}(),
+			wantErr: true,
+		},
+		{
+			name:    "missing destination",
+			args:    args{userToken: "USER_TOKEN_1"},
+			reqBody: map[string]interface{}{"transferID": "transfer-key", "fromAccountNumber": "ACCOUNT_NUMBER_1", "amount": 100, "currency": "MYR", "description": "rent"},
+			setup: func() setup {
+				return setup{&MockTransactioner{}}
 			}(),
 			wantErr: true,
 		},
 		{
 			name:    "logic error",
 			args:    args{userToken: "USER_TOKEN_1"},
-			reqBody: map[string]interface{}{"accountNumber": "ACCOUNT_NUMBER_1"},
+			reqBody: map[string]interface{}{"transferID": "transfer-key", "fromAccountNumber": "ACCOUNT_NUMBER_1", "toAccountNumber": "ACCOUNT_NUMBER_2", "amount": 100, "currency": "MYR", "description": "rent"},
 			setup: func() setup {
 				mockTransactioner := &MockTransactioner{
-					GetBalanceFunc: func(userID string, req transaction.GetBalanceRequest) (*transaction.GetBalanceResponse, error) {
+					CreateTransferFunc: func(userID string, req transaction.CreateTransferRequest) (*transaction.CreateTransferResponse, error) {
 						return nil, errors.New("logic error")
 					},
 				}
@@ -353,12 +472,12 @@ func TestGetBalance(t *testing.T) {
 	}
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			api := New(tt.setup.mockTransactioner)
+			api := New(tt.setup.mockTransactioner, testKeys(t))
 
 			reqBodyBytes, _ := json.Marshal(tt.reqBody)
-			req, _ := http.NewRequest("GET", "/api/v1/balances", bytes.NewBuffer(reqBodyBytes))
+			req, _ := http.NewRequest("POST", "/api/v1/transfers", bytes.NewBuffer(reqBodyBytes))
 			req.Header.Set("Content-Type", "application/json")
-			req.Header.Set("Authorization", tt.args.userToken)
+			req.Header.Set("Authorization", "Bearer "+tt.args.userToken)
 			w := httptest.NewRecorder()
 			api.ServeHTTP(w, req)
 
@@ -367,14 +486,14 @@ func TestGetBalance(t *testing.T) {
 				return
 			}
 			assert.Equal(t, http.StatusOK, w.Code)
-			var resp GetBalanceResponse
+			var resp CreateTransferResponse
 			json.Unmarshal(w.Body.Bytes(), &resp)
 			assert.Equal(t, tt.want, resp)
 		})
 	}
 }
 
-func TestGetTransactionStatus(t *testing.T) {
+func TestCreateQuote(t *testing.T) {
 	type args struct {
 		userToken string
 	}
@@ -382,61 +501,72 @@ func TestGetTransactionStatus(t *testing.T) {
 		mockTransactioner *MockTransactioner
 	}
 
+	expiresAt := time.Date(2025, 1, 1, 0, 0, 30, 0, time.UTC)
 	tests := []struct {
 		name    string
 		args    args
+		reqBody map[string]interface{}
 		setup   setup
-		want    GetTransactionResponse
+		want    CreateQuoteResponse
 		wantErr bool
 	}{
 		{
-			name: "success",
-			args: args{userToken: "USER_TOKEN_1"},
+			name:    "success",
+			args:    args{userToken: "USER_TOKEN_1"},
+			reqBody: map[string]interface{}{"accountNumber": "ACCOUNT_NUMBER_1", "from": "USD", "to": "MYR", "amount": 10000},
 			setup: func() setup {
 				mockTransactioner := &MockTransactioner{
-					GetTransactionFunc: func(userID string, transactionID string) (*transaction.Transaction, error) {
-						return &transaction.Transaction{
-							TransactionID: "TRANSACTION_ID_1",
-							Status:        "completed",
-							Amount:        100,
-							Currency:      "MYR",
-							Description:   "test transaction",
-						}, nil
+					CreateQuoteFunc: func(userID string, req transaction.CreateQuoteRequest) (*transaction.CreateQuoteResponse, error) {
+						return &transaction.CreateQuoteResponse{Quote: transaction.Quote{
+							QuoteID:       "quote-id",
+							AccountNumber: req.AccountNumber,
+							Source:        req.Amount,
+							Target:        types.NewMoney(46914, req.To),
+							Rate:          "4.715",
+							Spread:        50,
+							ExpiresAt:     expiresAt,
+						}}, nil
 					},
 				}
 				return setup{mockTransactioner}
 			}(),
-			want: GetTransactionResponse{
-				Transaction{
-					TransactionID: "TRANSACTION_ID_1",
-					Status:        "completed",
-					Amount:        100,
-					Currency:      "MYR",
-					Description:   "test transaction",
-					CreatedAt:     "0001-01-01T00:00:00Z",
-					UpdatedAt:     "0001-01-01T00:00:00Z",
+			want: CreateQuoteResponse{
+				Quote: Quote{
+					QuoteID:       "quote-id",
+					AccountNumber: "ACCOUNT_NUMBER_1",
+					Source:        types.NewMoney(10000, "USD"),
+					Target:        types.NewMoney(46914, "MYR"),
+					Rate:          "4.715",
+					Spread:        50,
+					ExpiresAt:     "2025-01-01T00:00:30Z",
 				},
 			},
 		},
 		{
-			name: "transaction not found",
-			args: args{userToken: "USER_TOKEN_1"},
+			name:    "invalid currency",
+			args:    args{userToken: "USER_TOKEN_1"},
+			reqBody: map[string]interface{}{"accountNumber": "ACCOUNT_NUMBER_1", "from": "USD", "to": "XYZ", "amount": 10000},
 			setup: func() setup {
-				mockTransactioner := &MockTransactioner{
-					GetTransactionFunc: func(userID string, transactionID string) (*transaction.Transaction, error) {
-						return nil, storage.ErrNotFound
-					},
-				}
-				return setup{mockTransactioner}
+				return setup{&MockTransactioner{}}
 			}(),
 			wantErr: true,
 		},
 		{
-			name: "logic error",
-			args: args{userToken: "USER_TOKEN_1"},
+			name:    "negative amount",
+			args:    args{userToken: "USER_TOKEN_1"},
+			reqBody: map[string]interface{}{"accountNumber": "ACCOUNT_NUMBER_1", "from": "USD", "to": "MYR", "amount": -10000},
+			setup: func() setup {
+				return setup{&MockTransactioner{}}
+			}(),
+			wantErr: true,
+		},
+		{
+			name:    "logic error",
+			args:    args{userToken: "USER_TOKEN_1"},
+			reqBody: map[string]interface{}{"accountNumber": "ACCOUNT_NUMBER_1", "from": "USD", "to": "MYR", "amount": 10000},
 			setup: func() setup {
 				mockTransactioner := &MockTransactioner{
-					GetTransactionFunc: func(userID string, transactionID string) (*transaction.Transaction, error) {
+					CreateQuoteFunc: func(userID string, req transaction.CreateQuoteRequest) (*transaction.CreateQuoteResponse, error) {
 						return nil, errors.New("logic error")
 					},
 				}
@@ -445,55 +575,1128 @@ func TestGetTransactionStatus(t *testing.T) {
 			wantErr: true,
 		},
 	}
-
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			api := New(tt.setup.mockTransactioner)
+			api := New(tt.setup.mockTransactioner, testKeys(t))
 
-			req, _ := http.NewRequest("GET", "/api/v1/transactions/TRANSACTION_ID_1", nil)
-			req.Header.Set("Authorization", tt.args.userToken)
-			r := httptest.NewRecorder()
-			api.ServeHTTP(r, req)
+			reqBodyBytes, _ := json.Marshal(tt.reqBody)
+			req, _ := http.NewRequest("POST", "/api/v1/conversions/quotes", bytes.NewBuffer(reqBodyBytes))
+			req.Header.Set("Content-Type", "application/json")
+			req.Header.Set("Authorization", "Bearer "+tt.args.userToken)
+			w := httptest.NewRecorder()
+			api.ServeHTTP(w, req)
 
 			if tt.wantErr {
-				assert.Equal(t, http.StatusBadRequest, r.Code)
+				assert.Equal(t, http.StatusBadRequest, w.Code)
 				return
 			}
-
-			assert.Equal(t, http.StatusOK, r.Code)
-			var resp GetTransactionResponse
-			err := json.Unmarshal(r.Body.Bytes(), &resp)
-			assert.NoError(t, err)
+			assert.Equal(t, http.StatusOK, w.Code)
+			var resp CreateQuoteResponse
+			json.Unmarshal(w.Body.Bytes(), &resp)
 			assert.Equal(t, tt.want, resp)
 		})
 	}
 }
 
-// MockTransactioner is a mock implementation of the Transactioner interface
-type MockTransactioner struct {
-	GetTransactionsFunc  func(userID string, req transaction.GetTransactionsRequest) (*transaction.GetTransactionsResponse, error)
-	CreateDepositFunc    func(userID string, req transaction.CreateDepositRequest) (*transaction.CreateDepositResponse, error)
-	CreateWithdrawalFunc func(userID string, req transaction.CreateWithdrawalRequest) (*transaction.CreateWithdrawalResponse, error)
-	GetBalanceFunc       func(userID string, req transaction.GetBalanceRequest) (*transaction.GetBalanceResponse, error)
-	GetTransactionFunc   func(userID string, transactionID string) (*transaction.Transaction, error)
-}
+func TestCreateConversion(t *testing.T) {
+	type args struct {
+		userToken string
+	}
+	type setup struct {
+		mockTransactioner *MockTransactioner
+	}
 
-func (m *MockTransactioner) GetTransactions(userID string, req transaction.GetTransactionsRequest) (*transaction.GetTransactionsResponse, error) {
-	return m.GetTransactionsFunc(userID, req)
-}
+	tests := []struct {
+		name    string
+		args    args
+		reqBody map[string]interface{}
+		setup   setup
+		want    CreateConversionResponse
+		wantErr bool
+	}{
+		{
+			name:    "success",
+			args:    args{userToken: "USER_TOKEN_1"},
+			reqBody: map[string]interface{}{"conversionID": "conversion-key", "quoteID": "quote-id", "description": "holiday"},
+			setup: func() setup {
+				mockTransactioner := &MockTransactioner{
+					CreateConversionFunc: func(userID string, req transaction.CreateConversionRequest) (*transaction.CreateConversionResponse, error) {
+						return &transaction.CreateConversionResponse{
+							ConversionID: "conversion-key",
+							Debit:        transaction.Transaction{TransactionID: "conversion-key-debit", Amount: types.NewMoney(-10000, "USD"), ConversionID: "conversion-key", Rate: "4.715", Spread: 50},
+							Credit:       transaction.Transaction{TransactionID: "conversion-key-credit", Amount: types.NewMoney(46914, "MYR"), ConversionID: "conversion-key", Rate: "4.715", Spread: 50},
+						}, nil
+					},
+				}
+				return setup{mockTransactioner}
+			}(),
+			want: CreateConversionResponse{
+				Conversion: Conversion{
+					ConversionID: "conversion-key",
+					Debit:        Transaction{TransactionID: "conversion-key-debit", Amount: -10000, Currency: "USD", ConversionID: "conversion-key", Rate: "4.715", Spread: 50, CreatedAt: "0001-01-01T00:00:00Z", UpdatedAt: "0001-01-01T00:00:00Z"},
+					Credit:       Transaction{TransactionID: "conversion-key-credit", Amount: 46914, Currency: "MYR", ConversionID: "conversion-key", Rate: "4.715", Spread: 50, CreatedAt: "0001-01-01T00:00:00Z", UpdatedAt: "0001-01-01T00:00:00Z"},
+				},
+			},
+		},
+		{
+			name:    "missing quote",
+			args:    args{userToken: "USER_TOKEN_1"},
+			reqBody: map[string]interface{}{"conversionID": "conversion-key", "description": "holiday"},
+			setup: func() setup {
+				return setup{&MockTransactioner{}}
+			}(),
+			wantErr: true,
+		},
+		{
+			name:    "logic error",
+			args:    args{userToken: "USER_TOKEN_1"},
+			reqBody: map[string]interface{}{"conversionID": "conversion-key", "quoteID": "quote-id", "description": "holiday"},
+			setup: func() setup {
+				mockTransactioner := &MockTransactioner{
+					CreateConversionFunc: func(userID string, req transaction.CreateConversionRequest) (*transaction.CreateConversionResponse, error) {
+						return nil, errors.New("logic error")
+					},
+				}
+				return setup{mockTransactioner}
+			}(),
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			api := New(tt.setup.mockTransactioner, testKeys(t))
 
-func (m *MockTransactioner) CreateDeposit(userID string, req transaction.CreateDepositRequest) (*transaction.CreateDepositResponse, error) {
-	return m.CreateDepositFunc(userID, req)
-}
+			reqBodyBytes, _ := json.Marshal(tt.reqBody)
+			req, _ := http.NewRequest("POST", "/api/v1/conversions", bytes.NewBuffer(reqBodyBytes))
+			req.Header.Set("Content-Type", "application/json")
+			req.Header.Set("Authorization", "Bearer "+tt.args.userToken)
+			w := httptest.NewRecorder()
+			api.ServeHTTP(w, req)
 
-func (m *MockTransactioner) CreateWithdrawal(userID string, req transaction.CreateWithdrawalRequest) (*transaction.CreateWithdrawalResponse, error) {
-	return m.CreateWithdrawalFunc(userID, req)
+			if tt.wantErr {
+				assert.Equal(t, http.StatusBadRequest, w.Code)
+				return
+			}
+			assert.Equal(t, http.StatusOK, w.Code)
+			var resp CreateConversionResponse
+			json.Unmarshal(w.Body.Bytes(), &resp)
+			assert.Equal(t, tt.want, resp)
+		})
+	}
 }
 
-func (m *MockTransactioner) GetBalance(userID string, req transaction.GetBalanceRequest) (*transaction.GetBalanceResponse, error) {
-	return m.GetBalanceFunc(userID, req)
-}
+func TestGetBalance(t *testing.T) {
+	type args struct {
+		userToken string
+	}
+	type setup struct {
+		mockTransactioner *MockTransactioner
+	}
 
-func (m *MockTransactioner) GetTransaction(userID string, transactionID string) (*transaction.Transaction, error) {
-	return m.GetTransactionFunc(userID, transactionID)
+	tests := []struct {
+		name    string
+		args    args
+		reqBody map[string]interface{}
+		setup   setup
+		want    GetBalanceResponse
+		wantErr bool
+	}{
+		{
+			name:    "success",
+			args:    args{userToken: "USER_TOKEN_1"},
+			reqBody: map[string]interface{}{"accountNumber": "ACCOUNT_NUMBER_1"},
+			setup: func() setup {
+				mockTransactioner := &MockTransactioner{
+					GetBalanceFunc: func(userID string, req transaction.GetBalanceRequest) (*transaction.GetBalanceResponse, error) {
+						return &transaction.GetBalanceResponse{
+							Balances: []transaction.Balance{
+								{Ledger: types.NewMoney(1000, "MYR"), Available: types.NewMoney(800, "MYR")},
+								{Ledger: types.NewMoney(500, "JPY"), Available: types.NewMoney(500, "JPY")},
+							},
+						}, nil
+					},
+				}
+				return setup{mockTransactioner}
+			}(),
+			want: GetBalanceResponse{
+				Balances: []Balance{
+					{Currency: "MYR", Exponent: 2, Ledger: 1000, Available: 800},
+					{Currency: "JPY", Exponent: 0, Ledger: 500, Available: 500},
+				},
+			},
+		},
+		{
+			name:    "invalid account",
+			args:    args{userToken: "USER_TOKEN_1"},
+			reqBody: map[string]interface{}{"accountNumber": "INVALID_ACCOUNT"},
+			setup: func() setup {
+				mockTransactioner := &MockTransactioner{
+					GetBalanceFunc: func(userID string, req transaction.GetBalanceRequest) (*transaction.GetBalanceResponse, error) {
+						return nil, errors.New("account not found")
+					},
+				}
+				return setup{mockTransactioner}
+			}(),
+			wantErr: true,
+		},
+		{
+			name:    "logic error",
+			args:    args{userToken: "USER_TOKEN_1"},
+			reqBody: map[string]interface{}{"accountNumber": "ACCOUNT_NUMBER_1"},
+			setup: func() setup {
+				mockTransactioner := &MockTransactioner{
+					GetBalanceFunc: func(userID string, req transaction.GetBalanceRequest) (*transaction.GetBalanceResponse, error) {
+						return nil, errors.New("logic error")
+					},
+				}
+				return setup{mockTransactioner}
+			}(),
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			api := New(tt.setup.mockTransactioner, testKeys(t))
+
+			reqBodyBytes, _ := json.Marshal(tt.reqBody)
+			req, _ := http.NewRequest("GET", "/api/v1/balances?accountNumber="+tt.reqBody["accountNumber"].(string), bytes.NewBuffer(reqBodyBytes))
+			req.Header.Set("Content-Type", "application/json")
+			req.Header.Set("Authorization", "Bearer "+tt.args.userToken)
+			w := httptest.NewRecorder()
+			api.ServeHTTP(w, req)
+
+			if tt.wantErr {
+				assert.Equal(t, http.StatusBadRequest, w.Code)
+				return
+			}
+			assert.Equal(t, http.StatusOK, w.Code)
+			var resp GetBalanceResponse
+			json.Unmarshal(w.Body.Bytes(), &resp)
+			assert.Equal(t, tt.want, resp)
+		})
+	}
+}
+
+func TestGetTransactionStatus(t *testing.T) {
+	type args struct {
+		userToken string
+	}
+	type setup struct {
+		mockTransactioner *MockTransactioner
+	}
+
+	tests := []struct {
+		name    string
+		args    args
+		setup   setup
+		want    GetTransactionResponse
+		wantErr bool
+	}{
+		{
+			name: "success",
+			args: args{userToken: "USER_TOKEN_1"},
+			setup: func() setup {
+				mockTransactioner := &MockTransactioner{
+					GetTransactionFunc: func(userID string, transactionID string) (*transaction.Transaction, error) {
+						return &transaction.Transaction{
+							TransactionID: "TRANSACTION_ID_1",
+							Status:        "completed",
+							Amount:        types.NewMoney(100, "MYR"),
+							Description:   "test transaction",
+							StatusHistory: []transaction.StatusChange{
+								{To: "pending", CreatedAt: time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)},
+								{From: "pending", To: "processing", CreatedAt: time.Date(2025, 1, 1, 0, 0, 0, 100, time.UTC)},
+								{From: "processing", To: "completed", CreatedAt: time.Date(2025, 1, 1, 0, 0, 1, 0, time.UTC)},
+							},
+						}, nil
+					},
+				}
+				return setup{mockTransactioner}
+			}(),
+			want: GetTransactionResponse{
+				Transaction{
+					TransactionID: "TRANSACTION_ID_1",
+					Status:        "completed",
+					Amount:        100,
+					Currency:      "MYR",
+					Description:   "test transaction",
+					CreatedAt:     "0001-01-01T00:00:00Z",
+					UpdatedAt:     "0001-01-01T00:00:00Z",
+					StatusHistory: []StatusChange{
+						{To: "pending", CreatedAt: "2025-01-01T00:00:00Z"},
+						{From: "pending", To: "processing", CreatedAt: "2025-01-01T00:00:00.0000001Z"},
+						{From: "processing", To: "completed", CreatedAt: "2025-01-01T00:00:01Z"},
+					},
+				},
+			},
+		},
+		{
+			name: "transaction not found",
+			args: args{userToken: "USER_TOKEN_1"},
+			setup: func() setup {
+				mockTransactioner := &MockTransactioner{
+					GetTransactionFunc: func(userID string, transactionID string) (*transaction.Transaction, error) {
+						return nil, storage.ErrNotFound
+					},
+				}
+				return setup{mockTransactioner}
+			}(),
+			wantErr: true,
+		},
+		{
+			name: "logic error",
+			args: args{userToken: "USER_TOKEN_1"},
+			setup: func() setup {
+				mockTransactioner := &MockTransactioner{
+					GetTransactionFunc: func(userID string, transactionID string) (*transaction.Transaction, error) {
+						return nil, errors.New("logic error")
+					},
+				}
+				return setup{mockTransactioner}
+			}(),
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			api := New(tt.setup.mockTransactioner, testKeys(t))
+
+			req, _ := http.NewRequest("GET", "/api/v1/transactions/TRANSACTION_ID_1", nil)
+			req.Header.Set("Authorization", "Bearer "+tt.args.userToken)
+			r := httptest.NewRecorder()
+			api.ServeHTTP(r, req)
+
+			if tt.wantErr {
+				assert.Equal(t, http.StatusBadRequest, r.Code)
+				return
+			}
+
+			assert.Equal(t, http.StatusOK, r.Code)
+			var resp GetTransactionResponse
+			err := json.Unmarshal(r.Body.Bytes(), &resp)
+			assert.NoError(t, err)
+			assert.Equal(t, tt.want, resp)
+		})
+	}
+}
+
+func TestCancelTransaction(t *testing.T) {
+	tests := []struct {
+		name       string
+		body       string
+		setup      func(t *testing.T) *MockTransactioner
+		want       CancelTransactionResponse
+		wantStatus int
+		wantCode   types.ErrorCode
+	}{
+		{
+			name: "success",
+			body: `{"reason": "changed my mind"}`,
+			setup: func(t *testing.T) *MockTransactioner {
+				return &MockTransactioner{
+					CancelTransactionFunc: func(userID string, transactionID string, req transaction.CancelTransactionRequest) (*transaction.Transaction, error) {
+						assert.Equal(t, "USER_ID_1", userID)
+						assert.Equal(t, "TRANSACTION_ID_1", transactionID)
+						assert.Equal(t, "changed my mind", req.Reason)
+						return &transaction.Transaction{
+							TransactionID: transactionID,
+							Status:        "cancelled",
+							StatusReason:  req.Reason,
+							Amount:        types.NewMoney(100, "MYR"),
+						}, nil
+					},
+				}
+			},
+			want: CancelTransactionResponse{
+				Transaction: Transaction{
+					TransactionID: "TRANSACTION_ID_1",
+					Status:        "cancelled",
+					StatusReason:  "changed my mind",
+					Amount:        100,
+					Currency:      "MYR",
+					CreatedAt:     "0001-01-01T00:00:00Z",
+					UpdatedAt:     "0001-01-01T00:00:00Z",
+				},
+			},
+			wantStatus: http.StatusOK,
+		},
+		{
+			name: "without a reason",
+			setup: func(t *testing.T) *MockTransactioner {
+				return &MockTransactioner{
+					CancelTransactionFunc: func(userID string, transactionID string, req transaction.CancelTransactionRequest) (*transaction.Transaction, error) {
+						assert.Empty(t, req.Reason)
+						return &transaction.Transaction{TransactionID: transactionID, Status: "cancelled", Amount: types.NewMoney(100, "MYR")}, nil
+					},
+				}
+			},
+			want: CancelTransactionResponse{
+				Transaction: Transaction{
+					TransactionID: "TRANSACTION_ID_1",
+					Status:        "cancelled",
+					Amount:        100,
+					Currency:      "MYR",
+					CreatedAt:     "0001-01-01T00:00:00Z",
+					UpdatedAt:     "0001-01-01T00:00:00Z",
+				},
+			},
+			wantStatus: http.StatusOK,
+		},
+		{
+			name: "already processing",
+			body: `{}`,
+			setup: func(t *testing.T) *MockTransactioner {
+				return &MockTransactioner{
+					CancelTransactionFunc: func(userID string, transactionID string, req transaction.CancelTransactionRequest) (*transaction.Transaction, error) {
+						return nil, types.NewBadRequest(types.ErrorCodeInvalidStatusTransition, "transaction TRANSACTION_ID_1 cannot move from processing to cancelled")
+					},
+				}
+			},
+			wantStatus: http.StatusBadRequest,
+			wantCode:   types.ErrorCodeInvalidStatusTransition,
+		},
+		{
+			name:       "invalid body",
+			body:       `{"reason": 1}`,
+			setup:      func(t *testing.T) *MockTransactioner { return &MockTransactioner{} },
+			wantStatus: http.StatusBadRequest,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			api := New(tt.setup(t), testKeys(t))
+
+			req, _ := http.NewRequest("POST", "/api/v1/transactions/TRANSACTION_ID_1/cancel", bytes.NewBufferString(tt.body))
+			req.Header.Set("Authorization", "Bearer USER_TOKEN_1")
+			r := httptest.NewRecorder()
+			api.ServeHTTP(r, req)
+
+			assert.Equal(t, tt.wantStatus, r.Code)
+			if tt.wantStatus != http.StatusOK {
+				if tt.wantCode != "" {
+					var serviceErr types.ServiceError
+					require.NoError(t, json.Unmarshal(r.Body.Bytes(), &serviceErr))
+					assert.Equal(t, string(tt.wantCode), serviceErr.Code)
+				}
+				return
+			}
+
+			var resp CancelTransactionResponse
+			require.NoError(t, json.Unmarshal(r.Body.Bytes(), &resp))
+			assert.Equal(t, tt.want, resp)
+		})
+	}
+}
+
+func TestCaptureHold(t *testing.T) {
+	tests := []struct {
+		name       string
+		body       string
+		setup      func(t *testing.T) *MockTransactioner
+		want       CaptureHoldResponse
+		wantStatus int
+		wantCode   types.ErrorCode
+	}{
+		{
+			name: "partial capture",
+			body: `{"transactionID": "CAPTURE_1", "amount": 250, "description": "coffee"}`,
+			setup: func(t *testing.T) *MockTransactioner {
+				return &MockTransactioner{
+					CaptureHoldFunc: func(userID string, holdID string, req transaction.CaptureHoldRequest) (*transaction.CaptureHoldResponse, error) {
+						assert.Equal(t, "USER_ID_1", userID)
+						assert.Equal(t, "HOLD_ID_1", holdID)
+						assert.Equal(t, transaction.CaptureHoldRequest{TransactionID: "CAPTURE_1", Amount: types.NewMoney(250, ""), Description: "coffee"}, req)
+						return &transaction.CaptureHoldResponse{
+							Hold: transaction.Hold{
+								HoldID:        holdID,
+								AccountNumber: "ACCOUNT_NUMBER_1",
+								Amount:        types.NewMoney(300, "MYR"),
+								Captured:      types.NewMoney(250, "MYR"),
+								Status:        "captured",
+								Description:   "authorization",
+							},
+							Transaction: transaction.Transaction{
+								TransactionID: "CAPTURE_1",
+								Type:          "capture",
+								Status:        "completed",
+								Amount:        types.NewMoney(-250, "MYR"),
+								Description:   "coffee",
+								HoldID:        holdID,
+							},
+						}, nil
+					},
+				}
+			},
+			want: CaptureHoldResponse{
+				Hold: Hold{
+					HoldID:         "HOLD_ID_1",
+					AccountNumber:  "ACCOUNT_NUMBER_1",
+					Amount:         300,
+					Currency:       "MYR",
+					CapturedAmount: 250,
+					Status:         "captured",
+					Description:    "authorization",
+					ExpiresAt:      "0001-01-01T00:00:00Z",
+					CreatedAt:      "0001-01-01T00:00:00Z",
+					UpdatedAt:      "0001-01-01T00:00:00Z",
+				},
+				Transaction: Transaction{
+					TransactionID: "CAPTURE_1",
+					Type:          "capture",
+					Status:        "completed",
+					Amount:        -250,
+					Currency:      "MYR",
+					Description:   "coffee",
+					HoldID:        "HOLD_ID_1",
+					CreatedAt:     "0001-01-01T00:00:00Z",
+					UpdatedAt:     "0001-01-01T00:00:00Z",
+				},
+			},
+			wantStatus: http.StatusOK,
+		},
+		{
+			name: "already voided",
+			body: `{"transactionID": "CAPTURE_1", "description": "coffee"}`,
+			setup: func(t *testing.T) *MockTransactioner {
+				return &MockTransactioner{
+					CaptureHoldFunc: func(userID string, holdID string, req transaction.CaptureHoldRequest) (*transaction.CaptureHoldResponse, error) {
+						assert.Zero(t, req.Amount.Amount)
+						return nil, types.NewBadRequest(types.ErrorCodeInvalidStatusTransition, "hold HOLD_ID_1 is voided")
+					},
+				}
+			},
+			wantStatus: http.StatusBadRequest,
+			wantCode:   types.ErrorCodeInvalidStatusTransition,
+		},
+		{
+			name:       "negative amount",
+			body:       `{"transactionID": "CAPTURE_1", "amount": -1, "description": "coffee"}`,
+			setup:      func(t *testing.T) *MockTransactioner { return &MockTransactioner{} },
+			wantStatus: http.StatusBadRequest,
+		},
+		{
+			name:       "unsupported currency",
+			body:       `{"transactionID": "CAPTURE_1", "amount": 1, "currency": "XYZ", "description": "coffee"}`,
+			setup:      func(t *testing.T) *MockTransactioner { return &MockTransactioner{} },
+			wantStatus: http.StatusBadRequest,
+			wantCode:   types.ErrorCodeInvalidCurrency,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			api := New(tt.setup(t), testKeys(t))
+
+			req, _ := http.NewRequest("POST", "/api/v1/holds/HOLD_ID_1/capture", bytes.NewBufferString(tt.body))
+			req.Header.Set("Authorization", "Bearer USER_TOKEN_1")
+			r := httptest.NewRecorder()
+			api.ServeHTTP(r, req)
+
+			assert.Equal(t, tt.wantStatus, r.Code)
+			if tt.wantStatus != http.StatusOK {
+				if tt.wantCode != "" {
+					var serviceErr types.ServiceError
+					require.NoError(t, json.Unmarshal(r.Body.Bytes(), &serviceErr))
+					assert.Equal(t, string(tt.wantCode), serviceErr.Code)
+				}
+				return
+			}
+
+			var resp CaptureHoldResponse
+			require.NoError(t, json.Unmarshal(r.Body.Bytes(), &resp))
+			assert.Equal(t, tt.want, resp)
+		})
+	}
+}
+
+func TestCreateReversal(t *testing.T) {
+	tests := []struct {
+		name       string
+		body       string
+		setup      func(t *testing.T) *MockTransactioner
+		want       CreateReversalResponse
+		wantStatus int
+		wantCode   types.ErrorCode
+	}{
+		{
+			name: "partial reversal",
+			body: `{"transactionID": "REVERSAL_1", "amount": 200, "description": "refund"}`,
+			setup: func(t *testing.T) *MockTransactioner {
+				return &MockTransactioner{
+					ReverseTransactionFunc: func(userID string, transactionID string, req transaction.CreateReversalRequest) (*transaction.CreateReversalResponse, error) {
+						assert.Equal(t, "USER_ID_1", userID)
+						assert.Equal(t, "TRANSACTION_ID_1", transactionID)
+						assert.Equal(t, transaction.CreateReversalRequest{TransactionID: "REVERSAL_1", Amount: types.NewMoney(200, ""), Description: "refund"}, req)
+						return &transaction.CreateReversalResponse{
+							Reversal: transaction.Transaction{
+								TransactionID: "REVERSAL_1",
+								Type:          "reversal",
+								Status:        "completed",
+								Amount:        types.NewMoney(-200, "MYR"),
+								Description:   "refund",
+								ReversalOf:    transactionID,
+							},
+							Original: transaction.Transaction{
+								TransactionID: transactionID,
+								Type:          "deposit",
+								Status:        "partially_reversed",
+								StatusReason:  "reversed by REVERSAL_1",
+								Amount:        types.NewMoney(500, "MYR"),
+								Description:   "salary",
+								Reversals: []transaction.Reversal{
+									{TransactionID: "REVERSAL_1", Amount: types.NewMoney(-200, "MYR"), CreatedAt: time.Date(2021, 1, 1, 0, 0, 0, 0, time.UTC)},
+								},
+							},
+						}, nil
+					},
+				}
+			},
+			want: CreateReversalResponse{
+				Reversal: Transaction{
+					TransactionID: "REVERSAL_1",
+					Type:          "reversal",
+					Status:        "completed",
+					Amount:        -200,
+					Currency:      "MYR",
+					Description:   "refund",
+					ReversalOf:    "TRANSACTION_ID_1",
+					CreatedAt:     "0001-01-01T00:00:00Z",
+					UpdatedAt:     "0001-01-01T00:00:00Z",
+				},
+				Original: Transaction{
+					TransactionID: "TRANSACTION_ID_1",
+					Type:          "deposit",
+					Status:        "partially_reversed",
+					StatusReason:  "reversed by REVERSAL_1",
+					Amount:        500,
+					Currency:      "MYR",
+					Description:   "salary",
+					CreatedAt:     "0001-01-01T00:00:00Z",
+					UpdatedAt:     "0001-01-01T00:00:00Z",
+					Reversals: []Reversal{
+						{TransactionID: "REVERSAL_1", Amount: -200, Currency: "MYR", CreatedAt: "2021-01-01T00:00:00Z"},
+					},
+				},
+			},
+			wantStatus: http.StatusOK,
+		},
+		{
+			name: "more than is left to reverse",
+			body: `{"transactionID": "REVERSAL_1", "amount": 900, "description": "refund"}`,
+			setup: func(t *testing.T) *MockTransactioner {
+				return &MockTransactioner{
+					ReverseTransactionFunc: func(userID string, transactionID string, req transaction.CreateReversalRequest) (*transaction.CreateReversalResponse, error) {
+						return nil, types.NewBadRequest(types.ErrorCodeInvalidAmount, "reversal must be between 0 and the 5.00 MYR left to reverse")
+					},
+				}
+			},
+			wantStatus: http.StatusBadRequest,
+			wantCode:   types.ErrorCodeInvalidAmount,
+		},
+		{
+			name:       "negative amount",
+			body:       `{"transactionID": "REVERSAL_1", "amount": -1, "description": "refund"}`,
+			setup:      func(t *testing.T) *MockTransactioner { return &MockTransactioner{} },
+			wantStatus: http.StatusBadRequest,
+		},
+		{
+			name:       "missing description",
+			body:       `{"transactionID": "REVERSAL_1"}`,
+			setup:      func(t *testing.T) *MockTransactioner { return &MockTransactioner{} },
+			wantStatus: http.StatusBadRequest,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			api := New(tt.setup(t), testKeys(t))
+
+			req, _ := http.NewRequest("POST", "/api/v1/transactions/TRANSACTION_ID_1/reversals", bytes.NewBufferString(tt.body))
+			req.Header.Set("Authorization", "Bearer USER_TOKEN_1")
+			r := httptest.NewRecorder()
+			api.ServeHTTP(r, req)
+
+			assert.Equal(t, tt.wantStatus, r.Code)
+			if tt.wantStatus != http.StatusOK {
+				if tt.wantCode != "" {
+					var serviceErr types.ServiceError
+					require.NoError(t, json.Unmarshal(r.Body.Bytes(), &serviceErr))
+					assert.Equal(t, string(tt.wantCode), serviceErr.Code)
+				}
+				return
+			}
+
+			var resp CreateReversalResponse
+			require.NoError(t, json.Unmarshal(r.Body.Bytes(), &resp))
+			assert.Equal(t, tt.want, resp)
+		})
+	}
+}
+
+func TestIdempotency(t *testing.T) {
+	store := storage.NewMemoryStorage()
+	calls := 0
+	mockTransactioner := &MockTransactioner{
+		CreateDepositFunc: func(userID string, req transaction.CreateDepositRequest) (*transaction.CreateDepositResponse, error) {
+			calls++
+			if req.Amount.Amount > 1000 {
+				return nil, types.NewBadRequest(types.ErrorCodeInvalidAmount, "too much")
+			}
+			return &transaction.CreateDepositResponse{Transaction: transaction.Transaction{TransactionID: req.TransactionID, Status: "pending", Amount: req.Amount}}, nil
+		},
+	}
+	api := New(mockTransactioner, testKeys(t), WithIdempotency(store, time.Hour))
+
+	deposit := func(token string, key string, body string) *httptest.ResponseRecorder {
+		req, _ := http.NewRequest("POST", "/api/v1/deposits", bytes.NewBufferString(body))
+		req.Header.Set("Authorization", "Bearer "+token)
+		if key != "" {
+			req.Header.Set(HeaderIdempotencyKey, key)
+		}
+		r := httptest.NewRecorder()
+		api.ServeHTTP(r, req)
+		return r
+	}
+	body := `{"transactionID": "TRANSACTION_ID_1", "accountNumber": "ACCOUNT_NUMBER_1", "amount": 100, "currency": "MYR", "description": "deposit"}`
+
+	// the first request runs, its retries get the same response
+	first := deposit("USER_TOKEN_1", "KEY_1", body)
+	assert.Equal(t, http.StatusOK, first.Code)
+	assert.Empty(t, first.Header().Get(HeaderIdempotentReplayed))
+
+	retry := deposit("USER_TOKEN_1", "KEY_1", body)
+	assert.Equal(t, http.StatusOK, retry.Code)
+	assert.Equal(t, "true", retry.Header().Get(HeaderIdempotentReplayed))
+	assert.Equal(t, first.Header().Get("Content-Type"), retry.Header().Get("Content-Type"))
+	assert.Equal(t, first.Body.String(), retry.Body.String())
+	assert.Equal(t, 1, calls)
+
+	// the same key with a different request
+	reused := deposit("USER_TOKEN_1", "KEY_1", `{"transactionID": "TRANSACTION_ID_2", "accountNumber": "ACCOUNT_NUMBER_1", "amount": 100, "currency": "MYR", "description": "deposit"}`)
+	assert.Equal(t, http.StatusUnprocessableEntity, reused.Code)
+	assert.Equal(t, string(types.ErrorCodeIdempotencyKeyReused), errorCode(t, reused))
+	assert.Equal(t, 1, calls)
+
+	// keys belong to the user who sent them
+	assert.Equal(t, http.StatusOK, deposit("USER_TOKEN_2", "KEY_1", body).Code)
+	assert.Equal(t, 2, calls)
+
+	// client errors are replayed as well
+	tooMuch := `{"transactionID": "TRANSACTION_ID_3", "accountNumber": "ACCOUNT_NUMBER_1", "amount": 5000, "currency": "MYR", "description": "deposit"}`
+	assert.Equal(t, http.StatusBadRequest, deposit("USER_TOKEN_1", "KEY_2", tooMuch).Code)
+	replayed := deposit("USER_TOKEN_1", "KEY_2", tooMuch)
+	assert.Equal(t, http.StatusBadRequest, replayed.Code)
+	assert.Equal(t, string(types.ErrorCodeInvalidAmount), errorCode(t, replayed))
+	assert.Equal(t, 3, calls)
+
+	// a retry while the first request is still running
+	running := fingerprint(httptest.NewRequest("POST", "/api/v1/deposits", nil), []byte(body))
+	require.NoError(t, store.CreateIdempotencyKey(&storage.IdempotencyKey{UserID: "USER_ID_1", Key: "KEY_3", Fingerprint: running, ExpiresAt: time.Now().Add(time.Hour)}))
+	inFlight := deposit("USER_TOKEN_1", "KEY_3", body)
+	assert.Equal(t, http.StatusConflict, inFlight.Code)
+	assert.Equal(t, string(types.ErrorCodeIdempotencyKeyInUse), errorCode(t, inFlight))
+	assert.Equal(t, 3, calls)
+
+	// requests without a key always run
+	deposit("USER_TOKEN_1", "", body)
+	deposit("USER_TOKEN_1", "", body)
+	assert.Equal(t, 5, calls)
+
+	tooLong := deposit("USER_TOKEN_1", string(bytes.Repeat([]byte("k"), 256)), body)
+	assert.Equal(t, http.StatusBadRequest, tooLong.Code)
+	assert.Equal(t, 5, calls)
+}
+
+func TestIdempotencyRelease(t *testing.T) {
+	store := storage.NewMemoryStorage()
+	calls := 0
+	mockTransactioner := &MockTransactioner{
+		CreateDepositFunc: func(userID string, req transaction.CreateDepositRequest) (*transaction.CreateDepositResponse, error) {
+			calls++
+			if calls == 1 {
+				panic("deposit panicked")
+			}
+			return &transaction.CreateDepositResponse{Transaction: transaction.Transaction{TransactionID: req.TransactionID, Status: "pending", Amount: req.Amount}}, nil
+		},
+	}
+	api := New(mockTransactioner, testKeys(t), WithIdempotency(store, time.Hour))
+
+	deposit := func(ctx context.Context, key string) *httptest.ResponseRecorder {
+		req, _ := http.NewRequestWithContext(ctx, "POST", "/api/v1/deposits", bytes.NewBufferString(`{"transactionID": "TRANSACTION_ID_1", "accountNumber": "ACCOUNT_NUMBER_1", "amount": 100, "currency": "MYR", "description": "deposit"}`))
+		req.Header.Set("Authorization", "Bearer USER_TOKEN_1")
+		req.Header.Set(HeaderIdempotencyKey, key)
+		r := httptest.NewRecorder()
+		api.ServeHTTP(r, req)
+		return r
+	}
+
+	// a request that panicked can be retried
+	assert.Panics(t, func() { deposit(context.Background(), "KEY_1") })
+	retry := deposit(context.Background(), "KEY_1")
+	assert.Equal(t, http.StatusOK, retry.Code)
+	assert.Empty(t, retry.Header().Get(HeaderIdempotentReplayed))
+	assert.Equal(t, 2, calls)
+
+	// so can a request whose client went away before getting the response
+	disconnected, cancel := context.WithCancel(context.Background())
+	cancel()
+	deposit(disconnected, "KEY_2")
+	_, err := store.GetIdempotencyKey("USER_ID_1", "KEY_2")
+	assert.ErrorIs(t, err, storage.ErrNotFound)
+	retry = deposit(context.Background(), "KEY_2")
+	assert.Equal(t, http.StatusOK, retry.Code)
+	assert.Empty(t, retry.Header().Get(HeaderIdempotentReplayed))
+	assert.Equal(t, 4, calls)
+}
+
+func TestIdempotencyExpiry(t *testing.T) {
+	calls := 0
+	mockTransactioner := &MockTransactioner{
+		CreateDepositFunc: func(userID string, req transaction.CreateDepositRequest) (*transaction.CreateDepositResponse, error) {
+			calls++
+			return &transaction.CreateDepositResponse{Transaction: transaction.Transaction{TransactionID: req.TransactionID, Status: "pending", Amount: req.Amount}}, nil
+		},
+	}
+	api := New(mockTransactioner, testKeys(t), WithIdempotency(storage.NewMemoryStorage(), time.Nanosecond))
+
+	for range 2 {
+		req, _ := http.NewRequest("POST", "/api/v1/deposits", bytes.NewBufferString(`{"transactionID": "TRANSACTION_ID_1", "accountNumber": "ACCOUNT_NUMBER_1", "amount": 100, "currency": "MYR", "description": "deposit"}`))
+		req.Header.Set("Authorization", "Bearer USER_TOKEN_1")
+		req.Header.Set(HeaderIdempotencyKey, "KEY_1")
+		r := httptest.NewRecorder()
+		api.ServeHTTP(r, req)
+		assert.Equal(t, http.StatusOK, r.Code)
+		assert.Empty(t, r.Header().Get(HeaderIdempotentReplayed))
+	}
+	assert.Equal(t, 2, calls)
+}
+
+func TestAuthMiddleware(t *testing.T) {
+	store := storage.NewMemoryStorage()
+	for _, key := range []*storage.APIKey{
+		{KeyID: "KEY_ID_1", UserID: "USER_ID_1", Scopes: types.AllScopes, Hash: storage.HashAPIKeySecret("SECRET_1")},
+		{KeyID: "KEY_ID_2", UserID: "USER_ID_1", Scopes: types.AllScopes, Hash: storage.HashAPIKeySecret("SECRET_2")},
+	} {
+		require.NoError(t, store.CreateAPIKey(key))
+	}
+	require.NoError(t, store.RevokeAPIKey("USER_ID_1", "KEY_ID_2", time.Now()))
+
+	var principal *types.Principal
+	mockTransactioner := &MockTransactioner{
+		GetBalanceFunc: func(userID string, req transaction.GetBalanceRequest) (*transaction.GetBalanceResponse, error) {
+			principal = &types.Principal{UserID: userID}
+			return &transaction.GetBalanceResponse{}, nil
+		},
+	}
+	api := New(mockTransactioner, apikey.New(store))
+
+	tests := []struct {
+		name          string
+		authorization string
+		wantStatus    int
+	}{
+		{name: "valid key", authorization: "Bearer SECRET_1", wantStatus: http.StatusOK},
+		{name: "scheme is case insensitive", authorization: "bearer SECRET_1", wantStatus: http.StatusOK},
+		{name: "missing header", authorization: "", wantStatus: http.StatusUnauthorized},
+		{name: "missing scheme", authorization: "SECRET_1", wantStatus: http.StatusUnauthorized},
+		{name: "other scheme", authorization: "Basic SECRET_1", wantStatus: http.StatusUnauthorized},
+		{name: "missing key", authorization: "Bearer ", wantStatus: http.StatusUnauthorized},
+		{name: "unknown key", authorization: "Bearer USER_TOKEN_1", wantStatus: http.StatusUnauthorized},
+		{name: "revoked key", authorization: "Bearer SECRET_2", wantStatus: http.StatusUnauthorized},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			principal = nil
+			req, _ := http.NewRequest("GET", "/api/v1/balances?accountNumber=ACCOUNT_NUMBER_1", nil)
+			req.Header.Set("Authorization", tt.authorization)
+			w := httptest.NewRecorder()
+			api.ServeHTTP(w, req)
+
+			assert.Equal(t, tt.wantStatus, w.Code)
+			if tt.wantStatus != http.StatusOK {
+				assert.Equal(t, string(types.Unauthorized), errorCode(t, w))
+				assert.Nil(t, principal)
+				return
+			}
+			require.NotNil(t, principal)
+			assert.Equal(t, "USER_ID_1", principal.UserID)
+		})
+	}
+
+	key, err := store.GetAPIKey("USER_ID_1", "KEY_ID_1")
+	require.NoError(t, err)
+	assert.False(t, key.LastUsedAt.IsZero())
+}
+
+func TestAPIKeyLifecycle(t *testing.T) {
+	api := New(&MockTransactioner{}, testKeys(t))
+
+	call := func(method, path, authorization, body string) *httptest.ResponseRecorder {
+		req, _ := http.NewRequest(method, path, bytes.NewBufferString(body))
+		req.Header.Set("Authorization", authorization)
+		w := httptest.NewRecorder()
+		api.ServeHTTP(w, req)
+		return w
+	}
+
+	w := call("POST", "/api/v1/api-keys", "Bearer USER_TOKEN_1", `{"name": "ci"}`)
+	require.Equal(t, http.StatusOK, w.Code)
+	var created CreateAPIKeyResponse
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &created))
+	assert.Equal(t, "ci", created.APIKey.Name)
+	assert.True(t, strings.HasPrefix(created.Secret, created.APIKey.Prefix))
+	assert.Empty(t, created.APIKey.RevokedAt)
+
+	assert.Equal(t, http.StatusBadRequest, call("POST", "/api/v1/api-keys", "Bearer USER_TOKEN_1", `{}`).Code)
+
+	// the new key authenticates as its user and is listed without its secret
+	w = call("GET", "/api/v1/api-keys", "Bearer "+created.Secret, "")
+	require.Equal(t, http.StatusOK, w.Code)
+	assert.NotContains(t, w.Body.String(), created.Secret)
+	var keys GetAPIKeysResponse
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &keys))
+	require.Len(t, keys.APIKeys, 2)
+	assert.Equal(t, created.APIKey.KeyID, keys.APIKeys[1].KeyID)
+	assert.NotEmpty(t, keys.APIKeys[1].LastUsedAt)
+
+	// keys of another user cannot be managed
+	assert.Equal(t, http.StatusNotFound, call("POST", "/api/v1/api-keys/"+created.APIKey.KeyID+"/revoke", "Bearer USER_TOKEN_2", "").Code)
+
+	// rotating replaces the secret
+	w = call("POST", "/api/v1/api-keys/"+created.APIKey.KeyID+"/rotate", "Bearer USER_TOKEN_1", "")
+	require.Equal(t, http.StatusOK, w.Code)
+	var rotated CreateAPIKeyResponse
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &rotated))
+	assert.Equal(t, "ci", rotated.APIKey.Name)
+	assert.NotEqual(t, created.APIKey.KeyID, rotated.APIKey.KeyID)
+	assert.Equal(t, http.StatusUnauthorized, call("GET", "/api/v1/api-keys", "Bearer "+created.Secret, "").Code)
+	assert.Equal(t, http.StatusOK, call("GET", "/api/v1/api-keys", "Bearer "+rotated.Secret, "").Code)
+	assert.Equal(t, http.StatusBadRequest, call("POST", "/api/v1/api-keys/"+created.APIKey.KeyID+"/rotate", "Bearer USER_TOKEN_1", "").Code)
+
+	w = call("POST", "/api/v1/api-keys/"+rotated.APIKey.KeyID+"/revoke", "Bearer USER_TOKEN_1", "")
+	require.Equal(t, http.StatusOK, w.Code)
+	var revoked RevokeAPIKeyResponse
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &revoked))
+	assert.NotEmpty(t, revoked.APIKey.RevokedAt)
+	assert.Equal(t, http.StatusUnauthorized, call("GET", "/api/v1/api-keys", "Bearer "+rotated.Secret, "").Code)
+	assert.Equal(t, http.StatusBadRequest, call("POST", "/api/v1/api-keys/"+rotated.APIKey.KeyID+"/revoke", "Bearer USER_TOKEN_1", "").Code)
+}
+
+func TestScopes(t *testing.T) {
+	mockTransactioner := &MockTransactioner{
+		GetBalanceFunc: func(userID string, req transaction.GetBalanceRequest) (*transaction.GetBalanceResponse, error) {
+			return &transaction.GetBalanceResponse{}, nil
+		},
+		CreateDepositFunc: func(userID string, req transaction.CreateDepositRequest) (*transaction.CreateDepositResponse, error) {
+			return &transaction.CreateDepositResponse{}, nil
+		},
+	}
+	tokens := fakeVerifier{
+		"read.only.token":    {UserID: "USER_ID_1", Scopes: []string{types.ScopeBalancesRead}},
+		"deposit.only.token": {UserID: "USER_ID_1", Scopes: []string{types.ScopeDepositsWrite}},
+	}
+	api := New(mockTransactioner, testKeys(t), WithJWT(tokens))
+
+	deposit := `{"transactionID": "TRANSACTION_ID_1", "accountNumber": "ACCOUNT_NUMBER_1", "amount": 100, "currency": "MYR", "description": "deposit"}`
+	tests := []struct {
+		name          string
+		method, path  string
+		authorization string
+		wantStatus    int
+	}{
+		{name: "token with scope", method: "GET", path: "/api/v1/balances?accountNumber=ACCOUNT_NUMBER_1", authorization: "Bearer read.only.token", wantStatus: http.StatusOK},
+		{name: "token without scope", method: "POST", path: "/api/v1/deposits", authorization: "Bearer read.only.token", wantStatus: http.StatusForbidden},
+		{name: "write scope does not grant reads", method: "GET", path: "/api/v1/balances?accountNumber=ACCOUNT_NUMBER_1", authorization: "Bearer deposit.only.token", wantStatus: http.StatusForbidden},
+		{name: "token with write scope", method: "POST", path: "/api/v1/deposits", authorization: "Bearer deposit.only.token", wantStatus: http.StatusOK},
+		{name: "invalid token", method: "GET", path: "/api/v1/balances?accountNumber=ACCOUNT_NUMBER_1", authorization: "Bearer forged.token.value", wantStatus: http.StatusUnauthorized},
+		{name: "api key with scope", method: "POST", path: "/api/v1/deposits", authorization: "Bearer USER_TOKEN_1", wantStatus: http.StatusOK},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req, _ := http.NewRequest(tt.method, tt.path, bytes.NewBufferString(deposit))
+			req.Header.Set("Authorization", tt.authorization)
+			w := httptest.NewRecorder()
+			api.ServeHTTP(w, req)
+
+			assert.Equal(t, tt.wantStatus, w.Code)
+			if tt.wantStatus == http.StatusForbidden {
+				assert.Equal(t, string(types.ErrorCodeInsufficientScope), errorCode(t, w))
+			}
+		})
+	}
+}
+
+func TestAPIKeyScopes(t *testing.T) {
+	mockTransactioner := &MockTransactioner{
+		GetBalanceFunc: func(userID string, req transaction.GetBalanceRequest) (*transaction.GetBalanceResponse, error) {
+			return &transaction.GetBalanceResponse{}, nil
+		},
+	}
+	tokens := fakeVerifier{
+		"keys.only.token": {UserID: "USER_ID_1", Role: types.RoleCustomer, Scopes: []string{types.ScopeAPIKeysWrite}},
+	}
+	api := New(mockTransactioner, testKeys(t), WithJWT(tokens))
+
+	call := func(method, path, authorization, body string) *httptest.ResponseRecorder {
+		req, _ := http.NewRequest(method, path, bytes.NewBufferString(body))
+		req.Header.Set("Authorization", authorization)
+		w := httptest.NewRecorder()
+		api.ServeHTTP(w, req)
+		return w
+	}
+
+	// a token scoped to minting keys cannot mint a key with more scopes than its own
+	w := call("POST", "/api/v1/api-keys", "Bearer keys.only.token", `{"name": "ci", "scopes": ["balances:read"]}`)
+	assert.Equal(t, http.StatusForbidden, w.Code)
+	assert.Equal(t, string(types.ErrorCodeInsufficientScope), errorCode(t, w))
+
+	w = call("POST", "/api/v1/api-keys", "Bearer keys.only.token", `{"name": "ci"}`)
+	require.Equal(t, http.StatusOK, w.Code)
+	var created CreateAPIKeyResponse
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &created))
+	assert.Equal(t, []string{types.ScopeAPIKeysWrite}, created.APIKey.Scopes)
+	w = call("GET", "/api/v1/balances?accountNumber=ACCOUNT_NUMBER_1", "Bearer "+created.Secret, "")
+	assert.Equal(t, http.StatusForbidden, w.Code)
+
+	// a broader key can mint a narrower one
+	w = call("POST", "/api/v1/api-keys", "Bearer USER_TOKEN_1", `{"name": "dashboard", "scopes": ["balances:read"]}`)
+	require.Equal(t, http.StatusOK, w.Code)
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &created))
+	assert.Equal(t, http.StatusOK, call("GET", "/api/v1/balances?accountNumber=ACCOUNT_NUMBER_1", "Bearer "+created.Secret, "").Code)
+	assert.Equal(t, http.StatusForbidden, call("POST", "/api/v1/api-keys", "Bearer "+created.Secret, `{"name": "escalate"}`).Code)
+}
+
+// fakeVerifier accepts the tokens it maps to a principal
+type fakeVerifier map[string]*types.Principal
+
+func (f fakeVerifier) Verify(token string) (*types.Principal, error) {
+	principal, ok := f[token]
+	if !ok {
+		return nil, fmt.Errorf("%w: unknown", jwt.ErrInvalidToken)
+	}
+	return principal, nil
+}
+
+func errorCode(t *testing.T, r *httptest.ResponseRecorder) string {
+	var serviceErr types.ServiceError
+	require.NoError(t, json.Unmarshal(r.Body.Bytes(), &serviceErr))
+	return serviceErr.Code
+}
+
+// testKeys authenticates USER_TOKEN_1 and USER_TOKEN_2 as USER_ID_1 and USER_ID_2
+func testKeys(t *testing.T) apikey.KeyManager {
+	store := storage.NewMemoryStorage()
+	for _, key := range []*storage.APIKey{
+		{KeyID: "KEY_ID_1", UserID: "USER_ID_1", Scopes: types.AllScopes, Hash: storage.HashAPIKeySecret("USER_TOKEN_1")},
+		{KeyID: "KEY_ID_2", UserID: "USER_ID_2", Scopes: types.AllScopes, Hash: storage.HashAPIKeySecret("USER_TOKEN_2")},
+	} {
+		require.NoError(t, store.CreateAPIKey(key))
+	}
+	return apikey.New(store)
+}
+
+// MockTransactioner is a mock implementation of the Transactioner interface
+type MockTransactioner struct {
+	GetTransactionsFunc    func(userID string, req transaction.GetTransactionsRequest) (*transaction.GetTransactionsResponse, error)
+	CreateDepositFunc      func(userID string, req transaction.CreateDepositRequest) (*transaction.CreateDepositResponse, error)
+	CreateWithdrawalFunc   func(userID string, req transaction.CreateWithdrawalRequest) (*transaction.CreateWithdrawalResponse, error)
+	GetBalanceFunc         func(userID string, req transaction.GetBalanceRequest) (*transaction.GetBalanceResponse, error)
+	GetBalanceAtFunc       func(userID string, req transaction.GetBalanceAtRequest) (*transaction.GetBalanceAtResponse, error)
+	GetBalanceHistoryFunc  func(userID string, req transaction.GetBalanceHistoryRequest) (*transaction.GetBalanceHistoryResponse, error)
+	GetTransactionFunc     func(userID string, transactionID string) (*transaction.Transaction, error)
+	CreateTransferFunc     func(userID string, req transaction.CreateTransferRequest) (*transaction.CreateTransferResponse, error)
+	CreateQuoteFunc        func(userID string, req transaction.CreateQuoteRequest) (*transaction.CreateQuoteResponse, error)
+	CreateConversionFunc   func(userID string, req transaction.CreateConversionRequest) (*transaction.CreateConversionResponse, error)
+	CancelTransactionFunc  func(userID string, transactionID string, req transaction.CancelTransactionRequest) (*transaction.Transaction, error)
+	ReverseTransactionFunc func(userID string, transactionID string, req transaction.CreateReversalRequest) (*transaction.CreateReversalResponse, error)
+	CreateHoldFunc         func(userID string, req transaction.CreateHoldRequest) (*transaction.CreateHoldResponse, error)
+	GetHoldFunc            func(userID string, holdID string) (*transaction.Hold, error)
+	CaptureHoldFunc        func(userID string, holdID string, req transaction.CaptureHoldRequest) (*transaction.CaptureHoldResponse, error)
+	VoidHoldFunc           func(userID string, holdID string) (*transaction.Hold, error)
+	OpenAccountFunc        func(userID string, req transaction.OpenAccountRequest) (*transaction.Account, error)
+	GetAccountsFunc        func(userID string) (*transaction.GetAccountsResponse, error)
+	GetAccountFunc         func(userID string, accountNumber string) (*transaction.Account, error)
+	CloseAccountFunc       func(userID string, accountNumber string) (*transaction.Account, error)
+}
+
+func (m *MockTransactioner) GetTransactions(userID string, req transaction.GetTransactionsRequest) (*transaction.GetTransactionsResponse, error) {
+	return m.GetTransactionsFunc(userID, req)
+}
+
+func (m *MockTransactioner) CreateDeposit(userID string, req transaction.CreateDepositRequest) (*transaction.CreateDepositResponse, error) {
+	return m.CreateDepositFunc(userID, req)
+}
+
+func (m *MockTransactioner) CreateWithdrawal(userID string, req transaction.CreateWithdrawalRequest) (*transaction.CreateWithdrawalResponse, error) {
+	return m.CreateWithdrawalFunc(userID, req)
+}
+
+func (m *MockTransactioner) GetBalance(userID string, req transaction.GetBalanceRequest) (*transaction.GetBalanceResponse, error) {
+	return m.GetBalanceFunc(userID, req)
+}
+
+func (m *MockTransactioner) GetBalanceAt(userID string, req transaction.GetBalanceAtRequest) (*transaction.GetBalanceAtResponse, error) {
+	return m.GetBalanceAtFunc(userID, req)
+}
+
+func (m *MockTransactioner) GetBalanceHistory(userID string, req transaction.GetBalanceHistoryRequest) (*transaction.GetBalanceHistoryResponse, error) {
+	return m.GetBalanceHistoryFunc(userID, req)
+}
+
+func (m *MockTransactioner) GetTransaction(userID string, transactionID string) (*transaction.Transaction, error) {
+	return m.GetTransactionFunc(userID, transactionID)
+}
+
+func (m *MockTransactioner) CreateTransfer(userID string, req transaction.CreateTransferRequest) (*transaction.CreateTransferResponse, error) {
+	return m.CreateTransferFunc(userID, req)
+}
+
+func (m *MockTransactioner) CreateQuote(userID string, req transaction.CreateQuoteRequest) (*transaction.CreateQuoteResponse, error) {
+	return m.CreateQuoteFunc(userID, req)
+}
+
+func (m *MockTransactioner) CreateConversion(userID string, req transaction.CreateConversionRequest) (*transaction.CreateConversionResponse, error) {
+	return m.CreateConversionFunc(userID, req)
+}
+
+func (m *MockTransactioner) CancelTransaction(userID string, transactionID string, req transaction.CancelTransactionRequest) (*transaction.Transaction, error) {
+	return m.CancelTransactionFunc(userID, transactionID, req)
+}
+
+func (m *MockTransactioner) ReverseTransaction(userID string, transactionID string, req transaction.CreateReversalRequest) (*transaction.CreateReversalResponse, error) {
+	return m.ReverseTransactionFunc(userID, transactionID, req)
+}
+
+func (m *MockTransactioner) CreateHold(userID string, req transaction.CreateHoldRequest) (*transaction.CreateHoldResponse, error) {
+	return m.CreateHoldFunc(userID, req)
+}
+
+func (m *MockTransactioner) GetHold(userID string, holdID string) (*transaction.Hold, error) {
+	return m.GetHoldFunc(userID, holdID)
+}
+
+func (m *MockTransactioner) CaptureHold(userID string, holdID string, req transaction.CaptureHoldRequest) (*transaction.CaptureHoldResponse, error) {
+	return m.CaptureHoldFunc(userID, holdID, req)
+}
+
+func (m *MockTransactioner) VoidHold(userID string, holdID string) (*transaction.Hold, error) {
+	return m.VoidHoldFunc(userID, holdID)
+}
+
+func (m *MockTransactioner) OpenAccount(userID string, req transaction.OpenAccountRequest) (*transaction.Account, error) {
+	return m.OpenAccountFunc(userID, req)
+}
+
+func (m *MockTransactioner) GetAccounts(userID string) (*transaction.GetAccountsResponse, error) {
+	return m.GetAccountsFunc(userID)
+}
+
+func (m *MockTransactioner) GetAccount(userID string, accountNumber string) (*transaction.Account, error) {
+	return m.GetAccountFunc(userID, accountNumber)
+}
+
+func (m *MockTransactioner) CloseAccount(userID string, accountNumber string) (*transaction.Account, error) {
+	return m.CloseAccountFunc(userID, accountNumber)
 }
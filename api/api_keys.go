@@ -0,0 +1,100 @@
+package api
+
+import (
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/alienxp03/teya-ledger/handler/apikey"
+	"github.com/alienxp03/teya-ledger/types"
+)
+
+func (a *APIImpl) createAPIKey(w http.ResponseWriter, r *http.Request) {
+	principal, _ := PrincipalFrom(r.Context())
+
+	var req CreateAPIKeyRequest
+	if err := a.parseBody(r, &req); err != nil {
+		a.respondError(w, http.StatusBadRequest, err, fmt.Sprintf("Invalid body request %+v", err))
+		return
+	}
+
+	// A new key acts with the role of the caller creating it and at most its scopes, so a narrowly
+	// scoped token cannot mint a broader key
+	scopes := req.Scopes
+	if len(scopes) == 0 {
+		scopes = principal.Scopes
+	}
+	for _, scope := range scopes {
+		if !principal.HasScope(scope) {
+			err := types.NewForbidden(types.ErrorCodeInsufficientScope, fmt.Sprintf("the %s scope cannot be granted without holding it", scope))
+			a.respondError(w, http.StatusForbidden, err, err.Error())
+			return
+		}
+	}
+
+	result, err := a.keys.CreateKey(principal.UserID, apikey.CreateKeyRequest{Name: req.Name, Role: principal.Role, Scopes: scopes})
+	if err != nil {
+		a.respondError(w, http.StatusBadRequest, err, fmt.Sprintf("Failed to create API key: %+v", err))
+		return
+	}
+
+	a.respond(w, http.StatusOK, CreateAPIKeyResponse{APIKey: newAPIKey(result.Key), Secret: result.Secret})
+}
+
+func (a *APIImpl) getAPIKeys(w http.ResponseWriter, r *http.Request) {
+	userID := requestUserID(r)
+
+	result, err := a.keys.ListKeys(userID)
+	if err != nil {
+		a.respondError(w, http.StatusBadRequest, err, fmt.Sprintf("Failed to get API keys: %+v", err))
+		return
+	}
+
+	response := GetAPIKeysResponse{APIKeys: make([]APIKey, 0, len(result.Keys))}
+	for _, key := range result.Keys {
+		response.APIKeys = append(response.APIKeys, newAPIKey(key))
+	}
+	a.respond(w, http.StatusOK, response)
+}
+
+func (a *APIImpl) rotateAPIKey(w http.ResponseWriter, r *http.Request) {
+	userID := requestUserID(r)
+
+	result, err := a.keys.RotateKey(userID, r.PathValue("keyID"))
+	if err != nil {
+		a.respondError(w, http.StatusBadRequest, err, fmt.Sprintf("Failed to rotate API key: %+v", err))
+		return
+	}
+
+	a.respond(w, http.StatusOK, CreateAPIKeyResponse{APIKey: newAPIKey(result.Key), Secret: result.Secret})
+}
+
+func (a *APIImpl) revokeAPIKey(w http.ResponseWriter, r *http.Request) {
+	userID := requestUserID(r)
+
+	key, err := a.keys.RevokeKey(userID, r.PathValue("keyID"))
+	if err != nil {
+		a.respondError(w, http.StatusBadRequest, err, fmt.Sprintf("Failed to revoke API key: %+v", err))
+		return
+	}
+
+	a.respond(w, http.StatusOK, RevokeAPIKeyResponse{APIKey: newAPIKey(*key)})
+}
+
+func newAPIKey(key apikey.Key) APIKey {
+	result := APIKey{
+		KeyID:     key.KeyID,
+		Name:      key.Name,
+		Role:      key.Role,
+		Scopes:    key.Scopes,
+		Prefix:    key.Prefix,
+		CreatedAt: key.CreatedAt.Format(time.RFC3339),
+	}
+	if !key.LastUsedAt.IsZero() {
+		result.LastUsedAt = key.LastUsedAt.Format(time.RFC3339)
+	}
+	if !key.RevokedAt.IsZero() {
+		result.RevokedAt = key.RevokedAt.Format(time.RFC3339)
+	}
+	return result
+}
@@ -2,23 +2,99 @@ package api
 
 import (
 	"context"
+	"errors"
+	"fmt"
 	"net/http"
 	"strings"
+
+	"github.com/alienxp03/teya-ledger/handler/jwt"
+	"github.com/alienxp03/teya-ledger/types"
 )
 
-func AuthMiddleware(next http.Handler) http.Handler {
+// principalKey is the context key of the principal a request is authenticated as
+type principalKey struct{}
+
+// TokenVerifier checks a signed JWT and resolves it to the principal it was issued to
+type TokenVerifier interface {
+	Verify(token string) (*types.Principal, error)
+}
+
+// AuthMiddleware authenticates a request by the credentials in its `Authorization: Bearer <credentials>`
+// header, an API key or, when a TokenVerifier is configured, a signed JWT. The resolved principal is
+// placed in the request context. Missing, malformed, unknown, revoked or expired credentials are
+// rejected with 401.
+func (a *APIImpl) AuthMiddleware(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		authHeader := r.Header.Get("Authorization")
-		if authHeader == "" {
-			http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		credentials, ok := bearerToken(r.Header.Get("Authorization"))
+		if !ok {
+			err := types.NewUnauthorized("a Bearer API key or token is required")
+			a.respondError(w, http.StatusUnauthorized, err, err.Error())
 			return
 		}
 
-		// resolve userID
-		// ideally we should query from the database to get the userID
-		userID := strings.ReplaceAll(authHeader, "USER_TOKEN", "USER_ID")
+		principal, err := a.authenticate(credentials)
+		if err != nil {
+			a.respondError(w, http.StatusInternalServerError, err, "Could not authenticate request")
+			return
+		}
 
-		ctx := context.WithValue(r.Context(), HeaderUserID, userID)
-		next.ServeHTTP(w, r.WithContext(ctx))
+		next.ServeHTTP(w, r.WithContext(WithPrincipal(r.Context(), principal)))
 	})
 }
+
+func (a *APIImpl) authenticate(credentials string) (*types.Principal, error) {
+	if a.tokens == nil || !jwt.IsToken(credentials) {
+		return a.keys.Authenticate(credentials)
+	}
+
+	principal, err := a.tokens.Verify(credentials)
+	if errors.Is(err, jwt.ErrInvalidToken) {
+		return nil, types.NewUnauthorized(err.Error())
+	}
+	return principal, err
+}
+
+// requireScope rejects requests whose principal was not granted scope with 403
+func (a *APIImpl) requireScope(scope string, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		principal, ok := PrincipalFrom(r.Context())
+		if !ok || !principal.HasScope(scope) {
+			err := types.NewForbidden(types.ErrorCodeInsufficientScope, fmt.Sprintf("the %s scope is required", scope))
+			a.respondError(w, http.StatusForbidden, err, err.Error())
+			return
+		}
+
+		next.ServeHTTP(w, r)
+	})
+}
+
+// bearerToken extracts the credentials of an `Authorization: Bearer <credentials>` header
+func bearerToken(header string) (string, bool) {
+	scheme, credentials, ok := strings.Cut(header, " ")
+	if !ok || !strings.EqualFold(scheme, "Bearer") {
+		return "", false
+	}
+
+	credentials = strings.TrimSpace(credentials)
+	return credentials, credentials != ""
+}
+
+// WithPrincipal returns a copy of ctx carrying the principal a request is authenticated as
+func WithPrincipal(ctx context.Context, principal *types.Principal) context.Context {
+	return context.WithValue(ctx, principalKey{}, principal)
+}
+
+// PrincipalFrom returns the principal placed in ctx by AuthMiddleware
+func PrincipalFrom(ctx context.Context) (*types.Principal, bool) {
+	principal, ok := ctx.Value(principalKey{}).(*types.Principal)
+	return principal, ok && principal != nil
+}
+
+// requestUserID is the ID of the user an authenticated request is made by
+func requestUserID(r *http.Request) string {
+	principal, ok := PrincipalFrom(r.Context())
+	if !ok {
+		return ""
+	}
+	return principal.UserID
+}
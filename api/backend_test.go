@@ -0,0 +1,389 @@
+package api
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/alienxp03/teya-ledger/db"
+	"github.com/alienxp03/teya-ledger/handler/apikey"
+	"github.com/alienxp03/teya-ledger/handler/settlement"
+	"github.com/alienxp03/teya-ledger/handler/transaction"
+	"github.com/alienxp03/teya-ledger/types"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// TestStorageBackends exercises the HTTP API against every storage implementation
+func TestStorageBackends(t *testing.T) {
+	backends := map[string]db.DB{
+		"memory": db.NewMemoryStorage(),
+		"sqlite": db.NewSQLiteStorage(filepath.Join(t.TempDir(), "ledger.db")),
+	}
+
+	for name, database := range backends {
+		t.Run(name, func(t *testing.T) {
+			require.NoError(t, database.Initialize())
+			t.Cleanup(func() { database.Close() })
+			require.NoError(t, database.SeedData())
+
+			handler := transaction.New(database.GetStorage())
+			api := New(handler, apikey.New(database.GetStorage()))
+
+			reqBody, _ := json.Marshal(map[string]interface{}{"transactionID": "DEPOSIT_1", "accountNumber": "ACCOUNT_NUMBER_1", "amount": 100, "currency": "MYR", "description": "description"})
+			req, _ := http.NewRequest("POST", "/api/v1/deposits", bytes.NewBuffer(reqBody))
+			req.Header.Set("Authorization", "Bearer USER_TOKEN_1")
+			w := httptest.NewRecorder()
+			api.ServeHTTP(w, req)
+			assert.Equal(t, http.StatusOK, w.Code)
+
+			getBalances := func() []Balance {
+				req, _ := http.NewRequest("GET", "/api/v1/balances?accountNumber=ACCOUNT_NUMBER_1", nil)
+				req.Header.Set("Authorization", "Bearer USER_TOKEN_1")
+				w := httptest.NewRecorder()
+				api.ServeHTTP(w, req)
+				require.Equal(t, http.StatusOK, w.Code)
+
+				var balance GetBalanceResponse
+				require.NoError(t, json.Unmarshal(w.Body.Bytes(), &balance))
+				return balance.Balances
+			}
+
+			// seeded with an opening balance of 1000 and a deposit of 100, the new deposit
+			// is credited once the settlement workers settle it
+			assert.Equal(t, []Balance{{Currency: "MYR", Exponent: 2, Ledger: 1100, Available: 1100}, {Currency: "USD", Exponent: 2, Ledger: 0, Available: 0}}, getBalances())
+
+			pool := settlement.NewPool(database.GetStorage(), handler, settlement.NewFakeSettler(0), settlement.DefaultConfig(), slog.New(slog.DiscardHandler))
+			pool.Start()
+			t.Cleanup(func() { _ = pool.Shutdown(context.Background()) })
+
+			var deposit GetTransactionResponse
+			assert.Eventually(t, func() bool {
+				req, _ := http.NewRequest("GET", "/api/v1/transactions/DEPOSIT_1", nil)
+				req.Header.Set("Authorization", "Bearer USER_TOKEN_1")
+				w := httptest.NewRecorder()
+				api.ServeHTTP(w, req)
+				require.Equal(t, http.StatusOK, w.Code)
+				require.NoError(t, json.Unmarshal(w.Body.Bytes(), &deposit))
+				return deposit.Transaction.Status == "completed"
+			}, 2*time.Second, 20*time.Millisecond)
+			assert.Equal(t, []Balance{{Currency: "MYR", Exponent: 2, Ledger: 1200, Available: 1200}, {Currency: "USD", Exponent: 2, Ledger: 0, Available: 0}}, getBalances())
+
+			statuses := []string{}
+			for _, change := range deposit.Transaction.StatusHistory {
+				statuses = append(statuses, change.To)
+			}
+			assert.Equal(t, []string{"pending", "processing", "completed"}, statuses)
+
+			var serviceErr types.ServiceError
+			reqBody, _ = json.Marshal(map[string]interface{}{"transactionID": "DEPOSIT_2", "accountNumber": "ACCOUNT_NUMBER_1", "amount": 100, "currency": "XYZ", "description": "description"})
+			req, _ = http.NewRequest("POST", "/api/v1/deposits", bytes.NewBuffer(reqBody))
+			req.Header.Set("Authorization", "Bearer USER_TOKEN_1")
+			w = httptest.NewRecorder()
+			api.ServeHTTP(w, req)
+			assert.Equal(t, http.StatusBadRequest, w.Code)
+			require.NoError(t, json.Unmarshal(w.Body.Bytes(), &serviceErr))
+			assert.Equal(t, string(types.ErrorCodeInvalidCurrency), serviceErr.Code)
+
+			reqBody, _ = json.Marshal(map[string]interface{}{"transactionID": "DEPOSIT_2", "accountNumber": "ACCOUNT_NUMBER_2", "amount": 100, "currency": "USD", "description": "description"})
+			req, _ = http.NewRequest("POST", "/api/v1/deposits", bytes.NewBuffer(reqBody))
+			req.Header.Set("Authorization", "Bearer USER_TOKEN_2")
+			w = httptest.NewRecorder()
+			api.ServeHTTP(w, req)
+			assert.Equal(t, http.StatusBadRequest, w.Code)
+			require.NoError(t, json.Unmarshal(w.Body.Bytes(), &serviceErr))
+			assert.Equal(t, string(types.ErrorCodeCurrencyMismatch), serviceErr.Code)
+
+			req, _ = http.NewRequest("GET", "/api/v1/transactions/DEPOSIT_1", nil)
+			req.Header.Set("Authorization", "Bearer USER_TOKEN_2")
+			w = httptest.NewRecorder()
+			api.ServeHTTP(w, req)
+			assert.Equal(t, http.StatusNotFound, w.Code)
+
+			// details sent with a deposit are returned with it and can be filtered on
+			reqBody = []byte(`{"transactionID": "DEPOSIT_3", "accountNumber": "ACCOUNT_NUMBER_1", "amount": 100, "currency": "MYR", "description": "refund",
+				"metadata": {"orderID": "ORDER_1"}, "tags": ["refund", "web"], "externalReference": "EXTERNAL_1",
+				"counterparty": {"name": "Corner Shop", "reference": "MERCHANT_1", "categoryCode": "5411"}}`)
+			req, _ = http.NewRequest("POST", "/api/v1/deposits", bytes.NewBuffer(reqBody))
+			req.Header.Set("Authorization", "Bearer USER_TOKEN_1")
+			w = httptest.NewRecorder()
+			api.ServeHTTP(w, req)
+			require.Equal(t, http.StatusOK, w.Code)
+
+			for _, query := range []string{"tag=web", "metadata%5BorderID%5D=ORDER_1", "externalReference=EXTERNAL_1", "counterpartyName=corner", "categoryCode=5411"} {
+				req, _ = http.NewRequest("GET", "/api/v1/transactions?accountNumber=ACCOUNT_NUMBER_1&"+query, nil)
+				req.Header.Set("Authorization", "Bearer USER_TOKEN_1")
+				w = httptest.NewRecorder()
+				api.ServeHTTP(w, req)
+				require.Equal(t, http.StatusOK, w.Code)
+
+				var found GetTransactionsResponse
+				require.NoError(t, json.Unmarshal(w.Body.Bytes(), &found))
+				require.Len(t, found.Transactions, 1, query)
+				assert.Equal(t, "DEPOSIT_3", found.Transactions[0].TransactionID)
+				assert.Equal(t, map[string]string{"orderID": "ORDER_1"}, found.Transactions[0].Metadata)
+				assert.Equal(t, []string{"refund", "web"}, found.Transactions[0].Tags)
+				assert.Equal(t, &Counterparty{Name: "Corner Shop", Reference: "MERCHANT_1", CategoryCode: "5411"}, found.Transactions[0].Counterparty)
+				assert.Equal(t, "EXTERNAL_1", found.Transactions[0].ExternalReference)
+			}
+
+			reqBody = []byte(`{"transactionID": "DEPOSIT_4", "accountNumber": "ACCOUNT_NUMBER_1", "amount": 100, "currency": "MYR", "description": "refund", "tags": ["web", "web"]}`)
+			req, _ = http.NewRequest("POST", "/api/v1/deposits", bytes.NewBuffer(reqBody))
+			req.Header.Set("Authorization", "Bearer USER_TOKEN_1")
+			w = httptest.NewRecorder()
+			api.ServeHTTP(w, req)
+			assert.Equal(t, http.StatusBadRequest, w.Code)
+			assert.Equal(t, string(types.ErrorInvalidParams), errorCode(t, w))
+		})
+	}
+}
+
+// TestAdminAPI checks the admin routes are only open to operators with the right role and scope
+func TestAdminAPI(t *testing.T) {
+	database := db.NewMemoryStorage()
+	require.NoError(t, database.Initialize())
+	require.NoError(t, database.SeedData())
+
+	handler := transaction.New(database.GetStorage())
+	tokens := fakeVerifier{
+		"admin.without.scope": {UserID: "ADMIN_ID", Role: types.RoleAdmin, Scopes: []string{types.ScopeAdminRead}},
+	}
+	api := New(handler, apikey.New(database.GetStorage()), WithAdministrator(handler), WithJWT(tokens))
+
+	call := func(method, path, authorization, body string) *httptest.ResponseRecorder {
+		req, _ := http.NewRequest(method, path, bytes.NewBufferString(body))
+		req.Header.Set("Authorization", authorization)
+		w := httptest.NewRecorder()
+		api.ServeHTTP(w, req)
+		return w
+	}
+
+	tests := []struct {
+		name          string
+		method, path  string
+		authorization string
+		wantStatus    int
+		wantCode      types.ErrorCode
+	}{
+		{name: "customers cannot search", method: "GET", path: "/api/v1/admin/transactions", authorization: "Bearer USER_TOKEN_1", wantStatus: http.StatusForbidden, wantCode: types.ErrorCodeInsufficientRole},
+		{name: "support can search", method: "GET", path: "/api/v1/admin/transactions", authorization: "Bearer SUPPORT_TOKEN", wantStatus: http.StatusOK},
+		{name: "support can look up any transaction", method: "GET", path: "/api/v1/admin/transactions/OPENING_BALANCE_2", authorization: "Bearer SUPPORT_TOKEN", wantStatus: http.StatusOK},
+		{name: "support cannot freeze", method: "POST", path: "/api/v1/admin/accounts/ACCOUNT_NUMBER_1/freeze", authorization: "Bearer SUPPORT_TOKEN", wantStatus: http.StatusForbidden, wantCode: types.ErrorCodeInsufficientRole},
+		{name: "support cannot read the audit log", method: "GET", path: "/api/v1/admin/audit", authorization: "Bearer SUPPORT_TOKEN", wantStatus: http.StatusForbidden, wantCode: types.ErrorCodeInsufficientRole},
+		{name: "role does not grant scopes", method: "POST", path: "/api/v1/admin/accounts/ACCOUNT_NUMBER_1/freeze", authorization: "Bearer admin.without.scope", wantStatus: http.StatusForbidden, wantCode: types.ErrorCodeInsufficientScope},
+		{name: "unknown transaction", method: "GET", path: "/api/v1/admin/transactions/TRANSACTION_ID_0", authorization: "Bearer ADMIN_TOKEN", wantStatus: http.StatusNotFound, wantCode: types.NotFound},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := call(tt.method, tt.path, tt.authorization, `{"reason": "fraud"}`)
+			assert.Equal(t, tt.wantStatus, w.Code)
+			if tt.wantCode != "" {
+				assert.Equal(t, string(tt.wantCode), errorCode(t, w))
+			}
+		})
+	}
+
+	w := call("GET", "/api/v1/admin/transactions?userID=USER_ID_2", "Bearer SUPPORT_TOKEN", "")
+	require.Equal(t, http.StatusOK, w.Code)
+	var search SearchTransactionsResponse
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &search))
+	require.NotEmpty(t, search.Transactions)
+	for _, transaction := range search.Transactions {
+		assert.Equal(t, "USER_ID_2", transaction.UserID)
+		assert.Equal(t, "ACCOUNT_NUMBER_2", transaction.AccountNumber)
+	}
+
+	// a frozen account rejects withdrawals until it is unfrozen
+	assert.Equal(t, http.StatusBadRequest, call("POST", "/api/v1/admin/accounts/ACCOUNT_NUMBER_1/freeze", "Bearer ADMIN_TOKEN", `{}`).Code)
+	w = call("POST", "/api/v1/admin/accounts/ACCOUNT_NUMBER_9/freeze", "Bearer ADMIN_TOKEN", `{"reason": "fraud"}`)
+	assert.Equal(t, string(types.ErrorCodeInvalidAccountNumber), errorCode(t, w))
+	w = call("POST", "/api/v1/admin/accounts/ACCOUNT_NUMBER_1/freeze", "Bearer ADMIN_TOKEN", `{"reason": "fraud"}`)
+	require.Equal(t, http.StatusOK, w.Code)
+	var frozen ChangeAccountStatusResponse
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &frozen))
+	assert.Equal(t, "frozen", frozen.Account.Status)
+	assert.Equal(t, "USER_ID_1", frozen.Account.UserID)
+
+	withdrawal := `{"transactionID": "WITHDRAWAL_1", "accountNumber": "ACCOUNT_NUMBER_1", "amount": -100, "currency": "MYR", "description": "withdrawal"}`
+	w = call("POST", "/api/v1/withdrawals", "Bearer USER_TOKEN_1", withdrawal)
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+	assert.Equal(t, string(types.ErrorCodeAccountFrozen), errorCode(t, w))
+	require.Equal(t, http.StatusOK, call("POST", "/api/v1/deposits", "Bearer USER_TOKEN_1", `{"transactionID": "DEPOSIT_1", "accountNumber": "ACCOUNT_NUMBER_1", "amount": 100, "currency": "MYR", "description": "deposit"}`).Code)
+
+	require.Equal(t, http.StatusOK, call("POST", "/api/v1/admin/accounts/ACCOUNT_NUMBER_1/unfreeze", "Bearer ADMIN_TOKEN", `{"reason": "cleared"}`).Code)
+	require.Equal(t, http.StatusOK, call("POST", "/api/v1/withdrawals", "Bearer USER_TOKEN_1", withdrawal).Code)
+
+	// admins fix stuck transactions of any user through the state machine
+	assert.Equal(t, http.StatusBadRequest, call("POST", "/api/v1/admin/transactions/DEPOSIT_1/status", "Bearer ADMIN_TOKEN", `{"status": "completed", "reason": "settled manually"}`).Code)
+	w = call("POST", "/api/v1/admin/transactions/DEPOSIT_1/status", "Bearer ADMIN_TOKEN", `{"status": "failed", "reason": "rejected by bank"}`)
+	require.Equal(t, http.StatusOK, w.Code)
+	var overridden GetAccountTransactionResponse
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &overridden))
+	assert.Equal(t, "failed", overridden.Transaction.Status)
+	assert.Equal(t, "rejected by bank", overridden.Transaction.StatusReason)
+
+	w = call("GET", "/api/v1/admin/audit?targetType=account", "Bearer ADMIN_TOKEN", "")
+	require.Equal(t, http.StatusOK, w.Code)
+	var audit GetAuditEntriesResponse
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &audit))
+	require.Len(t, audit.Entries, 2)
+	assert.Equal(t, "account.unfreeze", audit.Entries[0].Action)
+	assert.Equal(t, "ADMIN_ID", audit.Entries[0].OperatorID)
+	assert.Equal(t, "admin", audit.Entries[0].Role)
+	assert.Equal(t, "cleared", audit.Entries[0].Reason)
+}
+
+// TestAccountsAPI opens, lists and closes accounts through the HTTP API
+func TestAccountsAPI(t *testing.T) {
+	database := db.NewMemoryStorage()
+	require.NoError(t, database.Initialize())
+	require.NoError(t, database.SeedData())
+
+	handler := transaction.New(database.GetStorage())
+	api := New(handler, apikey.New(database.GetStorage()))
+
+	call := func(method, path, authorization, body string) *httptest.ResponseRecorder {
+		req, _ := http.NewRequest(method, path, bytes.NewBufferString(body))
+		req.Header.Set("Authorization", authorization)
+		w := httptest.NewRecorder()
+		api.ServeHTTP(w, req)
+		return w
+	}
+
+	w := call("POST", "/api/v1/accounts", "Bearer USER_TOKEN_1", `{"currencies": ["XYZ"]}`)
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+
+	// the body is optional
+	w = call("POST", "/api/v1/accounts", "Bearer USER_TOKEN_1", "")
+	require.Equal(t, http.StatusOK, w.Code)
+	var opened AccountResponse
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &opened))
+	assert.Equal(t, "active", opened.Account.Status)
+	assert.Equal(t, "USER_ID_1", opened.Account.UserID)
+
+	w = call("GET", "/api/v1/accounts", "Bearer USER_TOKEN_1", "")
+	require.Equal(t, http.StatusOK, w.Code)
+	var accounts GetAccountsResponse
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &accounts))
+	require.Len(t, accounts.Accounts, 2)
+	assert.Equal(t, opened.Account.AccountNumber, accounts.Accounts[1].AccountNumber)
+
+	w = call("GET", "/api/v1/accounts/"+opened.Account.AccountNumber, "Bearer USER_TOKEN_2", "")
+	assert.Equal(t, http.StatusNotFound, w.Code)
+
+	// a typo in a generated account number is caught by its check digits
+	number := []byte(opened.Account.AccountNumber)
+	number[len(number)-1] = '0' + (number[len(number)-1]-'0'+1)%10
+	w = call("POST", "/api/v1/deposits", "Bearer USER_TOKEN_1", `{"transactionID": "DEPOSIT_1", "accountNumber": "`+string(number)+`", "amount": 100, "currency": "MYR", "description": "deposit"}`)
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+	assert.Equal(t, string(types.ErrorCodeInvalidAccountNumber), errorCode(t, w))
+	w = call("POST", "/api/v1/withdrawals", "Bearer USER_TOKEN_1", `{"transactionID": "WITHDRAWAL_1", "accountNumber": "`+string(number)+`", "amount": -100, "currency": "MYR", "description": "withdrawal"}`)
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+	assert.Equal(t, string(types.ErrorCodeInvalidAccountNumber), errorCode(t, w))
+	for _, path := range []string{"/api/v1/transfers", "/api/v1/holds", "/api/v1/conversions/quotes"} {
+		w = call("POST", path, "Bearer USER_TOKEN_1", `{"transferID": "TRANSFER_1", "holdID": "HOLD_1", "fromAccountNumber": "ACCOUNT_NUMBER_1", "toAccountNumber": "`+string(number)+`", "accountNumber": "`+string(number)+`", "amount": 100, "currency": "MYR", "from": "MYR", "to": "USD", "description": "typo"}`)
+		assert.Equal(t, http.StatusBadRequest, w.Code, path)
+		assert.Equal(t, string(types.ErrorCodeInvalidAccountNumber), errorCode(t, w), path)
+	}
+	for _, path := range []string{"/api/v1/accounts/" + string(number), "/api/v1/accounts/ACCOUNT_NUMBER_9", "/api/v1/balances?accountNumber=" + string(number), "/api/v1/transactions?accountNumber=TEYB" + opened.Account.AccountNumber[4:]} {
+		w = call("GET", path, "Bearer USER_TOKEN_1", "")
+		assert.Equal(t, http.StatusBadRequest, w.Code, path)
+		assert.Equal(t, string(types.ErrorCodeInvalidAccountNumber), errorCode(t, w), path)
+	}
+
+	w = call("POST", "/api/v1/accounts/ACCOUNT_NUMBER_1/close", "Bearer USER_TOKEN_1", "")
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+	assert.Equal(t, string(types.ErrorCodeBalanceNotZero), errorCode(t, w))
+
+	w = call("POST", "/api/v1/accounts/"+opened.Account.AccountNumber+"/close", "Bearer USER_TOKEN_1", "")
+	require.Equal(t, http.StatusOK, w.Code)
+	w = call("GET", "/api/v1/accounts/"+opened.Account.AccountNumber, "Bearer USER_TOKEN_1", "")
+	require.Equal(t, http.StatusOK, w.Code)
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &opened))
+	assert.Equal(t, "closed", opened.Account.Status)
+
+	w = call("POST", "/api/v1/deposits", "Bearer USER_TOKEN_1", `{"transactionID": "DEPOSIT_1", "accountNumber": "`+opened.Account.AccountNumber+`", "amount": 100, "currency": "MYR", "description": "deposit"}`)
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+	assert.Equal(t, string(types.ErrorCodeAccountClosed), errorCode(t, w))
+}
+
+func TestBalanceHistoryAPI(t *testing.T) {
+	database := db.NewMemoryStorage()
+	require.NoError(t, database.Initialize())
+	require.NoError(t, database.SeedData())
+
+	handler := transaction.New(database.GetStorage())
+	api := New(handler, apikey.New(database.GetStorage()))
+
+	call := func(method, path, authorization, body string) *httptest.ResponseRecorder {
+		req, _ := http.NewRequest(method, path, bytes.NewBufferString(body))
+		req.Header.Set("Authorization", authorization)
+		w := httptest.NewRecorder()
+		api.ServeHTTP(w, req)
+		return w
+	}
+
+	yesterday := time.Now().UTC().Add(-24 * time.Hour).Format(time.RFC3339)
+	w := call("GET", "/api/v1/balances?accountNumber=ACCOUNT_NUMBER_1&asOf="+yesterday, "Bearer USER_TOKEN_1", "")
+	require.Equal(t, http.StatusOK, w.Code)
+	var at GetBalanceAtResponse
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &at))
+	assert.Equal(t, yesterday, at.AsOf)
+	assert.Equal(t, []LedgerBalance{{Currency: "MYR", Exponent: 2, Ledger: 1100}, {Currency: "USD", Exponent: 2, Ledger: 0}}, at.Balances)
+
+	// the seeded transactions are dated when the accounts were opened
+	w = call("GET", "/api/v1/balances?accountNumber=ACCOUNT_NUMBER_1&asOf=2022-01-31T00:00:00Z", "Bearer USER_TOKEN_1", "")
+	require.Equal(t, http.StatusOK, w.Code)
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &at))
+	assert.Equal(t, int64(0), at.Balances[0].Ledger)
+
+	now := time.Now().UTC().Format(time.RFC3339Nano)
+	w = call("GET", "/api/v1/balances?accountNumber=ACCOUNT_NUMBER_1&asOf="+now, "Bearer USER_TOKEN_1", "")
+	require.Equal(t, http.StatusOK, w.Code)
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &at))
+	assert.Equal(t, int64(1100), at.Balances[0].Ledger)
+
+	w = call("GET", "/api/v1/balances?accountNumber=ACCOUNT_NUMBER_1&asOf=yesterday", "Bearer USER_TOKEN_1", "")
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+	assert.Equal(t, string(types.ErrorInvalidParams), errorCode(t, w))
+
+	to := time.Now().UTC().Truncate(24 * time.Hour).Add(24 * time.Hour)
+	from := to.Add(-48 * time.Hour)
+	w = call("GET", "/api/v1/balances/history?accountNumber=ACCOUNT_NUMBER_1&currency=MYR&from="+from.Format(time.RFC3339)+"&to="+to.Format(time.RFC3339), "Bearer USER_TOKEN_1", "")
+	require.Equal(t, http.StatusOK, w.Code)
+	var history GetBalanceHistoryResponse
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &history))
+	assert.Equal(t, "day", history.Interval)
+	require.Len(t, history.Series, 1)
+	assert.Equal(t, 2, history.Series[0].Exponent)
+	assert.Equal(t, []BalancePoint{
+		{From: from.Format(time.RFC3339), To: from.Add(24 * time.Hour).Format(time.RFC3339), Closing: 1100},
+		{From: from.Add(24 * time.Hour).Format(time.RFC3339), To: to.Format(time.RFC3339), Closing: 1100},
+	}, history.Series[0].Points)
+
+	for _, query := range []string{
+		"accountNumber=ACCOUNT_NUMBER_1&from=" + from.Format(time.RFC3339),
+		"accountNumber=ACCOUNT_NUMBER_1&from=2024-01-01&to=" + to.Format(time.RFC3339),
+		"accountNumber=ACCOUNT_NUMBER_1&from=" + from.Format(time.RFC3339) + "&to=" + to.Format(time.RFC3339) + "&interval=week",
+	} {
+		w = call("GET", "/api/v1/balances/history?"+query, "Bearer USER_TOKEN_1", "")
+		assert.Equal(t, http.StatusBadRequest, w.Code, query)
+		assert.Equal(t, string(types.ErrorInvalidParams), errorCode(t, w), query)
+	}
+
+	w = call("GET", "/api/v1/balances/history?accountNumber=ACCOUNT_NUMBER_1&currency=XYZ&from="+from.Format(time.RFC3339)+"&to="+to.Format(time.RFC3339), "Bearer USER_TOKEN_1", "")
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+	assert.Equal(t, string(types.ErrorCodeInvalidCurrency), errorCode(t, w))
+	w = call("GET", "/api/v1/balances/history?accountNumber=TEYA00&from="+from.Format(time.RFC3339)+"&to="+to.Format(time.RFC3339), "Bearer USER_TOKEN_1", "")
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+	assert.Equal(t, string(types.ErrorCodeInvalidAccountNumber), errorCode(t, w))
+
+	w = call("GET", "/api/v1/balances/history?accountNumber=ACCOUNT_NUMBER_1&from="+from.Format(time.RFC3339)+"&to="+to.Format(time.RFC3339), "Bearer USER_TOKEN_2", "")
+	assert.Equal(t, http.StatusNotFound, w.Code)
+}
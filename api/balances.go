@@ -0,0 +1,99 @@
+package api
+
+import (
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/alienxp03/teya-ledger/handler/transaction"
+	"github.com/alienxp03/teya-ledger/types"
+)
+
+// getBalanceAt serves GET /api/v1/balances with an asOf query parameter
+func (a *APIImpl) getBalanceAt(w http.ResponseWriter, r *http.Request) {
+	userID := requestUserID(r)
+
+	query := r.URL.Query()
+	if err := a.checkAccountNumber(query.Get("accountNumber")); err != nil {
+		a.respondError(w, http.StatusBadRequest, err, "")
+		return
+	}
+	asOf, err := time.Parse(time.RFC3339, query.Get("asOf"))
+	if err != nil {
+		a.respondError(w, http.StatusBadRequest, types.NewBadRequest(types.ErrorInvalidParams, "asOf must be an RFC3339 time"), "")
+		return
+	}
+
+	resp, err := a.transactioner.GetBalanceAt(userID, transaction.GetBalanceAtRequest{
+		AccountNumber: query.Get("accountNumber"),
+		AsOf:          asOf,
+	})
+	if err != nil {
+		a.respondError(w, http.StatusBadRequest, err, fmt.Sprintf("Failed to get balance: %+v", err))
+		return
+	}
+
+	result := GetBalanceAtResponse{AsOf: resp.AsOf.Format(time.RFC3339Nano), Balances: []LedgerBalance{}}
+	for _, balance := range resp.Balances {
+		currency, _ := types.LookupCurrency(balance.Currency)
+		result.Balances = append(result.Balances, LedgerBalance{
+			Currency: balance.Currency,
+			Exponent: currency.Exponent,
+			Ledger:   balance.Amount,
+		})
+	}
+
+	a.respond(w, http.StatusOK, result)
+}
+
+func (a *APIImpl) getBalanceHistory(w http.ResponseWriter, r *http.Request) {
+	userID := requestUserID(r)
+
+	query := r.URL.Query()
+	params := GetBalanceHistoryRequest{
+		AccountNumber: query.Get("accountNumber"),
+		Currency:      query.Get("currency"),
+		From:          query.Get("from"),
+		To:            query.Get("to"),
+		Interval:      query.Get("interval"),
+	}
+	if err := a.validate.Struct(params); err != nil {
+		if err := fieldError(err); err != nil {
+			a.respondError(w, http.StatusBadRequest, err, "")
+			return
+		}
+		a.respondError(w, http.StatusBadRequest, types.NewBadRequest(types.ErrorInvalidParams, fmt.Sprintf("invalid query: %v", err)), "")
+		return
+	}
+
+	// Date formats are checked by the validate tags above
+	req := transaction.GetBalanceHistoryRequest{
+		AccountNumber: params.AccountNumber,
+		Currency:      params.Currency,
+		Interval:      params.Interval,
+	}
+	req.From, _ = time.Parse(time.RFC3339, params.From)
+	req.To, _ = time.Parse(time.RFC3339, params.To)
+
+	resp, err := a.transactioner.GetBalanceHistory(userID, req)
+	if err != nil {
+		a.respondError(w, http.StatusBadRequest, err, fmt.Sprintf("Failed to get balance history: %+v", err))
+		return
+	}
+
+	result := GetBalanceHistoryResponse{Interval: resp.Interval, Series: []BalanceSeries{}}
+	for _, series := range resp.Series {
+		currency, _ := types.LookupCurrency(series.Currency)
+		points := []BalancePoint{}
+		for _, point := range series.Points {
+			points = append(points, BalancePoint{
+				From:    point.From.Format(time.RFC3339),
+				To:      point.To.Format(time.RFC3339),
+				Closing: point.Closing.Amount,
+			})
+		}
+		result.Series = append(result.Series, BalanceSeries{Currency: series.Currency, Exponent: currency.Exponent, Points: points})
+	}
+
+	a.respond(w, http.StatusOK, result)
+}
@@ -2,10 +2,14 @@ package api
 
 import (
 	"encoding/json"
+	"errors"
 	"fmt"
 	"net/http"
+	"net/url"
+	"strconv"
 
 	"github.com/alienxp03/teya-ledger/types"
+	"github.com/go-playground/validator/v10"
 )
 
 func (a *APIImpl) respond(w http.ResponseWriter, status int, body any) {
@@ -28,14 +32,92 @@ func (a *APIImpl) respondError(w http.ResponseWriter, status int, err error, msg
 	a.respond(w, status, response{Message: msg})
 }
 
-func parseBody(r *http.Request, dst interface{}) error {
+func (a *APIImpl) parseBody(r *http.Request, dst interface{}) error {
 	if err := json.NewDecoder(r.Body).Decode(dst); err != nil {
 		return fmt.Errorf("invalid body: %w", err)
 	}
 
-	if err := validate.Struct(dst); err != nil {
+	if err := a.validate.Struct(dst); err != nil {
+		if err := fieldError(err); err != nil {
+			return err
+		}
 		return fmt.Errorf("invalid body: %w", err)
 	}
 
 	return nil
 }
+
+// fieldError turns the failure of a tag with its own error code into that error, nil for any other failure
+func fieldError(err error) error {
+	var validationErrors validator.ValidationErrors
+	if !errors.As(err, &validationErrors) {
+		return nil
+	}
+	for _, fieldErr := range validationErrors {
+		switch fieldErr.Tag() {
+		case "currency":
+			return types.NewBadRequest(types.ErrorCodeInvalidCurrency, fmt.Sprintf("unsupported currency %q", fieldErr.Value()))
+		case "account_number":
+			return invalidAccountNumber(fieldErr.Value())
+		}
+	}
+	return nil
+}
+
+// requestMoney builds every amount a request takes, so they all go through the checks of types.CheckedMoney
+func requestMoney(amount int64, currency string) (types.Money, error) {
+	money, err := types.CheckedMoney(amount, currency)
+	if errors.Is(err, types.ErrUnknownCurrency) {
+		return types.Money{}, types.NewBadRequest(types.ErrorCodeInvalidCurrency, err.Error())
+	}
+	if err != nil {
+		return types.Money{}, types.NewBadRequest(types.ErrorCodeInvalidAmount, err.Error())
+	}
+	return money, nil
+}
+
+// optionalMoney is requestMoney for a request whose currency can be left out, leaving it empty for
+// the handler to default
+func optionalMoney(amount int64, currency string) (types.Money, error) {
+	if currency == "" {
+		return types.NewMoney(amount, ""), nil
+	}
+	return requestMoney(amount, currency)
+}
+
+// checkAccountNumber validates an account number taken from the path or the query, which
+// are not validated as part of a struct
+func (a *APIImpl) checkAccountNumber(number string) error {
+	if err := a.accountNumbers.Validate(number); err != nil {
+		return invalidAccountNumber(number)
+	}
+	return nil
+}
+
+func invalidAccountNumber(number any) error {
+	return types.NewBadRequest(types.ErrorCodeInvalidAccountNumber, fmt.Sprintf("invalid account number %q, check it for typos", number))
+}
+
+// nextPageLink builds an RFC 8288 Link header pointing to the page after cursor,
+// keeping every other query parameter of the current request
+func nextPageLink(r *http.Request, cursor string) string {
+	query := r.URL.Query()
+	query.Del("page")
+	query.Set("cursor", cursor)
+
+	next := url.URL{Path: r.URL.Path, RawQuery: query.Encode()}
+	return fmt.Sprintf(`<%s>; rel="next"`, next.String())
+}
+
+// parseOptionalInt parses value as an int64, returning nil when value is empty
+func parseOptionalInt(value string) (*int64, error) {
+	if value == "" {
+		return nil, nil
+	}
+
+	parsed, err := strconv.ParseInt(value, 10, 64)
+	if err != nil {
+		return nil, err
+	}
+	return &parsed, nil
+}
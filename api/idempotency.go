@@ -0,0 +1,166 @@
+package api
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"time"
+
+	"github.com/alienxp03/teya-ledger/storage"
+	"github.com/alienxp03/teya-ledger/types"
+)
+
+const (
+	// HeaderIdempotencyKey lets a client retry a request safely. The first response to
+	// a key is stored and replayed to every retry sent with the same key and body.
+	HeaderIdempotencyKey = "Idempotency-Key"
+	// HeaderIdempotentReplayed marks a response replayed from an earlier request
+	HeaderIdempotentReplayed = "Idempotent-Replayed"
+
+	maxIdempotencyKeyLength = 255
+)
+
+// IdempotencyStore keeps the requests made with an idempotency key and their responses
+type IdempotencyStore interface {
+	CreateIdempotencyKey(key *storage.IdempotencyKey) error
+	GetIdempotencyKey(userID string, key string) (*storage.IdempotencyKey, error)
+	CompleteIdempotencyKey(key *storage.IdempotencyKey) error
+	DeleteIdempotencyKey(userID string, key string) error
+}
+
+// idempotent runs a request sent with an Idempotency-Key header once per key and user,
+// replaying the stored response to its retries. Reusing a key for a different request
+// is rejected with 422, retrying while the first request is still running with 409.
+// Requests without the header, or when idempotency is not configured, go straight to next.
+func (a *APIImpl) idempotent(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		key := r.Header.Get(HeaderIdempotencyKey)
+		if a.idempotencyKeys == nil || key == "" {
+			next.ServeHTTP(w, r)
+			return
+		}
+		if len(key) > maxIdempotencyKeyLength {
+			err := types.NewBadRequest(types.ErrorInvalidParams, fmt.Sprintf("%s must be at most %d characters", HeaderIdempotencyKey, maxIdempotencyKeyLength))
+			a.respondError(w, http.StatusBadRequest, err, err.Error())
+			return
+		}
+
+		userID := requestUserID(r)
+		body, err := io.ReadAll(r.Body)
+		if err != nil {
+			a.respondError(w, http.StatusBadRequest, err, fmt.Sprintf("Invalid body request %+v", err))
+			return
+		}
+		r.Body = io.NopCloser(bytes.NewReader(body))
+
+		record := &storage.IdempotencyKey{
+			UserID:      userID,
+			Key:         key,
+			Fingerprint: fingerprint(r, body),
+			ExpiresAt:   time.Now().Add(a.idempotencyTTL),
+		}
+		err = a.idempotencyKeys.CreateIdempotencyKey(record)
+		if errors.Is(err, storage.ErrIdempotencyKeyExists) {
+			a.replay(w, record)
+			return
+		}
+		if err != nil {
+			a.respondError(w, http.StatusInternalServerError, err, fmt.Sprintf("Could not store idempotency key: %+v", err))
+			return
+		}
+
+		// The key is released unless a response is stored for it, so a request that panicked, whose
+		// client went away or that hit a server error can be retried instead of answering 409 until
+		// the key expires
+		completed := false
+		defer func() {
+			if completed {
+				return
+			}
+			if err := a.idempotencyKeys.DeleteIdempotencyKey(userID, key); err != nil {
+				fmt.Printf("Could not release idempotency key %q: %s\n", key, err.Error())
+			}
+		}()
+
+		recorder := &responseRecorder{ResponseWriter: w, status: http.StatusOK}
+		next.ServeHTTP(recorder, r)
+
+		// A server error says nothing about the request, nor does a response the client never got
+		if recorder.status >= http.StatusInternalServerError || r.Context().Err() != nil {
+			return
+		}
+
+		record.StatusCode = recorder.status
+		record.ContentType = recorder.Header().Get("Content-Type")
+		record.Body = recorder.body.Bytes()
+		if err := a.idempotencyKeys.CompleteIdempotencyKey(record); err != nil {
+			fmt.Printf("Could not store response for idempotency key %q: %s\n", key, err.Error())
+			return
+		}
+		completed = true
+	})
+}
+
+// replay responds to a retry of the request first made with request's key
+func (a *APIImpl) replay(w http.ResponseWriter, request *storage.IdempotencyKey) {
+	stored, err := a.idempotencyKeys.GetIdempotencyKey(request.UserID, request.Key)
+	// Deleted since, after the first request hit a server error
+	if errors.Is(err, storage.ErrNotFound) {
+		err := types.NewConflict(types.ErrorCodeIdempotencyKeyInUse, "the request with this idempotency key failed, retry it")
+		a.respondError(w, http.StatusConflict, err, err.Error())
+		return
+	}
+	if err != nil {
+		a.respondError(w, http.StatusInternalServerError, err, fmt.Sprintf("Could not read idempotency key: %+v", err))
+		return
+	}
+
+	if stored.Fingerprint != request.Fingerprint {
+		err := types.NewUnprocessableEntity(types.ErrorCodeIdempotencyKeyReused, "idempotency key was already used for a different request")
+		a.respondError(w, http.StatusUnprocessableEntity, err, err.Error())
+		return
+	}
+	if stored.StatusCode == 0 {
+		err := types.NewConflict(types.ErrorCodeIdempotencyKeyInUse, "a request with this idempotency key is still in progress")
+		a.respondError(w, http.StatusConflict, err, err.Error())
+		return
+	}
+
+	if stored.ContentType != "" {
+		w.Header().Set("Content-Type", stored.ContentType)
+	}
+	w.Header().Set(HeaderIdempotentReplayed, "true")
+	w.WriteHeader(stored.StatusCode)
+	if _, err := w.Write(stored.Body); err != nil {
+		fmt.Printf("Could not replay response: %s\n", err.Error())
+	}
+}
+
+// fingerprint identifies a request by its method, path and body
+func fingerprint(r *http.Request, body []byte) string {
+	hash := sha256.New()
+	fmt.Fprintf(hash, "%s %s\n", r.Method, r.URL.Path)
+	hash.Write(body)
+	return hex.EncodeToString(hash.Sum(nil))
+}
+
+// responseRecorder passes a response through while keeping a copy of its status and body
+type responseRecorder struct {
+	http.ResponseWriter
+	status int
+	body   bytes.Buffer
+}
+
+func (r *responseRecorder) WriteHeader(status int) {
+	r.status = status
+	r.ResponseWriter.WriteHeader(status)
+}
+
+func (r *responseRecorder) Write(b []byte) (int, error) {
+	r.body.Write(b)
+	return r.ResponseWriter.Write(b)
+}
@@ -1,21 +1,43 @@
 package api
 
+import "github.com/alienxp03/teya-ledger/types"
+
 type GetTransactionsRequest struct {
-	AccountNumber string `json:"accountNumber"`
-	Limit         string `json:"limit"`
-	Page          string `json:"page"`
+	AccountNumber     string `json:"accountNumber" validate:"omitempty,account_number"`
+	Status            string `json:"status" validate:"omitempty,oneof=pending processing completed failed cancelled partially_reversed reversed"`
+	Type              string `json:"type" validate:"omitempty,oneof=deposit withdrawal transfer_in transfer_out conversion_in conversion_out capture reversal"`
+	MinAmount         string `json:"minAmount"`
+	MaxAmount         string `json:"maxAmount"`
+	From              string `json:"from" validate:"omitempty,datetime=2006-01-02T15:04:05Z07:00"`
+	To                string `json:"to" validate:"omitempty,datetime=2006-01-02T15:04:05Z07:00"`
+	Description       string `json:"description"`
+	Tag               string `json:"tag"`
+	ExternalReference string `json:"externalReference"`
+	CounterpartyName  string `json:"counterpartyName"`
+	CategoryCode      string `json:"categoryCode" validate:"omitempty,len=4,numeric"`
+	SortBy            string `json:"sortBy" validate:"omitempty,oneof=createdAt amount"`
+	Order             string `json:"order" validate:"omitempty,oneof=asc desc"`
+	Limit             string `json:"limit"`
+	Page              string `json:"page"`
+	Cursor            string `json:"cursor"`
 }
 
 type GetTransactionsResponse struct {
 	Transactions []Transaction `json:"transactions"`
+	NextCursor   string        `json:"nextCursor,omitempty"`
+	HasMore      bool          `json:"hasMore"`
 }
 
 type CreateDepositRequest struct {
-	TransactionID string `validate:"required"`
-	AccountNumber string `validate:"required"`
-	Amount        int64  `validate:"required,gte=0"`
-	Currency      string `validate:"required,oneof=MYR"`
-	Description   string `validate:"required"`
+	TransactionID     string `validate:"required"`
+	AccountNumber     string `validate:"required,account_number"`
+	Amount            int64  `validate:"required,gte=0"`
+	Currency          string `validate:"required,currency"`
+	Description       string `validate:"required"`
+	Metadata          map[string]string
+	Tags              []string
+	Counterparty      *Counterparty
+	ExternalReference string
 }
 
 type CreateDepositResponse struct {
@@ -23,23 +45,124 @@ type CreateDepositResponse struct {
 }
 
 type CreateWithdrawalRequest struct {
-	TransactionID string `validate:"required"`
-	AccountNumber string `validate:"required"`
-	Amount        int64  `validate:"required,lte=0"`
-	Currency      string `validate:"required,oneof=MYR"`
-	Description   string `validate:"required"`
+	TransactionID     string `validate:"required"`
+	AccountNumber     string `validate:"required,account_number"`
+	Amount            int64  `validate:"required,lte=0"`
+	Currency          string `validate:"required,currency"`
+	Description       string `validate:"required"`
+	Metadata          map[string]string
+	Tags              []string
+	Counterparty      *Counterparty
+	ExternalReference string
 }
 
 type CreateWithdrawalResponse struct {
 	Transaction Transaction `json:"transaction"`
 }
 
+type CreateTransferRequest struct {
+	TransferID        string `validate:"required"`
+	FromAccountNumber string `validate:"required,account_number"`
+	ToAccountNumber   string `validate:"required,account_number"`
+	Amount            int64  `validate:"required,gt=0"`
+	Currency          string `validate:"required,currency"`
+	Description       string `validate:"required"`
+}
+
+type CreateTransferResponse struct {
+	Transfer Transfer `json:"transfer"`
+}
+
+type Transfer struct {
+	TransferID string      `json:"transferID"`
+	Debit      Transaction `json:"debit"`
+	Credit     Transaction `json:"credit"`
+}
+
+type CreateQuoteRequest struct {
+	AccountNumber string `validate:"required,account_number"`
+	From          string `validate:"required,currency"`
+	To            string `validate:"required,currency"`
+	Amount        int64  `validate:"required,gt=0"`
+}
+
+type CreateQuoteResponse struct {
+	Quote Quote `json:"quote"`
+}
+
+// Quote Spread is in basis points
+type Quote struct {
+	QuoteID       string      `json:"quoteID"`
+	AccountNumber string      `json:"accountNumber"`
+	Source        types.Money `json:"source"`
+	Target        types.Money `json:"target"`
+	Rate          string      `json:"rate"`
+	Spread        int64       `json:"spread"`
+	ExpiresAt     string      `json:"expiresAt"`
+}
+
+type CreateConversionRequest struct {
+	ConversionID string `validate:"required"`
+	QuoteID      string `validate:"required"`
+	Description  string `validate:"required"`
+}
+
+type CreateConversionResponse struct {
+	Conversion Conversion `json:"conversion"`
+}
+
+type Conversion struct {
+	ConversionID string      `json:"conversionID"`
+	Debit        Transaction `json:"debit"`
+	Credit       Transaction `json:"credit"`
+}
+
 type GetBalanceRequest struct {
-	AccountNumber string `json:"accountNumber" validate:"required"`
+	AccountNumber string `json:"accountNumber" validate:"required,account_number"`
 }
 
 type GetBalanceResponse struct {
-	Balance Balance `json:"balance"`
+	Balances []Balance `json:"balances"`
+}
+
+// GetBalanceAtResponse holds the ledger balances of an account at a past instant. Holds are not
+// kept for the past, so there is no available balance.
+type GetBalanceAtResponse struct {
+	AsOf     string          `json:"asOf"`
+	Balances []LedgerBalance `json:"balances"`
+}
+
+type LedgerBalance struct {
+	Currency string `json:"currency"`
+	Exponent int    `json:"exponent"`
+	Ledger   int64  `json:"ledger"`
+}
+
+type GetBalanceHistoryRequest struct {
+	AccountNumber string `json:"accountNumber" validate:"required,account_number"`
+	Currency      string `json:"currency" validate:"omitempty,currency"`
+	From          string `json:"from" validate:"required,datetime=2006-01-02T15:04:05Z07:00"`
+	To            string `json:"to" validate:"required,datetime=2006-01-02T15:04:05Z07:00"`
+	Interval      string `json:"interval" validate:"omitempty,oneof=day hour"`
+}
+
+type GetBalanceHistoryResponse struct {
+	Interval string          `json:"interval"`
+	Series   []BalanceSeries `json:"series"`
+}
+
+// BalanceSeries is the closing balance of an account in one currency for each period, oldest first
+type BalanceSeries struct {
+	Currency string         `json:"currency"`
+	Exponent int            `json:"exponent"`
+	Points   []BalancePoint `json:"points"`
+}
+
+// BalancePoint is the ledger balance at the close of the period [from, to)
+type BalancePoint struct {
+	From    string `json:"from"`
+	To      string `json:"to"`
+	Closing int64  `json:"closing"`
 }
 
 type GetTransactionRequest struct {
@@ -50,17 +173,226 @@ type GetTransactionResponse struct {
 	Transaction Transaction `json:"transaction"`
 }
 
+// Balance amounts are in minor units of the currency, Exponent is the number of minor unit digits.
+// Ledger is the posted balance, Available is the ledger balance less the funds reserved by holds.
 type Balance struct {
-	Amount   int64  `json:"amount"`
-	Currency string `json:"currency"`
+	Currency  string `json:"currency"`
+	Exponent  int    `json:"exponent"`
+	Ledger    int64  `json:"ledger"`
+	Available int64  `json:"available"`
 }
 
 type Transaction struct {
+	TransactionID     string            `json:"transactionID"`
+	Type              string            `json:"type"`
+	Status            string            `json:"status"`
+	StatusReason      string            `json:"statusReason,omitempty"`
+	Amount            int64             `json:"amount"`
+	Currency          string            `json:"currency"`
+	Description       string            `json:"description"`
+	TransferID        string            `json:"transferID,omitempty"`
+	ConversionID      string            `json:"conversionID,omitempty"`
+	Rate              string            `json:"rate,omitempty"`
+	Spread            int64             `json:"spread,omitempty"`
+	HoldID            string            `json:"holdID,omitempty"`
+	ReversalOf        string            `json:"reversalOf,omitempty"`
+	Metadata          map[string]string `json:"metadata,omitempty"`
+	Tags              []string          `json:"tags,omitempty"`
+	Counterparty      *Counterparty     `json:"counterparty,omitempty"`
+	ExternalReference string            `json:"externalReference,omitempty"`
+	CreatedAt         string            `json:"createdAt"`
+	UpdatedAt         string            `json:"updatedAt"`
+	// StatusHistory and Reversals are only returned for a single transaction
+	StatusHistory []StatusChange `json:"statusHistory,omitempty"`
+	Reversals     []Reversal     `json:"reversals,omitempty"`
+}
+
+// Counterparty is the merchant or other party on the far side of a transaction
+type Counterparty struct {
+	Name         string `json:"name,omitempty"`
+	Reference    string `json:"reference,omitempty"`
+	CategoryCode string `json:"categoryCode,omitempty"`
+}
+
+// Reversal amounts are signed like the transaction amounts, opposite to the transaction reversed
+type Reversal struct {
 	TransactionID string `json:"transactionID"`
-	Status        string `json:"status"`
 	Amount        int64  `json:"amount"`
 	Currency      string `json:"currency"`
-	Description   string `json:"description"`
 	CreatedAt     string `json:"createdAt"`
-	UpdatedAt     string `json:"updatedAt"`
+}
+
+type StatusChange struct {
+	From      string `json:"from,omitempty"`
+	To        string `json:"to"`
+	Reason    string `json:"reason,omitempty"`
+	CreatedAt string `json:"createdAt"`
+}
+
+type CancelTransactionRequest struct {
+	Reason string `json:"reason"`
+}
+
+type CancelTransactionResponse struct {
+	Transaction Transaction `json:"transaction"`
+}
+
+// CreateReversalRequest reverses whatever is left to reverse when Amount is left out.
+// Amount is positive whichever way the original transaction moved funds.
+type CreateReversalRequest struct {
+	TransactionID string `validate:"required"`
+	Amount        int64  `validate:"gte=0"`
+	Currency      string `validate:"omitempty,currency"`
+	Description   string `validate:"required"`
+}
+
+type CreateReversalResponse struct {
+	Reversal Transaction `json:"reversal"`
+	Original Transaction `json:"original"`
+}
+
+type CreateHoldRequest struct {
+	HoldID        string `validate:"required"`
+	AccountNumber string `validate:"required,account_number"`
+	Amount        int64  `validate:"required,gt=0"`
+	Currency      string `validate:"required,currency"`
+	Description   string `validate:"required"`
+}
+
+type CreateHoldResponse struct {
+	Hold Hold `json:"hold"`
+}
+
+type GetHoldResponse struct {
+	Hold Hold `json:"hold"`
+}
+
+// CaptureHoldRequest captures the full amount held when Amount is left out
+type CaptureHoldRequest struct {
+	TransactionID string `validate:"required"`
+	Amount        int64  `validate:"gte=0"`
+	Currency      string `validate:"omitempty,currency"`
+	Description   string `validate:"required"`
+}
+
+type CaptureHoldResponse struct {
+	Hold        Hold        `json:"hold"`
+	Transaction Transaction `json:"transaction"`
+}
+
+type VoidHoldResponse struct {
+	Hold Hold `json:"hold"`
+}
+
+type Hold struct {
+	HoldID         string `json:"holdID"`
+	AccountNumber  string `json:"accountNumber"`
+	Amount         int64  `json:"amount"`
+	Currency       string `json:"currency"`
+	CapturedAmount int64  `json:"capturedAmount"`
+	Status         string `json:"status"`
+	Description    string `json:"description"`
+	ExpiresAt      string `json:"expiresAt"`
+	CreatedAt      string `json:"createdAt"`
+	UpdatedAt      string `json:"updatedAt"`
+}
+
+// CreateAPIKeyRequest names a new key. Scopes default to the scopes of the caller and can only narrow them.
+type CreateAPIKeyRequest struct {
+	Name   string   `validate:"required,max=100"`
+	Scopes []string `validate:"omitempty,dive,required"`
+}
+
+// CreateAPIKeyResponse holds the only copy of the new key's secret
+type CreateAPIKeyResponse struct {
+	APIKey APIKey `json:"apiKey"`
+	Secret string `json:"secret"`
+}
+
+type GetAPIKeysResponse struct {
+	APIKeys []APIKey `json:"apiKeys"`
+}
+
+type RevokeAPIKeyResponse struct {
+	APIKey APIKey `json:"apiKey"`
+}
+
+type APIKey struct {
+	KeyID      string   `json:"keyID"`
+	Name       string   `json:"name"`
+	Role       string   `json:"role"`
+	Scopes     []string `json:"scopes"`
+	Prefix     string   `json:"prefix"`
+	CreatedAt  string   `json:"createdAt"`
+	LastUsedAt string   `json:"lastUsedAt,omitempty"`
+	RevokedAt  string   `json:"revokedAt,omitempty"`
+}
+
+type SearchTransactionsResponse struct {
+	Transactions []AccountTransaction `json:"transactions"`
+	NextCursor   string               `json:"nextCursor,omitempty"`
+	HasMore      bool                 `json:"hasMore"`
+}
+
+type GetAccountTransactionResponse struct {
+	Transaction AccountTransaction `json:"transaction"`
+}
+
+// AccountTransaction is a transaction of any user, returned by the admin API
+type AccountTransaction struct {
+	Transaction
+	UserID        string `json:"userID"`
+	AccountNumber string `json:"accountNumber"`
+}
+
+// OverrideStatusRequest moves a transaction through the status state machine on behalf of an operator
+type OverrideStatusRequest struct {
+	Status string `validate:"required,oneof=processing completed failed cancelled"`
+	Reason string `validate:"required,max=500"`
+}
+
+type ChangeAccountStatusRequest struct {
+	Reason string `validate:"required,max=500"`
+}
+
+type ChangeAccountStatusResponse struct {
+	Account Account `json:"account"`
+}
+
+// OpenAccountRequest lists the currencies of a new account, MYR when left out
+type OpenAccountRequest struct {
+	Currencies []string `validate:"max=20,dive,currency"`
+}
+
+type AccountResponse struct {
+	Account Account `json:"account"`
+}
+
+type GetAccountsResponse struct {
+	Accounts []Account `json:"accounts"`
+}
+
+type Account struct {
+	AccountNumber string   `json:"accountNumber"`
+	UserID        string   `json:"userID"`
+	Status        string   `json:"status"` // active, frozen or closed
+	Currencies    []string `json:"currencies"`
+	CreatedAt     string   `json:"createdAt"`
+	UpdatedAt     string   `json:"updatedAt"`
+}
+
+type GetAuditEntriesResponse struct {
+	Entries []AuditEntry `json:"entries"`
+}
+
+type AuditEntry struct {
+	ID         int    `json:"id"`
+	OperatorID string `json:"operatorID"`
+	Role       string `json:"role"`
+	Action     string `json:"action"`
+	TargetType string `json:"targetType"`
+	TargetID   string `json:"targetID"`
+	Reason     string `json:"reason"`
+	Details    string `json:"details,omitempty"`
+	CreatedAt  string `json:"createdAt"`
 }
@@ -1,15 +1,18 @@
 package db
 
 import (
+	"errors"
 	"time"
 
 	"github.com/alienxp03/teya-ledger/storage"
+	"github.com/alienxp03/teya-ledger/types"
 )
 
 type DB interface {
 	Initialize() error
 	GetStorage() storage.Storage
 	SeedData() error
+	Close() error
 }
 
 type MemoryDB struct {
@@ -31,46 +34,137 @@ func (m *MemoryDB) GetStorage() storage.Storage {
 }
 
 func (m *MemoryDB) SeedData() error {
+	return seed(m.storage, true)
+}
+
+func (m *MemoryDB) Close() error {
+	return nil
+}
+
+// seed inserts the default accounts, API keys and transactions, and the operator keys SUPPORT_TOKEN and
+// ADMIN_TOKEN when operators is set. Records that already exist are skipped so seeding a persistent
+// database is safe to repeat.
+func seed(s storage.Storage, operators bool) error {
+	openedAt := time.Date(2022, 2, 1, 0, 0, 0, 0, time.UTC)
 	accounts := []storage.Account{
 		{
-			ID:        1,
-			Number:    "ACCOUNT_NUMBER_1",
-			UserID:    "USER_ID_1",
-			Balance:   1000,
-			CreatedAt: time.Date(2022, 2, 1, 0, 0, 0, 0, time.UTC).UTC(),
-			UpdatedAt: time.Date(2025, 2, 1, 0, 0, 2, 0, time.UTC).UTC(),
+			ID:         1,
+			Number:     "ACCOUNT_NUMBER_1",
+			UserID:     "USER_ID_1",
+			Currencies: []string{"MYR", "USD"},
+			CreatedAt:  openedAt,
+			UpdatedAt:  time.Date(2025, 2, 1, 0, 0, 2, 0, time.UTC).UTC(),
 		},
 		{
-			ID:        2,
-			Number:    "ACCOUNT_NUMBER_2",
-			UserID:    "USER_ID_2",
-			Balance:   2000,
-			CreatedAt: time.Date(2022, 2, 1, 0, 0, 0, 0, time.UTC).UTC(),
-			UpdatedAt: time.Date(2025, 2, 1, 0, 0, 2, 0, time.UTC).UTC(),
+			ID:         2,
+			Number:     "ACCOUNT_NUMBER_2",
+			UserID:     "USER_ID_2",
+			Currencies: []string{"MYR", "SGD"},
+			CreatedAt:  openedAt,
+			UpdatedAt:  time.Date(2025, 2, 1, 0, 0, 2, 0, time.UTC).UTC(),
 		},
 	}
 
 	for _, account := range accounts {
-		m.storage.CreateAccount(account)
+		if _, err := s.CreateAccount(account); err != nil && !errors.Is(err, storage.ErrAccountExists) {
+			return err
+		}
 	}
 
-	transactions := []storage.Transaction{
+	// Development keys, so the seeded users can call the API with `Authorization: Bearer USER_TOKEN_1`
+	// and the seeded operators the admin API with SUPPORT_TOKEN and ADMIN_TOKEN
+	apiKeys := []storage.APIKey{
+		{KeyID: "SEED_KEY_1", UserID: "USER_ID_1", Role: types.RoleCustomer, Scopes: types.AllScopes, Name: "Seeded development key", Prefix: "USER_TOKEN_1", Hash: storage.HashAPIKeySecret("USER_TOKEN_1")},
+		{KeyID: "SEED_KEY_2", UserID: "USER_ID_2", Role: types.RoleCustomer, Scopes: types.AllScopes, Name: "Seeded development key", Prefix: "USER_TOKEN_2", Hash: storage.HashAPIKeySecret("USER_TOKEN_2")},
+	}
+	if operators {
+		apiKeys = append(apiKeys,
+			storage.APIKey{KeyID: "SEED_KEY_SUPPORT", UserID: "SUPPORT_ID", Role: types.RoleSupport, Scopes: types.AllScopes, Name: "Seeded support key", Prefix: "SUPPORT_TOKEN", Hash: storage.HashAPIKeySecret("SUPPORT_TOKEN")},
+			storage.APIKey{KeyID: "SEED_KEY_ADMIN", UserID: "ADMIN_ID", Role: types.RoleAdmin, Scopes: types.AllScopes, Name: "Seeded admin key", Prefix: "ADMIN_TOKEN", Hash: storage.HashAPIKeySecret("ADMIN_TOKEN")},
+		)
+	}
+	for _, key := range apiKeys {
+		if err := s.CreateAPIKey(&key); err != nil && !errors.Is(err, storage.ErrAPIKeyExists) {
+			return err
+		}
+	}
+
+	// Opening balances are posted as transactions like any other balance change, so every balance
+	// can be derived from the transaction history. They are dated when the accounts were opened
+	// rather than when seeding ran, so the balance history starts from them.
+	transactions := []struct {
+		transaction    storage.Transaction
+		counterAccount string
+	}{
+		{
+			transaction: storage.Transaction{
+				TransactionID: "OPENING_BALANCE_1",
+				Type:          storage.TransactionTypeDeposit,
+				Status:        storage.TransactionStatusCompleted,
+				Amount:        types.NewMoney(1000, "MYR"),
+				Description:   "Opening balance",
+				UserID:        "USER_ID_1",
+				AccountNumber: "ACCOUNT_NUMBER_1",
+				CreatedAt:     openedAt,
+			},
+			counterAccount: storage.LedgerAccountOpeningBalances,
+		},
+		{
+			transaction: storage.Transaction{
+				TransactionID: "OPENING_BALANCE_2",
+				Type:          storage.TransactionTypeDeposit,
+				Status:        storage.TransactionStatusCompleted,
+				Amount:        types.NewMoney(2000, "MYR"),
+				Description:   "Opening balance",
+				UserID:        "USER_ID_2",
+				AccountNumber: "ACCOUNT_NUMBER_2",
+				CreatedAt:     openedAt,
+			},
+			counterAccount: storage.LedgerAccountOpeningBalances,
+		},
 		{
-			ID:            1,
-			TransactionID: "123456",
-			Status:        "success",
-			Amount:        100,
-			Currency:      "MYR",
-			Description:   "Payment for order 123456",
-			UserID:        "USER_ID_1",
-			AccountNumber: "ACCOUNT_NUMBER_1",
-			CreatedAt:     time.Date(2022, 2, 1, 0, 0, 0, 0, time.UTC),
-			UpdatedAt:     time.Date(2025, 2, 1, 0, 0, 2, 0, time.UTC),
+			transaction: storage.Transaction{
+				ID:            1,
+				TransactionID: "123456",
+				Type:          storage.TransactionTypeDeposit,
+				Status:        storage.TransactionStatusCompleted,
+				Amount:        types.NewMoney(100, "MYR"),
+				Description:   "Payment for order 123456",
+				UserID:        "USER_ID_1",
+				AccountNumber: "ACCOUNT_NUMBER_1",
+				CreatedAt:     openedAt,
+				UpdatedAt:     time.Date(2025, 2, 1, 0, 0, 2, 0, time.UTC),
+			},
+			counterAccount: storage.LedgerAccountCashInTransit,
 		},
 	}
 
-	for _, transaction := range transactions {
-		m.storage.CreateTransaction(&transaction)
+	for _, seeded := range transactions {
+		transaction := seeded.transaction
+		err := s.WithTx(func(tx storage.Storage) error {
+			if err := tx.CreateTransaction(&transaction); err != nil {
+				return err
+			}
+			if err := tx.UpdateBalance(transaction.UserID, transaction.AccountNumber, transaction.Amount); err != nil {
+				return err
+			}
+			credit, err := transaction.Amount.Neg()
+			if err != nil {
+				return err
+			}
+			return tx.PostJournalEntry(&storage.JournalEntry{
+				Reference:   transaction.TransactionID,
+				Description: transaction.Description,
+				CreatedAt:   transaction.CreatedAt,
+				Postings: []storage.Posting{
+					{LedgerAccount: seeded.counterAccount, Amount: transaction.Amount},
+					{LedgerAccount: storage.CustomerLedgerAccount(transaction.UserID, transaction.AccountNumber), Amount: credit},
+				},
+			})
+		})
+		if err != nil && !errors.Is(err, storage.ErrTransactionExists) {
+			return err
+		}
 	}
 
 	return nil
@@ -0,0 +1,42 @@
+package db
+
+import (
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/alienxp03/teya-ledger/storage"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSeedData(t *testing.T) {
+	memory := NewMemoryStorage()
+	require.NoError(t, memory.SeedData())
+	_, err := memory.GetStorage().GetAPIKeyByHash(storage.HashAPIKeySecret("ADMIN_TOKEN"))
+	assert.NoError(t, err)
+
+	// operator keys would outlive the development session in a database file
+	sqlite := NewSQLiteStorage(filepath.Join(t.TempDir(), "ledger.db"))
+	require.NoError(t, sqlite.Initialize())
+	t.Cleanup(func() { sqlite.Close() })
+	require.NoError(t, sqlite.SeedData())
+	require.NoError(t, sqlite.SeedData())
+
+	_, err = sqlite.GetStorage().GetAPIKeyByHash(storage.HashAPIKeySecret("USER_TOKEN_1"))
+	assert.NoError(t, err)
+	for _, secret := range []string{"SUPPORT_TOKEN", "ADMIN_TOKEN"} {
+		_, err = sqlite.GetStorage().GetAPIKeyByHash(storage.HashAPIKeySecret(secret))
+		assert.ErrorIs(t, err, storage.ErrNotFound, secret)
+	}
+
+	// opening balances are dated when the accounts were opened, whenever seeding runs
+	for _, database := range []DB{memory, sqlite} {
+		account, err := database.GetStorage().GetAccount("USER_ID_1", "ACCOUNT_NUMBER_1")
+		require.NoError(t, err)
+		opening, err := database.GetStorage().GetTransaction("USER_ID_1", "OPENING_BALANCE_1")
+		require.NoError(t, err)
+		assert.True(t, opening.CreatedAt.Equal(account.CreatedAt))
+		assert.True(t, opening.CreatedAt.Before(time.Date(2023, 1, 1, 0, 0, 0, 0, time.UTC)))
+	}
+}
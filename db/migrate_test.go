@@ -0,0 +1,296 @@
+package db
+
+import (
+	"path/filepath"
+	"testing"
+	"testing/fstest"
+	"time"
+
+	"github.com/alienxp03/teya-ledger/types"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestLoadMigrations(t *testing.T) {
+	tests := []struct {
+		name    string
+		files   fstest.MapFS
+		want    []int
+		wantErr bool
+	}{
+		{
+			name: "success",
+			files: fstest.MapFS{
+				"m/0002_second.up.sql":   {Data: []byte("SELECT 2")},
+				"m/0002_second.down.sql": {Data: []byte("SELECT 2")},
+				"m/0001_first.up.sql":    {Data: []byte("SELECT 1")},
+				"m/0001_first.down.sql":  {Data: []byte("SELECT 1")},
+			},
+			want: []int{1, 2},
+		},
+		{
+			name: "missing down script",
+			files: fstest.MapFS{
+				"m/0001_first.up.sql": {Data: []byte("SELECT 1")},
+			},
+			wantErr: true,
+		},
+		{
+			name: "version gap",
+			files: fstest.MapFS{
+				"m/0001_first.up.sql":   {Data: []byte("SELECT 1")},
+				"m/0001_first.down.sql": {Data: []byte("SELECT 1")},
+				"m/0003_third.up.sql":   {Data: []byte("SELECT 3")},
+				"m/0003_third.down.sql": {Data: []byte("SELECT 3")},
+			},
+			wantErr: true,
+		},
+		{
+			name: "invalid file name",
+			files: fstest.MapFS{
+				"m/first.sql": {Data: []byte("SELECT 1")},
+			},
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := loadMigrations(tt.files, "m")
+			if tt.wantErr {
+				assert.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+
+			versions := []int{}
+			for _, migration := range got {
+				versions = append(versions, migration.Version)
+				assert.NotEmpty(t, migration.Checksum)
+			}
+			assert.Equal(t, tt.want, versions)
+		})
+	}
+}
+
+func TestMigrator(t *testing.T) {
+	database := NewSQLiteStorage(filepath.Join(t.TempDir(), "ledger.db"))
+	require.NoError(t, database.Open())
+	defer database.Close()
+
+	migrator, err := database.Migrator()
+	require.NoError(t, err)
+
+	applied, err := migrator.Up()
+	require.NoError(t, err)
+	assert.Len(t, applied, len(migrator.migrations))
+
+	applied, err = migrator.Up()
+	require.NoError(t, err)
+	assert.Empty(t, applied)
+
+	statuses, err := migrator.Status()
+	require.NoError(t, err)
+	for _, status := range statuses {
+		assert.True(t, status.Applied)
+	}
+
+	_, err = migrator.DownTo(len(migrator.migrations) + 1)
+	assert.ErrorIs(t, err, ErrUnknownMigration)
+
+	rolledBack, err := migrator.DownTo(0)
+	require.NoError(t, err)
+	assert.Len(t, rolledBack, len(migrator.migrations))
+
+	statuses, err = migrator.Status()
+	require.NoError(t, err)
+	for _, status := range statuses {
+		assert.False(t, status.Applied)
+	}
+
+	_, err = migrator.Up()
+	require.NoError(t, err)
+
+	_, err = database.conn.Exec(`UPDATE schema_migrations SET checksum = 'tampered' WHERE version = 1`)
+	require.NoError(t, err)
+
+	_, err = migrator.Status()
+	assert.ErrorIs(t, err, ErrChecksumMismatch)
+}
+
+func TestJournalBackfill(t *testing.T) {
+	database := NewSQLiteStorage(filepath.Join(t.TempDir(), "ledger.db"))
+	require.NoError(t, database.Open())
+	defer database.Close()
+
+	migrator, err := database.Migrator()
+	require.NoError(t, err)
+
+	_, err = migrator.Up()
+	require.NoError(t, err)
+	_, err = migrator.DownTo(4)
+	require.NoError(t, err)
+
+	_, err = database.conn.Exec(
+		`INSERT INTO transactions (transaction_id, type, status, amount, currency, user_id, description, account_number, created_at, updated_at)
+		VALUES ('123456', 'deposit', 'success', 100, 'MYR', 'USER_ID_1', 'deposit', 'ACCOUNT_NUMBER_1', ?, ?)`,
+		time.Now().UTC(), time.Now().UTC(),
+	)
+	require.NoError(t, err)
+
+	_, err = migrator.Up()
+	require.NoError(t, err)
+
+	trialBalance, err := database.GetStorage().GetTrialBalance()
+	require.NoError(t, err)
+	require.Len(t, trialBalance, 2)
+	assert.Equal(t, "customer:USER_ID_1:ACCOUNT_NUMBER_1", trialBalance[0].LedgerAccount)
+	assert.Equal(t, types.NewMoney(-100, "MYR"), trialBalance[0].Balance)
+	assert.Equal(t, "system:cash_in_transit", trialBalance[1].LedgerAccount)
+	assert.Equal(t, types.NewMoney(100, "MYR"), trialBalance[1].Balance)
+}
+
+func TestStatusHistoryBackfill(t *testing.T) {
+	database := NewSQLiteStorage(filepath.Join(t.TempDir(), "ledger.db"))
+	require.NoError(t, database.Open())
+	defer database.Close()
+
+	migrator, err := database.Migrator()
+	require.NoError(t, err)
+
+	_, err = migrator.Up()
+	require.NoError(t, err)
+	_, err = migrator.DownTo(8)
+	require.NoError(t, err)
+
+	for _, row := range []struct {
+		transactionID string
+		status        string
+		amount        int64
+	}{
+		{transactionID: "LEGACY", status: "success", amount: 100},
+		{transactionID: "PENDING_DEPOSIT", status: "pending", amount: 100},
+		{transactionID: "PENDING_WITHDRAWAL", status: "pending", amount: -50},
+	} {
+		_, err = database.conn.Exec(
+			`INSERT INTO transactions (transaction_id, type, status, amount, currency, user_id, description, account_number, created_at, updated_at)
+			VALUES (?, 'deposit', ?, ?, 'MYR', 'USER_ID_1', 'legacy', 'ACCOUNT_NUMBER_1', ?, ?)`,
+			row.transactionID, row.status, row.amount, time.Now().UTC(), time.Now().UTC(),
+		)
+		require.NoError(t, err)
+	}
+
+	_, err = migrator.Up()
+	require.NoError(t, err)
+
+	// legacy balances were updated on creation, so the derived balance still counts every row
+	derived, err := database.GetStorage().DeriveBalance("USER_ID_1", "ACCOUNT_NUMBER_1", "MYR")
+	require.NoError(t, err)
+	assert.Equal(t, types.NewMoney(150, "MYR"), derived)
+
+	for transactionID, want := range map[string]string{"LEGACY": "completed", "PENDING_DEPOSIT": "completed", "PENDING_WITHDRAWAL": "pending"} {
+		transaction, err := database.GetStorage().GetTransaction("USER_ID_1", transactionID)
+		require.NoError(t, err)
+		assert.Equal(t, want, transaction.Status, transactionID)
+
+		changes, err := database.GetStorage().GetStatusChanges(transactionID)
+		require.NoError(t, err)
+		require.Len(t, changes, 1)
+		assert.Equal(t, want, changes[0].To)
+	}
+}
+
+func TestSettlementQueueBackfill(t *testing.T) {
+	database := NewSQLiteStorage(filepath.Join(t.TempDir(), "ledger.db"))
+	require.NoError(t, database.Open())
+	defer database.Close()
+
+	migrator, err := database.Migrator()
+	require.NoError(t, err)
+
+	_, err = migrator.Up()
+	require.NoError(t, err)
+	_, err = migrator.DownTo(9)
+	require.NoError(t, err)
+
+	for _, row := range []struct {
+		transactionID string
+		kind          string
+		status        string
+	}{
+		{transactionID: "PENDING", kind: "deposit", status: "pending"},
+		{transactionID: "PROCESSING", kind: "withdrawal", status: "processing"},
+		{transactionID: "COMPLETED", kind: "deposit", status: "completed"},
+		{transactionID: "TRANSFER", kind: "transfer_out", status: "pending"},
+	} {
+		_, err = database.conn.Exec(
+			`INSERT INTO transactions (transaction_id, type, status, amount, currency, user_id, description, account_number, created_at, updated_at)
+			VALUES (?, ?, ?, 100, 'MYR', 'USER_ID_1', 'legacy', 'ACCOUNT_NUMBER_1', ?, ?)`,
+			row.transactionID, row.kind, row.status, time.Now().UTC(), time.Now().UTC(),
+		)
+		require.NoError(t, err)
+	}
+
+	_, err = migrator.Up()
+	require.NoError(t, err)
+
+	// unsettled deposits and withdrawals are queued, due straight away
+	jobs, err := database.GetStorage().ClaimSettlements(time.Now(), time.Minute, 10)
+	require.NoError(t, err)
+	transactionIDs := []string{}
+	for _, job := range jobs {
+		assert.Equal(t, "USER_ID_1", job.UserID)
+		transactionIDs = append(transactionIDs, job.TransactionID)
+	}
+	assert.ElementsMatch(t, []string{"PENDING", "PROCESSING"}, transactionIDs)
+}
+
+func TestReversalBackfill(t *testing.T) {
+	database := NewSQLiteStorage(filepath.Join(t.TempDir(), "ledger.db"))
+	require.NoError(t, database.Open())
+	defer database.Close()
+
+	migrator, err := database.Migrator()
+	require.NoError(t, err)
+
+	_, err = migrator.Up()
+	require.NoError(t, err)
+	_, err = migrator.DownTo(11)
+	require.NoError(t, err)
+
+	for _, row := range []struct {
+		transactionID string
+		status        string
+		amount        int64
+	}{
+		{transactionID: "COMPLETED", status: "completed", amount: 300},
+		{transactionID: "REVERSED", status: "reversed", amount: 100},
+	} {
+		_, err = database.conn.Exec(
+			`INSERT INTO transactions (transaction_id, type, status, amount, currency, user_id, description, account_number, created_at, updated_at)
+			VALUES (?, 'deposit', ?, ?, 'MYR', 'USER_ID_1', 'legacy', 'ACCOUNT_NUMBER_1', ?, ?)`,
+			row.transactionID, row.status, row.amount, time.Now().UTC(), time.Now().UTC(),
+		)
+		require.NoError(t, err)
+	}
+
+	_, err = migrator.Up()
+	require.NoError(t, err)
+
+	// a legacy reversal no longer counted, it now gets a compensating transaction
+	s := database.GetStorage()
+	reversals, err := s.GetReversals("USER_ID_1", "REVERSED")
+	require.NoError(t, err)
+	require.Len(t, reversals, 1)
+	assert.Equal(t, "reversal", reversals[0].Type)
+	assert.Equal(t, "completed", reversals[0].Status)
+	assert.Equal(t, types.NewMoney(-100, "MYR"), reversals[0].Amount)
+
+	changes, err := s.GetStatusChanges(reversals[0].TransactionID)
+	require.NoError(t, err)
+	assert.Len(t, changes, 1)
+
+	balance, err := s.DeriveBalance("USER_ID_1", "ACCOUNT_NUMBER_1", "MYR")
+	require.NoError(t, err)
+	assert.Equal(t, types.NewMoney(300, "MYR"), balance)
+}
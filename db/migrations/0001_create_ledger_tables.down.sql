@@ -0,0 +1,4 @@
+DROP TABLE IF EXISTS balances;
+DROP INDEX IF EXISTS idx_transactions_account;
+DROP TABLE IF EXISTS transactions;
+DROP TABLE IF EXISTS accounts;
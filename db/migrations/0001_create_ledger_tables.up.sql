@@ -0,0 +1,32 @@
+CREATE TABLE IF NOT EXISTS accounts (
+	id INTEGER PRIMARY KEY AUTOINCREMENT,
+	number TEXT NOT NULL,
+	user_id TEXT NOT NULL,
+	balance INTEGER NOT NULL DEFAULT 0,
+	created_at TIMESTAMP NOT NULL,
+	updated_at TIMESTAMP NOT NULL,
+	UNIQUE (user_id, number)
+);
+
+CREATE TABLE IF NOT EXISTS transactions (
+	id INTEGER PRIMARY KEY AUTOINCREMENT,
+	transaction_id TEXT NOT NULL UNIQUE,
+	status TEXT NOT NULL,
+	amount INTEGER NOT NULL,
+	currency TEXT NOT NULL,
+	user_id TEXT NOT NULL,
+	description TEXT NOT NULL,
+	account_number TEXT NOT NULL,
+	created_at TIMESTAMP NOT NULL,
+	updated_at TIMESTAMP NOT NULL
+);
+
+CREATE INDEX IF NOT EXISTS idx_transactions_account ON transactions (user_id, account_number);
+
+CREATE TABLE IF NOT EXISTS balances (
+	user_id TEXT NOT NULL,
+	account_number TEXT NOT NULL,
+	amount INTEGER NOT NULL DEFAULT 0,
+	currency TEXT NOT NULL,
+	PRIMARY KEY (user_id, account_number)
+);
@@ -0,0 +1,3 @@
+DROP INDEX IF EXISTS idx_transactions_account_created;
+
+CREATE INDEX IF NOT EXISTS idx_transactions_account ON transactions (user_id, account_number);
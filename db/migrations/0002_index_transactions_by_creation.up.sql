@@ -0,0 +1,3 @@
+DROP INDEX IF EXISTS idx_transactions_account;
+
+CREATE INDEX idx_transactions_account_created ON transactions (user_id, account_number, created_at, id);
@@ -0,0 +1,3 @@
+DROP INDEX IF EXISTS idx_transactions_account_amount;
+
+ALTER TABLE transactions DROP COLUMN type;
@@ -0,0 +1,5 @@
+ALTER TABLE transactions ADD COLUMN type TEXT NOT NULL DEFAULT '';
+
+UPDATE transactions SET type = CASE WHEN amount < 0 THEN 'withdrawal' ELSE 'deposit' END;
+
+CREATE INDEX idx_transactions_account_amount ON transactions (user_id, account_number, amount, id);
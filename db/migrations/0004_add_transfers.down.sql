@@ -0,0 +1,5 @@
+DROP INDEX IF EXISTS idx_accounts_number;
+
+DROP INDEX IF EXISTS idx_transactions_transfer;
+
+ALTER TABLE transactions DROP COLUMN transfer_id;
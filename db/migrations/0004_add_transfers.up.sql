@@ -0,0 +1,5 @@
+ALTER TABLE transactions ADD COLUMN transfer_id TEXT NOT NULL DEFAULT '';
+
+CREATE INDEX idx_transactions_transfer ON transactions (transfer_id) WHERE transfer_id != '';
+
+CREATE INDEX idx_accounts_number ON accounts (number);
@@ -0,0 +1,29 @@
+CREATE TABLE journal_entries (
+	id INTEGER PRIMARY KEY AUTOINCREMENT,
+	reference TEXT NOT NULL,
+	description TEXT NOT NULL,
+	created_at TIMESTAMP NOT NULL
+);
+
+CREATE INDEX idx_journal_entries_reference ON journal_entries (reference);
+
+CREATE TABLE postings (
+	id INTEGER PRIMARY KEY AUTOINCREMENT,
+	entry_id INTEGER NOT NULL REFERENCES journal_entries (id) ON DELETE CASCADE,
+	ledger_account TEXT NOT NULL,
+	amount INTEGER NOT NULL CHECK (amount != 0),
+	currency TEXT NOT NULL
+);
+
+CREATE INDEX idx_postings_entry ON postings (entry_id);
+CREATE INDEX idx_postings_ledger_account ON postings (ledger_account, currency);
+
+-- Journal every existing transaction against cash in transit. The two legs of a
+-- transfer cancel out on cash in transit, so the backfilled entries stay balanced.
+INSERT INTO journal_entries (id, reference, description, created_at)
+SELECT id, transaction_id, description, created_at FROM transactions WHERE amount != 0;
+
+INSERT INTO postings (entry_id, ledger_account, amount, currency)
+SELECT id, 'system:cash_in_transit', amount, currency FROM transactions WHERE amount != 0
+UNION ALL
+SELECT id, 'customer:' || user_id || ':' || account_number, -amount, currency FROM transactions WHERE amount != 0;
@@ -0,0 +1 @@
+ALTER TABLE accounts ADD COLUMN balance INTEGER NOT NULL DEFAULT 0;
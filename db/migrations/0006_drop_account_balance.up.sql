@@ -0,0 +1,6 @@
+-- Every account gets its balance row when it is created instead of on first read
+INSERT OR IGNORE INTO balances (user_id, account_number, amount, currency)
+SELECT user_id, number, 0, 'MYR' FROM accounts;
+
+-- accounts.balance was never kept in sync with balances.amount
+ALTER TABLE accounts DROP COLUMN balance;
@@ -0,0 +1,15 @@
+-- Only the MYR balance of each account survives the rollback
+CREATE TABLE balances_per_account (
+	user_id TEXT NOT NULL,
+	account_number TEXT NOT NULL,
+	amount INTEGER NOT NULL DEFAULT 0,
+	currency TEXT NOT NULL,
+	PRIMARY KEY (user_id, account_number)
+);
+
+INSERT INTO balances_per_account (user_id, account_number, amount, currency)
+SELECT user_id, account_number, amount, currency FROM balances WHERE currency = 'MYR';
+
+DROP TABLE balances;
+
+ALTER TABLE balances_per_account RENAME TO balances;
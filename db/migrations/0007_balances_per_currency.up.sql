@@ -0,0 +1,15 @@
+-- An account holds one balance per currency, so the currency joins the primary key
+CREATE TABLE balances_per_currency (
+	user_id TEXT NOT NULL,
+	account_number TEXT NOT NULL,
+	amount INTEGER NOT NULL DEFAULT 0,
+	currency TEXT NOT NULL,
+	PRIMARY KEY (user_id, account_number, currency)
+);
+
+INSERT INTO balances_per_currency (user_id, account_number, amount, currency)
+SELECT user_id, account_number, amount, currency FROM balances;
+
+DROP TABLE balances;
+
+ALTER TABLE balances_per_currency RENAME TO balances;
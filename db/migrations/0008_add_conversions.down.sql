@@ -0,0 +1,5 @@
+DROP INDEX IF EXISTS idx_transactions_conversion;
+
+ALTER TABLE transactions DROP COLUMN spread;
+ALTER TABLE transactions DROP COLUMN rate;
+ALTER TABLE transactions DROP COLUMN conversion_id;
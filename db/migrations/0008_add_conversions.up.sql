@@ -0,0 +1,5 @@
+ALTER TABLE transactions ADD COLUMN conversion_id TEXT NOT NULL DEFAULT '';
+ALTER TABLE transactions ADD COLUMN rate TEXT NOT NULL DEFAULT '';
+ALTER TABLE transactions ADD COLUMN spread INTEGER NOT NULL DEFAULT 0;
+
+CREATE INDEX idx_transactions_conversion ON transactions (conversion_id) WHERE conversion_id != '';
@@ -0,0 +1,4 @@
+DROP INDEX IF EXISTS idx_transaction_status_changes_transaction;
+DROP TABLE IF EXISTS transaction_status_changes;
+
+ALTER TABLE transactions DROP COLUMN status_reason;
@@ -0,0 +1,21 @@
+ALTER TABLE transactions ADD COLUMN status_reason TEXT NOT NULL DEFAULT '';
+
+-- Balances used to be updated when a transaction was created, whatever its status.
+-- Credits now only count once completed, so settle the ones still pending, together
+-- with the legacy "success" status, to keep derived balances matching stored ones.
+UPDATE transactions SET status = 'completed' WHERE status = 'success' OR (status = 'pending' AND amount >= 0);
+
+CREATE TABLE transaction_status_changes (
+	id INTEGER PRIMARY KEY AUTOINCREMENT,
+	transaction_id TEXT NOT NULL,
+	from_status TEXT NOT NULL,
+	to_status TEXT NOT NULL,
+	reason TEXT NOT NULL,
+	created_at TIMESTAMP NOT NULL
+);
+
+CREATE INDEX idx_transaction_status_changes_transaction ON transaction_status_changes (transaction_id, id);
+
+-- Only the current status of existing transactions is known, record it as of their creation
+INSERT INTO transaction_status_changes (transaction_id, from_status, to_status, reason, created_at)
+SELECT transaction_id, '', status, '', created_at FROM transactions;
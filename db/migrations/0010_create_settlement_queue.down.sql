@@ -0,0 +1,2 @@
+DROP INDEX IF EXISTS idx_settlements_next_attempt;
+DROP TABLE IF EXISTS settlements;
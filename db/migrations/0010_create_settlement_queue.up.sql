@@ -0,0 +1,16 @@
+CREATE TABLE settlements (
+	transaction_id TEXT PRIMARY KEY,
+	user_id TEXT NOT NULL,
+	attempts INTEGER NOT NULL DEFAULT 0,
+	next_attempt_at TIMESTAMP NOT NULL,
+	claimed_until TIMESTAMP,
+	last_error TEXT NOT NULL DEFAULT '',
+	created_at TIMESTAMP NOT NULL
+);
+
+CREATE INDEX idx_settlements_next_attempt ON settlements (next_attempt_at);
+
+-- Deposits and withdrawals used to be settled in memory, queue the ones left unsettled
+INSERT INTO settlements (transaction_id, user_id, next_attempt_at, created_at)
+SELECT transaction_id, user_id, created_at, created_at FROM transactions
+WHERE status IN ('pending', 'processing') AND type IN ('deposit', 'withdrawal');
@@ -0,0 +1,5 @@
+ALTER TABLE transactions DROP COLUMN hold_id;
+
+DROP INDEX IF EXISTS idx_holds_expiry;
+DROP INDEX IF EXISTS idx_holds_account;
+DROP TABLE IF EXISTS holds;
@@ -0,0 +1,19 @@
+CREATE TABLE holds (
+	id INTEGER PRIMARY KEY AUTOINCREMENT,
+	hold_id TEXT NOT NULL UNIQUE,
+	user_id TEXT NOT NULL,
+	account_number TEXT NOT NULL,
+	amount INTEGER NOT NULL,
+	currency TEXT NOT NULL,
+	captured_amount INTEGER NOT NULL DEFAULT 0,
+	status TEXT NOT NULL,
+	description TEXT NOT NULL,
+	expires_at TIMESTAMP NOT NULL,
+	created_at TIMESTAMP NOT NULL,
+	updated_at TIMESTAMP NOT NULL
+);
+
+CREATE INDEX idx_holds_account ON holds (user_id, account_number, currency, status);
+CREATE INDEX idx_holds_expiry ON holds (status, expires_at);
+
+ALTER TABLE transactions ADD COLUMN hold_id TEXT NOT NULL DEFAULT '';
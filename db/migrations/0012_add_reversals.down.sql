@@ -0,0 +1,7 @@
+-- Only completed transactions counted towards the balance before, and reversals stay
+-- posted, so reversed transactions go back to completed
+UPDATE transactions SET status = 'completed' WHERE status IN ('partially_reversed', 'reversed');
+
+DROP INDEX IF EXISTS idx_transactions_reversal;
+
+ALTER TABLE transactions DROP COLUMN reversal_of;
@@ -0,0 +1,13 @@
+ALTER TABLE transactions ADD COLUMN reversal_of TEXT NOT NULL DEFAULT '';
+
+CREATE INDEX idx_transactions_reversal ON transactions (reversal_of) WHERE reversal_of != '';
+
+-- A reversed transaction used to be taken out of the balance. Reversals are now compensating
+-- transactions next to an original that keeps counting, so record one for every transaction
+-- reversed so far to keep derived balances matching stored ones.
+INSERT INTO transactions (transaction_id, type, status, amount, currency, user_id, description, account_number, reversal_of, created_at, updated_at)
+SELECT transaction_id || '-REVERSAL', 'reversal', 'completed', -amount, currency, user_id, 'Reversal of ' || transaction_id, account_number, transaction_id, updated_at, updated_at
+FROM transactions WHERE status = 'reversed';
+
+INSERT INTO transaction_status_changes (transaction_id, from_status, to_status, reason, created_at)
+SELECT transaction_id, '', status, '', created_at FROM transactions WHERE type = 'reversal';
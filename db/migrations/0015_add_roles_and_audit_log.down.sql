@@ -0,0 +1,7 @@
+DROP INDEX IF EXISTS idx_audit_entries_target;
+DROP INDEX IF EXISTS idx_audit_entries_operator;
+DROP TABLE IF EXISTS audit_entries;
+
+ALTER TABLE accounts DROP COLUMN status;
+
+ALTER TABLE api_keys DROP COLUMN role;
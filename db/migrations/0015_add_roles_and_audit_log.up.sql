@@ -0,0 +1,18 @@
+ALTER TABLE api_keys ADD COLUMN role TEXT NOT NULL DEFAULT 'customer';
+
+ALTER TABLE accounts ADD COLUMN status TEXT NOT NULL DEFAULT 'active';
+
+CREATE TABLE audit_entries (
+	id INTEGER PRIMARY KEY AUTOINCREMENT,
+	operator_id TEXT NOT NULL,
+	role TEXT NOT NULL,
+	action TEXT NOT NULL,
+	target_type TEXT NOT NULL,
+	target_id TEXT NOT NULL,
+	reason TEXT NOT NULL,
+	details TEXT NOT NULL DEFAULT '',
+	created_at TIMESTAMP NOT NULL
+);
+
+CREATE INDEX idx_audit_entries_operator ON audit_entries (operator_id);
+CREATE INDEX idx_audit_entries_target ON audit_entries (target_type, target_id);
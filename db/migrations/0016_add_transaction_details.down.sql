@@ -0,0 +1,8 @@
+DROP INDEX IF EXISTS idx_transactions_external_reference;
+
+ALTER TABLE transactions DROP COLUMN external_reference;
+ALTER TABLE transactions DROP COLUMN counterparty_category_code;
+ALTER TABLE transactions DROP COLUMN counterparty_reference;
+ALTER TABLE transactions DROP COLUMN counterparty_name;
+ALTER TABLE transactions DROP COLUMN tags;
+ALTER TABLE transactions DROP COLUMN metadata;
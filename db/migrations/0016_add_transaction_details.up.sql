@@ -0,0 +1,9 @@
+-- metadata is a JSON object of strings and tags a JSON array of strings
+ALTER TABLE transactions ADD COLUMN metadata TEXT NOT NULL DEFAULT '{}';
+ALTER TABLE transactions ADD COLUMN tags TEXT NOT NULL DEFAULT '[]';
+ALTER TABLE transactions ADD COLUMN counterparty_name TEXT NOT NULL DEFAULT '';
+ALTER TABLE transactions ADD COLUMN counterparty_reference TEXT NOT NULL DEFAULT '';
+ALTER TABLE transactions ADD COLUMN counterparty_category_code TEXT NOT NULL DEFAULT '';
+ALTER TABLE transactions ADD COLUMN external_reference TEXT NOT NULL DEFAULT '';
+
+CREATE INDEX idx_transactions_external_reference ON transactions (user_id, external_reference) WHERE external_reference != '';
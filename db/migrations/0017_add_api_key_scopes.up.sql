@@ -0,0 +1,5 @@
+-- scopes is a JSON array of the scopes granted to the key. Keys created before it
+-- authenticated with every scope and keep them.
+ALTER TABLE api_keys ADD COLUMN scopes TEXT NOT NULL DEFAULT '[]';
+
+UPDATE api_keys SET scopes = '["balances:read","transactions:read","transactions:write","deposits:write","withdrawals:write","transfers:write","conversions:write","holds:read","holds:write","api-keys:read","api-keys:write","accounts:read","accounts:write","admin:read","admin:write"]';
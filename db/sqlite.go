@@ -0,0 +1,91 @@
+package db
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+
+	"github.com/alienxp03/teya-ledger/storage"
+	_ "modernc.org/sqlite"
+)
+
+// SQLiteDB persists the ledger in an SQLite database file
+type SQLiteDB struct {
+	path    string
+	conn    *sql.DB
+	storage storage.Storage
+}
+
+func NewSQLiteStorage(path string) *SQLiteDB {
+	return &SQLiteDB{
+		path: path,
+	}
+}
+
+// Initialize opens the database file and applies every pending migration
+func (s *SQLiteDB) Initialize() error {
+	if err := s.Open(); err != nil {
+		return err
+	}
+
+	migrator, err := s.Migrator()
+	if err != nil {
+		return err
+	}
+	if _, err := migrator.Up(); err != nil {
+		return fmt.Errorf("migrate database: %w", err)
+	}
+
+	return nil
+}
+
+// Open connects to the database file without touching the schema
+func (s *SQLiteDB) Open() error {
+	if s.conn != nil {
+		return nil
+	}
+
+	dsn := fmt.Sprintf("file:%s?_pragma=foreign_keys(1)&_pragma=busy_timeout(5000)&_pragma=journal_mode(WAL)&_time_format=sqlite", s.path)
+	conn, err := sql.Open("sqlite", dsn)
+	if err != nil {
+		return fmt.Errorf("open database: %w", err)
+	}
+
+	// SQLite allows a single writer at a time. Funnelling every query through one
+	// connection avoids SQLITE_BUSY errors between concurrent requests.
+	conn.SetMaxOpenConns(1)
+
+	if err := conn.Ping(); err != nil {
+		conn.Close()
+		return fmt.Errorf("connect database: %w", err)
+	}
+
+	s.conn = conn
+	s.storage = storage.NewSQLiteStorage(conn)
+	return nil
+}
+
+// Migrator returns a migration runner for the opened database
+func (s *SQLiteDB) Migrator() (*Migrator, error) {
+	if s.conn == nil {
+		return nil, errors.New("database is not open")
+	}
+	return NewMigrator(s.conn)
+}
+
+func (s *SQLiteDB) GetStorage() storage.Storage {
+	return s.storage
+}
+
+// SeedData seeds the development accounts and customer keys. The operator keys are left out as they
+// would outlive the development session in the database file, create them with the create-key command.
+func (s *SQLiteDB) SeedData() error {
+	return seed(s.storage, false)
+}
+
+func (s *SQLiteDB) Close() error {
+	if s.conn == nil {
+		return nil
+	}
+	return s.conn.Close()
+}
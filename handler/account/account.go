@@ -0,0 +1,173 @@
+package account
+
+import (
+	"crypto/rand"
+	"errors"
+	"fmt"
+	"math/big"
+	"slices"
+	"strings"
+)
+
+// Algorithm computes the check digits of an account number
+type Algorithm string
+
+const (
+	// Mod97 puts two ISO 7064 MOD 97-10 check digits after the prefix, like an IBAN does
+	Mod97 Algorithm = "mod97"
+	// Luhn appends a single Luhn check digit to the number
+	Luhn Algorithm = "luhn"
+)
+
+const (
+	maxPrefixLength = 8
+	minDigits       = 6
+	maxDigits       = 20
+)
+
+// ErrInvalidAccountNumber is returned for every account number that fails validation, wrapped with the reason
+var ErrInvalidAccountNumber = errors.New("invalid account number")
+
+// Config is the format of the account numbers of a Scheme
+type Config struct {
+	// Prefix starts every account number, up to 8 upper case letters
+	Prefix    string
+	Algorithm Algorithm
+	// Digits is the length of the random part of an account number, check digits excluded
+	Digits int
+	// Legacy lists the account numbers issued before the scheme, which are accepted without check digits
+	Legacy []string
+}
+
+// DefaultConfig accepts the seeded development accounts, which predate check digits
+func DefaultConfig() Config {
+	return Config{
+		Prefix:    "TEYA",
+		Algorithm: Mod97,
+		Digits:    10,
+		Legacy:    []string{"ACCOUNT_NUMBER_1", "ACCOUNT_NUMBER_2"},
+	}
+}
+
+// Scheme generates account numbers with check digits and validates them, catching most typos
+// before an account is looked up
+type Scheme struct {
+	config Config
+}
+
+// NewScheme checks config and returns the scheme generating account numbers in its format
+func NewScheme(config Config) (*Scheme, error) {
+	if len(config.Prefix) > maxPrefixLength || strings.IndexFunc(config.Prefix, func(r rune) bool { return r < 'A' || r > 'Z' }) >= 0 {
+		return nil, fmt.Errorf("account number prefix %q must be up to %d upper case letters", config.Prefix, maxPrefixLength)
+	}
+	if config.Algorithm != Mod97 && config.Algorithm != Luhn {
+		return nil, fmt.Errorf("unknown check digit algorithm %q, expected %s or %s", config.Algorithm, Mod97, Luhn)
+	}
+	if config.Digits < minDigits || config.Digits > maxDigits {
+		return nil, fmt.Errorf("account numbers must have between %d and %d digits, got %d", minDigits, maxDigits, config.Digits)
+	}
+	return &Scheme{config: config}, nil
+}
+
+// Default is the scheme of DefaultConfig
+func Default() *Scheme {
+	return &Scheme{config: DefaultConfig()}
+}
+
+// Generate draws a random account number with its check digits
+func (s *Scheme) Generate() (string, error) {
+	limit := new(big.Int).Exp(big.NewInt(10), big.NewInt(int64(s.config.Digits)), nil)
+	n, err := rand.Int(rand.Reader, limit)
+	if err != nil {
+		return "", err
+	}
+	body := fmt.Sprintf("%0*d", s.config.Digits, n)
+
+	if s.config.Algorithm == Luhn {
+		return s.config.Prefix + body + luhnDigit(body), nil
+	}
+	return s.config.Prefix + mod97Digits(s.config.Prefix, body) + body, nil
+}
+
+// Matches reports whether number looks like an account number of the scheme, its prefix followed by
+// digits only, whether or not its check digits are right
+func (s *Scheme) Matches(number string) bool {
+	rest, ok := strings.CutPrefix(number, s.config.Prefix)
+	return ok && rest != "" && isDigits(rest)
+}
+
+// Validate checks number has the prefix and length of the scheme and the right check digits,
+// unless it is one of the legacy numbers of the scheme
+func (s *Scheme) Validate(number string) error {
+	if slices.Contains(s.config.Legacy, number) {
+		return nil
+	}
+	if !s.Matches(number) {
+		return fmt.Errorf("%w: %q is not %s followed by digits", ErrInvalidAccountNumber, number, s.config.Prefix)
+	}
+
+	rest := strings.TrimPrefix(number, s.config.Prefix)
+	checkDigits := 2
+	if s.config.Algorithm == Luhn {
+		checkDigits = 1
+	}
+	if len(rest) != s.config.Digits+checkDigits {
+		return fmt.Errorf("%w: %q must have %d digits", ErrInvalidAccountNumber, number, s.config.Digits+checkDigits)
+	}
+
+	var check, body string
+	if s.config.Algorithm == Luhn {
+		body, check = rest[:s.config.Digits], rest[s.config.Digits:]
+		if luhnDigit(body) != check {
+			return fmt.Errorf("%w: %q has the wrong check digit", ErrInvalidAccountNumber, number)
+		}
+		return nil
+	}
+
+	check, body = rest[:2], rest[2:]
+	if mod97(body+s.config.Prefix+check) != 1 {
+		return fmt.Errorf("%w: %q has the wrong check digits", ErrInvalidAccountNumber, number)
+	}
+	return nil
+}
+
+// mod97Digits computes the two check digits of an IBAN style number, which moves the prefix and
+// check digits to the end and turns letters into the numbers 10 to 35
+func mod97Digits(prefix, body string) string {
+	return fmt.Sprintf("%02d", 98-mod97(body+prefix+"00"))
+}
+
+// mod97 is the remainder of s divided by 97, reading each letter of s as the two digits 10 to 35
+func mod97(s string) int {
+	remainder := 0
+	for _, r := range s {
+		if r >= 'A' && r <= 'Z' {
+			remainder = (remainder*100 + int(r-'A') + 10) % 97
+			continue
+		}
+		remainder = (remainder*10 + int(r-'0')) % 97
+	}
+	return remainder
+}
+
+// luhnDigit computes the Luhn check digit appended to digits
+func luhnDigit(digits string) string {
+	sum := 0
+	// Every second digit from the right is doubled, starting with the rightmost one as the check
+	// digit will be placed after it
+	for i := len(digits) - 1; i >= 0; i -= 2 {
+		d := int(digits[i]-'0') * 2
+		if d > 9 {
+			d -= 9
+		}
+		sum += d
+		if i > 0 {
+			sum += int(digits[i-1] - '0')
+		}
+	}
+	return fmt.Sprintf("%d", (10-sum%10)%10)
+}
+
+func isDigits(s string) bool {
+	return strings.IndexFunc(s, func(r rune) bool { return r < '0' || r > '9' }) < 0
+}
@@ -0,0 +1,81 @@
+package account
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestValidate(t *testing.T) {
+	iban, err := NewScheme(Config{Prefix: "DE", Algorithm: Mod97, Digits: 18})
+	require.NoError(t, err)
+	luhn, err := NewScheme(Config{Algorithm: Luhn, Digits: 10})
+	require.NoError(t, err)
+
+	tests := []struct {
+		name    string
+		scheme  *Scheme
+		number  string
+		wantErr bool
+	}{
+		{name: "iban", scheme: iban, number: "DE89370400440532013000"},
+		{name: "iban with a wrong digit", scheme: iban, number: "DE89370400440532013001", wantErr: true},
+		{name: "iban with swapped digits", scheme: iban, number: "DE89374000440532013000", wantErr: true},
+		{name: "iban too short", scheme: iban, number: "DE8937040044053201300", wantErr: true},
+		{name: "iban with another prefix", scheme: iban, number: "GB89370400440532013000", wantErr: true},
+		{name: "luhn", scheme: luhn, number: "79927398713"},
+		{name: "luhn with a wrong check digit", scheme: luhn, number: "79927398710", wantErr: true},
+		{name: "luhn with letters", scheme: luhn, number: "7992739871X", wantErr: true},
+		{name: "legacy number", scheme: Default(), number: "ACCOUNT_NUMBER_1"},
+		{name: "unknown number without the prefix", scheme: Default(), number: "ACCOUNT_NUMBER_3", wantErr: true},
+		{name: "typo in the prefix", scheme: Default(), number: "TEYB710123456789", wantErr: true},
+		{name: "digits only", scheme: Default(), number: "710123456789", wantErr: true},
+		{name: "default", scheme: Default(), number: "TEYA710123456789"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.scheme.Validate(tt.number)
+			if tt.wantErr {
+				assert.ErrorIs(t, err, ErrInvalidAccountNumber)
+				return
+			}
+			assert.NoError(t, err)
+		})
+	}
+}
+
+func TestGenerate(t *testing.T) {
+	for _, algorithm := range []Algorithm{Mod97, Luhn} {
+		scheme, err := NewScheme(Config{Prefix: "TL", Algorithm: algorithm, Digits: 8})
+		require.NoError(t, err)
+
+		for range 50 {
+			number, err := scheme.Generate()
+			require.NoError(t, err)
+			assert.True(t, scheme.Matches(number), number)
+			assert.NoError(t, scheme.Validate(number))
+		}
+	}
+
+	// numbers in another format do not match, legacy ones included
+	assert.False(t, Default().Matches("ACCOUNT_NUMBER_1"))
+	assert.False(t, Default().Matches("TEYA"))
+	assert.True(t, Default().Matches("TEYA123"))
+}
+
+func TestNewScheme(t *testing.T) {
+	for _, config := range []Config{
+		{Prefix: "teya", Algorithm: Mod97, Digits: 10},
+		{Prefix: "TEYA_", Algorithm: Mod97, Digits: 10},
+		{Prefix: "TEYALEDGER", Algorithm: Mod97, Digits: 10},
+		{Prefix: "TEYA", Algorithm: "crc", Digits: 10},
+		{Prefix: "TEYA", Algorithm: Luhn, Digits: 2},
+	} {
+		_, err := NewScheme(config)
+		assert.Error(t, err, config)
+	}
+
+	_, err := NewScheme(DefaultConfig())
+	assert.NoError(t, err)
+}
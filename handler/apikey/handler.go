@@ -0,0 +1,198 @@
+package apikey
+
+import (
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"slices"
+	"time"
+
+	"github.com/alienxp03/teya-ledger/storage"
+	"github.com/alienxp03/teya-ledger/types"
+)
+
+const (
+	// secretPrefix marks a string as a ledger API key secret, e.g. for secret scanners
+	secretPrefix = "tlk_"
+	// displayedPrefixLength is how much of a secret is kept to tell keys apart
+	displayedPrefixLength = len(secretPrefix) + 8
+)
+
+// KeyManager defines the interface for API key operations
+type KeyManager interface {
+	// Authenticate resolves the secret of an active key to its principal, granted the role
+	// and scopes of the key, recording that the key was used. Unknown and revoked keys fail with a 401 service error.
+	Authenticate(secret string) (*types.Principal, error)
+	CreateKey(userID string, req CreateKeyRequest) (*CreateKeyResponse, error)
+	ListKeys(userID string) (*ListKeysResponse, error)
+	RotateKey(userID string, keyID string) (*CreateKeyResponse, error)
+	RevokeKey(userID string, keyID string) (*Key, error)
+}
+
+type KeyHandler struct {
+	storage storage.Storage
+}
+
+func New(storage storage.Storage) *KeyHandler {
+	return &KeyHandler{storage: storage}
+}
+
+func (k KeyHandler) Authenticate(secret string) (*types.Principal, error) {
+	key, err := k.storage.GetAPIKeyByHash(storage.HashAPIKeySecret(secret))
+	if errors.Is(err, storage.ErrNotFound) {
+		return nil, types.NewUnauthorized("invalid API key")
+	}
+	if err != nil {
+		return nil, err
+	}
+	if key.Revoked() {
+		return nil, types.NewUnauthorized("API key was revoked")
+	}
+
+	if err := k.storage.TouchAPIKey(key.KeyID, time.Now()); err != nil {
+		return nil, err
+	}
+
+	return &types.Principal{UserID: key.UserID, Role: key.Role, KeyID: key.KeyID, Scopes: slices.Clone(key.Scopes)}, nil
+}
+
+// CreateKey issues a new key for the user. The secret is only returned here.
+func (k KeyHandler) CreateKey(userID string, req CreateKeyRequest) (*CreateKeyResponse, error) {
+	var result *CreateKeyResponse
+	err := k.storage.WithTx(func(tx storage.Storage) error {
+		var err error
+		result, err = createKey(tx, userID, req.Role, req.Scopes, req.Name)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return result, nil
+}
+
+func (k KeyHandler) ListKeys(userID string) (*ListKeysResponse, error) {
+	keys, err := k.storage.ListAPIKeys(userID)
+	if err != nil {
+		return nil, err
+	}
+
+	result := &ListKeysResponse{Keys: make([]Key, 0, len(keys))}
+	for _, key := range keys {
+		result.Keys = append(result.Keys, newKey(key))
+	}
+	return result, nil
+}
+
+// RotateKey replaces an active key with a new one of the same name, role and scopes, revoking the old key
+// in the same unit of work
+func (k KeyHandler) RotateKey(userID string, keyID string) (*CreateKeyResponse, error) {
+	var result *CreateKeyResponse
+	err := k.storage.WithTx(func(tx storage.Storage) error {
+		key, err := tx.GetAPIKey(userID, keyID)
+		if err != nil {
+			return types.NewNotFound("API key not found")
+		}
+		if err := revokeKey(tx, userID, keyID); err != nil {
+			return err
+		}
+
+		result, err = createKey(tx, userID, key.Role, key.Scopes, key.Name)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return result, nil
+}
+
+// RevokeKey revokes a key of the user, after which it no longer authenticates requests
+func (k KeyHandler) RevokeKey(userID string, keyID string) (*Key, error) {
+	if err := revokeKey(k.storage, userID, keyID); err != nil {
+		return nil, err
+	}
+
+	key, err := k.storage.GetAPIKey(userID, keyID)
+	if err != nil {
+		return nil, err
+	}
+	result := newKey(key)
+	return &result, nil
+}
+
+func createKey(tx storage.Storage, userID string, role string, scopes []string, name string) (*CreateKeyResponse, error) {
+	if role == "" {
+		role = types.RoleCustomer
+	}
+	if !types.ValidRole(role) {
+		return nil, types.NewBadRequest(types.ErrorInvalidParams, fmt.Sprintf("unknown role %q", role))
+	}
+	if len(scopes) == 0 {
+		return nil, types.NewBadRequest(types.ErrorInvalidParams, "a key needs at least one scope")
+	}
+	for _, scope := range scopes {
+		if !types.ValidScope(scope) {
+			return nil, types.NewBadRequest(types.ErrorInvalidParams, fmt.Sprintf("unknown scope %q", scope))
+		}
+	}
+
+	keyID, err := randomString(8, hex.EncodeToString)
+	if err != nil {
+		return nil, err
+	}
+	secret, err := randomString(32, base64.RawURLEncoding.EncodeToString)
+	if err != nil {
+		return nil, err
+	}
+	secret = secretPrefix + secret
+
+	key := &storage.APIKey{
+		KeyID:  "key_" + keyID,
+		UserID: userID,
+		Role:   role,
+		Scopes: slices.Compact(slices.Sorted(slices.Values(scopes))),
+		Name:   name,
+		Prefix: secret[:displayedPrefixLength],
+		Hash:   storage.HashAPIKeySecret(secret),
+	}
+	if err := tx.CreateAPIKey(key); err != nil {
+		return nil, err
+	}
+
+	return &CreateKeyResponse{Key: newKey(key), Secret: secret}, nil
+}
+
+func revokeKey(tx storage.Storage, userID string, keyID string) error {
+	err := tx.RevokeAPIKey(userID, keyID, time.Now())
+	if errors.Is(err, storage.ErrNotFound) {
+		return types.NewNotFound("API key not found")
+	}
+	if errors.Is(err, storage.ErrStatusConflict) {
+		return types.NewBadRequest(types.ErrorCodeInvalidStatusTransition, fmt.Sprintf("API key %s was already revoked", keyID))
+	}
+	return err
+}
+
+func randomString(size int, encode func([]byte) string) (string, error) {
+	b := make([]byte, size)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return encode(b), nil
+}
+
+func newKey(key *storage.APIKey) Key {
+	return Key{
+		KeyID:      key.KeyID,
+		Name:       key.Name,
+		Role:       key.Role,
+		Scopes:     key.Scopes,
+		Prefix:     key.Prefix,
+		CreatedAt:  key.CreatedAt,
+		LastUsedAt: key.LastUsedAt,
+		RevokedAt:  key.RevokedAt,
+	}
+}
@@ -0,0 +1,109 @@
+package apikey
+
+import (
+	"net/http"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/alienxp03/teya-ledger/db"
+	"github.com/alienxp03/teya-ledger/types"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestKeyHandler(t *testing.T) {
+	backends := map[string]db.DB{
+		"memory": db.NewMemoryStorage(),
+		"sqlite": db.NewSQLiteStorage(filepath.Join(t.TempDir(), "ledger.db")),
+	}
+
+	for name, database := range backends {
+		t.Run(name, func(t *testing.T) {
+			require.NoError(t, database.Initialize())
+			t.Cleanup(func() { database.Close() })
+			require.NoError(t, database.SeedData())
+
+			s := database.GetStorage()
+			keys := New(s)
+
+			// the seeded development keys
+			principal, err := keys.Authenticate("USER_TOKEN_2")
+			require.NoError(t, err)
+			assert.Equal(t, &types.Principal{UserID: "USER_ID_2", Role: types.RoleCustomer, KeyID: "SEED_KEY_2", Scopes: types.AllScopes}, principal)
+
+			created, err := keys.CreateKey("USER_ID_1", CreateKeyRequest{Name: "ci", Scopes: []string{types.ScopeDepositsWrite, types.ScopeBalancesRead}})
+			require.NoError(t, err)
+			assert.True(t, strings.HasPrefix(created.Secret, secretPrefix))
+			assert.Equal(t, created.Secret[:displayedPrefixLength], created.Key.Prefix)
+
+			// only the hash of the secret is stored
+			stored, err := s.GetAPIKey("USER_ID_1", created.Key.KeyID)
+			require.NoError(t, err)
+			assert.NotContains(t, stored.Hash, created.Secret)
+			assert.True(t, stored.LastUsedAt.IsZero())
+
+			principal, err = keys.Authenticate(created.Secret)
+			require.NoError(t, err)
+			assert.Equal(t, &types.Principal{UserID: "USER_ID_1", Role: types.RoleCustomer, KeyID: created.Key.KeyID, Scopes: []string{types.ScopeBalancesRead, types.ScopeDepositsWrite}}, principal)
+			stored, err = s.GetAPIKey("USER_ID_1", created.Key.KeyID)
+			require.NoError(t, err)
+			assert.False(t, stored.LastUsedAt.IsZero())
+
+			_, err = keys.Authenticate("tlk_unknown")
+			assertStatus(t, http.StatusUnauthorized, err)
+
+			rotated, err := keys.RotateKey("USER_ID_1", created.Key.KeyID)
+			require.NoError(t, err)
+			assert.Equal(t, "ci", rotated.Key.Name)
+			assert.Equal(t, created.Key.Scopes, rotated.Key.Scopes)
+			assert.NotEqual(t, created.Secret, rotated.Secret)
+			_, err = keys.Authenticate(created.Secret)
+			assertStatus(t, http.StatusUnauthorized, err)
+			_, err = keys.Authenticate(rotated.Secret)
+			require.NoError(t, err)
+
+			// a revoked key cannot be rotated, nothing is created when rotation fails
+			_, err = keys.RotateKey("USER_ID_1", created.Key.KeyID)
+			assertStatus(t, http.StatusBadRequest, err)
+			_, err = keys.RotateKey("USER_ID_2", rotated.Key.KeyID)
+			assertStatus(t, http.StatusNotFound, err)
+
+			// operator keys keep their role when rotated
+			operator, err := keys.CreateKey("ADMIN_ID", CreateKeyRequest{Name: "ops", Role: types.RoleAdmin, Scopes: types.AllScopes})
+			require.NoError(t, err)
+			operator, err = keys.RotateKey("ADMIN_ID", operator.Key.KeyID)
+			require.NoError(t, err)
+			principal, err = keys.Authenticate(operator.Secret)
+			require.NoError(t, err)
+			assert.Equal(t, types.RoleAdmin, principal.Role)
+			_, err = keys.CreateKey("ADMIN_ID", CreateKeyRequest{Name: "ops", Role: "superuser", Scopes: types.AllScopes})
+			assertStatus(t, http.StatusBadRequest, err)
+			_, err = keys.CreateKey("ADMIN_ID", CreateKeyRequest{Name: "ops", Role: types.RoleAdmin})
+			assertStatus(t, http.StatusBadRequest, err)
+			_, err = keys.CreateKey("ADMIN_ID", CreateKeyRequest{Name: "ops", Role: types.RoleAdmin, Scopes: []string{"everything"}})
+			assertStatus(t, http.StatusBadRequest, err)
+
+			revoked, err := keys.RevokeKey("USER_ID_1", rotated.Key.KeyID)
+			require.NoError(t, err)
+			assert.False(t, revoked.RevokedAt.IsZero())
+			_, err = keys.Authenticate(rotated.Secret)
+			assertStatus(t, http.StatusUnauthorized, err)
+
+			list, err := keys.ListKeys("USER_ID_1")
+			require.NoError(t, err)
+			require.Len(t, list.Keys, 3)
+			assert.Equal(t, "SEED_KEY_1", list.Keys[0].KeyID)
+			for _, key := range list.Keys[1:] {
+				assert.False(t, key.RevokedAt.IsZero())
+			}
+		})
+	}
+}
+
+func assertStatus(t *testing.T, status int, err error) {
+	t.Helper()
+	var serviceErr *types.ServiceError
+	require.ErrorAs(t, err, &serviceErr)
+	assert.Equal(t, status, serviceErr.Status)
+}
@@ -0,0 +1,32 @@
+package apikey
+
+import "time"
+
+// CreateKeyRequest names a new key. The key authenticates requests with Role, types.RoleCustomer when empty,
+// and Scopes, of which there must be at least one.
+type CreateKeyRequest struct {
+	Name   string
+	Role   string
+	Scopes []string
+}
+
+// CreateKeyResponse holds the secret of a new key, which is not stored and cannot be shown again
+type CreateKeyResponse struct {
+	Key    Key
+	Secret string
+}
+
+type ListKeysResponse struct {
+	Keys []Key
+}
+
+type Key struct {
+	KeyID      string
+	Name       string
+	Role       string
+	Scopes     []string
+	Prefix     string
+	CreatedAt  time.Time
+	LastUsedAt time.Time
+	RevokedAt  time.Time
+}
@@ -0,0 +1,81 @@
+package fx
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/big"
+	"os"
+	"strings"
+)
+
+var (
+	ErrRateNotFound  = errors.New("rate not found")
+	ErrQuoteNotFound = errors.New("quote not found")
+	ErrQuoteExpired  = errors.New("quote expired")
+)
+
+// RateProvider supplies mid-market exchange rates
+type RateProvider interface {
+	// Rate returns how many units of to one unit of from is worth.
+	// It returns ErrRateNotFound when the pair is not quoted.
+	Rate(from string, to string) (*big.Rat, error)
+}
+
+// StaticProvider serves a fixed set of rates, e.g. for local development.
+// A pair that is only quoted in one direction is also served inverted.
+type StaticProvider struct {
+	rates map[string]*big.Rat
+}
+
+// NewStaticProvider builds a provider from decimal rates keyed by "FROM/TO", e.g. {"USD/MYR": "4.7150"}
+func NewStaticProvider(rates map[string]string) (*StaticProvider, error) {
+	provider := &StaticProvider{rates: map[string]*big.Rat{}}
+	for pair, value := range rates {
+		from, to, ok := strings.Cut(pair, "/")
+		if !ok || from == "" || to == "" || from == to {
+			return nil, fmt.Errorf("invalid currency pair %q", pair)
+		}
+
+		rate, ok := new(big.Rat).SetString(value)
+		if !ok || rate.Sign() <= 0 {
+			return nil, fmt.Errorf("invalid rate %q for %s", value, pair)
+		}
+		provider.rates[pair] = rate
+	}
+
+	return provider, nil
+}
+
+// LoadStaticProvider reads a JSON object of decimal rates keyed by "FROM/TO" from path
+func LoadStaticProvider(path string) (*StaticProvider, error) {
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	rates := map[string]string{}
+	if err := json.Unmarshal(content, &rates); err != nil {
+		return nil, fmt.Errorf("parse rates %s: %w", path, err)
+	}
+
+	return NewStaticProvider(rates)
+}
+
+func (p *StaticProvider) Rate(from string, to string) (*big.Rat, error) {
+	if rate, ok := p.rates[from+"/"+to]; ok {
+		return new(big.Rat).Set(rate), nil
+	}
+	if rate, ok := p.rates[to+"/"+from]; ok {
+		return new(big.Rat).Inv(rate), nil
+	}
+
+	return nil, fmt.Errorf("%w: %s/%s", ErrRateNotFound, from, to)
+}
+
+// FormatRate renders a rate as a decimal with up to ten fractional digits
+func FormatRate(rate *big.Rat) string {
+	formatted := rate.FloatString(10)
+	formatted = strings.TrimRight(formatted, "0")
+	return strings.TrimSuffix(formatted, ".")
+}
@@ -0,0 +1,134 @@
+package fx
+
+import (
+	"math/big"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/alienxp03/teya-ledger/types"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestStaticProvider(t *testing.T) {
+	provider, err := NewStaticProvider(map[string]string{"USD/MYR": "4.7150", "USD/JPY": "151.20"})
+	require.NoError(t, err)
+
+	tests := []struct {
+		name    string
+		from    string
+		to      string
+		want    string
+		wantErr error
+	}{
+		{name: "quoted pair", from: "USD", to: "MYR", want: "4.715"},
+		{name: "inverted pair", from: "JPY", to: "USD", want: "0.0066137566"},
+		{name: "missing pair", from: "MYR", to: "JPY", wantErr: ErrRateNotFound},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rate, err := provider.Rate(tt.from, tt.to)
+			if tt.wantErr != nil {
+				assert.ErrorIs(t, err, tt.wantErr)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tt.want, FormatRate(rate))
+		})
+	}
+
+	for _, rates := range []map[string]string{
+		{"USDMYR": "4.7150"},
+		{"USD/USD": "1"},
+		{"USD/MYR": "-4.7150"},
+		{"USD/MYR": "four"},
+	} {
+		_, err := NewStaticProvider(rates)
+		assert.Error(t, err, rates)
+	}
+}
+
+func TestLoadStaticProvider(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "rates.json")
+	require.NoError(t, os.WriteFile(path, []byte(`{"USD/MYR": "4.7150"}`), 0o600))
+
+	provider, err := LoadStaticProvider(path)
+	require.NoError(t, err)
+	rate, err := provider.Rate("MYR", "USD")
+	require.NoError(t, err)
+	assert.Equal(t, "0.2120890774", FormatRate(rate))
+
+	_, err = LoadStaticProvider(filepath.Join(t.TempDir(), "missing.json"))
+	assert.Error(t, err)
+}
+
+func TestConvert(t *testing.T) {
+	tests := []struct {
+		name   string
+		amount int64
+		from   string
+		to     string
+		rate   string
+		spread int64
+		want   int64
+	}{
+		{name: "same exponent", amount: 10000, from: "USD", to: "MYR", rate: "4.7150", want: 47150},
+		{name: "spread", amount: 10000, from: "USD", to: "MYR", rate: "4.7150", spread: 50, want: 46914},
+		{name: "rounds down", amount: 943, from: "MYR", to: "USD", rate: "0.2120890774", spread: 50, want: 198},
+		{name: "to zero exponent", amount: 10000, from: "USD", to: "JPY", rate: "151.20", want: 15120},
+		{name: "from zero exponent", amount: 15120, from: "JPY", to: "USD", rate: "0.0066137566", want: 9999},
+		{name: "to three exponent", amount: 100, from: "USD", to: "BHD", rate: "0.376", want: 376},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rate, _ := new(big.Rat).SetString(tt.rate)
+			got, err := convert(types.NewMoney(tt.amount, tt.from), tt.to, rate, tt.spread)
+			require.NoError(t, err)
+			assert.Equal(t, types.NewMoney(tt.want, tt.to), got)
+		})
+	}
+
+	_, err := convert(types.NewMoney(1<<62, "USD"), "JPY", big.NewRat(1000, 1), 0)
+	assert.ErrorIs(t, err, types.ErrAmountOverflow)
+}
+
+func TestQuoter(t *testing.T) {
+	provider, err := NewStaticProvider(map[string]string{"USD/MYR": "4.7150"})
+	require.NoError(t, err)
+
+	now := time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)
+	quoter := NewQuoter(provider, 50, 30*time.Second)
+	quoter.now = func() time.Time { return now }
+
+	quote, err := quoter.Quote(QuoteRequest{UserID: "USER_ID_1", AccountNumber: "ACCOUNT_NUMBER_1", Source: types.NewMoney(10000, "USD"), To: "MYR"})
+	require.NoError(t, err)
+	assert.Equal(t, types.NewMoney(46914, "MYR"), quote.Target)
+	assert.Equal(t, "4.715", quote.Rate)
+	assert.Equal(t, now.Add(30*time.Second), quote.ExpiresAt)
+
+	got, err := quoter.Get("USER_ID_1", quote.QuoteID)
+	require.NoError(t, err)
+	assert.Equal(t, quote, got)
+
+	_, err = quoter.Get("USER_ID_2", quote.QuoteID)
+	assert.ErrorIs(t, err, ErrQuoteNotFound)
+
+	_, err = quoter.Quote(QuoteRequest{UserID: "USER_ID_1", Source: types.NewMoney(100, "USD"), To: "SGD"})
+	assert.ErrorIs(t, err, ErrRateNotFound)
+
+	now = now.Add(30 * time.Second)
+	_, err = quoter.Get("USER_ID_1", quote.QuoteID)
+	assert.ErrorIs(t, err, ErrQuoteExpired)
+
+	// expired quotes are forgotten
+	_, err = quoter.Get("USER_ID_1", quote.QuoteID)
+	assert.ErrorIs(t, err, ErrQuoteNotFound)
+
+	quote, err = quoter.Quote(QuoteRequest{UserID: "USER_ID_1", Source: types.NewMoney(10000, "USD"), To: "MYR"})
+	require.NoError(t, err)
+	quoter.Remove(quote.QuoteID)
+	_, err = quoter.Get("USER_ID_1", quote.QuoteID)
+	assert.ErrorIs(t, err, ErrQuoteNotFound)
+}
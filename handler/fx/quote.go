@@ -0,0 +1,166 @@
+package fx
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"math/big"
+	"sync"
+	"time"
+
+	"github.com/alienxp03/teya-ledger/types"
+)
+
+// Quote is a firm offer to convert Source into Target until ExpiresAt
+type Quote struct {
+	QuoteID       string
+	UserID        string
+	AccountNumber string
+	Source        types.Money
+	Target        types.Money
+	// Rate is the mid-market rate the quote was priced at
+	Rate string
+	// Spread is the margin taken from the mid-market rate, in basis points
+	Spread    int64
+	ExpiresAt time.Time
+}
+
+// QuoteRequest asks for the price of Source in currency To
+type QuoteRequest struct {
+	UserID        string
+	AccountNumber string
+	Source        types.Money
+	To            string
+}
+
+// Quoter prices conversions and keeps the quotes it issued until they are used or expire.
+// It is safe for concurrent use.
+type Quoter struct {
+	provider RateProvider
+	spread   int64
+	ttl      time.Duration
+	now      func() time.Time
+
+	mu     sync.Mutex
+	quotes map[string]*Quote
+}
+
+// NewQuoter prices quotes with rates from provider, less spread basis points, valid for ttl
+func NewQuoter(provider RateProvider, spread int64, ttl time.Duration) *Quoter {
+	return &Quoter{
+		provider: provider,
+		spread:   spread,
+		ttl:      ttl,
+		now:      time.Now,
+		quotes:   map[string]*Quote{},
+	}
+}
+
+// Quote prices req and stores the quote until it expires
+func (q *Quoter) Quote(req QuoteRequest) (*Quote, error) {
+	rate, err := q.provider.Rate(req.Source.Currency, req.To)
+	if err != nil {
+		return nil, err
+	}
+
+	target, err := convert(req.Source, req.To, rate, q.spread)
+	if err != nil {
+		return nil, err
+	}
+
+	quoteID, err := newQuoteID()
+	if err != nil {
+		return nil, err
+	}
+
+	quote := &Quote{
+		QuoteID:       quoteID,
+		UserID:        req.UserID,
+		AccountNumber: req.AccountNumber,
+		Source:        req.Source,
+		Target:        target,
+		Rate:          FormatRate(rate),
+		Spread:        q.spread,
+		ExpiresAt:     q.now().Add(q.ttl),
+	}
+
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	q.removeExpired()
+	q.quotes[quote.QuoteID] = quote
+
+	result := *quote
+	return &result, nil
+}
+
+// Get returns an unexpired quote issued to userID
+func (q *Quoter) Get(userID string, quoteID string) (*Quote, error) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	quote, ok := q.quotes[quoteID]
+	if !ok || quote.UserID != userID {
+		return nil, ErrQuoteNotFound
+	}
+	if !q.now().Before(quote.ExpiresAt) {
+		delete(q.quotes, quoteID)
+		return nil, ErrQuoteExpired
+	}
+
+	result := *quote
+	return &result, nil
+}
+
+// Remove forgets a quote so it cannot be executed twice
+func (q *Quoter) Remove(quoteID string) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	delete(q.quotes, quoteID)
+}
+
+// removeExpired drops quotes that can no longer be executed. The caller must hold q.mu.
+func (q *Quoter) removeExpired() {
+	now := q.now()
+	for quoteID, quote := range q.quotes {
+		if !now.Before(quote.ExpiresAt) {
+			delete(q.quotes, quoteID)
+		}
+	}
+}
+
+// convert prices amount in currency to, after taking spread basis points off rate.
+// The result is rounded down so the ledger never gives away a fraction of a minor unit.
+func convert(amount types.Money, to string, rate *big.Rat, spread int64) (types.Money, error) {
+	fromCurrency, ok := types.LookupCurrency(amount.Currency)
+	if !ok {
+		return types.Money{}, fmt.Errorf("%w: %s/%s", ErrRateNotFound, amount.Currency, to)
+	}
+	toCurrency, ok := types.LookupCurrency(to)
+	if !ok {
+		return types.Money{}, fmt.Errorf("%w: %s/%s", ErrRateNotFound, amount.Currency, to)
+	}
+
+	result := new(big.Rat).SetInt64(amount.Amount)
+	result.Mul(result, rate)
+	result.Mul(result, big.NewRat(10_000-spread, 10_000))
+	result.Mul(result, new(big.Rat).SetFrac(pow10(toCurrency.Exponent), pow10(fromCurrency.Exponent)))
+
+	target := new(big.Int).Quo(result.Num(), result.Denom())
+	if !target.IsInt64() {
+		return types.Money{}, fmt.Errorf("%w: %s in %s", types.ErrAmountOverflow, amount, to)
+	}
+	return types.NewMoney(target.Int64(), to), nil
+}
+
+func pow10(exponent int) *big.Int {
+	return new(big.Int).Exp(big.NewInt(10), big.NewInt(int64(exponent)), nil)
+}
+
+func newQuoteID() (string, error) {
+	id := make([]byte, 16)
+	if _, err := rand.Read(id); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(id), nil
+}
@@ -0,0 +1,210 @@
+package jwt
+
+import (
+	"crypto"
+	"crypto/hmac"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"hash"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/alienxp03/teya-ledger/types"
+)
+
+// method is a supported signing algorithm
+type method struct {
+	hash      crypto.Hash
+	symmetric bool
+}
+
+// methods are the algorithms tokens may be signed with. "none" is never accepted.
+var methods = map[string]method{
+	"HS256": {hash: crypto.SHA256, symmetric: true},
+	"HS384": {hash: crypto.SHA384, symmetric: true},
+	"HS512": {hash: crypto.SHA512, symmetric: true},
+	"RS256": {hash: crypto.SHA256},
+	"RS384": {hash: crypto.SHA384},
+	"RS512": {hash: crypto.SHA512},
+}
+
+// ErrInvalidToken is returned for every token that fails verification, wrapped with the reason
+var ErrInvalidToken = errors.New("invalid token")
+
+// Config is what a token must be issued by and for
+type Config struct {
+	Issuer   string
+	Audience string
+	// Leeway allows for clock skew between the issuer and the ledger
+	Leeway time.Duration
+}
+
+// Verifier checks signed JWTs and resolves them to the principal they were issued to
+type Verifier struct {
+	keys   *KeySet
+	config Config
+	now    func() time.Time
+}
+
+func NewVerifier(keys *KeySet, config Config) *Verifier {
+	return &Verifier{keys: keys, config: config, now: time.Now}
+}
+
+type header struct {
+	Alg string `json:"alg"`
+	Kid string `json:"kid"`
+	Typ string `json:"typ"`
+}
+
+type claims struct {
+	Subject   string   `json:"sub"`
+	Issuer    string   `json:"iss"`
+	Audience  audience `json:"aud"`
+	ExpiresAt *int64   `json:"exp"`
+	NotBefore *int64   `json:"nbf"`
+	// Scope is a space separated list of scopes
+	Scope string `json:"scope"`
+	// Role defaults to types.RoleCustomer
+	Role string `json:"role"`
+}
+
+// audience is a single audience or a list of them
+type audience []string
+
+func (a *audience) UnmarshalJSON(data []byte) error {
+	var single string
+	if err := json.Unmarshal(data, &single); err == nil {
+		*a = audience{single}
+		return nil
+	}
+
+	var list []string
+	if err := json.Unmarshal(data, &list); err != nil {
+		return errors.New("aud must be a string or a list of strings")
+	}
+	*a = list
+	return nil
+}
+
+// IsToken reports whether s looks like a JWT rather than an API key
+func IsToken(s string) bool {
+	return strings.Count(s, ".") == 2
+}
+
+// Verify checks the signature, expiry, issuer and audience of a token and returns its subject
+// with the role and scopes it was granted. Tokens must expire.
+func (v *Verifier) Verify(token string) (*types.Principal, error) {
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return nil, fmt.Errorf("%w: malformed", ErrInvalidToken)
+	}
+
+	var h header
+	if err := decodeSegment(parts[0], &h); err != nil {
+		return nil, fmt.Errorf("%w: header: %v", ErrInvalidToken, err)
+	}
+	if err := v.verifySignature(h, parts[0]+"."+parts[1], parts[2]); err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidToken, err)
+	}
+
+	var c claims
+	if err := decodeSegment(parts[1], &c); err != nil {
+		return nil, fmt.Errorf("%w: claims: %v", ErrInvalidToken, err)
+	}
+	if err := v.validate(c); err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidToken, err)
+	}
+
+	role := c.Role
+	if role == "" {
+		role = types.RoleCustomer
+	}
+	return &types.Principal{UserID: c.Subject, Role: role, Scopes: strings.Fields(c.Scope)}, nil
+}
+
+func (v *Verifier) verifySignature(h header, signed string, encodedSignature string) error {
+	method, ok := methods[h.Alg]
+	if !ok {
+		return fmt.Errorf("unsupported algorithm %q", h.Alg)
+	}
+	k, err := v.keys.find(h.Kid, h.Alg)
+	if err != nil {
+		return err
+	}
+
+	signature, err := base64.RawURLEncoding.DecodeString(encodedSignature)
+	if err != nil {
+		return errors.New("malformed signature")
+	}
+
+	if method.symmetric {
+		mac := hmac.New(hasher(method.hash), k.secret)
+		mac.Write([]byte(signed))
+		if !hmac.Equal(mac.Sum(nil), signature) {
+			return errors.New("signature mismatch")
+		}
+		return nil
+	}
+	if err := rsa.VerifyPKCS1v15(k.public, method.hash, hashOf(method.hash, []byte(signed)), signature); err != nil {
+		return errors.New("signature mismatch")
+	}
+	return nil
+}
+
+func (v *Verifier) validate(c claims) error {
+	now := v.now()
+	if c.ExpiresAt == nil {
+		return errors.New("missing exp")
+	}
+	if !now.Before(time.Unix(*c.ExpiresAt, 0).Add(v.config.Leeway)) {
+		return errors.New("expired")
+	}
+	if c.NotBefore != nil && now.Add(v.config.Leeway).Before(time.Unix(*c.NotBefore, 0)) {
+		return errors.New("not valid yet")
+	}
+	if v.config.Issuer != "" && c.Issuer != v.config.Issuer {
+		return fmt.Errorf("issuer %q is not trusted", c.Issuer)
+	}
+	if v.config.Audience != "" && !slices.Contains(c.Audience, v.config.Audience) {
+		return errors.New("not issued for this audience")
+	}
+	if c.Subject == "" {
+		return errors.New("missing sub")
+	}
+	if c.Role != "" && !types.ValidRole(c.Role) {
+		return fmt.Errorf("unknown role %q", c.Role)
+	}
+
+	return nil
+}
+
+func decodeSegment(segment string, dst any) error {
+	data, err := base64.RawURLEncoding.DecodeString(segment)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(data, dst)
+}
+
+func hasher(algorithm crypto.Hash) func() hash.Hash {
+	switch algorithm {
+	case crypto.SHA384:
+		return sha512.New384
+	case crypto.SHA512:
+		return sha512.New
+	default:
+		return sha256.New
+	}
+}
+
+func hashOf(algorithm crypto.Hash, data []byte) []byte {
+	h := hasher(algorithm)()
+	h.Write(data)
+	return h.Sum(nil)
+}
@@ -0,0 +1,166 @@
+package jwt
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"math/big"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/alienxp03/teya-ledger/types"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+var hmacSecret = []byte("0123456789abcdef0123456789abcdef")
+
+func TestVerify(t *testing.T) {
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+	otherKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+
+	keys, err := ParseKeySet([]byte(fmt.Sprintf(`{"keys": [
+		{"kty": "oct", "kid": "hmac", "alg": "HS256", "k": %q},
+		{"kty": "RSA", "kid": "rsa", "use": "sig", "n": %q, "e": %q},
+		{"kty": "RSA", "kid": "encryption", "use": "enc", "n": "", "e": ""}
+	]}`,
+		base64.RawURLEncoding.EncodeToString(hmacSecret),
+		base64.RawURLEncoding.EncodeToString(rsaKey.N.Bytes()),
+		base64.RawURLEncoding.EncodeToString(big.NewInt(int64(rsaKey.E)).Bytes()),
+	)))
+	require.NoError(t, err)
+
+	now := time.Date(2025, 3, 1, 12, 0, 0, 0, time.UTC)
+	verifier := NewVerifier(keys, Config{Issuer: "https://auth.example.com", Audience: "ledger", Leeway: 30 * time.Second})
+	verifier.now = func() time.Time { return now }
+
+	valid := func() map[string]any {
+		return map[string]any{
+			"sub":   "USER_ID_1",
+			"iss":   "https://auth.example.com",
+			"aud":   "ledger",
+			"exp":   now.Add(time.Minute).Unix(),
+			"scope": "transactions:read deposits:write",
+		}
+	}
+	with := func(key string, value any) map[string]any {
+		claims := valid()
+		if value == nil {
+			delete(claims, key)
+		} else {
+			claims[key] = value
+		}
+		return claims
+	}
+
+	principal, err := verifier.Verify(signHMAC(t, "HS256", "hmac", hmacSecret, valid()))
+	require.NoError(t, err)
+	assert.Equal(t, &types.Principal{UserID: "USER_ID_1", Role: types.RoleCustomer, Scopes: []string{types.ScopeTransactionsRead, types.ScopeDepositsWrite}}, principal)
+
+	principal, err = verifier.Verify(signRSA(t, "RS256", "rsa", rsaKey, with("aud", []string{"frontend", "ledger"})))
+	require.NoError(t, err)
+	assert.Equal(t, "USER_ID_1", principal.UserID)
+
+	principal, err = verifier.Verify(signHMAC(t, "HS256", "hmac", hmacSecret, with("role", types.RoleSupport)))
+	require.NoError(t, err)
+	assert.Equal(t, types.RoleSupport, principal.Role)
+
+	// a single key supporting the algorithm is found without kid
+	_, err = verifier.Verify(signRSA(t, "RS256", "", rsaKey, valid()))
+	require.NoError(t, err)
+
+	tests := []struct {
+		name  string
+		token string
+	}{
+		{name: "malformed", token: "not.a-token"},
+		{name: "expired", token: signHMAC(t, "HS256", "hmac", hmacSecret, with("exp", now.Add(-time.Minute).Unix()))},
+		{name: "without expiry", token: signHMAC(t, "HS256", "hmac", hmacSecret, with("exp", nil))},
+		{name: "not valid yet", token: signHMAC(t, "HS256", "hmac", hmacSecret, with("nbf", now.Add(time.Minute).Unix()))},
+		{name: "other issuer", token: signHMAC(t, "HS256", "hmac", hmacSecret, with("iss", "https://evil.example.com"))},
+		{name: "other audience", token: signHMAC(t, "HS256", "hmac", hmacSecret, with("aud", "payments"))},
+		{name: "without subject", token: signHMAC(t, "HS256", "hmac", hmacSecret, with("sub", ""))},
+		{name: "unknown role", token: signHMAC(t, "HS256", "hmac", hmacSecret, with("role", "superuser"))},
+		{name: "wrong secret", token: signHMAC(t, "HS256", "hmac", []byte("fedcba9876543210fedcba9876543210"), valid())},
+		{name: "wrong rsa key", token: signRSA(t, "RS256", "rsa", otherKey, valid())},
+		{name: "unknown kid", token: signHMAC(t, "HS256", "other", hmacSecret, valid())},
+		{name: "algorithm not allowed for key", token: signHMAC(t, "HS512", "hmac", hmacSecret, valid())},
+		// an RSA public key must not be usable as an HMAC secret
+		{name: "algorithm confusion", token: signHMAC(t, "HS256", "rsa", rsaKey.N.Bytes(), valid())},
+		{name: "alg none", token: sign(t, map[string]any{"alg": "none"}, valid(), func(string) []byte { return nil })},
+		{name: "tampered claims", token: tamper(t, signHMAC(t, "HS256", "hmac", hmacSecret, valid()), with("sub", "USER_ID_2"))},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := verifier.Verify(tt.token)
+			assert.ErrorIs(t, err, ErrInvalidToken)
+		})
+	}
+
+	// leeway allows for clock skew
+	_, err = verifier.Verify(signHMAC(t, "HS256", "hmac", hmacSecret, with("exp", now.Add(-10*time.Second).Unix())))
+	assert.NoError(t, err)
+}
+
+func TestParseKeySet(t *testing.T) {
+	for name, data := range map[string]string{
+		"not json":        `keys`,
+		"no keys":         `{"keys": []}`,
+		"short secret":    `{"keys": [{"kty": "oct", "k": "c2hvcnQ"}]}`,
+		"unknown type":    `{"keys": [{"kty": "EC", "crv": "P-256"}]}`,
+		"small modulus":   `{"keys": [{"kty": "RSA", "n": "AQAB", "e": "AQAB"}]}`,
+		"alg mismatch":    fmt.Sprintf(`{"keys": [{"kty": "oct", "alg": "RS256", "k": %q}]}`, base64.RawURLEncoding.EncodeToString(hmacSecret)),
+		"unsupported alg": fmt.Sprintf(`{"keys": [{"kty": "oct", "alg": "none", "k": %q}]}`, base64.RawURLEncoding.EncodeToString(hmacSecret)),
+	} {
+		t.Run(name, func(t *testing.T) {
+			_, err := ParseKeySet([]byte(data))
+			assert.Error(t, err)
+		})
+	}
+}
+
+func TestIsToken(t *testing.T) {
+	assert.True(t, IsToken("eyJhbGciOiJIUzI1NiJ9.e30.c2ln"))
+	assert.False(t, IsToken("tlk_LP-y2CGAmf8fsyEnaVfzH7FEOzaeS52E"))
+	assert.False(t, IsToken("USER_TOKEN_1"))
+}
+
+func signHMAC(t *testing.T, alg string, kid string, secret []byte, claims map[string]any) string {
+	return sign(t, map[string]any{"alg": alg, "kid": kid, "typ": "JWT"}, claims, func(signed string) []byte {
+		mac := hmac.New(hasher(methods[alg].hash), secret)
+		mac.Write([]byte(signed))
+		return mac.Sum(nil)
+	})
+}
+
+func signRSA(t *testing.T, alg string, kid string, key *rsa.PrivateKey, claims map[string]any) string {
+	return sign(t, map[string]any{"alg": alg, "kid": kid, "typ": "JWT"}, claims, func(signed string) []byte {
+		hash := methods[alg].hash
+		signature, err := rsa.SignPKCS1v15(rand.Reader, key, hash, hashOf(hash, []byte(signed)))
+		require.NoError(t, err)
+		return signature
+	})
+}
+
+func sign(t *testing.T, header map[string]any, claims map[string]any, signature func(signed string) []byte) string {
+	signed := encode(t, header) + "." + encode(t, claims)
+	return signed + "." + base64.RawURLEncoding.EncodeToString(signature(signed))
+}
+
+// tamper replaces the claims of a signed token, keeping its signature
+func tamper(t *testing.T, token string, claims map[string]any) string {
+	parts := strings.Split(token, ".")
+	return parts[0] + "." + encode(t, claims) + "." + parts[2]
+}
+
+func encode(t *testing.T, value any) string {
+	data, err := json.Marshal(value)
+	require.NoError(t, err)
+	return base64.RawURLEncoding.EncodeToString(data)
+}
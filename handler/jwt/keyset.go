@@ -0,0 +1,149 @@
+package jwt
+
+import (
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/big"
+	"os"
+)
+
+// minRSAKeyBits is the smallest RSA modulus accepted for verifying tokens
+const minRSAKeyBits = 2048
+
+// KeySet holds the keys tokens are verified with, loaded from a JSON Web Key Set
+type KeySet struct {
+	keys []*key
+}
+
+// key is a verification key. Exactly one of secret and public is set.
+type key struct {
+	id string
+	// alg restricts the key to one algorithm when set
+	alg    string
+	secret []byte
+	public *rsa.PublicKey
+}
+
+type jsonWebKey struct {
+	Kty string `json:"kty"`
+	Kid string `json:"kid"`
+	Alg string `json:"alg"`
+	Use string `json:"use"`
+	// K is the secret of a symmetric (oct) key
+	K string `json:"k"`
+	// N and E are the modulus and exponent of an RSA public key
+	N string `json:"n"`
+	E string `json:"e"`
+}
+
+// LoadKeySet reads a JSON Web Key Set file holding symmetric (oct) and RSA public keys
+func LoadKeySet(path string) (*KeySet, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	return ParseKeySet(data)
+}
+
+// ParseKeySet parses a JSON Web Key Set. Keys meant for anything other than signatures are skipped.
+func ParseKeySet(data []byte) (*KeySet, error) {
+	var set struct {
+		Keys []jsonWebKey `json:"keys"`
+	}
+	if err := json.Unmarshal(data, &set); err != nil {
+		return nil, fmt.Errorf("invalid key set: %w", err)
+	}
+
+	result := &KeySet{}
+	for i, jwk := range set.Keys {
+		if jwk.Use != "" && jwk.Use != "sig" {
+			continue
+		}
+
+		parsed, err := parseKey(jwk)
+		if err != nil {
+			return nil, fmt.Errorf("invalid key %d %q: %w", i, jwk.Kid, err)
+		}
+		result.keys = append(result.keys, parsed)
+	}
+	if len(result.keys) == 0 {
+		return nil, errors.New("key set has no signing keys")
+	}
+
+	return result, nil
+}
+
+func parseKey(jwk jsonWebKey) (*key, error) {
+	result := &key{id: jwk.Kid, alg: jwk.Alg}
+
+	switch jwk.Kty {
+	case "oct":
+		secret, err := base64.RawURLEncoding.DecodeString(jwk.K)
+		if err != nil {
+			return nil, fmt.Errorf("invalid k: %w", err)
+		}
+		if len(secret) < 32 {
+			return nil, errors.New("secret must be at least 32 bytes")
+		}
+		result.secret = secret
+	case "RSA":
+		n, err := base64.RawURLEncoding.DecodeString(jwk.N)
+		if err != nil {
+			return nil, fmt.Errorf("invalid n: %w", err)
+		}
+		e, err := base64.RawURLEncoding.DecodeString(jwk.E)
+		if err != nil {
+			return nil, fmt.Errorf("invalid e: %w", err)
+		}
+		exponent := new(big.Int).SetBytes(e)
+		if !exponent.IsInt64() || exponent.Int64() < 3 || exponent.Int64() > 1<<31-1 {
+			return nil, errors.New("invalid exponent")
+		}
+		result.public = &rsa.PublicKey{N: new(big.Int).SetBytes(n), E: int(exponent.Int64())}
+		if result.public.N.BitLen() < minRSAKeyBits {
+			return nil, fmt.Errorf("modulus must be at least %d bits", minRSAKeyBits)
+		}
+	default:
+		return nil, fmt.Errorf("unsupported key type %q", jwk.Kty)
+	}
+
+	if result.alg != "" && !result.supports(result.alg) {
+		return nil, fmt.Errorf("algorithm %s does not match key type %s", result.alg, jwk.Kty)
+	}
+	return result, nil
+}
+
+// supports reports whether the key can verify a signature made with alg
+func (k *key) supports(alg string) bool {
+	method, ok := methods[alg]
+	if !ok || (k.alg != "" && k.alg != alg) {
+		return false
+	}
+	return method.symmetric == (k.secret != nil)
+}
+
+// find returns the key a token signed with alg by the key kid is verified with. A token
+// without kid is accepted when a single key supports its algorithm.
+func (s *KeySet) find(kid string, alg string) (*key, error) {
+	var found *key
+	for _, k := range s.keys {
+		if kid != "" && k.id != kid {
+			continue
+		}
+		if !k.supports(alg) {
+			continue
+		}
+		if found != nil {
+			return nil, errors.New("token does not identify its key")
+		}
+		found = k
+	}
+	if found == nil {
+		return nil, fmt.Errorf("no %s key %q", alg, kid)
+	}
+
+	return found, nil
+}
@@ -0,0 +1,115 @@
+package reconcile
+
+import (
+	"github.com/alienxp03/teya-ledger/storage"
+	"github.com/alienxp03/teya-ledger/types"
+)
+
+// Drift is an account whose stored balance differs from the balance derived from its transactions
+type Drift struct {
+	UserID        string
+	AccountNumber string
+	Stored        types.Money
+	Derived       types.Money
+	// Repaired is set when the stored balance was overwritten with the derived one
+	Repaired bool
+}
+
+// Difference is the amount the stored balance is off by
+func (d Drift) Difference() (types.Money, error) {
+	return d.Stored.Sub(d.Derived)
+}
+
+type Report struct {
+	// Accounts is the number of accounts checked
+	Accounts int
+	// Balances is the number of balances checked, one per account and currency
+	Balances int
+	Drifts   []Drift
+}
+
+type Reconciler struct {
+	storage storage.Storage
+}
+
+func New(storage storage.Storage) *Reconciler {
+	return &Reconciler{
+		storage: storage,
+	}
+}
+
+// Run recomputes every balance of every account from its transaction history and reports
+// balances that have drifted. With repair set, drifted balances are corrected to the
+// derived amount.
+func (r *Reconciler) Run(repair bool) (*Report, error) {
+	accounts, err := r.storage.ListAccounts()
+	if err != nil {
+		return nil, err
+	}
+
+	report := &Report{Drifts: []Drift{}}
+	for _, account := range accounts {
+		balances, drifts, err := r.reconcile(account, repair)
+		if err != nil {
+			return report, err
+		}
+		report.Accounts++
+		report.Balances += balances
+		report.Drifts = append(report.Drifts, drifts...)
+	}
+
+	return report, nil
+}
+
+// reconcile checks the balances of a single account while holding its lock, so no
+// posting can land between reading a stored balance and deriving it. It returns the
+// number of balances checked and those that drifted.
+func (r *Reconciler) reconcile(account *storage.Account, repair bool) (int, []Drift, error) {
+	unlock := r.storage.LockAccount(account.UserID, account.Number)
+	defer unlock()
+
+	checked := 0
+	drifts := []Drift{}
+	err := r.storage.WithTx(func(tx storage.Storage) error {
+		balances, err := tx.GetBalances(account.UserID, account.Number)
+		if err != nil {
+			return err
+		}
+		checked = len(balances)
+
+		for _, balance := range balances {
+			derived, err := tx.DeriveBalance(account.UserID, account.Number, balance.Amount.Currency)
+			if err != nil {
+				return err
+			}
+			if balance.Amount == derived {
+				continue
+			}
+
+			drift := Drift{
+				UserID:        account.UserID,
+				AccountNumber: account.Number,
+				Stored:        balance.Amount,
+				Derived:       derived,
+			}
+			if repair {
+				correction, err := derived.Sub(balance.Amount)
+				if err != nil {
+					return err
+				}
+				if err := tx.UpdateBalance(account.UserID, account.Number, correction); err != nil {
+					return err
+				}
+				drift.Repaired = true
+			}
+			drifts = append(drifts, drift)
+		}
+
+		return nil
+	})
+	if err != nil {
+		return 0, nil, err
+	}
+
+	return checked, drifts, nil
+}
@@ -0,0 +1,61 @@
+package reconcile
+
+import (
+	"path/filepath"
+	"testing"
+
+	"github.com/alienxp03/teya-ledger/db"
+	"github.com/alienxp03/teya-ledger/types"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestReconciler(t *testing.T) {
+	backends := map[string]db.DB{
+		"memory": db.NewMemoryStorage(),
+		"sqlite": db.NewSQLiteStorage(filepath.Join(t.TempDir(), "ledger.db")),
+	}
+
+	for name, database := range backends {
+		t.Run(name, func(t *testing.T) {
+			require.NoError(t, database.Initialize())
+			t.Cleanup(func() { database.Close() })
+			require.NoError(t, database.SeedData())
+
+			s := database.GetStorage()
+			reconciler := New(s)
+
+			report, err := reconciler.Run(false)
+			require.NoError(t, err)
+			assert.Equal(t, 2, report.Accounts)
+			// MYR and USD of ACCOUNT_NUMBER_1, MYR and SGD of ACCOUNT_NUMBER_2
+			assert.Equal(t, 4, report.Balances)
+			assert.Empty(t, report.Drifts)
+
+			// a balance change without a transaction
+			require.NoError(t, s.UpdateBalance("USER_ID_2", "ACCOUNT_NUMBER_2", types.NewMoney(50, "MYR")))
+
+			report, err = reconciler.Run(false)
+			require.NoError(t, err)
+			assert.Equal(t, []Drift{
+				{UserID: "USER_ID_2", AccountNumber: "ACCOUNT_NUMBER_2", Stored: types.NewMoney(2050, "MYR"), Derived: types.NewMoney(2000, "MYR")},
+			}, report.Drifts)
+			difference, err := report.Drifts[0].Difference()
+			require.NoError(t, err)
+			assert.Equal(t, types.NewMoney(50, "MYR"), difference)
+
+			report, err = reconciler.Run(true)
+			require.NoError(t, err)
+			require.Len(t, report.Drifts, 1)
+			assert.True(t, report.Drifts[0].Repaired)
+
+			balance, err := s.GetBalance("USER_ID_2", "ACCOUNT_NUMBER_2", "MYR")
+			require.NoError(t, err)
+			assert.Equal(t, types.NewMoney(2000, "MYR"), balance.Amount)
+
+			report, err = reconciler.Run(false)
+			require.NoError(t, err)
+			assert.Empty(t, report.Drifts)
+		})
+	}
+}
@@ -0,0 +1,66 @@
+package settlement
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/alienxp03/teya-ledger/storage"
+)
+
+// Outcome is the result of one call to FakeSettler.Settle
+type Outcome struct {
+	// Delay is how long the settlement takes
+	Delay time.Duration
+	// Err is returned once the delay is over, nil settles the transaction
+	Err error
+}
+
+// FakeSettler settles every transaction after a fixed delay, e.g. for local development
+// and tests. Other outcomes can be queued per transaction.
+type FakeSettler struct {
+	mu       sync.Mutex
+	delay    time.Duration
+	outcomes map[string][]Outcome
+}
+
+func NewFakeSettler(delay time.Duration) *FakeSettler {
+	return &FakeSettler{
+		delay:    delay,
+		outcomes: map[string][]Outcome{},
+	}
+}
+
+// Queue sets the outcomes of the next attempts to settle a transaction, in order. Once
+// they run out, the transaction settles after the default delay.
+func (f *FakeSettler) Queue(transactionID string, outcomes ...Outcome) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	f.outcomes[transactionID] = append(f.outcomes[transactionID], outcomes...)
+}
+
+func (f *FakeSettler) Settle(ctx context.Context, transaction *storage.Transaction) error {
+	outcome := f.next(transaction.TransactionID)
+
+	timer := time.NewTimer(outcome.Delay)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return outcome.Err
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+func (f *FakeSettler) next(transactionID string) Outcome {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	outcomes := f.outcomes[transactionID]
+	if len(outcomes) == 0 {
+		return Outcome{Delay: f.delay}
+	}
+	f.outcomes[transactionID] = outcomes[1:]
+	return outcomes[0]
+}
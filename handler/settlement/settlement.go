@@ -0,0 +1,265 @@
+package settlement
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"sync"
+	"time"
+
+	"github.com/alienxp03/teya-ledger/handler/transaction"
+	"github.com/alienxp03/teya-ledger/storage"
+)
+
+// Settler settles a transaction with the outside world, e.g. a card network or a bank
+type Settler interface {
+	// Settle returns nil once the transaction has settled. A DeclinedError fails the
+	// transaction straight away, any other error is retried with backoff.
+	Settle(ctx context.Context, transaction *storage.Transaction) error
+}
+
+// DeclinedError is a permanent settlement failure that is not worth retrying
+type DeclinedError struct {
+	Reason string
+}
+
+func (e *DeclinedError) Error() string {
+	return "settlement declined: " + e.Reason
+}
+
+// Decline returns a DeclinedError for reason
+func Decline(reason string) error {
+	return &DeclinedError{Reason: reason}
+}
+
+// Transitioner moves transactions through the status state machine
+type Transitioner interface {
+	UpdateStatus(userID string, transactionID string, req transaction.UpdateStatusRequest) (*transaction.Transaction, error)
+}
+
+type Config struct {
+	// Workers is the number of transactions settled at the same time
+	Workers int
+	// PollInterval is how often an idle worker checks the queue
+	PollInterval time.Duration
+	// Lease is how long a worker holds a job, which is also the time a settlement
+	// can take. A job held by a process that stopped is picked up again after it.
+	Lease time.Duration
+	// MaxAttempts is the number of attempts after which the transaction fails
+	MaxAttempts int
+	// Backoff is the delay before the first retry, doubled for every further retry up to MaxBackoff
+	Backoff    time.Duration
+	MaxBackoff time.Duration
+}
+
+func DefaultConfig() Config {
+	return Config{
+		Workers:      4,
+		PollInterval: 100 * time.Millisecond,
+		Lease:        time.Minute,
+		MaxAttempts:  5,
+		Backoff:      time.Second,
+		MaxBackoff:   time.Minute,
+	}
+}
+
+// Pool settles the transactions in the settlement queue with a fixed number of workers
+type Pool struct {
+	storage      storage.Storage
+	transitioner Transitioner
+	settler      Settler
+	config       Config
+	logger       *slog.Logger
+
+	// stop is closed to stop workers from claiming new jobs, once however many times Shutdown is called
+	stop     chan struct{}
+	stopOnce sync.Once
+	// ctx is cancelled to abandon the settlements in flight
+	ctx    context.Context
+	cancel context.CancelFunc
+	wg     sync.WaitGroup
+}
+
+func NewPool(storage storage.Storage, transitioner Transitioner, settler Settler, config Config, logger *slog.Logger) *Pool {
+	ctx, cancel := context.WithCancel(context.Background())
+	return &Pool{
+		storage:      storage,
+		transitioner: transitioner,
+		settler:      settler,
+		config:       config,
+		logger:       logger,
+		stop:         make(chan struct{}),
+		ctx:          ctx,
+		cancel:       cancel,
+	}
+}
+
+// Start starts the workers
+func (p *Pool) Start() {
+	for range p.config.Workers {
+		p.wg.Add(1)
+		go func() {
+			defer p.wg.Done()
+			p.work()
+		}()
+	}
+}
+
+// Shutdown stops claiming jobs and waits for the settlements in flight to finish. When ctx
+// is done first, the settlements in flight are abandoned and stay queued for the next start.
+// It is safe to call more than once.
+func (p *Pool) Shutdown(ctx context.Context) error {
+	p.stopOnce.Do(func() { close(p.stop) })
+
+	done := make(chan struct{})
+	go func() {
+		p.wg.Wait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+		p.cancel()
+		return nil
+	case <-ctx.Done():
+		p.cancel()
+		<-done
+		return ctx.Err()
+	}
+}
+
+func (p *Pool) work() {
+	for {
+		select {
+		case <-p.stop:
+			return
+		default:
+		}
+
+		jobs, err := p.storage.ClaimSettlements(time.Now(), p.config.Lease, 1)
+		if err != nil {
+			p.logger.Error("Could not claim settlements", "error", err)
+		}
+		if len(jobs) == 0 {
+			select {
+			case <-p.stop:
+				return
+			case <-time.After(p.config.PollInterval):
+			}
+			continue
+		}
+
+		p.process(jobs[0])
+	}
+}
+
+// process makes one attempt to settle the transaction of job
+func (p *Pool) process(job *storage.SettlementJob) {
+	logger := p.logger.With("transaction_id", job.TransactionID, "attempt", job.Attempts+1)
+
+	current, err := p.storage.GetTransaction(job.UserID, job.TransactionID)
+	if errors.Is(err, storage.ErrNotFound) {
+		p.remove(logger, job)
+		return
+	}
+	if err != nil {
+		p.retry(logger, job, err)
+		return
+	}
+
+	switch current.Status {
+	case storage.TransactionStatusPending:
+		if err := p.transition(current, storage.TransactionStatusProcessing, ""); err != nil {
+			p.retry(logger, job, err)
+			return
+		}
+	case storage.TransactionStatusProcessing:
+		// A previous attempt started settling, settle again
+	default:
+		// Cancelled or failed before settlement got to it
+		p.remove(logger, job)
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(p.ctx, p.config.Lease)
+	defer cancel()
+	err = p.settler.Settle(ctx, current)
+	if err != nil && p.ctx.Err() != nil {
+		// Shutting down, the job is picked up again once its lease expires
+		logger.Warn("Settlement abandoned", "error", err)
+		return
+	}
+
+	var declined *DeclinedError
+	if errors.As(err, &declined) {
+		p.fail(logger, job, declined.Reason)
+		return
+	}
+	if err != nil {
+		p.retry(logger, job, err)
+		return
+	}
+
+	if err := p.transition(current, storage.TransactionStatusCompleted, ""); err != nil {
+		p.retry(logger, job, err)
+		return
+	}
+	logger.Info("Transaction settled")
+	p.remove(logger, job)
+}
+
+// retry schedules the next attempt of job with exponential backoff, or fails the
+// transaction once it runs out of attempts
+func (p *Pool) retry(logger *slog.Logger, job *storage.SettlementJob, cause error) {
+	job.Attempts++
+	job.LastError = cause.Error()
+	if job.Attempts >= p.config.MaxAttempts {
+		p.fail(logger, job, fmt.Sprintf("settlement failed after %d attempts: %s", job.Attempts, job.LastError))
+		return
+	}
+
+	job.NextAttemptAt = time.Now().Add(p.backoff(job.Attempts))
+	logger.Warn("Settlement attempt failed", "error", cause, "next_attempt_at", job.NextAttemptAt)
+	if err := p.storage.RetrySettlement(job); err != nil {
+		logger.Error("Could not reschedule settlement", "error", err)
+	}
+}
+
+func (p *Pool) fail(logger *slog.Logger, job *storage.SettlementJob, reason string) {
+	current, err := p.storage.GetTransaction(job.UserID, job.TransactionID)
+	if err == nil {
+		err = p.transition(current, storage.TransactionStatusFailed, reason)
+	}
+	if err != nil {
+		// Left leased, the job is picked up again once the lease expires
+		logger.Error("Could not fail transaction", "error", err)
+		return
+	}
+
+	logger.Warn("Settlement failed", "reason", reason)
+	p.remove(logger, job)
+}
+
+func (p *Pool) transition(current *storage.Transaction, status string, reason string) error {
+	_, err := p.transitioner.UpdateStatus(current.UserID, current.TransactionID, transaction.UpdateStatusRequest{
+		Status: status,
+		Reason: reason,
+	})
+	return err
+}
+
+func (p *Pool) remove(logger *slog.Logger, job *storage.SettlementJob) {
+	if err := p.storage.RemoveSettlement(job.TransactionID); err != nil {
+		logger.Error("Could not remove settlement", "error", err)
+	}
+}
+
+// backoff is the delay before the retry following the given number of failed attempts
+func (p *Pool) backoff(attempts int) time.Duration {
+	delay := p.config.Backoff
+	for i := 1; i < attempts && delay < p.config.MaxBackoff; i++ {
+		delay *= 2
+	}
+	return min(delay, p.config.MaxBackoff)
+}
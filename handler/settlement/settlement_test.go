@@ -0,0 +1,183 @@
+package settlement
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/alienxp03/teya-ledger/db"
+	"github.com/alienxp03/teya-ledger/handler/transaction"
+	"github.com/alienxp03/teya-ledger/storage"
+	"github.com/alienxp03/teya-ledger/types"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// seededBackends returns an initialized and seeded database for every storage implementation
+func seededBackends(t *testing.T) map[string]db.DB {
+	t.Helper()
+
+	backends := map[string]db.DB{
+		"memory": db.NewMemoryStorage(),
+		"sqlite": db.NewSQLiteStorage(filepath.Join(t.TempDir(), "ledger.db")),
+	}
+	for _, database := range backends {
+		require.NoError(t, database.Initialize())
+		t.Cleanup(func() { database.Close() })
+		require.NoError(t, database.SeedData())
+	}
+
+	return backends
+}
+
+func testConfig() Config {
+	return Config{
+		Workers:      2,
+		PollInterval: 10 * time.Millisecond,
+		Lease:        time.Minute,
+		MaxAttempts:  3,
+		Backoff:      10 * time.Millisecond,
+		MaxBackoff:   20 * time.Millisecond,
+	}
+}
+
+// waitForStatus waits until the transaction reaches status
+func waitForStatus(t *testing.T, handler *transaction.TransactionHandler, transactionID string, status string) *transaction.Transaction {
+	t.Helper()
+
+	var got *transaction.Transaction
+	require.Eventually(t, func() bool {
+		var err error
+		got, err = handler.GetTransaction("USER_ID_1", transactionID)
+		return err == nil && got.Status == status
+	}, 5*time.Second, 10*time.Millisecond)
+	return got
+}
+
+func TestPool(t *testing.T) {
+	for name, database := range seededBackends(t) {
+		t.Run(name, func(t *testing.T) {
+			s := database.GetStorage()
+			handler := transaction.New(s)
+			settler := NewFakeSettler(0)
+
+			transient := errors.New("bank unavailable")
+			settler.Queue("DECLINED", Outcome{Err: Decline("card declined")})
+			settler.Queue("RETRIED", Outcome{Err: transient}, Outcome{Delay: 5 * time.Millisecond, Err: transient})
+			settler.Queue("EXHAUSTED", Outcome{Err: transient}, Outcome{Err: transient}, Outcome{Err: transient})
+
+			_, err := handler.CreateDeposit("USER_ID_1", transaction.CreateDepositRequest{TransactionID: "SETTLED", AccountNumber: "ACCOUNT_NUMBER_1", Amount: types.NewMoney(500, "MYR")})
+			require.NoError(t, err)
+			_, err = handler.CreateDeposit("USER_ID_1", transaction.CreateDepositRequest{TransactionID: "DECLINED", AccountNumber: "ACCOUNT_NUMBER_1", Amount: types.NewMoney(200, "MYR")})
+			require.NoError(t, err)
+			_, err = handler.CreateWithdrawal("USER_ID_1", transaction.CreateWithdrawalRequest{TransactionID: "RETRIED", AccountNumber: "ACCOUNT_NUMBER_1", Amount: types.NewMoney(-100, "MYR")})
+			require.NoError(t, err)
+			_, err = handler.CreateWithdrawal("USER_ID_1", transaction.CreateWithdrawalRequest{TransactionID: "EXHAUSTED", AccountNumber: "ACCOUNT_NUMBER_1", Amount: types.NewMoney(-300, "MYR")})
+			require.NoError(t, err)
+			_, err = handler.CreateDeposit("USER_ID_1", transaction.CreateDepositRequest{TransactionID: "CANCELLED", AccountNumber: "ACCOUNT_NUMBER_1", Amount: types.NewMoney(50, "MYR")})
+			require.NoError(t, err)
+			_, err = handler.CancelTransaction("USER_ID_1", "CANCELLED", transaction.CancelTransactionRequest{})
+			require.NoError(t, err)
+
+			pool := NewPool(s, handler, settler, testConfig(), slog.New(slog.DiscardHandler))
+			pool.Start()
+
+			settled := waitForStatus(t, handler, "SETTLED", storage.TransactionStatusCompleted)
+			assert.Equal(t, []string{"pending", "processing", "completed"}, statusesOf(settled))
+
+			declined := waitForStatus(t, handler, "DECLINED", storage.TransactionStatusFailed)
+			assert.Equal(t, "card declined", declined.StatusReason)
+
+			retried := waitForStatus(t, handler, "RETRIED", storage.TransactionStatusCompleted)
+			assert.Equal(t, []string{"pending", "processing", "completed"}, statusesOf(retried))
+
+			exhausted := waitForStatus(t, handler, "EXHAUSTED", storage.TransactionStatusFailed)
+			assert.Equal(t, "settlement failed after 3 attempts: bank unavailable", exhausted.StatusReason)
+
+			waitForStatus(t, handler, "CANCELLED", storage.TransactionStatusCancelled)
+
+			require.NoError(t, pool.Shutdown(context.Background()))
+
+			// Every job has left the queue
+			jobs, err := s.ClaimSettlements(time.Now().Add(time.Hour), time.Minute, 10)
+			require.NoError(t, err)
+			assert.Empty(t, jobs)
+
+			// Only the settled deposit and withdrawal moved the balance, the failed withdrawal was released
+			balance, err := handler.GetBalance("USER_ID_1", transaction.GetBalanceRequest{AccountNumber: "ACCOUNT_NUMBER_1"})
+			require.NoError(t, err)
+			assert.Equal(t, types.NewMoney(1500, "MYR"), balance.Balances[0].Ledger)
+		})
+	}
+}
+
+func TestPoolShutdown(t *testing.T) {
+	for name, database := range seededBackends(t) {
+		t.Run(name, func(t *testing.T) {
+			s := database.GetStorage()
+			handler := transaction.New(s)
+			config := testConfig()
+			config.Lease = 200 * time.Millisecond
+
+			_, err := handler.CreateDeposit("USER_ID_1", transaction.CreateDepositRequest{TransactionID: "DRAINED", AccountNumber: "ACCOUNT_NUMBER_1", Amount: types.NewMoney(100, "MYR")})
+			require.NoError(t, err)
+
+			// The settlement in flight finishes before shutting down
+			pool := NewPool(s, handler, NewFakeSettler(200*time.Millisecond), config, slog.New(slog.DiscardHandler))
+			pool.Start()
+			waitForStatus(t, handler, "DRAINED", storage.TransactionStatusProcessing)
+			require.NoError(t, pool.Shutdown(context.Background()))
+			waitForStatus(t, handler, "DRAINED", storage.TransactionStatusCompleted)
+			// e.g. a signal handler and a deferred cleanup both shutting the pool down
+			require.NoError(t, pool.Shutdown(context.Background()))
+
+			_, err = handler.CreateDeposit("USER_ID_1", transaction.CreateDepositRequest{TransactionID: "ABANDONED", AccountNumber: "ACCOUNT_NUMBER_1", Amount: types.NewMoney(100, "MYR")})
+			require.NoError(t, err)
+
+			// A settlement that outlasts the shutdown deadline is abandoned and stays queued
+			pool = NewPool(s, handler, NewFakeSettler(time.Hour), config, slog.New(slog.DiscardHandler))
+			pool.Start()
+			waitForStatus(t, handler, "ABANDONED", storage.TransactionStatusProcessing)
+			ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+			defer cancel()
+			assert.ErrorIs(t, pool.Shutdown(ctx), context.DeadlineExceeded)
+
+			// The next pool picks it up once the lease expires
+			pool = NewPool(s, handler, NewFakeSettler(0), config, slog.New(slog.DiscardHandler))
+			pool.Start()
+			settled := waitForStatus(t, handler, "ABANDONED", storage.TransactionStatusCompleted)
+			assert.Equal(t, []string{"pending", "processing", "completed"}, statusesOf(settled))
+			require.NoError(t, pool.Shutdown(context.Background()))
+		})
+	}
+}
+
+func TestBackoff(t *testing.T) {
+	pool := NewPool(nil, nil, nil, Config{Backoff: time.Second, MaxBackoff: 10 * time.Second}, nil)
+
+	tests := []struct {
+		attempts int
+		want     time.Duration
+	}{
+		{attempts: 1, want: time.Second},
+		{attempts: 2, want: 2 * time.Second},
+		{attempts: 3, want: 4 * time.Second},
+		{attempts: 4, want: 8 * time.Second},
+		{attempts: 5, want: 10 * time.Second},
+		{attempts: 100, want: 10 * time.Second},
+	}
+	for _, tt := range tests {
+		assert.Equal(t, tt.want, pool.backoff(tt.attempts), "attempts %d", tt.attempts)
+	}
+}
+
+func statusesOf(transaction *transaction.Transaction) []string {
+	statuses := []string{}
+	for _, change := range transaction.StatusHistory {
+		statuses = append(statuses, change.To)
+	}
+	return statuses
+}
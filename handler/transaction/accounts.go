@@ -0,0 +1,143 @@
+package transaction
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/alienxp03/teya-ledger/storage"
+	"github.com/alienxp03/teya-ledger/types"
+)
+
+// accountNumberAttempts is how many account numbers are tried before giving up on opening an account
+const accountNumberAttempts = 5
+
+// OpenAccount opens an active account for the user with a new account number and a zero
+// balance in each of the requested currencies, the default currency when none is requested
+func (t TransactionHandler) OpenAccount(userID string, req OpenAccountRequest) (*Account, error) {
+	for _, currency := range req.Currencies {
+		if _, ok := types.LookupCurrency(currency); !ok {
+			return nil, types.NewBadRequest(types.ErrorCodeInvalidCurrency, fmt.Sprintf("unsupported currency %q", currency))
+		}
+	}
+
+	for range accountNumberAttempts {
+		number, err := t.accountNumbers.Generate()
+		if err != nil {
+			return nil, err
+		}
+		// Numbers are unique across users, transfers find their destination by number alone
+		if _, err := t.storage.GetAccountByNumber(number); err == nil {
+			continue
+		}
+
+		account, err := t.storage.CreateAccount(storage.Account{
+			Number:     number,
+			UserID:     userID,
+			Status:     storage.AccountStatusActive,
+			Currencies: req.Currencies,
+		})
+		if errors.Is(err, storage.ErrAccountExists) {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		result := newAccount(account)
+		return &result, nil
+	}
+
+	return nil, fmt.Errorf("could not find a free account number in %d attempts", accountNumberAttempts)
+}
+
+// GetAccounts lists the accounts of the user, closed ones included, oldest first
+func (t TransactionHandler) GetAccounts(userID string) (*GetAccountsResponse, error) {
+	accounts, err := t.storage.GetAccounts(userID)
+	if err != nil {
+		return nil, err
+	}
+
+	result := &GetAccountsResponse{Accounts: []Account{}}
+	for _, account := range accounts {
+		result.Accounts = append(result.Accounts, newAccount(account))
+	}
+	return result, nil
+}
+
+func (t TransactionHandler) GetAccount(userID string, accountNumber string) (*Account, error) {
+	account, err := t.storage.GetAccount(userID, accountNumber)
+	if err != nil {
+		return nil, types.NewNotFound("account not found")
+	}
+
+	result := newAccount(account)
+	return &result, nil
+}
+
+// CloseAccount closes an active or frozen account of the user for good. Every balance of the
+// account must be zero and none of its transactions may still be settling.
+func (t TransactionHandler) CloseAccount(userID string, accountNumber string) (*Account, error) {
+	if _, err := t.storage.GetAccount(userID, accountNumber); err != nil {
+		return nil, types.NewNotFound("account not found")
+	}
+
+	unlock := t.storage.LockAccount(userID, accountNumber)
+	defer unlock()
+
+	err := t.storage.WithTx(func(tx storage.Storage) error {
+		// Read the account again under the lock, it may have been closed since
+		account, err := tx.GetAccount(userID, accountNumber)
+		if err != nil {
+			return types.NewNotFound("account not found")
+		}
+		if account.Status == storage.AccountStatusClosed {
+			return types.NewBadRequest(types.ErrorCodeInvalidStatusTransition, fmt.Sprintf("account %s is already closed", accountNumber))
+		}
+		if err := checkSettled(tx, account); err != nil {
+			return err
+		}
+
+		err = tx.UpdateAccountStatus(userID, accountNumber, account.Status, storage.AccountStatusClosed)
+		if errors.Is(err, storage.ErrStatusConflict) {
+			return types.NewBadRequest(types.ErrorCodeInvalidStatusTransition, err.Error())
+		}
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return t.GetAccount(userID, accountNumber)
+}
+
+// checkSettled fails when an account still holds funds or has transactions that could still move them
+func checkSettled(tx storage.Storage, account *storage.Account) error {
+	balances, err := tx.GetBalances(account.UserID, account.Number)
+	if err != nil {
+		return err
+	}
+	for _, balance := range balances {
+		if balance.Amount.Amount != 0 {
+			return types.NewBadRequest(types.ErrorCodeBalanceNotZero,
+				fmt.Sprintf("account %s still holds %s", account.Number, balance.Amount))
+		}
+	}
+
+	for _, status := range []string{storage.TransactionStatusPending, storage.TransactionStatusProcessing} {
+		page, err := tx.GetTransactions(storage.TransactionQuery{
+			UserID:        account.UserID,
+			AccountNumber: account.Number,
+			Status:        status,
+			Limit:         1,
+		})
+		if err != nil {
+			return err
+		}
+		if len(page.Transactions) > 0 {
+			return types.NewBadRequest(types.ErrorCodeInvalidStatusTransition,
+				fmt.Sprintf("account %s has %s transactions", account.Number, status))
+		}
+	}
+
+	return nil
+}
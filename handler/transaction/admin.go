@@ -0,0 +1,193 @@
+package transaction
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/alienxp03/teya-ledger/storage"
+	"github.com/alienxp03/teya-ledger/types"
+)
+
+// Administrator defines the operations support and admin staff take on the data of any user.
+// Every change is recorded in the audit log together with the operator who made it.
+type Administrator interface {
+	SearchTransactions(req SearchTransactionsRequest) (*SearchTransactionsResponse, error)
+	FindTransaction(transactionID string) (*AccountTransaction, error)
+	OverrideStatus(operator Operator, transactionID string, req UpdateStatusRequest) (*AccountTransaction, error)
+	FreezeAccount(operator Operator, accountNumber string, req ChangeAccountStatusRequest) (*Account, error)
+	UnfreezeAccount(operator Operator, accountNumber string, req ChangeAccountStatusRequest) (*Account, error)
+	GetAuditEntries(req GetAuditEntriesRequest) (*GetAuditEntriesResponse, error)
+}
+
+// SearchTransactions finds transactions across every user with the filters of GetTransactions
+func (t TransactionHandler) SearchTransactions(req SearchTransactionsRequest) (*SearchTransactionsResponse, error) {
+	page, err := t.storage.SearchTransactions(transactionQuery(req.UserID, req.GetTransactionsRequest))
+	if errors.Is(err, storage.ErrInvalidCursor) || errors.Is(err, storage.ErrInvalidQuery) {
+		return nil, types.NewBadRequest(types.ErrorInvalidParams, err.Error())
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	transactions := []AccountTransaction{}
+	for _, transaction := range page.Transactions {
+		transactions = append(transactions, newAccountTransaction(transaction, newTransaction(transaction)))
+	}
+
+	return &SearchTransactionsResponse{
+		Transactions: transactions,
+		NextCursor:   page.NextCursor,
+		HasMore:      page.HasMore,
+	}, nil
+}
+
+// FindTransaction retrieves a transaction of any user with its status history and reversals
+func (t TransactionHandler) FindTransaction(transactionID string) (*AccountTransaction, error) {
+	transaction, err := t.storage.FindTransaction(transactionID)
+	if err != nil {
+		return nil, types.NewNotFound("transaction not found")
+	}
+
+	detailed, err := t.GetTransaction(transaction.UserID, transactionID)
+	if err != nil {
+		return nil, err
+	}
+	result := newAccountTransaction(transaction, *detailed)
+	return &result, nil
+}
+
+// OverrideStatus moves a stuck transaction of any user through the status state machine on
+// behalf of the operator. Unlike UpdateStatus a reason is always required.
+func (t TransactionHandler) OverrideStatus(operator Operator, transactionID string, req UpdateStatusRequest) (*AccountTransaction, error) {
+	if req.Reason == "" {
+		return nil, types.NewBadRequest(types.ErrorInvalidParams, "a reason is required to override a transaction status")
+	}
+
+	transaction, err := t.storage.FindTransaction(transactionID)
+	if err != nil {
+		return nil, types.NewNotFound("transaction not found")
+	}
+
+	updated, err := t.updateStatus(transaction.UserID, transactionID, req, func(tx storage.Storage, before *storage.Transaction) error {
+		return tx.RecordAuditEntry(&storage.AuditEntry{
+			OperatorID: operator.UserID,
+			Role:       operator.Role,
+			Action:     storage.AuditActionStatusOverride,
+			TargetType: storage.AuditTargetTransaction,
+			TargetID:   transactionID,
+			Reason:     req.Reason,
+			Details:    fmt.Sprintf("%s -> %s", before.Status, req.Status),
+		})
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	result := newAccountTransaction(transaction, *updated)
+	return &result, nil
+}
+
+// FreezeAccount stops funds moving in or out of an account until it is unfrozen
+func (t TransactionHandler) FreezeAccount(operator Operator, accountNumber string, req ChangeAccountStatusRequest) (*Account, error) {
+	return t.changeAccountStatus(operator, accountNumber, req, storage.AccountStatusActive, storage.AccountStatusFrozen, storage.AuditActionAccountFreeze)
+}
+
+// UnfreezeAccount lets funds move in and out of a frozen account again
+func (t TransactionHandler) UnfreezeAccount(operator Operator, accountNumber string, req ChangeAccountStatusRequest) (*Account, error) {
+	return t.changeAccountStatus(operator, accountNumber, req, storage.AccountStatusFrozen, storage.AccountStatusActive, storage.AuditActionAccountUnfreeze)
+}
+
+// changeAccountStatus moves an account from one status to another, recording the action
+// in the audit log in the same unit of work
+func (t TransactionHandler) changeAccountStatus(operator Operator, accountNumber string, req ChangeAccountStatusRequest, from string, to string, action string) (*Account, error) {
+	if req.Reason == "" {
+		return nil, types.NewBadRequest(types.ErrorInvalidParams, "a reason is required to change the status of an account")
+	}
+
+	account, err := t.storage.GetAccountByNumber(accountNumber)
+	if err != nil {
+		return nil, types.NewNotFound("account not found")
+	}
+
+	// Wait for the transactions in flight on the account before changing its status
+	unlock := t.storage.LockAccount(account.UserID, account.Number)
+	defer unlock()
+
+	err = t.storage.WithTx(func(tx storage.Storage) error {
+		err := tx.UpdateAccountStatus(account.UserID, account.Number, from, to)
+		if errors.Is(err, storage.ErrStatusConflict) {
+			return types.NewBadRequest(types.ErrorCodeInvalidStatusTransition,
+				fmt.Sprintf("account %s cannot move from %s to %s", accountNumber, account.Status, to))
+		}
+		if err != nil {
+			return err
+		}
+
+		return tx.RecordAuditEntry(&storage.AuditEntry{
+			OperatorID: operator.UserID,
+			Role:       operator.Role,
+			Action:     action,
+			TargetType: storage.AuditTargetAccount,
+			TargetID:   accountNumber,
+			Reason:     req.Reason,
+			Details:    fmt.Sprintf("%s -> %s", from, to),
+		})
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	if account, err = t.storage.GetAccount(account.UserID, account.Number); err != nil {
+		return nil, err
+	}
+	result := newAccount(account)
+	return &result, nil
+}
+
+// GetAuditEntries lists the most recent actions operators took, newest first
+func (t TransactionHandler) GetAuditEntries(req GetAuditEntriesRequest) (*GetAuditEntriesResponse, error) {
+	entries, err := t.storage.ListAuditEntries(storage.AuditQuery{
+		OperatorID: req.OperatorID,
+		TargetType: req.TargetType,
+		TargetID:   req.TargetID,
+		Limit:      req.Limit,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	result := &GetAuditEntriesResponse{Entries: []AuditEntry{}}
+	for _, entry := range entries {
+		result.Entries = append(result.Entries, AuditEntry{
+			ID:         entry.ID,
+			OperatorID: entry.OperatorID,
+			Role:       entry.Role,
+			Action:     entry.Action,
+			TargetType: entry.TargetType,
+			TargetID:   entry.TargetID,
+			Reason:     entry.Reason,
+			Details:    entry.Details,
+			CreatedAt:  entry.CreatedAt,
+		})
+	}
+	return result, nil
+}
+
+func newAccountTransaction(stored *storage.Transaction, transaction Transaction) AccountTransaction {
+	return AccountTransaction{
+		Transaction:   transaction,
+		UserID:        stored.UserID,
+		AccountNumber: stored.AccountNumber,
+	}
+}
+
+func newAccount(account *storage.Account) Account {
+	return Account{
+		Number:     account.Number,
+		UserID:     account.UserID,
+		Status:     account.Status,
+		Currencies: account.Currencies,
+		CreatedAt:  account.CreatedAt,
+		UpdatedAt:  account.UpdatedAt,
+	}
+}
@@ -0,0 +1,978 @@
+package transaction
+
+import (
+	"fmt"
+	"net/http"
+	"path/filepath"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/alienxp03/teya-ledger/db"
+	"github.com/alienxp03/teya-ledger/handler/fx"
+	"github.com/alienxp03/teya-ledger/storage"
+	"github.com/alienxp03/teya-ledger/types"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// seededBackends returns an initialized and seeded database for every storage implementation
+func seededBackends(t *testing.T) map[string]db.DB {
+	t.Helper()
+
+	backends := map[string]db.DB{
+		"memory": db.NewMemoryStorage(),
+		"sqlite": db.NewSQLiteStorage(filepath.Join(t.TempDir(), "ledger.db")),
+	}
+	for _, database := range backends {
+		require.NoError(t, database.Initialize())
+		t.Cleanup(func() { database.Close() })
+		require.NoError(t, database.SeedData())
+	}
+
+	return backends
+}
+
+// completeTransaction settles a transaction straight away rather than waiting for the background settlement
+func completeTransaction(t *testing.T, handler *TransactionHandler, userID string, transactionID string) {
+	t.Helper()
+
+	for _, status := range []string{storage.TransactionStatusProcessing, storage.TransactionStatusCompleted} {
+		_, err := handler.UpdateStatus(userID, transactionID, UpdateStatusRequest{Status: status})
+		require.NoError(t, err)
+	}
+}
+
+// TestStorageBackends runs the handler end to end against every storage implementation
+func TestStorageBackends(t *testing.T) {
+	for name, database := range seededBackends(t) {
+		t.Run(name, func(t *testing.T) {
+			handler := New(database.GetStorage())
+
+			deposit, err := handler.CreateDeposit("USER_ID_1", CreateDepositRequest{
+				TransactionID: "DEPOSIT_1",
+				AccountNumber: "ACCOUNT_NUMBER_1",
+				Amount:        types.NewMoney(500, "MYR"),
+				Description:   "deposit",
+			})
+			require.NoError(t, err)
+			assert.Equal(t, "pending", deposit.Transaction.Status)
+			completeTransaction(t, handler, "USER_ID_1", "DEPOSIT_1")
+
+			_, err = handler.CreateDeposit("USER_ID_1", CreateDepositRequest{
+				TransactionID: "DEPOSIT_1",
+				AccountNumber: "ACCOUNT_NUMBER_1",
+				Amount:        types.NewMoney(500, "MYR"),
+				Description:   "deposit",
+			})
+			assert.Error(t, err)
+
+			_, err = handler.CreateWithdrawal("USER_ID_1", CreateWithdrawalRequest{
+				TransactionID: "WITHDRAWAL_1",
+				AccountNumber: "ACCOUNT_NUMBER_1",
+				Amount:        types.NewMoney(-200, "MYR"),
+				Description:   "withdrawal",
+			})
+			require.NoError(t, err)
+
+			_, err = handler.CreateWithdrawal("USER_ID_1", CreateWithdrawalRequest{
+				TransactionID: "WITHDRAWAL_2",
+				AccountNumber: "ACCOUNT_NUMBER_1",
+				Amount:        types.NewMoney(-5000, "MYR"),
+				Description:   "withdrawal",
+			})
+			assert.Error(t, err)
+
+			_, err = handler.CreateDeposit("USER_ID_1", CreateDepositRequest{
+				TransactionID: "DEPOSIT_SGD",
+				AccountNumber: "ACCOUNT_NUMBER_1",
+				Amount:        types.NewMoney(500, "SGD"),
+				Description:   "deposit",
+			})
+			var serviceErr *types.ServiceError
+			require.ErrorAs(t, err, &serviceErr)
+			assert.Equal(t, string(types.ErrorCodeCurrencyMismatch), serviceErr.Code)
+
+			_, err = handler.CreateDeposit("USER_ID_1", CreateDepositRequest{
+				TransactionID: "DEPOSIT_USD",
+				AccountNumber: "ACCOUNT_NUMBER_1",
+				Amount:        types.NewMoney(700, "USD"),
+				Description:   "deposit",
+			})
+			require.NoError(t, err)
+			completeTransaction(t, handler, "USER_ID_1", "DEPOSIT_USD")
+
+			_, err = handler.CreateWithdrawal("USER_ID_1", CreateWithdrawalRequest{
+				TransactionID: "WITHDRAWAL_USD",
+				AccountNumber: "ACCOUNT_NUMBER_1",
+				Amount:        types.NewMoney(-800, "USD"),
+				Description:   "withdrawal",
+			})
+			assert.Error(t, err)
+
+			balance, err := handler.GetBalance("USER_ID_1", GetBalanceRequest{AccountNumber: "ACCOUNT_NUMBER_1"})
+			require.NoError(t, err)
+			// seeded with an opening balance of 1000 and a deposit of 100
+			assert.Equal(t, []Balance{
+				{Ledger: types.NewMoney(1400, "MYR"), Available: types.NewMoney(1400, "MYR")},
+				{Ledger: types.NewMoney(700, "USD"), Available: types.NewMoney(700, "USD")},
+			}, balance.Balances)
+
+			transactions, err := handler.GetTransactions("USER_ID_1", GetTransactionsRequest{AccountNumber: "ACCOUNT_NUMBER_1"})
+			require.NoError(t, err)
+			assert.Len(t, transactions.Transactions, 5)
+
+			transaction, err := handler.GetTransaction("USER_ID_1", "WITHDRAWAL_1")
+			require.NoError(t, err)
+			assert.Equal(t, types.NewMoney(-200, "MYR"), transaction.Amount)
+
+			_, err = handler.GetTransaction("USER_ID_2", "WITHDRAWAL_1")
+			assert.Error(t, err)
+		})
+	}
+}
+
+func TestTransferBackends(t *testing.T) {
+	for name, database := range seededBackends(t) {
+		t.Run(name, func(t *testing.T) {
+			handler := New(database.GetStorage())
+			_, err := handler.CreateDeposit("USER_ID_1", CreateDepositRequest{
+				TransactionID: "DEPOSIT_1",
+				AccountNumber: "ACCOUNT_NUMBER_1",
+				Amount:        types.NewMoney(500, "MYR"),
+				Description:   "deposit",
+			})
+			require.NoError(t, err)
+			completeTransaction(t, handler, "USER_ID_1", "DEPOSIT_1")
+
+			transfer, err := handler.CreateTransfer("USER_ID_1", CreateTransferRequest{
+				TransferID:        "TRANSFER_1",
+				FromAccountNumber: "ACCOUNT_NUMBER_1",
+				ToAccountNumber:   "ACCOUNT_NUMBER_2",
+				Amount:            types.NewMoney(200, "MYR"),
+				Description:       "transfer",
+			})
+			require.NoError(t, err)
+			assert.Equal(t, "TRANSFER_1", transfer.Debit.TransferID)
+			assert.Equal(t, "TRANSFER_1", transfer.Credit.TransferID)
+
+			// a retry gets the transfer back without moving the funds again
+			retried, err := handler.CreateTransfer("USER_ID_1", CreateTransferRequest{
+				TransferID:        "TRANSFER_1",
+				FromAccountNumber: "ACCOUNT_NUMBER_1",
+				ToAccountNumber:   "ACCOUNT_NUMBER_2",
+				Amount:            types.NewMoney(200, "MYR"),
+				Description:       "transfer",
+			})
+			require.NoError(t, err)
+			assert.Equal(t, transfer.Debit.TransactionID, retried.Debit.TransactionID)
+			assert.Equal(t, transfer.Credit.Amount, retried.Credit.Amount)
+
+			// the same transfer ID for another request
+			var serviceErr *types.ServiceError
+			_, err = handler.CreateTransfer("USER_ID_1", CreateTransferRequest{
+				TransferID:        "TRANSFER_1",
+				FromAccountNumber: "ACCOUNT_NUMBER_1",
+				ToAccountNumber:   "ACCOUNT_NUMBER_2",
+				Amount:            types.NewMoney(300, "MYR"),
+				Description:       "transfer",
+			})
+			require.ErrorAs(t, err, &serviceErr)
+			assert.Equal(t, string(types.ErrorCodeIdempotencyKeyReused), serviceErr.Code)
+
+			// or a transfer ID whose legs would take the ID of another user's transaction
+			_, err = handler.CreateDeposit("USER_ID_2", CreateDepositRequest{
+				TransactionID: "TRANSFER_3-debit",
+				AccountNumber: "ACCOUNT_NUMBER_2",
+				Amount:        types.NewMoney(100, "MYR"),
+				Description:   "deposit",
+			})
+			require.NoError(t, err)
+			_, err = handler.CreateTransfer("USER_ID_1", CreateTransferRequest{
+				TransferID:        "TRANSFER_3",
+				FromAccountNumber: "ACCOUNT_NUMBER_1",
+				ToAccountNumber:   "ACCOUNT_NUMBER_2",
+				Amount:            types.NewMoney(100, "MYR"),
+				Description:       "transfer",
+			})
+			require.ErrorAs(t, err, &serviceErr)
+			assert.Equal(t, string(types.ErrorCodeIdempotencyKeyReused), serviceErr.Code)
+
+			_, err = handler.CreateTransfer("USER_ID_1", CreateTransferRequest{
+				TransferID:        "TRANSFER_2",
+				FromAccountNumber: "ACCOUNT_NUMBER_1",
+				ToAccountNumber:   "ACCOUNT_NUMBER_2",
+				Amount:            types.NewMoney(5000, "MYR"),
+				Description:       "transfer",
+			})
+			assert.Error(t, err)
+
+			source, err := handler.GetBalance("USER_ID_1", GetBalanceRequest{AccountNumber: "ACCOUNT_NUMBER_1"})
+			require.NoError(t, err)
+			assert.Equal(t, int64(1400), source.Balances[0].Ledger.Amount)
+
+			destination, err := handler.GetBalance("USER_ID_2", GetBalanceRequest{AccountNumber: "ACCOUNT_NUMBER_2"})
+			require.NoError(t, err)
+			assert.Equal(t, int64(2200), destination.Balances[0].Ledger.Amount)
+
+			credit, err := handler.GetTransaction("USER_ID_2", "TRANSFER_1-credit")
+			require.NoError(t, err)
+			assert.Equal(t, types.NewMoney(200, "MYR"), credit.Amount)
+
+			// every customer ledger account mirrors its balance as a credit
+			trialBalance, err := database.GetStorage().GetTrialBalance()
+			require.NoError(t, err)
+			balances := map[string]int64{}
+			var total int64
+			for _, line := range trialBalance {
+				balances[line.LedgerAccount] = line.Balance.Amount
+				total += line.Balance.Amount
+			}
+			assert.Equal(t, int64(0), total)
+			assert.Equal(t, int64(600), balances[storage.LedgerAccountCashInTransit])
+			assert.Equal(t, int64(3000), balances[storage.LedgerAccountOpeningBalances])
+			assert.Equal(t, -source.Balances[0].Ledger.Amount, balances[storage.CustomerLedgerAccount("USER_ID_1", "ACCOUNT_NUMBER_1")])
+			assert.Equal(t, -destination.Balances[0].Ledger.Amount, balances[storage.CustomerLedgerAccount("USER_ID_2", "ACCOUNT_NUMBER_2")])
+		})
+	}
+}
+
+func TestConversionBackends(t *testing.T) {
+	rates, err := fx.NewStaticProvider(map[string]string{"USD/MYR": "4.7150"})
+	require.NoError(t, err)
+
+	for name, database := range seededBackends(t) {
+		t.Run(name, func(t *testing.T) {
+			handler := New(database.GetStorage(), WithQuoter(fx.NewQuoter(rates, 50, time.Minute)))
+			var serviceErr *types.ServiceError
+
+			quote, err := handler.CreateQuote("USER_ID_1", CreateQuoteRequest{
+				AccountNumber: "ACCOUNT_NUMBER_1",
+				Amount:        types.NewMoney(943, "MYR"),
+				To:            "USD",
+			})
+			require.NoError(t, err)
+			// 9.43 MYR is 2.00 USD at the mid rate, less the 0.5% spread
+			assert.Equal(t, types.NewMoney(199, "USD"), quote.Quote.Target)
+			assert.Equal(t, "0.2120890774", quote.Quote.Rate)
+
+			_, err = handler.CreateQuote("USER_ID_1", CreateQuoteRequest{
+				AccountNumber: "ACCOUNT_NUMBER_1",
+				Amount:        types.NewMoney(100, "MYR"),
+				To:            "SGD",
+			})
+			require.ErrorAs(t, err, &serviceErr)
+			assert.Equal(t, string(types.ErrorCodeCurrencyMismatch), serviceErr.Code)
+
+			conversion, err := handler.CreateConversion("USER_ID_1", CreateConversionRequest{
+				ConversionID: "CONVERSION_1",
+				QuoteID:      quote.Quote.QuoteID,
+				Description:  "conversion",
+			})
+			require.NoError(t, err)
+			assert.Equal(t, types.NewMoney(-943, "MYR"), conversion.Debit.Amount)
+			assert.Equal(t, types.NewMoney(199, "USD"), conversion.Credit.Amount)
+			assert.Equal(t, int64(50), conversion.Credit.Spread)
+
+			// a retry after a timeout gets the conversion back although its quote is gone
+			retried, err := handler.CreateConversion("USER_ID_1", CreateConversionRequest{
+				ConversionID: "CONVERSION_1",
+				QuoteID:      quote.Quote.QuoteID,
+				Description:  "conversion",
+			})
+			require.NoError(t, err)
+			assert.Equal(t, conversion.Debit.TransactionID, retried.Debit.TransactionID)
+			assert.Equal(t, conversion.Debit.Amount, retried.Debit.Amount)
+			assert.Equal(t, conversion.Credit.Amount, retried.Credit.Amount)
+
+			// a quote can only be executed once
+			_, err = handler.CreateConversion("USER_ID_1", CreateConversionRequest{
+				ConversionID: "CONVERSION_2",
+				QuoteID:      quote.Quote.QuoteID,
+				Description:  "conversion",
+			})
+			require.ErrorAs(t, err, &serviceErr)
+			assert.Equal(t, string(types.NotFound), serviceErr.Code)
+
+			quote, err = handler.CreateQuote("USER_ID_1", CreateQuoteRequest{
+				AccountNumber: "ACCOUNT_NUMBER_1",
+				Amount:        types.NewMoney(5000, "MYR"),
+				To:            "USD",
+			})
+			require.NoError(t, err)
+
+			// reusing a conversion ID with another quote does not pass the old conversion off as this one
+			_, err = handler.CreateConversion("USER_ID_1", CreateConversionRequest{
+				ConversionID: "CONVERSION_1",
+				QuoteID:      quote.Quote.QuoteID,
+				Description:  "conversion",
+			})
+			require.ErrorAs(t, err, &serviceErr)
+			assert.Equal(t, string(types.ErrorCodeIdempotencyKeyReused), serviceErr.Code)
+			assert.Equal(t, http.StatusUnprocessableEntity, serviceErr.Status)
+
+			// and leaves the quote to be executed
+			_, err = handler.CreateConversion("USER_ID_1", CreateConversionRequest{
+				ConversionID: "CONVERSION_3",
+				QuoteID:      quote.Quote.QuoteID,
+				Description:  "conversion",
+			})
+			require.ErrorAs(t, err, &serviceErr)
+			assert.Equal(t, string(types.ErrorCodeInvalidAmount), serviceErr.Code)
+
+			balances, err := handler.GetBalance("USER_ID_1", GetBalanceRequest{AccountNumber: "ACCOUNT_NUMBER_1"})
+			require.NoError(t, err)
+			assert.Equal(t, []Balance{
+				{Ledger: types.NewMoney(157, "MYR"), Available: types.NewMoney(157, "MYR")},
+				{Ledger: types.NewMoney(199, "USD"), Available: types.NewMoney(199, "USD")},
+			}, balances.Balances)
+
+			credit, err := handler.GetTransaction("USER_ID_1", "CONVERSION_1-credit")
+			require.NoError(t, err)
+			assert.Equal(t, "CONVERSION_1", credit.ConversionID)
+			assert.Equal(t, "0.2120890774", credit.Rate)
+
+			trialBalance, err := database.GetStorage().GetTrialBalance()
+			require.NoError(t, err)
+			position := map[string]int64{}
+			for _, line := range trialBalance {
+				if line.LedgerAccount == storage.LedgerAccountFXPosition {
+					position[line.Balance.Currency] = line.Balance.Amount
+				}
+			}
+			assert.Equal(t, map[string]int64{"MYR": -943, "USD": 199}, position)
+		})
+	}
+}
+
+func TestHoldBackends(t *testing.T) {
+	for name, database := range seededBackends(t) {
+		t.Run(name, func(t *testing.T) {
+			handler := New(database.GetStorage(), WithHoldTTL(time.Hour))
+			var serviceErr *types.ServiceError
+
+			assertBalance := func(ledger int64, available int64) {
+				t.Helper()
+
+				balance, err := handler.GetBalance("USER_ID_1", GetBalanceRequest{AccountNumber: "ACCOUNT_NUMBER_1"})
+				require.NoError(t, err)
+				assert.Equal(t, Balance{Ledger: types.NewMoney(ledger, "MYR"), Available: types.NewMoney(available, "MYR")}, balance.Balances[0])
+
+				derived, err := database.GetStorage().DeriveBalance("USER_ID_1", "ACCOUNT_NUMBER_1", "MYR")
+				require.NoError(t, err)
+				assert.Equal(t, types.NewMoney(ledger, "MYR"), derived)
+			}
+
+			created, err := handler.CreateHold("USER_ID_1", CreateHoldRequest{HoldID: "HOLD_1", AccountNumber: "ACCOUNT_NUMBER_1", Amount: types.NewMoney(300, "MYR"), Description: "authorization"})
+			require.NoError(t, err)
+			assert.Equal(t, "active", created.Hold.Status)
+			assert.WithinDuration(t, time.Now().Add(time.Hour), created.Hold.ExpiresAt, time.Minute)
+			assertBalance(1100, 800)
+
+			// reserved funds cannot be spent, by a withdrawal or another hold
+			_, err = handler.CreateWithdrawal("USER_ID_1", CreateWithdrawalRequest{TransactionID: "WITHDRAWAL_1", AccountNumber: "ACCOUNT_NUMBER_1", Amount: types.NewMoney(-900, "MYR"), Description: "withdrawal"})
+			require.ErrorAs(t, err, &serviceErr)
+			assert.Equal(t, string(types.ErrorCodeInvalidAmount), serviceErr.Code)
+			_, err = handler.CreateHold("USER_ID_1", CreateHoldRequest{HoldID: "HOLD_2", AccountNumber: "ACCOUNT_NUMBER_1", Amount: types.NewMoney(900, "MYR"), Description: "authorization"})
+			require.ErrorAs(t, err, &serviceErr)
+			assert.Equal(t, string(types.ErrorCodeInvalidAmount), serviceErr.Code)
+
+			_, err = handler.CaptureHold("USER_ID_1", "HOLD_1", CaptureHoldRequest{TransactionID: "CAPTURE_1", Amount: types.NewMoney(301, "MYR"), Description: "capture"})
+			require.ErrorAs(t, err, &serviceErr)
+			assert.Equal(t, string(types.ErrorCodeInvalidAmount), serviceErr.Code)
+			_, err = handler.CaptureHold("USER_ID_2", "HOLD_1", CaptureHoldRequest{TransactionID: "CAPTURE_1", Description: "capture"})
+			require.ErrorAs(t, err, &serviceErr)
+			assert.Equal(t, http.StatusNotFound, serviceErr.Status)
+
+			// a partial capture takes the final amount and releases the rest
+			captured, err := handler.CaptureHold("USER_ID_1", "HOLD_1", CaptureHoldRequest{TransactionID: "CAPTURE_1", Amount: types.NewMoney(200, ""), Description: "capture"})
+			require.NoError(t, err)
+			assert.Equal(t, "captured", captured.Hold.Status)
+			assert.Equal(t, types.NewMoney(200, "MYR"), captured.Hold.Captured)
+			assert.Equal(t, "capture", captured.Transaction.Type)
+			assert.Equal(t, "completed", captured.Transaction.Status)
+			assert.Equal(t, types.NewMoney(-200, "MYR"), captured.Transaction.Amount)
+			assert.Equal(t, "HOLD_1", captured.Transaction.HoldID)
+			assertBalance(900, 900)
+
+			capture, err := handler.GetTransaction("USER_ID_1", "CAPTURE_1")
+			require.NoError(t, err)
+			assert.Equal(t, "HOLD_1", capture.HoldID)
+
+			_, err = handler.CaptureHold("USER_ID_1", "HOLD_1", CaptureHoldRequest{TransactionID: "CAPTURE_2", Description: "capture"})
+			require.ErrorAs(t, err, &serviceErr)
+			assert.Equal(t, string(types.ErrorCodeInvalidStatusTransition), serviceErr.Code)
+
+			// voiding releases the hold without touching the ledger balance
+			_, err = handler.CreateHold("USER_ID_1", CreateHoldRequest{HoldID: "HOLD_2", AccountNumber: "ACCOUNT_NUMBER_1", Amount: types.NewMoney(400, "MYR"), Description: "authorization"})
+			require.NoError(t, err)
+			assertBalance(900, 500)
+			voided, err := handler.VoidHold("USER_ID_1", "HOLD_2")
+			require.NoError(t, err)
+			assert.Equal(t, "voided", voided.Status)
+			assertBalance(900, 900)
+			_, err = handler.VoidHold("USER_ID_1", "HOLD_2")
+			require.ErrorAs(t, err, &serviceErr)
+			assert.Equal(t, string(types.ErrorCodeInvalidStatusTransition), serviceErr.Code)
+
+			// stale holds expire
+			_, err = handler.CreateHold("USER_ID_1", CreateHoldRequest{HoldID: "HOLD_3", AccountNumber: "ACCOUNT_NUMBER_1", Amount: types.NewMoney(100, "MYR"), Description: "authorization"})
+			require.NoError(t, err)
+			assertBalance(900, 800)
+			expired, err := handler.ExpireHolds(time.Now())
+			require.NoError(t, err)
+			assert.Zero(t, expired)
+			expired, err = handler.ExpireHolds(time.Now().Add(2 * time.Hour))
+			require.NoError(t, err)
+			assert.Equal(t, 1, expired)
+			hold, err := handler.GetHold("USER_ID_1", "HOLD_3")
+			require.NoError(t, err)
+			assert.Equal(t, "expired", hold.Status)
+			assertBalance(900, 900)
+
+			trialBalance, err := database.GetStorage().GetTrialBalance()
+			require.NoError(t, err)
+			var total int64
+			for _, line := range trialBalance {
+				total += line.Balance.Amount
+			}
+			assert.Zero(t, total)
+		})
+	}
+}
+
+func TestReversalBackends(t *testing.T) {
+	for name, database := range seededBackends(t) {
+		t.Run(name, func(t *testing.T) {
+			handler := New(database.GetStorage())
+			var serviceErr *types.ServiceError
+
+			assertBalance := func(want int64) {
+				t.Helper()
+
+				balance, err := handler.GetBalance("USER_ID_1", GetBalanceRequest{AccountNumber: "ACCOUNT_NUMBER_1"})
+				require.NoError(t, err)
+				assert.Equal(t, types.NewMoney(want, "MYR"), balance.Balances[0].Ledger)
+
+				derived, err := database.GetStorage().DeriveBalance("USER_ID_1", "ACCOUNT_NUMBER_1", "MYR")
+				require.NoError(t, err)
+				assert.Equal(t, types.NewMoney(want, "MYR"), derived)
+			}
+
+			_, err := handler.CreateDeposit("USER_ID_1", CreateDepositRequest{TransactionID: "DEPOSIT_1", AccountNumber: "ACCOUNT_NUMBER_1", Amount: types.NewMoney(500, "MYR"), Description: "deposit"})
+			require.NoError(t, err)
+
+			// only completed transactions can be reversed
+			_, err = handler.ReverseTransaction("USER_ID_1", "DEPOSIT_1", CreateReversalRequest{TransactionID: "REVERSAL_1", Description: "refund"})
+			require.ErrorAs(t, err, &serviceErr)
+			assert.Equal(t, string(types.ErrorCodeInvalidStatusTransition), serviceErr.Code)
+
+			completeTransaction(t, handler, "USER_ID_1", "DEPOSIT_1")
+			assertBalance(1600)
+
+			_, err = handler.ReverseTransaction("USER_ID_2", "DEPOSIT_1", CreateReversalRequest{TransactionID: "REVERSAL_1", Description: "refund"})
+			require.ErrorAs(t, err, &serviceErr)
+			assert.Equal(t, http.StatusNotFound, serviceErr.Status)
+
+			// a partial reversal takes back part of the credit
+			reversed, err := handler.ReverseTransaction("USER_ID_1", "DEPOSIT_1", CreateReversalRequest{TransactionID: "REVERSAL_1", Amount: types.NewMoney(200, ""), Description: "partial refund"})
+			require.NoError(t, err)
+			assert.Equal(t, "reversal", reversed.Reversal.Type)
+			assert.Equal(t, "completed", reversed.Reversal.Status)
+			assert.Equal(t, types.NewMoney(-200, "MYR"), reversed.Reversal.Amount)
+			assert.Equal(t, "DEPOSIT_1", reversed.Reversal.ReversalOf)
+			assert.Equal(t, "partially_reversed", reversed.Original.Status)
+			assert.Equal(t, "reversed by REVERSAL_1", reversed.Original.StatusReason)
+			assertBalance(1400)
+
+			entries, err := database.GetStorage().GetJournalEntries("REVERSAL_1")
+			require.NoError(t, err)
+			require.Len(t, entries, 1)
+			assert.Equal(t, storage.LedgerAccountCashInTransit, entries[0].Postings[0].LedgerAccount)
+
+			// reversals cannot add up to more than the original
+			_, err = handler.ReverseTransaction("USER_ID_1", "DEPOSIT_1", CreateReversalRequest{TransactionID: "REVERSAL_2", Amount: types.NewMoney(301, "MYR"), Description: "refund"})
+			require.ErrorAs(t, err, &serviceErr)
+			assert.Equal(t, string(types.ErrorCodeInvalidAmount), serviceErr.Code)
+
+			reversed, err = handler.ReverseTransaction("USER_ID_1", "DEPOSIT_1", CreateReversalRequest{TransactionID: "REVERSAL_2", Description: "refund"})
+			require.NoError(t, err)
+			assert.Equal(t, types.NewMoney(-300, "MYR"), reversed.Reversal.Amount)
+			assert.Equal(t, "reversed", reversed.Original.Status)
+			assertBalance(1100)
+
+			original, err := handler.GetTransaction("USER_ID_1", "DEPOSIT_1")
+			require.NoError(t, err)
+			require.Len(t, original.Reversals, 2)
+			assert.Equal(t, "REVERSAL_1", original.Reversals[0].TransactionID)
+			assert.Equal(t, types.NewMoney(-200, "MYR"), original.Reversals[0].Amount)
+			assert.Equal(t, "REVERSAL_2", original.Reversals[1].TransactionID)
+			assert.Equal(t, types.NewMoney(-300, "MYR"), original.Reversals[1].Amount)
+			require.Len(t, original.StatusHistory, 5)
+			assert.Equal(t, "partially_reversed", original.StatusHistory[3].To)
+			assert.Equal(t, "reversed", original.StatusHistory[4].To)
+
+			reversal, err := handler.GetTransaction("USER_ID_1", "REVERSAL_2")
+			require.NoError(t, err)
+			assert.Equal(t, "DEPOSIT_1", reversal.ReversalOf)
+			assert.Empty(t, reversal.Reversals)
+
+			_, err = handler.ReverseTransaction("USER_ID_1", "DEPOSIT_1", CreateReversalRequest{TransactionID: "REVERSAL_3", Description: "refund"})
+			require.ErrorAs(t, err, &serviceErr)
+			assert.Equal(t, string(types.ErrorCodeInvalidStatusTransition), serviceErr.Code)
+
+			// reversing a withdrawal gives the funds back
+			_, err = handler.CreateWithdrawal("USER_ID_1", CreateWithdrawalRequest{TransactionID: "WITHDRAWAL_1", AccountNumber: "ACCOUNT_NUMBER_1", Amount: types.NewMoney(-1000, "MYR"), Description: "withdrawal"})
+			require.NoError(t, err)
+			completeTransaction(t, handler, "USER_ID_1", "WITHDRAWAL_1")
+			assertBalance(100)
+
+			reversed, err = handler.ReverseTransaction("USER_ID_1", "WITHDRAWAL_1", CreateReversalRequest{TransactionID: "REVERSAL_3", Amount: types.NewMoney(400, "MYR"), Description: "returned"})
+			require.NoError(t, err)
+			assert.Equal(t, types.NewMoney(400, "MYR"), reversed.Reversal.Amount)
+			assertBalance(500)
+
+			// taking back a credit that was spent would overdraw the account
+			_, err = handler.CreateDeposit("USER_ID_1", CreateDepositRequest{TransactionID: "DEPOSIT_2", AccountNumber: "ACCOUNT_NUMBER_1", Amount: types.NewMoney(200, "MYR"), Description: "deposit"})
+			require.NoError(t, err)
+			completeTransaction(t, handler, "USER_ID_1", "DEPOSIT_2")
+			_, err = handler.CreateWithdrawal("USER_ID_1", CreateWithdrawalRequest{TransactionID: "WITHDRAWAL_2", AccountNumber: "ACCOUNT_NUMBER_1", Amount: types.NewMoney(-600, "MYR"), Description: "withdrawal"})
+			require.NoError(t, err)
+			_, err = handler.ReverseTransaction("USER_ID_1", "DEPOSIT_2", CreateReversalRequest{TransactionID: "REVERSAL_4", Description: "refund"})
+			require.ErrorAs(t, err, &serviceErr)
+			assert.Equal(t, string(types.ErrorCodeInvalidAmount), serviceErr.Code)
+			assertBalance(100)
+
+			// the legs of a transfer are not reversed on their own
+			transfer, err := handler.CreateTransfer("USER_ID_1", CreateTransferRequest{TransferID: "TRANSFER_1", FromAccountNumber: "ACCOUNT_NUMBER_1", ToAccountNumber: "ACCOUNT_NUMBER_2", Amount: types.NewMoney(50, "MYR"), Description: "transfer"})
+			require.NoError(t, err)
+			_, err = handler.ReverseTransaction("USER_ID_1", transfer.Debit.TransactionID, CreateReversalRequest{TransactionID: "REVERSAL_4", Description: "refund"})
+			require.ErrorAs(t, err, &serviceErr)
+			assert.Equal(t, string(types.ErrorCodeInvalidStatusTransition), serviceErr.Code)
+
+			trialBalance, err := database.GetStorage().GetTrialBalance()
+			require.NoError(t, err)
+			var total int64
+			for _, line := range trialBalance {
+				total += line.Balance.Amount
+			}
+			assert.Zero(t, total)
+		})
+	}
+}
+
+func TestStatusBackends(t *testing.T) {
+	for name, database := range seededBackends(t) {
+		t.Run(name, func(t *testing.T) {
+			handler := New(database.GetStorage())
+			var serviceErr *types.ServiceError
+
+			// assertBalance checks the stored balance, the balance derived from the
+			// transaction history and the customer's ledger account all agree
+			assertBalance := func(want int64) {
+				t.Helper()
+
+				balance, err := handler.GetBalance("USER_ID_1", GetBalanceRequest{AccountNumber: "ACCOUNT_NUMBER_1"})
+				require.NoError(t, err)
+				assert.Equal(t, types.NewMoney(want, "MYR"), balance.Balances[0].Ledger)
+
+				derived, err := database.GetStorage().DeriveBalance("USER_ID_1", "ACCOUNT_NUMBER_1", "MYR")
+				require.NoError(t, err)
+				assert.Equal(t, types.NewMoney(want, "MYR"), derived)
+
+				trialBalance, err := database.GetStorage().GetTrialBalance()
+				require.NoError(t, err)
+				for _, line := range trialBalance {
+					if line.LedgerAccount == storage.CustomerLedgerAccount("USER_ID_1", "ACCOUNT_NUMBER_1") && line.Balance.Currency == "MYR" {
+						assert.Equal(t, -want, line.Balance.Amount)
+					}
+				}
+			}
+
+			// a pending deposit is not credited and can be cancelled
+			_, err := handler.CreateDeposit("USER_ID_1", CreateDepositRequest{TransactionID: "DEPOSIT_1", AccountNumber: "ACCOUNT_NUMBER_1", Amount: types.NewMoney(500, "MYR"), Description: "deposit"})
+			require.NoError(t, err)
+			assertBalance(1100)
+
+			cancelled, err := handler.CancelTransaction("USER_ID_1", "DEPOSIT_1", CancelTransactionRequest{Reason: "changed my mind"})
+			require.NoError(t, err)
+			assert.Equal(t, "cancelled", cancelled.Status)
+			assert.Equal(t, "changed my mind", cancelled.StatusReason)
+			require.Len(t, cancelled.StatusHistory, 2)
+			assert.Equal(t, StatusChange{To: "pending", CreatedAt: cancelled.StatusHistory[0].CreatedAt}, cancelled.StatusHistory[0])
+			assert.Equal(t, StatusChange{From: "pending", To: "cancelled", Reason: "changed my mind", CreatedAt: cancelled.StatusHistory[1].CreatedAt}, cancelled.StatusHistory[1])
+			assertBalance(1100)
+
+			_, err = handler.UpdateStatus("USER_ID_1", "DEPOSIT_1", UpdateStatusRequest{Status: "processing"})
+			require.ErrorAs(t, err, &serviceErr)
+			assert.Equal(t, string(types.ErrorCodeInvalidStatusTransition), serviceErr.Code)
+
+			// a withdrawal holds its funds while pending and releases them when it fails
+			_, err = handler.CreateWithdrawal("USER_ID_1", CreateWithdrawalRequest{TransactionID: "WITHDRAWAL_1", AccountNumber: "ACCOUNT_NUMBER_1", Amount: types.NewMoney(-300, "MYR"), Description: "withdrawal"})
+			require.NoError(t, err)
+			assertBalance(800)
+
+			_, err = handler.UpdateStatus("USER_ID_1", "WITHDRAWAL_1", UpdateStatusRequest{Status: "processing"})
+			require.NoError(t, err)
+			_, err = handler.CancelTransaction("USER_ID_1", "WITHDRAWAL_1", CancelTransactionRequest{})
+			require.ErrorAs(t, err, &serviceErr)
+			assert.Equal(t, string(types.ErrorCodeInvalidStatusTransition), serviceErr.Code)
+
+			failed, err := handler.UpdateStatus("USER_ID_1", "WITHDRAWAL_1", UpdateStatusRequest{Status: "failed", Reason: "declined by bank"})
+			require.NoError(t, err)
+			assert.Equal(t, "declined by bank", failed.StatusReason)
+			assertBalance(1100)
+
+			// a completed deposit is credited and final until it is reversed
+			_, err = handler.CreateDeposit("USER_ID_1", CreateDepositRequest{TransactionID: "DEPOSIT_2", AccountNumber: "ACCOUNT_NUMBER_1", Amount: types.NewMoney(200, "MYR"), Description: "deposit"})
+			require.NoError(t, err)
+			completeTransaction(t, handler, "USER_ID_1", "DEPOSIT_2")
+			assertBalance(1300)
+
+			_, err = handler.UpdateStatus("USER_ID_1", "DEPOSIT_2", UpdateStatusRequest{Status: "reversed"})
+			require.ErrorAs(t, err, &serviceErr)
+			assert.Equal(t, string(types.ErrorCodeInvalidStatusTransition), serviceErr.Code)
+			assertBalance(1300)
+		})
+	}
+}
+
+// TestAdminBackends covers operators acting on the data of other users through the admin API
+func TestAdminBackends(t *testing.T) {
+	for name, database := range seededBackends(t) {
+		t.Run(name, func(t *testing.T) {
+			handler := New(database.GetStorage())
+			admin := Operator{UserID: "ADMIN_ID", Role: types.RoleAdmin}
+			var serviceErr *types.ServiceError
+
+			_, err := handler.CreateDeposit("USER_ID_1", CreateDepositRequest{TransactionID: "DEPOSIT_1", AccountNumber: "ACCOUNT_NUMBER_1", Amount: types.NewMoney(500, "MYR"), Description: "deposit"})
+			require.NoError(t, err)
+			_, err = handler.CreateDeposit("USER_ID_2", CreateDepositRequest{TransactionID: "DEPOSIT_2", AccountNumber: "ACCOUNT_NUMBER_2", Amount: types.NewMoney(500, "MYR"), Description: "deposit"})
+			require.NoError(t, err)
+
+			// searches span every user
+			found, err := handler.SearchTransactions(SearchTransactionsRequest{GetTransactionsRequest: GetTransactionsRequest{Status: "pending"}})
+			require.NoError(t, err)
+			require.Len(t, found.Transactions, 2)
+			found, err = handler.SearchTransactions(SearchTransactionsRequest{UserID: "USER_ID_2", GetTransactionsRequest: GetTransactionsRequest{Status: "pending"}})
+			require.NoError(t, err)
+			require.Len(t, found.Transactions, 1)
+			assert.Equal(t, "DEPOSIT_2", found.Transactions[0].TransactionID)
+			assert.Equal(t, "ACCOUNT_NUMBER_2", found.Transactions[0].AccountNumber)
+
+			transaction, err := handler.FindTransaction("DEPOSIT_2")
+			require.NoError(t, err)
+			assert.Equal(t, "USER_ID_2", transaction.UserID)
+			require.Len(t, transaction.StatusHistory, 1)
+
+			// overrides go through the state machine and need a reason
+			_, err = handler.OverrideStatus(admin, "DEPOSIT_2", UpdateStatusRequest{Status: "processing"})
+			require.ErrorAs(t, err, &serviceErr)
+			assert.Equal(t, string(types.ErrorInvalidParams), serviceErr.Code)
+			_, err = handler.OverrideStatus(admin, "DEPOSIT_2", UpdateStatusRequest{Status: "completed", Reason: "settled manually"})
+			require.ErrorAs(t, err, &serviceErr)
+			assert.Equal(t, string(types.ErrorCodeInvalidStatusTransition), serviceErr.Code)
+
+			for _, status := range []string{"processing", "completed"} {
+				transaction, err = handler.OverrideStatus(admin, "DEPOSIT_2", UpdateStatusRequest{Status: status, Reason: "settled manually"})
+				require.NoError(t, err)
+			}
+			assert.Equal(t, "completed", transaction.Status)
+			assert.Equal(t, "USER_ID_2", transaction.UserID)
+			balance, err := handler.GetBalance("USER_ID_2", GetBalanceRequest{AccountNumber: "ACCOUNT_NUMBER_2"})
+			require.NoError(t, err)
+			assert.Equal(t, types.NewMoney(2500, "MYR"), balance.Balances[0].Ledger)
+
+			// frozen accounts cannot move funds in or out
+			_, err = handler.FreezeAccount(admin, "ACCOUNT_NUMBER_1", ChangeAccountStatusRequest{})
+			require.ErrorAs(t, err, &serviceErr)
+			assert.Equal(t, string(types.ErrorInvalidParams), serviceErr.Code)
+			_, err = handler.FreezeAccount(admin, "ACCOUNT_NUMBER_3", ChangeAccountStatusRequest{Reason: "fraud"})
+			require.ErrorAs(t, err, &serviceErr)
+			assert.Equal(t, string(types.NotFound), serviceErr.Code)
+
+			account, err := handler.FreezeAccount(admin, "ACCOUNT_NUMBER_1", ChangeAccountStatusRequest{Reason: "fraud"})
+			require.NoError(t, err)
+			assert.Equal(t, storage.AccountStatusFrozen, account.Status)
+			_, err = handler.FreezeAccount(admin, "ACCOUNT_NUMBER_1", ChangeAccountStatusRequest{Reason: "fraud"})
+			require.ErrorAs(t, err, &serviceErr)
+			assert.Equal(t, string(types.ErrorCodeInvalidStatusTransition), serviceErr.Code)
+
+			_, err = handler.CreateWithdrawal("USER_ID_1", CreateWithdrawalRequest{TransactionID: "WITHDRAWAL_1", AccountNumber: "ACCOUNT_NUMBER_1", Amount: types.NewMoney(-100, "MYR"), Description: "withdrawal"})
+			require.ErrorAs(t, err, &serviceErr)
+			assert.Equal(t, string(types.ErrorCodeAccountFrozen), serviceErr.Code)
+			_, err = handler.CreateTransfer("USER_ID_1", CreateTransferRequest{TransferID: "TRANSFER_1", FromAccountNumber: "ACCOUNT_NUMBER_1", ToAccountNumber: "ACCOUNT_NUMBER_2", Amount: types.NewMoney(100, "MYR"), Description: "transfer"})
+			require.ErrorAs(t, err, &serviceErr)
+			assert.Equal(t, string(types.ErrorCodeAccountFrozen), serviceErr.Code)
+
+			// funds can still be paid into a frozen account
+			_, err = handler.CreateTransfer("USER_ID_2", CreateTransferRequest{TransferID: "TRANSFER_1", FromAccountNumber: "ACCOUNT_NUMBER_2", ToAccountNumber: "ACCOUNT_NUMBER_1", Amount: types.NewMoney(100, "MYR"), Description: "transfer"})
+			require.NoError(t, err)
+
+			// settling transactions already in flight is still possible
+			_, err = handler.OverrideStatus(admin, "DEPOSIT_1", UpdateStatusRequest{Status: "cancelled", Reason: "frozen account"})
+			require.NoError(t, err)
+
+			account, err = handler.UnfreezeAccount(admin, "ACCOUNT_NUMBER_1", ChangeAccountStatusRequest{Reason: "cleared"})
+			require.NoError(t, err)
+			assert.Equal(t, storage.AccountStatusActive, account.Status)
+			_, err = handler.CreateWithdrawal("USER_ID_1", CreateWithdrawalRequest{TransactionID: "WITHDRAWAL_1", AccountNumber: "ACCOUNT_NUMBER_1", Amount: types.NewMoney(-100, "MYR"), Description: "withdrawal"})
+			require.NoError(t, err)
+
+			// every change is audited with the operator who made it, newest first
+			audit, err := handler.GetAuditEntries(GetAuditEntriesRequest{})
+			require.NoError(t, err)
+			require.Len(t, audit.Entries, 5)
+			assert.Equal(t, storage.AuditActionAccountUnfreeze, audit.Entries[0].Action)
+			assert.Equal(t, "frozen -> active", audit.Entries[0].Details)
+			assert.Equal(t, storage.AuditActionStatusOverride, audit.Entries[1].Action)
+			assert.Equal(t, "pending -> cancelled", audit.Entries[1].Details)
+			assert.Equal(t, storage.AuditActionAccountFreeze, audit.Entries[2].Action)
+			assert.Equal(t, "fraud", audit.Entries[2].Reason)
+			for _, entry := range audit.Entries {
+				assert.Equal(t, "ADMIN_ID", entry.OperatorID)
+				assert.Equal(t, types.RoleAdmin, entry.Role)
+			}
+
+			audit, err = handler.GetAuditEntries(GetAuditEntriesRequest{TargetType: storage.AuditTargetTransaction, TargetID: "DEPOSIT_2"})
+			require.NoError(t, err)
+			assert.Len(t, audit.Entries, 2)
+		})
+	}
+}
+
+func TestAccountBackends(t *testing.T) {
+	for name, database := range seededBackends(t) {
+		t.Run(name, func(t *testing.T) {
+			handler := New(database.GetStorage())
+			var serviceErr *types.ServiceError
+
+			_, err := handler.OpenAccount("USER_ID_1", OpenAccountRequest{Currencies: []string{"XYZ"}})
+			require.ErrorAs(t, err, &serviceErr)
+			assert.Equal(t, string(types.ErrorCodeInvalidCurrency), serviceErr.Code)
+
+			account, err := handler.OpenAccount("USER_ID_1", OpenAccountRequest{Currencies: []string{"MYR"}})
+			require.NoError(t, err)
+			assert.NoError(t, handler.accountNumbers.Validate(account.Number))
+			assert.Equal(t, storage.AccountStatusActive, account.Status)
+			assert.Equal(t, []string{"MYR"}, account.Currencies)
+			number := account.Number
+
+			accounts, err := handler.GetAccounts("USER_ID_1")
+			require.NoError(t, err)
+			require.Len(t, accounts.Accounts, 2)
+			assert.Equal(t, "ACCOUNT_NUMBER_1", accounts.Accounts[0].Number)
+			assert.Equal(t, number, accounts.Accounts[1].Number)
+
+			_, err = handler.GetAccount("USER_ID_2", number)
+			require.ErrorAs(t, err, &serviceErr)
+			assert.Equal(t, string(types.NotFound), serviceErr.Code)
+			_, err = handler.CloseAccount("USER_ID_2", number)
+			require.ErrorAs(t, err, &serviceErr)
+			assert.Equal(t, string(types.NotFound), serviceErr.Code)
+
+			// an account closes only once nothing is settling and every balance is zero
+			_, err = handler.CreateDeposit("USER_ID_1", CreateDepositRequest{TransactionID: "DEPOSIT_1", AccountNumber: number, Amount: types.NewMoney(100, "MYR"), Description: "deposit"})
+			require.NoError(t, err)
+			_, err = handler.CloseAccount("USER_ID_1", number)
+			require.ErrorAs(t, err, &serviceErr)
+			assert.Equal(t, string(types.ErrorCodeInvalidStatusTransition), serviceErr.Code)
+
+			completeTransaction(t, handler, "USER_ID_1", "DEPOSIT_1")
+			_, err = handler.CloseAccount("USER_ID_1", number)
+			require.ErrorAs(t, err, &serviceErr)
+			assert.Equal(t, string(types.ErrorCodeBalanceNotZero), serviceErr.Code)
+
+			_, err = handler.CreateWithdrawal("USER_ID_1", CreateWithdrawalRequest{TransactionID: "WITHDRAWAL_1", AccountNumber: number, Amount: types.NewMoney(-100, "MYR"), Description: "withdrawal"})
+			require.NoError(t, err)
+			completeTransaction(t, handler, "USER_ID_1", "WITHDRAWAL_1")
+
+			account, err = handler.CloseAccount("USER_ID_1", number)
+			require.NoError(t, err)
+			assert.Equal(t, storage.AccountStatusClosed, account.Status)
+			_, err = handler.CloseAccount("USER_ID_1", number)
+			require.ErrorAs(t, err, &serviceErr)
+			assert.Equal(t, string(types.ErrorCodeInvalidStatusTransition), serviceErr.Code)
+
+			// closed accounts reject every posting
+			_, err = handler.CreateDeposit("USER_ID_1", CreateDepositRequest{TransactionID: "DEPOSIT_2", AccountNumber: number, Amount: types.NewMoney(100, "MYR"), Description: "deposit"})
+			require.ErrorAs(t, err, &serviceErr)
+			assert.Equal(t, string(types.ErrorCodeAccountClosed), serviceErr.Code)
+			_, err = handler.CreateTransfer("USER_ID_2", CreateTransferRequest{TransferID: "TRANSFER_1", FromAccountNumber: "ACCOUNT_NUMBER_2", ToAccountNumber: number, Amount: types.NewMoney(100, "MYR"), Description: "transfer"})
+			require.ErrorAs(t, err, &serviceErr)
+			assert.Equal(t, string(types.ErrorCodeAccountClosed), serviceErr.Code)
+
+			// closed accounts are still listed
+			accounts, err = handler.GetAccounts("USER_ID_1")
+			require.NoError(t, err)
+			require.Len(t, accounts.Accounts, 2)
+			assert.Equal(t, storage.AccountStatusClosed, accounts.Accounts[1].Status)
+		})
+	}
+}
+
+// TestAccountStatusRaces checks a freeze or close landing while a posting is in flight is not ignored
+func TestAccountStatusRaces(t *testing.T) {
+	for name, database := range seededBackends(t) {
+		t.Run(name, func(t *testing.T) {
+			s := database.GetStorage()
+			handler := New(s)
+			var serviceErr *types.ServiceError
+
+			// the withdrawal reads the account before the freeze and waits for the lock held by it
+			unlock := s.LockAccount("USER_ID_1", "ACCOUNT_NUMBER_1")
+			done := make(chan error)
+			go func() {
+				_, err := handler.CreateWithdrawal("USER_ID_1", CreateWithdrawalRequest{TransactionID: "WITHDRAWAL_1", AccountNumber: "ACCOUNT_NUMBER_1", Amount: types.NewMoney(-100, "MYR"), Description: "withdrawal"})
+				done <- err
+			}()
+			time.Sleep(20 * time.Millisecond)
+			require.NoError(t, s.UpdateAccountStatus("USER_ID_1", "ACCOUNT_NUMBER_1", storage.AccountStatusActive, storage.AccountStatusFrozen))
+			unlock()
+			require.ErrorAs(t, <-done, &serviceErr)
+			assert.Equal(t, string(types.ErrorCodeAccountFrozen), serviceErr.Code)
+
+			unlock = s.LockAccount("USER_ID_1", "ACCOUNT_NUMBER_1")
+			go func() {
+				_, err := handler.CreateTransfer("USER_ID_2", CreateTransferRequest{TransferID: "TRANSFER_1", FromAccountNumber: "ACCOUNT_NUMBER_2", ToAccountNumber: "ACCOUNT_NUMBER_1", Amount: types.NewMoney(100, "MYR"), Description: "transfer"})
+				done <- err
+			}()
+			time.Sleep(20 * time.Millisecond)
+			require.NoError(t, s.UpdateAccountStatus("USER_ID_1", "ACCOUNT_NUMBER_1", storage.AccountStatusFrozen, storage.AccountStatusClosed))
+			unlock()
+			require.ErrorAs(t, <-done, &serviceErr)
+			assert.Equal(t, string(types.ErrorCodeAccountClosed), serviceErr.Code)
+
+			// a deposit settling into an account closed in the meantime fails instead of crediting it
+			_, err := handler.CreateDeposit("USER_ID_2", CreateDepositRequest{TransactionID: "DEPOSIT_1", AccountNumber: "ACCOUNT_NUMBER_2", Amount: types.NewMoney(500, "MYR"), Description: "deposit"})
+			require.NoError(t, err)
+			_, err = handler.UpdateStatus("USER_ID_2", "DEPOSIT_1", UpdateStatusRequest{Status: storage.TransactionStatusProcessing})
+			require.NoError(t, err)
+			require.NoError(t, s.UpdateAccountStatus("USER_ID_2", "ACCOUNT_NUMBER_2", storage.AccountStatusActive, storage.AccountStatusClosed))
+			deposit, err := handler.UpdateStatus("USER_ID_2", "DEPOSIT_1", UpdateStatusRequest{Status: storage.TransactionStatusCompleted})
+			require.NoError(t, err)
+			assert.Equal(t, storage.TransactionStatusFailed, deposit.Status)
+			balance, err := s.GetBalance("USER_ID_2", "ACCOUNT_NUMBER_2", "MYR")
+			require.NoError(t, err)
+			assert.Equal(t, types.NewMoney(2000, "MYR"), balance.Amount)
+		})
+	}
+}
+
+func TestBalanceHistoryBackends(t *testing.T) {
+	for name, database := range seededBackends(t) {
+		t.Run(name, func(t *testing.T) {
+			handler := New(database.GetStorage())
+			var serviceErr *types.ServiceError
+
+			time.Sleep(time.Millisecond)
+			beforeDeposit := time.Now()
+			time.Sleep(time.Millisecond)
+			_, err := handler.CreateDeposit("USER_ID_1", CreateDepositRequest{TransactionID: "DEPOSIT_1", AccountNumber: "ACCOUNT_NUMBER_1", Amount: types.NewMoney(500, "MYR"), Description: "deposit"})
+			require.NoError(t, err)
+			completeTransaction(t, handler, "USER_ID_1", "DEPOSIT_1")
+
+			// the balances of the past are rebuilt from the transaction log
+			balances, err := handler.GetBalanceAt("USER_ID_1", GetBalanceAtRequest{AccountNumber: "ACCOUNT_NUMBER_1", AsOf: beforeDeposit})
+			require.NoError(t, err)
+			assert.Equal(t, []types.Money{types.NewMoney(1100, "MYR"), types.NewMoney(0, "USD")}, balances.Balances)
+			balances, err = handler.GetBalanceAt("USER_ID_1", GetBalanceAtRequest{AccountNumber: "ACCOUNT_NUMBER_1", AsOf: time.Now()})
+			require.NoError(t, err)
+			assert.Equal(t, []types.Money{types.NewMoney(1600, "MYR"), types.NewMoney(0, "USD")}, balances.Balances)
+			balances, err = handler.GetBalanceAt("USER_ID_1", GetBalanceAtRequest{AccountNumber: "ACCOUNT_NUMBER_1", AsOf: time.Now().Add(-24 * time.Hour)})
+			require.NoError(t, err)
+			assert.Equal(t, []types.Money{types.NewMoney(1100, "MYR"), types.NewMoney(0, "USD")}, balances.Balances)
+			// the seeded transactions are dated when the accounts were opened
+			balances, err = handler.GetBalanceAt("USER_ID_1", GetBalanceAtRequest{AccountNumber: "ACCOUNT_NUMBER_1", AsOf: time.Date(2022, 1, 31, 0, 0, 0, 0, time.UTC)})
+			require.NoError(t, err)
+			assert.Equal(t, []types.Money{types.NewMoney(0, "MYR"), types.NewMoney(0, "USD")}, balances.Balances)
+
+			_, err = handler.GetBalanceAt("USER_ID_1", GetBalanceAtRequest{AccountNumber: "ACCOUNT_NUMBER_1", AsOf: time.Now().Add(time.Hour)})
+			require.ErrorAs(t, err, &serviceErr)
+			assert.Equal(t, string(types.ErrorInvalidParams), serviceErr.Code)
+			_, err = handler.GetBalanceAt("USER_ID_2", GetBalanceAtRequest{AccountNumber: "ACCOUNT_NUMBER_1", AsOf: time.Now()})
+			require.ErrorAs(t, err, &serviceErr)
+			assert.Equal(t, string(types.NotFound), serviceErr.Code)
+
+			// the period still running closes with the balance now
+			to := time.Now().Truncate(time.Hour).Add(time.Hour)
+			history, err := handler.GetBalanceHistory("USER_ID_1", GetBalanceHistoryRequest{AccountNumber: "ACCOUNT_NUMBER_1", Currency: "MYR", From: to.Add(-3 * time.Hour), To: to, Interval: BalanceIntervalHour})
+			require.NoError(t, err)
+			require.Len(t, history.Series, 1)
+			assert.Equal(t, "MYR", history.Series[0].Currency)
+			points := history.Series[0].Points
+			require.Len(t, points, 3)
+			assert.Equal(t, types.NewMoney(1100, "MYR"), points[0].Closing)
+			assert.Equal(t, types.NewMoney(1600, "MYR"), points[2].Closing)
+			assert.Equal(t, to, points[2].To)
+
+			history, err = handler.GetBalanceHistory("USER_ID_1", GetBalanceHistoryRequest{AccountNumber: "ACCOUNT_NUMBER_1", From: to.Add(-36 * time.Hour), To: to})
+			require.NoError(t, err)
+			assert.Equal(t, BalanceIntervalDay, history.Interval)
+			require.Len(t, history.Series, 2)
+			require.Len(t, history.Series[1].Points, 2)
+			assert.Equal(t, to, history.Series[1].Points[1].To)
+
+			// periods yet to start are left out
+			history, err = handler.GetBalanceHistory("USER_ID_1", GetBalanceHistoryRequest{AccountNumber: "ACCOUNT_NUMBER_1", Currency: "MYR", From: to.Add(-time.Hour), To: to.Add(3 * time.Hour), Interval: BalanceIntervalHour})
+			require.NoError(t, err)
+			require.Len(t, history.Series[0].Points, 1)
+			assert.Equal(t, types.NewMoney(1600, "MYR"), history.Series[0].Points[0].Closing)
+
+			for _, req := range []GetBalanceHistoryRequest{
+				{AccountNumber: "ACCOUNT_NUMBER_1", From: to, To: to.Add(-time.Hour)},
+				{AccountNumber: "ACCOUNT_NUMBER_1", From: to.Add(-time.Hour), To: to, Interval: "minute"},
+				{AccountNumber: "ACCOUNT_NUMBER_1", From: to.Add(-800 * time.Hour), To: to, Interval: BalanceIntervalHour},
+			} {
+				_, err = handler.GetBalanceHistory("USER_ID_1", req)
+				require.ErrorAs(t, err, &serviceErr)
+				assert.Equal(t, string(types.ErrorInvalidParams), serviceErr.Code)
+			}
+			_, err = handler.GetBalanceHistory("USER_ID_1", GetBalanceHistoryRequest{AccountNumber: "ACCOUNT_NUMBER_1", Currency: "SGD", From: to.Add(-time.Hour), To: to})
+			require.ErrorAs(t, err, &serviceErr)
+			assert.Equal(t, string(types.ErrorCodeCurrencyMismatch), serviceErr.Code)
+		})
+	}
+}
+
+func TestConcurrentWithdrawals(t *testing.T) {
+	for name, database := range seededBackends(t) {
+		t.Run(name, func(t *testing.T) {
+			handler := New(database.GetStorage())
+			_, err := handler.CreateDeposit("USER_ID_1", CreateDepositRequest{
+				TransactionID: "DEPOSIT_1",
+				AccountNumber: "ACCOUNT_NUMBER_1",
+				// topping up the seeded 1100 to 2000
+				Amount:      types.NewMoney(900, "MYR"),
+				Description: "deposit",
+			})
+			require.NoError(t, err)
+			completeTransaction(t, handler, "USER_ID_1", "DEPOSIT_1")
+
+			var wg sync.WaitGroup
+			var succeeded atomic.Int32
+			for i := range 20 {
+				wg.Add(1)
+				go func() {
+					defer wg.Done()
+					_, err := handler.CreateWithdrawal("USER_ID_1", CreateWithdrawalRequest{
+						TransactionID: fmt.Sprintf("WITHDRAWAL_%d", i),
+						AccountNumber: "ACCOUNT_NUMBER_1",
+						Amount:        types.NewMoney(-200, "MYR"),
+						Description:   "withdrawal",
+					})
+					if err == nil {
+						succeeded.Add(1)
+					}
+				}()
+			}
+			wg.Wait()
+
+			balance, err := handler.GetBalance("USER_ID_1", GetBalanceRequest{AccountNumber: "ACCOUNT_NUMBER_1"})
+			require.NoError(t, err)
+			assert.Equal(t, int64(0), balance.Balances[0].Ledger.Amount)
+			assert.Equal(t, int32(10), succeeded.Load())
+		})
+	}
+}
@@ -0,0 +1,259 @@
+package transaction
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/alienxp03/teya-ledger/handler/fx"
+	"github.com/alienxp03/teya-ledger/storage"
+	"github.com/alienxp03/teya-ledger/types"
+)
+
+// CreateQuote prices the conversion of an amount between two currencies held by the
+// same account. The quote can be executed with CreateConversion until it expires.
+func (t TransactionHandler) CreateQuote(userID string, req CreateQuoteRequest) (*CreateQuoteResponse, error) {
+	if t.quoter == nil {
+		return nil, conversionsDisabled()
+	}
+
+	if req.Amount.Currency == req.To {
+		return nil, types.NewBadRequest(types.ErrorInvalidParams, "cannot convert a currency to itself")
+	}
+	if !req.Amount.IsPositive() {
+		return nil, types.NewBadRequest(types.ErrorCodeInvalidAmount, "amount must be positive")
+	}
+
+	account, err := t.storage.GetAccount(userID, req.AccountNumber)
+	if err != nil {
+		return nil, types.NewNotFound(err.Error())
+	}
+	if err := checkDebit(account); err != nil {
+		return nil, err
+	}
+	for _, currency := range []string{req.Amount.Currency, req.To} {
+		if !account.HoldsCurrency(currency) {
+			return nil, currencyMismatch(account, currency)
+		}
+	}
+
+	quote, err := t.quoter.Quote(fx.QuoteRequest{
+		UserID:        userID,
+		AccountNumber: req.AccountNumber,
+		Source:        req.Amount,
+		To:            req.To,
+	})
+	if errors.Is(err, fx.ErrRateNotFound) {
+		return nil, types.NewBadRequest(types.ErrorCodeRateNotFound, err.Error())
+	}
+	if err != nil {
+		return nil, types.NewBadRequest(types.ErrorCodeInvalidAmount, err.Error())
+	}
+
+	if !quote.Target.IsPositive() {
+		t.quoter.Remove(quote.QuoteID)
+		return nil, types.NewBadRequest(types.ErrorCodeInvalidAmount, "amount is too small to convert")
+	}
+
+	return &CreateQuoteResponse{Quote: newQuote(quote)}, nil
+}
+
+// CreateConversion executes a quote, debiting the source currency balance and crediting
+// the target currency balance of the quoted account. Both legs share the conversion ID,
+// which is also the idempotency key, and record the quoted rate and spread.
+func (t TransactionHandler) CreateConversion(userID string, req CreateConversionRequest) (*CreateConversionResponse, error) {
+	if t.quoter == nil {
+		return nil, conversionsDisabled()
+	}
+
+	// The quote is gone once executed, so a retry is answered with the conversion it made
+	if existing, err := t.existingConversion(userID, req.ConversionID, req.QuoteID); existing != nil || err != nil {
+		return existing, err
+	}
+
+	quote, err := t.getQuote(userID, req.QuoteID)
+	if err != nil {
+		return nil, err
+	}
+
+	account, err := t.storage.GetAccount(userID, quote.AccountNumber)
+	if err != nil {
+		return nil, types.NewNotFound(err.Error())
+	}
+	if err := checkDebit(account); err != nil {
+		return nil, err
+	}
+	for _, currency := range []string{quote.Source.Currency, quote.Target.Currency} {
+		if !account.HoldsCurrency(currency) {
+			return nil, currencyMismatch(account, currency)
+		}
+	}
+
+	unlock := t.storage.LockAccount(userID, quote.AccountNumber)
+	defer unlock()
+
+	// Check the quote again under the lock so it cannot be executed twice, and the account
+	// as it may have been frozen or closed since
+	if existing, err := t.existingConversion(userID, req.ConversionID, req.QuoteID); existing != nil || err != nil {
+		return existing, err
+	}
+	if quote, err = t.getQuote(userID, req.QuoteID); err != nil {
+		return nil, err
+	}
+	if err := checkLocked(t.storage, account, checkDebit); err != nil {
+		return nil, err
+	}
+
+	sold, err := negate(quote.Source)
+	if err != nil {
+		return nil, err
+	}
+	bought, err := negate(quote.Target)
+	if err != nil {
+		return nil, err
+	}
+
+	var debit, credit *storage.Transaction
+	err = t.storage.WithTx(func(tx storage.Storage) error {
+		available, err := availableBalance(tx, userID, quote.AccountNumber, quote.Source.Currency)
+		if err != nil {
+			return err
+		}
+
+		if err := checkFunds(available, quote.Source); err != nil {
+			return err
+		}
+
+		debit = &storage.Transaction{
+			TransactionID: req.ConversionID + "-debit",
+			Type:          storage.TransactionTypeConversionOut,
+			Status:        storage.TransactionStatusCompleted,
+			Amount:        sold,
+			Description:   req.Description,
+			UserID:        userID,
+			AccountNumber: quote.AccountNumber,
+			ConversionID:  req.ConversionID,
+			Rate:          quote.Rate,
+			Spread:        quote.Spread,
+		}
+		if err := tx.CreateTransaction(debit); err != nil {
+			return err
+		}
+
+		credit = &storage.Transaction{
+			TransactionID: req.ConversionID + "-credit",
+			Type:          storage.TransactionTypeConversionIn,
+			Status:        storage.TransactionStatusCompleted,
+			Amount:        quote.Target,
+			Description:   req.Description,
+			UserID:        userID,
+			AccountNumber: quote.AccountNumber,
+			ConversionID:  req.ConversionID,
+			Rate:          quote.Rate,
+			Spread:        quote.Spread,
+		}
+		if err := tx.CreateTransaction(credit); err != nil {
+			return err
+		}
+
+		if err := updateBalance(tx, userID, quote.AccountNumber, sold); err != nil {
+			return err
+		}
+		if err := updateBalance(tx, userID, quote.AccountNumber, quote.Target); err != nil {
+			return err
+		}
+
+		// The FX position takes the currency the customer sells and gives the one they buy,
+		// so the entry balances in each currency on its own
+		customer := storage.CustomerLedgerAccount(userID, quote.AccountNumber)
+		return tx.PostJournalEntry(&storage.JournalEntry{
+			Reference:   req.ConversionID,
+			Description: req.Description,
+			Postings: []storage.Posting{
+				{LedgerAccount: customer, Amount: quote.Source},
+				{LedgerAccount: storage.LedgerAccountFXPosition, Amount: sold},
+				{LedgerAccount: storage.LedgerAccountFXPosition, Amount: quote.Target},
+				{LedgerAccount: customer, Amount: bought},
+			},
+		})
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	t.quoter.Remove(quote.QuoteID)
+
+	return &CreateConversionResponse{
+		ConversionID: req.ConversionID,
+		Debit:        newTransaction(debit),
+		Credit:       newTransaction(credit),
+	}, nil
+}
+
+// existingConversion returns the conversion made with conversionID, nil when there is none.
+// A retry naming a quote that can still be executed is rejected unless the conversion was made
+// on the same terms, or the client would believe it converted at that quote's rate.
+func (t TransactionHandler) existingConversion(userID string, conversionID string, quoteID string) (*CreateConversionResponse, error) {
+	debit, err := t.storage.GetTransaction(userID, conversionID+"-debit")
+	if errors.Is(err, storage.ErrNotFound) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if debit.ConversionID != conversionID {
+		return nil, types.NewBadRequest(types.ErrorInvalidParams, fmt.Sprintf("transaction %s is not a leg of conversion %s", debit.TransactionID, conversionID))
+	}
+
+	credit, err := t.storage.GetTransaction(userID, conversionID+"-credit")
+	if err != nil {
+		return nil, err
+	}
+	if quote, err := t.quoter.Get(userID, quoteID); err == nil && !madeWith(debit, credit, quote) {
+		return nil, types.NewUnprocessableEntity(types.ErrorCodeIdempotencyKeyReused,
+			fmt.Sprintf("conversion %s was made with a different quote", conversionID))
+	}
+
+	return &CreateConversionResponse{
+		ConversionID: conversionID,
+		Debit:        newTransaction(debit),
+		Credit:       newTransaction(credit),
+	}, nil
+}
+
+// madeWith reports whether the legs of a conversion are the ones quote would have posted
+func madeWith(debit *storage.Transaction, credit *storage.Transaction, quote *fx.Quote) bool {
+	sold, err := quote.Source.Neg()
+	if err != nil {
+		return false
+	}
+	return debit.AccountNumber == quote.AccountNumber && debit.Amount == sold && credit.Amount == quote.Target &&
+		debit.Rate == quote.Rate && debit.Spread == quote.Spread
+}
+
+func (t TransactionHandler) getQuote(userID string, quoteID string) (*fx.Quote, error) {
+	quote, err := t.quoter.Get(userID, quoteID)
+	if errors.Is(err, fx.ErrQuoteExpired) {
+		return nil, types.NewBadRequest(types.ErrorCodeQuoteExpired, fmt.Sprintf("quote %s has expired", quoteID))
+	}
+	if err != nil {
+		return nil, types.NewNotFound(fmt.Sprintf("quote %s not found", quoteID))
+	}
+
+	return quote, nil
+}
+
+func conversionsDisabled() error {
+	return types.NewBadRequest(types.BadRequest, "currency conversions are not enabled")
+}
+
+func newQuote(quote *fx.Quote) Quote {
+	return Quote{
+		QuoteID:       quote.QuoteID,
+		AccountNumber: quote.AccountNumber,
+		Source:        quote.Source,
+		Target:        quote.Target,
+		Rate:          quote.Rate,
+		Spread:        quote.Spread,
+		ExpiresAt:     quote.ExpiresAt,
+	}
+}
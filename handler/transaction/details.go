@@ -0,0 +1,78 @@
+package transaction
+
+import (
+	"fmt"
+	"slices"
+	"unicode/utf8"
+
+	"github.com/alienxp03/teya-ledger/storage"
+	"github.com/alienxp03/teya-ledger/types"
+)
+
+// Bounds on the details of a transaction, which are stored with it and returned on every read
+const (
+	maxMetadataKeys        = 20
+	maxMetadataKeyLength   = 40
+	maxMetadataValueLength = 500
+	maxTags                = 10
+	maxTagLength           = 40
+	maxReferenceLength     = 140
+	categoryCodeLength     = 4
+)
+
+// checkDetails fails when the details of a transaction are over their bounds
+func checkDetails(details storage.Details) error {
+	if len(details.Metadata) > maxMetadataKeys {
+		return invalidDetails("metadata has %d keys, at most %d are allowed", len(details.Metadata), maxMetadataKeys)
+	}
+	for key, value := range details.Metadata {
+		if key == "" || utf8.RuneCountInString(key) > maxMetadataKeyLength {
+			return invalidDetails("metadata key %q must be 1 to %d characters", key, maxMetadataKeyLength)
+		}
+		if utf8.RuneCountInString(value) > maxMetadataValueLength {
+			return invalidDetails("metadata value of %q is longer than %d characters", key, maxMetadataValueLength)
+		}
+	}
+
+	if len(details.Tags) > maxTags {
+		return invalidDetails("%d tags given, at most %d are allowed", len(details.Tags), maxTags)
+	}
+	for i, tag := range details.Tags {
+		if tag == "" || utf8.RuneCountInString(tag) > maxTagLength {
+			return invalidDetails("tag %q must be 1 to %d characters", tag, maxTagLength)
+		}
+		if slices.Contains(details.Tags[:i], tag) {
+			return invalidDetails("tag %q is given twice", tag)
+		}
+	}
+
+	for name, value := range map[string]string{
+		"counterparty name":      details.Counterparty.Name,
+		"counterparty reference": details.Counterparty.Reference,
+		"external reference":     details.ExternalReference,
+	} {
+		if utf8.RuneCountInString(value) > maxReferenceLength {
+			return invalidDetails("%s is longer than %d characters", name, maxReferenceLength)
+		}
+	}
+
+	code := details.Counterparty.CategoryCode
+	if code != "" && (len(code) != categoryCodeLength || !isDigits(code)) {
+		return invalidDetails("category code %q must be %d digits", code, categoryCodeLength)
+	}
+
+	return nil
+}
+
+func invalidDetails(format string, args ...any) error {
+	return types.NewBadRequest(types.ErrorInvalidParams, fmt.Sprintf(format, args...))
+}
+
+func isDigits(s string) bool {
+	for _, r := range s {
+		if r < '0' || r > '9' {
+			return false
+		}
+	}
+	return true
+}
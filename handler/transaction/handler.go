@@ -1,9 +1,12 @@
 package transaction
 
 import (
+	"errors"
 	"fmt"
 	"time"
 
+	"github.com/alienxp03/teya-ledger/handler/account"
+	"github.com/alienxp03/teya-ledger/handler/fx"
 	"github.com/alienxp03/teya-ledger/storage"
 	"github.com/alienxp03/teya-ledger/types"
 )
@@ -14,123 +17,235 @@ type Transactioner interface {
 	CreateDeposit(userID string, req CreateDepositRequest) (*CreateDepositResponse, error)
 	CreateWithdrawal(userID string, req CreateWithdrawalRequest) (*CreateWithdrawalResponse, error)
 	GetBalance(userID string, req GetBalanceRequest) (*GetBalanceResponse, error)
+	GetBalanceAt(userID string, req GetBalanceAtRequest) (*GetBalanceAtResponse, error)
+	GetBalanceHistory(userID string, req GetBalanceHistoryRequest) (*GetBalanceHistoryResponse, error)
 	GetTransaction(userID string, transactionID string) (*Transaction, error)
+	CreateTransfer(userID string, req CreateTransferRequest) (*CreateTransferResponse, error)
+	CreateQuote(userID string, req CreateQuoteRequest) (*CreateQuoteResponse, error)
+	CreateConversion(userID string, req CreateConversionRequest) (*CreateConversionResponse, error)
+	CancelTransaction(userID string, transactionID string, req CancelTransactionRequest) (*Transaction, error)
+	ReverseTransaction(userID string, transactionID string, req CreateReversalRequest) (*CreateReversalResponse, error)
+	CreateHold(userID string, req CreateHoldRequest) (*CreateHoldResponse, error)
+	GetHold(userID string, holdID string) (*Hold, error)
+	CaptureHold(userID string, holdID string, req CaptureHoldRequest) (*CaptureHoldResponse, error)
+	VoidHold(userID string, holdID string) (*Hold, error)
+	OpenAccount(userID string, req OpenAccountRequest) (*Account, error)
+	GetAccounts(userID string) (*GetAccountsResponse, error)
+	GetAccount(userID string, accountNumber string) (*Account, error)
+	CloseAccount(userID string, accountNumber string) (*Account, error)
 }
 
 type TransactionHandler struct {
-	storage storage.Storage
+	storage        storage.Storage
+	quoter         *fx.Quoter
+	holdTTL        time.Duration
+	accountNumbers *account.Scheme
 }
 
-func New(storage storage.Storage) *TransactionHandler {
-	return &TransactionHandler{
-		storage: storage,
+// Option configures optional features of a TransactionHandler
+type Option func(*TransactionHandler)
+
+// WithHoldTTL sets how long a hold reserves funds before it expires
+func WithHoldTTL(ttl time.Duration) Option {
+	return func(t *TransactionHandler) {
+		t.holdTTL = ttl
+	}
+}
+
+// WithQuoter enables currency conversions priced by quoter
+func WithQuoter(quoter *fx.Quoter) Option {
+	return func(t *TransactionHandler) {
+		t.quoter = quoter
+	}
+}
+
+// WithAccountNumbers gives new accounts numbers generated by scheme
+func WithAccountNumbers(scheme *account.Scheme) Option {
+	return func(t *TransactionHandler) {
+		t.accountNumbers = scheme
 	}
 }
 
+func New(storage storage.Storage, opts ...Option) *TransactionHandler {
+	handler := &TransactionHandler{
+		storage:        storage,
+		holdTTL:        defaultHoldTTL,
+		accountNumbers: account.Default(),
+	}
+	for _, opt := range opts {
+		opt(handler)
+	}
+	return handler
+}
+
+// CreateDeposit records a pending deposit and queues it for settlement. The account is
+// credited once the deposit completes.
 func (t TransactionHandler) CreateDeposit(userID string, req CreateDepositRequest) (*CreateDepositResponse, error) {
-	if _, err := t.storage.GetAccount(userID, req.AccountNumber); err != nil {
-		return nil, types.NewNotFound(err.Error())
+	if err := checkDetails(req.Details); err != nil {
+		return nil, err
 	}
 
-	transaction, err := t.storage.CreateDeposit(&storage.Transaction{
-		TransactionID: req.TransactionID,
-		AccountNumber: req.AccountNumber,
-		UserID:        userID,
-		Status:        "pending",
-		Amount:        req.Amount,
-		Currency:      req.Currency,
-		Description:   req.Description,
-	})
+	account, err := t.storage.GetAccount(userID, req.AccountNumber)
 	if err != nil {
+		return nil, types.NewNotFound(err.Error())
+	}
+	if err := checkCredit(account); err != nil {
 		return nil, err
 	}
-
-	// Update balance
-	if err := t.storage.UpdateBalance(userID, req.AccountNumber, req.Amount); err != nil {
-		return nil, types.NewBadRequest(types.BadRequest, err.Error())
+	if !account.HoldsCurrency(req.Amount.Currency) {
+		return nil, currencyMismatch(account, req.Amount.Currency)
 	}
 
-	// Start background status update
-	t.updateTransaction(transaction.TransactionID)
+	// Hold the account and read it again, it may have been closed since it was first read
+	unlock := t.storage.LockAccount(userID, req.AccountNumber)
+	defer unlock()
 
-	return &CreateDepositResponse{Transaction: Transaction{
-		TransactionID: transaction.TransactionID,
-		Status:        transaction.Status,
-		Amount:        transaction.Amount,
-		Currency:      transaction.Currency,
-		Description:   transaction.Description,
-		CreatedAt:     transaction.CreatedAt,
-		UpdatedAt:     transaction.UpdatedAt,
-	}}, nil
+	var transaction *storage.Transaction
+	err = t.storage.WithTx(func(tx storage.Storage) error {
+		if err := checkLocked(tx, account, checkCredit); err != nil {
+			return err
+		}
+
+		var err error
+		transaction, err = tx.CreateDeposit(&storage.Transaction{
+			TransactionID: req.TransactionID,
+			AccountNumber: req.AccountNumber,
+			UserID:        userID,
+			Type:          storage.TransactionTypeDeposit,
+			Status:        storage.TransactionStatusPending,
+			Amount:        req.Amount,
+			Description:   req.Description,
+			Details:       req.Details,
+		})
+		if err != nil {
+			return err
+		}
+
+		return enqueueSettlement(tx, transaction)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return &CreateDepositResponse{Transaction: newTransaction(transaction)}, nil
 }
 
 func (t TransactionHandler) GetTransactions(userID string, req GetTransactionsRequest) (*GetTransactionsResponse, error) {
-	transactionsData, err := t.storage.GetTransactions(userID, req.AccountNumber, req.Limit, req.Page)
+	page, err := t.storage.GetTransactions(transactionQuery(userID, req))
+	if errors.Is(err, storage.ErrInvalidCursor) || errors.Is(err, storage.ErrInvalidQuery) {
+		return nil, types.NewBadRequest(types.ErrorInvalidParams, err.Error())
+	}
 	if err != nil {
 		return nil, err
 	}
 
 	transactions := []Transaction{}
-	for _, transaction := range transactionsData {
-		transactions = append(transactions, Transaction{
-			TransactionID: transaction.TransactionID,
-			Status:        transaction.Status,
-			Amount:        transaction.Amount,
-			Currency:      transaction.Currency,
-			Description:   transaction.Description,
-			CreatedAt:     transaction.CreatedAt,
-			UpdatedAt:     transaction.UpdatedAt,
-		})
+	for _, transaction := range page.Transactions {
+		transactions = append(transactions, newTransaction(transaction))
 	}
 
-	return &GetTransactionsResponse{Transactions: transactions}, nil
+	return &GetTransactionsResponse{
+		Transactions: transactions,
+		NextCursor:   page.NextCursor,
+		HasMore:      page.HasMore,
+	}, nil
+}
+
+func transactionQuery(userID string, req GetTransactionsRequest) storage.TransactionQuery {
+	return storage.TransactionQuery{
+		UserID:            userID,
+		AccountNumber:     req.AccountNumber,
+		Status:            req.Status,
+		Type:              req.Type,
+		MinAmount:         req.MinAmount,
+		MaxAmount:         req.MaxAmount,
+		CreatedFrom:       req.CreatedFrom,
+		CreatedTo:         req.CreatedTo,
+		Description:       req.Description,
+		Tag:               req.Tag,
+		Metadata:          req.Metadata,
+		ExternalReference: req.ExternalReference,
+		CounterpartyName:  req.CounterpartyName,
+		CategoryCode:      req.CategoryCode,
+		SortBy:            req.SortBy,
+		SortOrder:         req.SortOrder,
+		Limit:             req.Limit,
+		Page:              req.Page,
+		Cursor:            req.Cursor,
+	}
 }
 
+// CreateWithdrawal records a pending withdrawal and queues it for settlement. The funds are taken from the balance
+// straight away and released again if the withdrawal fails or is cancelled.
 func (t TransactionHandler) CreateWithdrawal(userID string, req CreateWithdrawalRequest) (*CreateWithdrawalResponse, error) {
-	if _, err := t.storage.GetAccount(userID, req.AccountNumber); err != nil {
-		return nil, types.NewNotFound(err.Error())
+	if err := checkDetails(req.Details); err != nil {
+		return nil, err
 	}
 
-	balance, err := t.storage.GetBalance(userID, req.AccountNumber)
+	account, err := t.storage.GetAccount(userID, req.AccountNumber)
 	if err != nil {
-		return nil, types.NewBadRequest(types.BadRequest, err.Error())
+		return nil, types.NewNotFound(err.Error())
+	}
+	if err := checkDebit(account); err != nil {
+		return nil, err
 	}
+	if !account.HoldsCurrency(req.Amount.Currency) {
+		return nil, currencyMismatch(account, req.Amount.Currency)
+	}
+
+	// Hold the account until the balance is updated so concurrent withdrawals
+	// cannot both pass the balance check and overdraw the account
+	unlock := t.storage.LockAccount(userID, req.AccountNumber)
+	defer unlock()
 
-	if balance.Amount < -req.Amount {
-		return nil, types.NewBadRequest(types.ErrorCodeInvalidAmount, "insufficient balance")
+	if err := checkLocked(t.storage, account, checkDebit); err != nil {
+		return nil, err
 	}
 
-	transaction, err := t.storage.CreateWithdrawal(&storage.Transaction{
-		TransactionID: req.TransactionID,
-		Status:        "pending",
-		Amount:        req.Amount,
-		Currency:      req.Currency,
-		Description:   req.Description,
-		UserID:        userID,
-		AccountNumber: req.AccountNumber,
-	})
+	available, err := availableBalance(t.storage, userID, req.AccountNumber, req.Amount.Currency)
 	if err != nil {
 		return nil, err
 	}
 
-	if err := t.storage.UpdateBalance(userID, req.AccountNumber, req.Amount); err != nil {
-		return nil, types.NewBadRequest(types.BadRequest, err.Error())
+	debit, err := negate(req.Amount)
+	if err != nil {
+		return nil, err
+	}
+	if err := checkFunds(available, debit); err != nil {
+		return nil, err
 	}
 
-	t.updateTransaction(transaction.TransactionID)
+	var transaction *storage.Transaction
+	err = t.storage.WithTx(func(tx storage.Storage) error {
+		var err error
+		transaction, err = tx.CreateWithdrawal(&storage.Transaction{
+			TransactionID: req.TransactionID,
+			Type:          storage.TransactionTypeWithdrawal,
+			Status:        storage.TransactionStatusPending,
+			Amount:        req.Amount,
+			Description:   req.Description,
+			Details:       req.Details,
+			UserID:        userID,
+			AccountNumber: req.AccountNumber,
+		})
+		if err != nil {
+			return err
+		}
 
-	return &CreateWithdrawalResponse{Transaction: Transaction{
-		TransactionID: transaction.TransactionID,
-		Status:        transaction.Status,
-		Amount:        transaction.Amount,
-		Currency:      transaction.Currency,
-		Description:   transaction.Description,
-		CreatedAt:     transaction.CreatedAt,
-		UpdatedAt:     transaction.UpdatedAt,
-	}}, nil
+		if err := postTransaction(tx, transaction, transaction.Amount, storage.LedgerAccountCashInTransit); err != nil {
+			return err
+		}
+
+		return enqueueSettlement(tx, transaction)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return &CreateWithdrawalResponse{Transaction: newTransaction(transaction)}, nil
 }
 
-// GetBalance retrieves the current balance for an account
+// GetBalance retrieves the current ledger and available balances of an account in every currency it holds
 func (h *TransactionHandler) GetBalance(userID string, req GetBalanceRequest) (*GetBalanceResponse, error) {
 	// Validate that the account belongs to the user
 	if _, err := h.storage.GetAccount(userID, req.AccountNumber); err != nil {
@@ -138,42 +253,97 @@ func (h *TransactionHandler) GetBalance(userID string, req GetBalanceRequest) (*
 	}
 
 	// Get balance directly from storage
-	balance, err := h.storage.GetBalance(userID, req.AccountNumber)
+	balances, err := h.storage.GetBalances(userID, req.AccountNumber)
 	if err != nil {
 		return nil, types.NewBadRequest(types.BadRequest, err.Error())
 	}
 
-	return &GetBalanceResponse{
-		Amount:   balance.Amount,
-		Currency: balance.Currency,
-	}, nil
+	result := &GetBalanceResponse{Balances: []Balance{}}
+	for _, balance := range balances {
+		available, err := availableBalance(h.storage, userID, req.AccountNumber, balance.Amount.Currency)
+		if err != nil {
+			return nil, err
+		}
+		result.Balances = append(result.Balances, Balance{Ledger: balance.Amount, Available: available})
+	}
+
+	return result, nil
 }
 
-// GetTransaction retrieves the current status of a transaction
+// GetTransaction retrieves the current status of a transaction together with its status history and reversals
 func (t TransactionHandler) GetTransaction(userID string, transactionID string) (*Transaction, error) {
 	transaction, err := t.storage.GetTransaction(userID, transactionID)
 	if err != nil {
 		return nil, types.NewNotFound("transaction not found")
 	}
 
-	return &Transaction{
+	changes, err := t.storage.GetStatusChanges(transactionID)
+	if err != nil {
+		return nil, types.NewBadRequest(types.BadRequest, err.Error())
+	}
+
+	result := newTransaction(transaction)
+	for _, change := range changes {
+		result.StatusHistory = append(result.StatusHistory, StatusChange{
+			From:      change.From,
+			To:        change.To,
+			Reason:    change.Reason,
+			CreatedAt: change.CreatedAt,
+		})
+	}
+
+	reversals, err := t.storage.GetReversals(userID, transactionID)
+	if err != nil {
+		return nil, types.NewBadRequest(types.BadRequest, err.Error())
+	}
+	for _, reversal := range reversals {
+		result.Reversals = append(result.Reversals, Reversal{
+			TransactionID: reversal.TransactionID,
+			Amount:        reversal.Amount,
+			CreatedAt:     reversal.CreatedAt,
+		})
+	}
+	return &result, nil
+}
+
+// checkCredit fails when funds cannot be paid into an account because it was closed
+func checkCredit(account *storage.Account) error {
+	if account.Status == storage.AccountStatusClosed {
+		return types.NewBadRequest(types.ErrorCodeAccountClosed, fmt.Sprintf("account %s is closed", account.Number))
+	}
+
+	return nil
+}
+
+// checkDebit fails when funds cannot leave an account because it was frozen or closed
+func checkDebit(account *storage.Account) error {
+	if account.Status == storage.AccountStatusFrozen {
+		return types.NewBadRequest(types.ErrorCodeAccountFrozen, fmt.Sprintf("account %s is frozen", account.Number))
+	}
+
+	return checkCredit(account)
+}
+
+func currencyMismatch(account *storage.Account, currency string) error {
+	return types.NewBadRequest(types.ErrorCodeCurrencyMismatch, fmt.Sprintf("account %s does not hold %s", account.Number, currency))
+}
+
+func newTransaction(transaction *storage.Transaction) Transaction {
+	return Transaction{
 		TransactionID: transaction.TransactionID,
+		Type:          transaction.Type,
 		Status:        transaction.Status,
+		StatusReason:  transaction.StatusReason,
 		Amount:        transaction.Amount,
-		Currency:      transaction.Currency,
 		Description:   transaction.Description,
+		TransferID:    transaction.TransferID,
+		ConversionID:  transaction.ConversionID,
+		Rate:          transaction.Rate,
+		Spread:        transaction.Spread,
+		HoldID:        transaction.HoldID,
+		ReversalOf:    transaction.ReversalOf,
+		Details:       transaction.Details,
 		CreatedAt:     transaction.CreatedAt,
 		UpdatedAt:     transaction.UpdatedAt,
-	}, nil
-}
-
-// updateTransaction updates the transaction status to completed after a delay to mock a background task
-func (t TransactionHandler) updateTransaction(transactionID string) {
-	go func() {
-		time.Sleep(200 * time.Millisecond)
-		if err := t.storage.UpdateTransaction(transactionID, "completed"); err != nil {
-			// Log error but don't return it since this is a background task
-			fmt.Printf("Error updating transaction status: %v\n", err)
-		}
-	}()
+	}
 }
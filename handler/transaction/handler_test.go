@@ -2,11 +2,16 @@ package transaction
 
 import (
 	"errors"
+	"fmt"
 	"reflect"
+	"strings"
 	"testing"
 	"time"
 
 	"github.com/alienxp03/teya-ledger/storage"
+	"github.com/alienxp03/teya-ledger/types"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 )
 
 func TestCreateDeposit(t *testing.T) {
@@ -30,30 +35,28 @@ func TestCreateDeposit(t *testing.T) {
 			args: args{userID: "USER_ID_1"},
 			req: CreateDepositRequest{
 				TransactionID: "idempotency-key",
-				Amount:        100,
-				Currency:      "MYR",
+				Amount:        types.NewMoney(100, "MYR"),
 				Description:   "description",
 			},
 			setup: func() setup {
 				mockStorage := &MockStorage{
 					GetAccountFunc: func(userID, accountNumber string) (*storage.Account, error) {
-						return &storage.Account{Number: "ACCOUNT_NUMBER_1"}, nil
+						return &storage.Account{Number: "ACCOUNT_NUMBER_1", Currencies: []string{"MYR"}}, nil
+					},
+					LockAccountFunc: func(userID, accountNumber string) func() {
+						return func() {}
 					},
 					CreateDepositFunc: func(transaction *storage.Transaction) (*storage.Transaction, error) {
 						return &storage.Transaction{
 							TransactionID: "idempotency-key",
 							Status:        "pending",
-							Amount:        100,
-							Currency:      "MYR",
+							Amount:        types.NewMoney(100, "MYR"),
 							Description:   "description",
 							CreatedAt:     time.Date(2021, 1, 1, 0, 0, 0, 0, time.UTC),
 							UpdatedAt:     time.Date(2021, 1, 1, 0, 0, 0, 0, time.UTC),
 						}, nil
 					},
-					UpdateBalanceFunc: func(userID string, accountNumber string, amount int64) error {
-						return nil
-					},
-					UpdateTransactionFunc: func(transactionID string, status string) error {
+					EnqueueSettlementFunc: func(job *storage.SettlementJob) error {
 						return nil
 					},
 				}
@@ -63,8 +66,7 @@ func TestCreateDeposit(t *testing.T) {
 				Transaction: Transaction{
 					TransactionID: "idempotency-key",
 					Status:        "pending",
-					Amount:        100,
-					Currency:      "MYR",
+					Amount:        types.NewMoney(100, "MYR"),
 					Description:   "description",
 					CreatedAt:     time.Date(2021, 1, 1, 0, 0, 0, 0, time.UTC),
 					UpdatedAt:     time.Date(2021, 1, 1, 0, 0, 0, 0, time.UTC),
@@ -75,8 +77,7 @@ func TestCreateDeposit(t *testing.T) {
 			name: "invalid user account",
 			req: CreateDepositRequest{
 				TransactionID: "idempotency-key",
-				Amount:        100,
-				Currency:      "MYR",
+				Amount:        types.NewMoney(100, "MYR"),
 				Description:   "description",
 			},
 			setup: func() setup {
@@ -90,18 +91,38 @@ func TestCreateDeposit(t *testing.T) {
 			want:    nil,
 			wantErr: true,
 		},
+		{
+			name: "currency not held by account",
+			req: CreateDepositRequest{
+				TransactionID: "idempotency-key",
+				Amount:        types.NewMoney(100, "USD"),
+				Description:   "description",
+			},
+			setup: func() setup {
+				mockStorage := &MockStorage{
+					GetAccountFunc: func(userID string, accountNumber string) (*storage.Account, error) {
+						return &storage.Account{Number: "account-number", Currencies: []string{"MYR"}}, nil
+					},
+				}
+				return setup{mockStorage}
+			}(),
+			want:    nil,
+			wantErr: true,
+		},
 		{
 			name: "error saving data",
 			req: CreateDepositRequest{
 				TransactionID: "idempotency-key",
-				Amount:        100,
-				Currency:      "MYR",
+				Amount:        types.NewMoney(100, "MYR"),
 				Description:   "description",
 			},
 			setup: func() setup {
 				mockStorage := &MockStorage{
 					GetAccountFunc: func(userID string, accountNumber string) (*storage.Account, error) {
-						return &storage.Account{Number: "account-number"}, nil
+						return &storage.Account{Number: "account-number", Currencies: []string{"MYR"}}, nil
+					},
+					LockAccountFunc: func(userID, accountNumber string) func() {
+						return func() {}
 					},
 					CreateDepositFunc: func(transaction *storage.Transaction) (*storage.Transaction, error) {
 						return nil, errors.New("saving error")
@@ -156,17 +177,20 @@ func TestGetTransactions(t *testing.T) {
 			},
 			setup: func() setup {
 				mockStorage := &MockStorage{
-					GetTransactionsFunc: func(userID, accountNumber string, limit, page int) ([]*storage.Transaction, error) {
-						return []*storage.Transaction{
-							{
-								TransactionID: "idempotency-key",
-								Status:        "pending",
-								Amount:        100,
-								Currency:      "MYR",
-								Description:   "description",
-								CreatedAt:     time.Date(2021, 1, 1, 0, 0, 0, 0, time.UTC),
-								UpdatedAt:     time.Date(2021, 1, 1, 0, 0, 0, 0, time.UTC),
+					GetTransactionsFunc: func(query storage.TransactionQuery) (*storage.TransactionPage, error) {
+						return &storage.TransactionPage{
+							Transactions: []*storage.Transaction{
+								{
+									TransactionID: "idempotency-key",
+									Status:        "pending",
+									Amount:        types.NewMoney(100, "MYR"),
+									Description:   "description",
+									CreatedAt:     time.Date(2021, 1, 1, 0, 0, 0, 0, time.UTC),
+									UpdatedAt:     time.Date(2021, 1, 1, 0, 0, 0, 0, time.UTC),
+								},
 							},
+							NextCursor: "next-cursor",
+							HasMore:    true,
 						}, nil
 					},
 				}
@@ -177,14 +201,35 @@ func TestGetTransactions(t *testing.T) {
 					{
 						TransactionID: "idempotency-key",
 						Status:        "pending",
-						Amount:        100,
-						Currency:      "MYR",
+						Amount:        types.NewMoney(100, "MYR"),
 						Description:   "description",
 						CreatedAt:     time.Date(2021, 1, 1, 0, 0, 0, 0, time.UTC),
 						UpdatedAt:     time.Date(2021, 1, 1, 0, 0, 0, 0, time.UTC),
 					},
 				},
+				NextCursor: "next-cursor",
+				HasMore:    true,
+			},
+		},
+		{
+			name: "invalid cursor",
+			args: args{
+				userID: "USER_ID_1",
+				req: GetTransactionsRequest{
+					AccountNumber: "account-number",
+					Cursor:        "invalid",
+				},
 			},
+			setup: func() setup {
+				mockStorage := &MockStorage{
+					GetTransactionsFunc: func(query storage.TransactionQuery) (*storage.TransactionPage, error) {
+						return nil, storage.ErrInvalidCursor
+					},
+				}
+				return setup{mockStorage}
+			}(),
+			want:    nil,
+			wantErr: true,
 		},
 		{
 			name: "logic error",
@@ -198,7 +243,7 @@ func TestGetTransactions(t *testing.T) {
 			},
 			setup: func() setup {
 				mockStorage := &MockStorage{
-					GetTransactionsFunc: func(userID, accountNumber string, limit, page int) ([]*storage.Transaction, error) {
+					GetTransactionsFunc: func(query storage.TransactionQuery) (*storage.TransactionPage, error) {
 						return nil, errors.New("error")
 					},
 				}
@@ -247,33 +292,40 @@ func TestCreateWithdrawal(t *testing.T) {
 			req: CreateWithdrawalRequest{
 				TransactionID: "idempotency-key",
 				AccountNumber: "ACCOUNT_NUMBER_1",
-				Amount:        100,
-				Currency:      "MYR",
+				Amount:        types.NewMoney(100, "MYR"),
 				Description:   "withdrawal description",
 			},
 			setup: func() setup {
 				mockStorage := &MockStorage{
 					GetAccountFunc: func(userID, accountNumber string) (*storage.Account, error) {
-						return &storage.Account{Number: "ACCOUNT_NUMBER_1"}, nil
+						return &storage.Account{Number: "ACCOUNT_NUMBER_1", Currencies: []string{"MYR"}}, nil
 					},
-					GetBalanceFunc: func(userID string, accountNumber string) (*storage.Balance, error) {
-						return &storage.Balance{Amount: 1000, Currency: "MYR"}, nil
+					LockAccountFunc: func(userID, accountNumber string) func() {
+						return func() {}
+					},
+					GetBalanceFunc: func(userID, accountNumber, currency string) (*storage.Balance, error) {
+						return &storage.Balance{Amount: types.NewMoney(1000, "MYR")}, nil
+					},
+					GetHeldAmountFunc: func(userID, accountNumber, currency string, now time.Time) (types.Money, error) {
+						return types.NewMoney(0, currency), nil
 					},
 					CreateWithdrawalFunc: func(transaction *storage.Transaction) (*storage.Transaction, error) {
 						return &storage.Transaction{
 							TransactionID: "idempotency-key",
 							Status:        "pending",
-							Amount:        -100,
-							Currency:      "MYR",
+							Amount:        types.NewMoney(-100, "MYR"),
 							Description:   "withdrawal description",
 							CreatedAt:     time.Date(2021, 1, 1, 0, 0, 0, 0, time.UTC),
 							UpdatedAt:     time.Date(2021, 1, 1, 0, 0, 0, 0, time.UTC),
 						}, nil
 					},
-					UpdateBalanceFunc: func(userID string, accountNumber string, amount int64) error {
+					UpdateBalanceFunc: func(userID, accountNumber string, amount types.Money) error {
 						return nil
 					},
-					UpdateTransactionFunc: func(transactionID string, status string) error {
+					PostJournalEntryFunc: func(entry *storage.JournalEntry) error {
+						return nil
+					},
+					EnqueueSettlementFunc: func(job *storage.SettlementJob) error {
 						return nil
 					},
 				}
@@ -283,8 +335,7 @@ func TestCreateWithdrawal(t *testing.T) {
 				Transaction: Transaction{
 					TransactionID: "idempotency-key",
 					Status:        "pending",
-					Amount:        -100,
-					Currency:      "MYR",
+					Amount:        types.NewMoney(-100, "MYR"),
 					Description:   "withdrawal description",
 					CreatedAt:     time.Date(2021, 1, 1, 0, 0, 0, 0, time.UTC),
 					UpdatedAt:     time.Date(2021, 1, 1, 0, 0, 0, 0, time.UTC),
@@ -295,8 +346,7 @@ func TestCreateWithdrawal(t *testing.T) {
 			name: "invalid user account",
 			req: CreateWithdrawalRequest{
 				TransactionID: "idempotency-key",
-				Amount:        100,
-				Currency:      "MYR",
+				Amount:        types.NewMoney(100, "MYR"),
 				Description:   "withdrawal description",
 			},
 			setup: func() setup {
@@ -314,20 +364,25 @@ func TestCreateWithdrawal(t *testing.T) {
 			name: "error saving data",
 			req: CreateWithdrawalRequest{
 				TransactionID: "idempotency-key",
-				Amount:        100,
-				Currency:      "MYR",
+				Amount:        types.NewMoney(100, "MYR"),
 				Description:   "withdrawal description",
 			},
 			setup: func() setup {
 				mockStorage := &MockStorage{
 					GetAccountFunc: func(userID string, accountNumber string) (*storage.Account, error) {
-						return &storage.Account{Number: "account-number"}, nil
+						return &storage.Account{Number: "account-number", Currencies: []string{"MYR"}}, nil
+					},
+					LockAccountFunc: func(userID, accountNumber string) func() {
+						return func() {}
 					},
 					CreateWithdrawalFunc: func(transaction *storage.Transaction) (*storage.Transaction, error) {
 						return nil, errors.New("saving error")
 					},
-					GetBalanceFunc: func(userID string, accountNumber string) (*storage.Balance, error) {
-						return &storage.Balance{Amount: 1000, Currency: "MYR"}, nil
+					GetBalanceFunc: func(userID, accountNumber, currency string) (*storage.Balance, error) {
+						return &storage.Balance{Amount: types.NewMoney(1000, "MYR")}, nil
+					},
+					GetHeldAmountFunc: func(userID, accountNumber, currency string, now time.Time) (types.Money, error) {
+						return types.NewMoney(0, currency), nil
 					},
 				}
 				return setup{mockStorage}
@@ -381,24 +436,33 @@ func TestGetTransaction(t *testing.T) {
 							TransactionID: "TRANSACTION_ID_1",
 							UserID:        "USER_ID_1",
 							Status:        "pending",
-							Amount:        100,
-							Currency:      "MYR",
+							Amount:        types.NewMoney(100, "MYR"),
 							Description:   "test transaction",
 							CreatedAt:     time.Date(2021, 1, 1, 0, 0, 0, 0, time.UTC),
 							UpdatedAt:     time.Date(2021, 1, 1, 0, 0, 0, 0, time.UTC),
 						}, nil
 					},
+					GetStatusChangesFunc: func(transactionID string) ([]*storage.StatusChange, error) {
+						return []*storage.StatusChange{
+							{TransactionID: transactionID, To: "pending", CreatedAt: time.Date(2021, 1, 1, 0, 0, 0, 0, time.UTC)},
+						}, nil
+					},
+					GetReversalsFunc: func(userID, transactionID string) ([]*storage.Transaction, error) {
+						return []*storage.Transaction{}, nil
+					},
 				}
 				return setup{mockStorage}
 			}(),
 			want: &Transaction{
 				TransactionID: "TRANSACTION_ID_1",
 				Status:        "pending",
-				Amount:        100,
-				Currency:      "MYR",
+				Amount:        types.NewMoney(100, "MYR"),
 				Description:   "test transaction",
 				CreatedAt:     time.Date(2021, 1, 1, 0, 0, 0, 0, time.UTC),
 				UpdatedAt:     time.Date(2021, 1, 1, 0, 0, 0, 0, time.UTC),
+				StatusHistory: []StatusChange{
+					{To: "pending", CreatedAt: time.Date(2021, 1, 1, 0, 0, 0, 0, time.UTC)},
+				},
 			},
 		},
 		{
@@ -452,73 +516,473 @@ func TestGetTransaction(t *testing.T) {
 	}
 }
 
-func TestUpdateTransactionStatus(t *testing.T) {
-	type args struct {
-		transactionID string
+func TestUpdateStatus(t *testing.T) {
+	deposit := func(status string) *storage.Transaction {
+		return &storage.Transaction{TransactionID: "TRANSACTION_ID_1", Type: storage.TransactionTypeDeposit, Status: status, Amount: types.NewMoney(100, "MYR"), UserID: "USER_ID_1", AccountNumber: "ACCOUNT_NUMBER_1"}
+	}
+	withdrawal := func(status string) *storage.Transaction {
+		return &storage.Transaction{TransactionID: "TRANSACTION_ID_1", Type: storage.TransactionTypeWithdrawal, Status: status, Amount: types.NewMoney(-100, "MYR"), UserID: "USER_ID_1", AccountNumber: "ACCOUNT_NUMBER_1"}
+	}
+
+	tests := []struct {
+		name        string
+		transaction *storage.Transaction
+		balance     int64
+		updateErr   error
+		statusErr   error
+		req         UpdateStatusRequest
+		// wantBalance is the balance update applied by the transition, if any
+		wantBalance *types.Money
+		wantCode    types.ErrorCode
+	}{
+		{
+			name:        "pending deposit starts processing",
+			transaction: deposit("pending"),
+			req:         UpdateStatusRequest{Status: "processing"},
+		},
+		{
+			name:        "completed deposit credits the account",
+			transaction: deposit("processing"),
+			req:         UpdateStatusRequest{Status: "completed"},
+			wantBalance: &types.Money{Amount: 100, Currency: "MYR"},
+		},
+		{
+			name:        "failed withdrawal releases its funds",
+			transaction: withdrawal("pending"),
+			req:         UpdateStatusRequest{Status: "failed", Reason: "declined by bank"},
+			wantBalance: &types.Money{Amount: 100, Currency: "MYR"},
+		},
+		{
+			name:        "completed withdrawal keeps its funds",
+			transaction: withdrawal("processing"),
+			req:         UpdateStatusRequest{Status: "completed"},
+		},
+		{
+			name:        "failed without a reason",
+			transaction: deposit("processing"),
+			req:         UpdateStatusRequest{Status: "failed"},
+			wantCode:    types.ErrorInvalidParams,
+		},
+		{
+			name:        "completed transaction cannot go back to pending",
+			transaction: deposit("completed"),
+			req:         UpdateStatusRequest{Status: "pending"},
+			wantCode:    types.ErrorCodeInvalidStatusTransition,
+		},
+		{
+			name:        "processing transaction cannot be cancelled",
+			transaction: deposit("processing"),
+			req:         UpdateStatusRequest{Status: "cancelled"},
+			wantCode:    types.ErrorCodeInvalidStatusTransition,
+		},
+		{
+			name:        "failed transaction is final",
+			transaction: deposit("failed"),
+			req:         UpdateStatusRequest{Status: "completed"},
+			wantCode:    types.ErrorCodeInvalidStatusTransition,
+		},
+		{
+			name:        "completed transaction is only reversed with a reversal",
+			transaction: deposit("completed"),
+			balance:     100,
+			req:         UpdateStatusRequest{Status: "reversed"},
+			wantCode:    types.ErrorCodeInvalidStatusTransition,
+		},
+		{
+			name:        "changed concurrently",
+			transaction: deposit("pending"),
+			statusErr:   storage.ErrStatusConflict,
+			req:         UpdateStatusRequest{Status: "processing"},
+			wantCode:    types.ErrorCodeInvalidStatusTransition,
+		},
+		{
+			name:        "credit overflows the balance",
+			transaction: deposit("processing"),
+			updateErr:   types.ErrAmountOverflow,
+			req:         UpdateStatusRequest{Status: "completed"},
+			wantCode:    types.ErrorCodeInvalidAmount,
+		},
+		{
+			name:     "transaction not found",
+			req:      UpdateStatusRequest{Status: "processing"},
+			wantCode: types.NotFound,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var balanceUpdates []types.Money
+			var entries []*storage.JournalEntry
+			var changes []*storage.StatusChange
+			mockStorage := &MockStorage{
+				GetTransactionFunc: func(userID, transactionID string) (*storage.Transaction, error) {
+					if tt.transaction == nil {
+						return nil, storage.ErrNotFound
+					}
+					copied := *tt.transaction
+					if len(changes) > 0 {
+						copied.Status = changes[len(changes)-1].To
+					}
+					return &copied, nil
+				},
+				GetStatusChangesFunc: func(transactionID string) ([]*storage.StatusChange, error) {
+					return changes, nil
+				},
+				GetReversalsFunc: func(userID, transactionID string) ([]*storage.Transaction, error) {
+					return []*storage.Transaction{}, nil
+				},
+				GetAccountFunc: func(userID, accountNumber string) (*storage.Account, error) {
+					return &storage.Account{UserID: userID, Number: accountNumber, Status: storage.AccountStatusActive}, nil
+				},
+				LockAccountFunc: func(userID, accountNumber string) func() {
+					return func() {}
+				},
+				GetBalanceFunc: func(userID, accountNumber, currency string) (*storage.Balance, error) {
+					return &storage.Balance{Amount: types.NewMoney(tt.balance, currency)}, nil
+				},
+				GetHeldAmountFunc: func(userID, accountNumber, currency string, now time.Time) (types.Money, error) {
+					return types.NewMoney(0, currency), nil
+				},
+				UpdateBalanceFunc: func(userID, accountNumber string, amount types.Money) error {
+					if tt.updateErr != nil {
+						return tt.updateErr
+					}
+					balanceUpdates = append(balanceUpdates, amount)
+					return nil
+				},
+				GetJournalEntriesFunc: func(reference string) ([]*storage.JournalEntry, error) {
+					return entries, nil
+				},
+				PostJournalEntryFunc: func(entry *storage.JournalEntry) error {
+					entries = append(entries, entry)
+					return nil
+				},
+				UpdateTransactionStatusFunc: func(change *storage.StatusChange) error {
+					if tt.statusErr != nil {
+						return tt.statusErr
+					}
+					changes = append(changes, change)
+					return nil
+				},
+			}
+
+			got, err := New(mockStorage).UpdateStatus("USER_ID_1", "TRANSACTION_ID_1", tt.req)
+			if tt.wantCode != "" {
+				var serviceErr *types.ServiceError
+				require.ErrorAs(t, err, &serviceErr)
+				assert.Equal(t, string(tt.wantCode), serviceErr.Code)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tt.req.Status, got.Status)
+			require.Len(t, changes, 1)
+			assert.Equal(t, &storage.StatusChange{TransactionID: "TRANSACTION_ID_1", From: tt.transaction.Status, To: tt.req.Status, Reason: tt.req.Reason}, changes[0])
+
+			if tt.wantBalance == nil {
+				assert.Empty(t, balanceUpdates)
+				assert.Empty(t, entries)
+				return
+			}
+			assert.Equal(t, []types.Money{*tt.wantBalance}, balanceUpdates)
+			require.Len(t, entries, 1)
+			credit, _ := tt.wantBalance.Neg()
+			assert.Equal(t, []storage.Posting{
+				{LedgerAccount: storage.LedgerAccountCashInTransit, Amount: *tt.wantBalance},
+				{LedgerAccount: storage.CustomerLedgerAccount("USER_ID_1", "ACCOUNT_NUMBER_1"), Amount: credit},
+			}, entries[0].Postings)
+		})
+	}
+}
+
+func TestCaptureAmount(t *testing.T) {
+	hold := &storage.Hold{HoldID: "HOLD_ID_1", Amount: types.NewMoney(300, "MYR")}
+
+	tests := []struct {
+		name      string
+		requested types.Money
+		want      types.Money
+		wantCode  types.ErrorCode
+	}{
+		{name: "full amount", requested: types.Money{}, want: types.NewMoney(300, "MYR")},
+		{name: "partial amount", requested: types.NewMoney(120, "MYR"), want: types.NewMoney(120, "MYR")},
+		{name: "currency of the hold", requested: types.NewMoney(120, ""), want: types.NewMoney(120, "MYR")},
+		{name: "more than held", requested: types.NewMoney(301, "MYR"), wantCode: types.ErrorCodeInvalidAmount},
+		{name: "negative amount", requested: types.NewMoney(-1, "MYR"), wantCode: types.ErrorCodeInvalidAmount},
+		{name: "other currency", requested: types.NewMoney(100, "USD"), wantCode: types.ErrorCodeCurrencyMismatch},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := captureAmount(hold, tt.requested)
+			if tt.wantCode != "" {
+				var serviceErr *types.ServiceError
+				require.ErrorAs(t, err, &serviceErr)
+				assert.Equal(t, string(tt.wantCode), serviceErr.Code)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tt.want, got)
+		})
+	}
+}
+
+func TestCheckDetails(t *testing.T) {
+	metadata := map[string]string{}
+	for i := range maxMetadataKeys + 1 {
+		metadata[fmt.Sprintf("key%d", i)] = "value"
+	}
+
+	tests := []struct {
+		name    string
+		details storage.Details
+		wantErr bool
+	}{
+		{name: "no details"},
+		{name: "every detail", details: storage.Details{
+			Metadata:          map[string]string{"orderID": "ORDER_1"},
+			Tags:              []string{"groceries"},
+			Counterparty:      storage.Counterparty{Name: "Corner Shop", Reference: "MERCHANT_1", CategoryCode: "5411"},
+			ExternalReference: "EXTERNAL_1",
+		}},
+		{name: "too many metadata keys", details: storage.Details{Metadata: metadata}, wantErr: true},
+		{name: "empty metadata key", details: storage.Details{Metadata: map[string]string{"": "value"}}, wantErr: true},
+		{name: "metadata value too long", details: storage.Details{Metadata: map[string]string{"key": strings.Repeat("a", maxMetadataValueLength+1)}}, wantErr: true},
+		{name: "empty tag", details: storage.Details{Tags: []string{""}}, wantErr: true},
+		{name: "duplicate tag", details: storage.Details{Tags: []string{"card", "card"}}, wantErr: true},
+		{name: "external reference too long", details: storage.Details{ExternalReference: strings.Repeat("a", maxReferenceLength+1)}, wantErr: true},
+		{name: "category code with letters", details: storage.Details{Counterparty: storage.Counterparty{CategoryCode: "54A1"}}, wantErr: true},
+		{name: "category code too short", details: storage.Details{Counterparty: storage.Counterparty{CategoryCode: "541"}}, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := checkDetails(tt.details)
+			if !tt.wantErr {
+				assert.NoError(t, err)
+				return
+			}
+			var serviceErr *types.ServiceError
+			require.ErrorAs(t, err, &serviceErr)
+			assert.Equal(t, string(types.ErrorInvalidParams), serviceErr.Code)
+		})
+	}
+}
+
+func TestReversalAmount(t *testing.T) {
+	original := &storage.Transaction{TransactionID: "TRANSACTION_ID_1", Amount: types.NewMoney(-500, "MYR")}
+	remaining := types.NewMoney(300, "MYR")
+
+	tests := []struct {
+		name      string
+		requested types.Money
+		want      types.Money
+		wantCode  types.ErrorCode
+	}{
+		{name: "whatever is left", requested: types.Money{}, want: types.NewMoney(300, "MYR")},
+		{name: "partial amount", requested: types.NewMoney(120, "MYR"), want: types.NewMoney(120, "MYR")},
+		{name: "currency of the original", requested: types.NewMoney(120, ""), want: types.NewMoney(120, "MYR")},
+		{name: "more than is left", requested: types.NewMoney(301, "MYR"), wantCode: types.ErrorCodeInvalidAmount},
+		{name: "negative amount", requested: types.NewMoney(-1, "MYR"), wantCode: types.ErrorCodeInvalidAmount},
+		{name: "other currency", requested: types.NewMoney(100, "USD"), wantCode: types.ErrorCodeCurrencyMismatch},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := reversalAmount(original, remaining, tt.requested)
+			if tt.wantCode != "" {
+				var serviceErr *types.ServiceError
+				require.ErrorAs(t, err, &serviceErr)
+				assert.Equal(t, string(tt.wantCode), serviceErr.Code)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tt.want, got)
+		})
 	}
+}
+
+func TestCreateTransfer(t *testing.T) {
 	type setup struct {
 		mockStorage *MockStorage
 	}
 
+	newMockStorage := func(balance int64, createErr error) *MockStorage {
+		return &MockStorage{
+			GetAccountFunc: func(userID, accountNumber string) (*storage.Account, error) {
+				// the recipient is read again by its owner once locked
+				if accountNumber != "ACCOUNT_NUMBER_1" && (userID != "USER_ID_2" || accountNumber != "ACCOUNT_NUMBER_2") {
+					return nil, storage.ErrNotFound
+				}
+				return &storage.Account{UserID: userID, Number: accountNumber, Currencies: []string{"MYR"}}, nil
+			},
+			GetAccountByNumberFunc: func(accountNumber string) (*storage.Account, error) {
+				switch accountNumber {
+				case "ACCOUNT_NUMBER_1":
+					return &storage.Account{UserID: "USER_ID_1", Number: accountNumber, Currencies: []string{"MYR"}}, nil
+				case "ACCOUNT_NUMBER_2":
+					return &storage.Account{UserID: "USER_ID_2", Number: accountNumber, Currencies: []string{"MYR"}}, nil
+				}
+				return nil, storage.ErrNotFound
+			},
+			LockAccountFunc: func(userID, accountNumber string) func() {
+				return func() {}
+			},
+			GetTransactionFunc: func(userID, transactionID string) (*storage.Transaction, error) {
+				return nil, storage.ErrNotFound
+			},
+			GetBalanceFunc: func(userID, accountNumber, currency string) (*storage.Balance, error) {
+				return &storage.Balance{Amount: types.NewMoney(balance, "MYR")}, nil
+			},
+			GetHeldAmountFunc: func(userID, accountNumber, currency string, now time.Time) (types.Money, error) {
+				return types.NewMoney(0, currency), nil
+			},
+			CreateTransactionFunc: func(transaction *storage.Transaction) error {
+				transaction.CreatedAt = time.Date(2021, 1, 1, 0, 0, 0, 0, time.UTC)
+				transaction.UpdatedAt = time.Date(2021, 1, 1, 0, 0, 0, 0, time.UTC)
+				return createErr
+			},
+			UpdateBalanceFunc: func(userID, accountNumber string, amount types.Money) error {
+				return nil
+			},
+			PostJournalEntryFunc: func(entry *storage.JournalEntry) error {
+				return nil
+			},
+		}
+	}
+
 	tests := []struct {
 		name    string
-		args    args
+		req     CreateTransferRequest
 		setup   setup
+		want    *CreateTransferResponse
 		wantErr bool
 	}{
 		{
 			name: "success",
-			args: args{
-				transactionID: "TRANSACTION_ID_1",
+			req: CreateTransferRequest{
+				TransferID:        "transfer-key",
+				FromAccountNumber: "ACCOUNT_NUMBER_1",
+				ToAccountNumber:   "ACCOUNT_NUMBER_2",
+				Amount:            types.NewMoney(100, "MYR"),
+				Description:       "rent",
+			},
+			setup: setup{newMockStorage(1000, nil)},
+			want: &CreateTransferResponse{
+				TransferID: "transfer-key",
+				Debit: Transaction{
+					TransactionID: "transfer-key-debit",
+					Type:          storage.TransactionTypeTransferOut,
+					Status:        "completed",
+					Amount:        types.NewMoney(-100, "MYR"),
+					Description:   "rent",
+					TransferID:    "transfer-key",
+					CreatedAt:     time.Date(2021, 1, 1, 0, 0, 0, 0, time.UTC),
+					UpdatedAt:     time.Date(2021, 1, 1, 0, 0, 0, 0, time.UTC),
+				},
+				Credit: Transaction{
+					TransactionID: "transfer-key-credit",
+					Type:          storage.TransactionTypeTransferIn,
+					Status:        "completed",
+					Amount:        types.NewMoney(100, "MYR"),
+					Description:   "rent",
+					TransferID:    "transfer-key",
+					CreatedAt:     time.Date(2021, 1, 1, 0, 0, 0, 0, time.UTC),
+					UpdatedAt:     time.Date(2021, 1, 1, 0, 0, 0, 0, time.UTC),
+				},
 			},
-			setup: func() setup {
-				mockStorage := &MockStorage{
-					UpdateTransactionFunc: func(transactionID string, status string) error {
-						return nil
-					},
-				}
-				return setup{mockStorage}
-			}(),
-			wantErr: false,
 		},
 		{
-			name: "error updating status",
-			args: args{
-				transactionID: "TRANSACTION_ID_2",
-			},
-			setup: func() setup {
-				mockStorage := &MockStorage{
-					UpdateTransactionFunc: func(transactionID string, status string) error {
-						return errors.New("update error")
-					},
-				}
-				return setup{mockStorage}
-			}(),
-			wantErr: false, // Should not return error since it's a background task
+			name:    "source account not owned by user",
+			req:     CreateTransferRequest{TransferID: "transfer-key", FromAccountNumber: "ACCOUNT_NUMBER_2", ToAccountNumber: "ACCOUNT_NUMBER_1", Amount: types.NewMoney(100, "MYR")},
+			setup:   setup{newMockStorage(1000, nil)},
+			wantErr: true,
+		},
+		{
+			name:    "destination account not found",
+			req:     CreateTransferRequest{TransferID: "transfer-key", FromAccountNumber: "ACCOUNT_NUMBER_1", ToAccountNumber: "ACCOUNT_NUMBER_3", Amount: types.NewMoney(100, "MYR")},
+			setup:   setup{newMockStorage(1000, nil)},
+			wantErr: true,
+		},
+		{
+			name:    "same account",
+			req:     CreateTransferRequest{TransferID: "transfer-key", FromAccountNumber: "ACCOUNT_NUMBER_1", ToAccountNumber: "ACCOUNT_NUMBER_1", Amount: types.NewMoney(100, "MYR")},
+			setup:   setup{newMockStorage(1000, nil)},
+			wantErr: true,
+		},
+		{
+			name:    "insufficient balance",
+			req:     CreateTransferRequest{TransferID: "transfer-key", FromAccountNumber: "ACCOUNT_NUMBER_1", ToAccountNumber: "ACCOUNT_NUMBER_2", Amount: types.NewMoney(100, "MYR")},
+			setup:   setup{newMockStorage(99, nil)},
+			wantErr: true,
+		},
+		{
+			name:    "duplicate transfer",
+			req:     CreateTransferRequest{TransferID: "transfer-key", FromAccountNumber: "ACCOUNT_NUMBER_1", ToAccountNumber: "ACCOUNT_NUMBER_2", Amount: types.NewMoney(100, "MYR")},
+			setup:   setup{newMockStorage(1000, storage.ErrTransactionExists)},
+			wantErr: true,
 		},
 	}
 
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
 			handler := New(tt.setup.mockStorage)
-			handler.updateTransaction(tt.args.transactionID)
-			// Wait for the goroutine to complete
-			time.Sleep(300 * time.Millisecond)
+			got, err := handler.CreateTransfer("USER_ID_1", tt.req)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("CreateTransfer() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("CreateTransfer() got = %v, want %v", got, tt.want)
+			}
 		})
 	}
 }
 
 type MockStorage struct {
-	CreateAccountFunc     func(accountNumber storage.Account) (*storage.Account, error)
-	GetAccountFunc        func(userID string, accountNumber string) (*storage.Account, error)
-	CreateTransactionFunc func(transaction *storage.Transaction) error
-	GetTransactionsFunc   func(userID, accountNumber string, limit, page int) ([]*storage.Transaction, error)
-	CreateDepositFunc     func(transaction *storage.Transaction) (*storage.Transaction, error)
-	CreateWithdrawalFunc  func(transaction *storage.Transaction) (*storage.Transaction, error)
-	GetBalanceFunc        func(userID, accountNumber string) (*storage.Balance, error)
-	UpdateBalanceFunc     func(userID, accountNumber string, amount int64) error
-	GetTransactionFunc    func(useriD, transactionID string) (*storage.Transaction, error)
-	UpdateTransactionFunc func(transactionID string, status string) error
+	CreateAccountFunc           func(accountNumber storage.Account) (*storage.Account, error)
+	GetAccountFunc              func(userID string, accountNumber string) (*storage.Account, error)
+	LockAccountFunc             func(userID string, accountNumber string) func()
+	GetAccountByNumberFunc      func(accountNumber string) (*storage.Account, error)
+	ListAccountsFunc            func() ([]*storage.Account, error)
+	GetAccountsFunc             func(userID string) ([]*storage.Account, error)
+	UpdateAccountStatusFunc     func(userID, accountNumber, from, to string) error
+	CreateTransactionFunc       func(transaction *storage.Transaction) error
+	GetTransactionsFunc         func(query storage.TransactionQuery) (*storage.TransactionPage, error)
+	SearchTransactionsFunc      func(query storage.TransactionQuery) (*storage.TransactionPage, error)
+	FindTransactionFunc         func(transactionID string) (*storage.Transaction, error)
+	CreateDepositFunc           func(transaction *storage.Transaction) (*storage.Transaction, error)
+	CreateWithdrawalFunc        func(transaction *storage.Transaction) (*storage.Transaction, error)
+	GetBalanceFunc              func(userID, accountNumber, currency string) (*storage.Balance, error)
+	GetBalancesFunc             func(userID, accountNumber string) ([]*storage.Balance, error)
+	UpdateBalanceFunc           func(userID, accountNumber string, amount types.Money) error
+	DeriveBalanceFunc           func(userID, accountNumber, currency string) (types.Money, error)
+	DeriveBalanceHistoryFunc    func(userID, accountNumber, currency string, instants []time.Time) ([]types.Money, error)
+	GetTransactionFunc          func(useriD, transactionID string) (*storage.Transaction, error)
+	UpdateTransactionStatusFunc func(change *storage.StatusChange) error
+	GetStatusChangesFunc        func(transactionID string) ([]*storage.StatusChange, error)
+	GetReversalsFunc            func(userID, transactionID string) ([]*storage.Transaction, error)
+	PostJournalEntryFunc        func(entry *storage.JournalEntry) error
+	GetJournalEntriesFunc       func(reference string) ([]*storage.JournalEntry, error)
+	GetTrialBalanceFunc         func() ([]*storage.TrialBalanceLine, error)
+	EnqueueSettlementFunc       func(job *storage.SettlementJob) error
+	ClaimSettlementsFunc        func(now time.Time, lease time.Duration, limit int) ([]*storage.SettlementJob, error)
+	RetrySettlementFunc         func(job *storage.SettlementJob) error
+	RemoveSettlementFunc        func(transactionID string) error
+	CreateHoldFunc              func(hold *storage.Hold) error
+	GetHoldFunc                 func(userID, holdID string) (*storage.Hold, error)
+	CloseHoldFunc               func(hold *storage.Hold) error
+	GetHeldAmountFunc           func(userID, accountNumber, currency string, now time.Time) (types.Money, error)
+	ListExpiredHoldsFunc        func(now time.Time, limit int) ([]*storage.Hold, error)
+
+	CreateIdempotencyKeyFunc         func(key *storage.IdempotencyKey) error
+	GetIdempotencyKeyFunc            func(userID, key string) (*storage.IdempotencyKey, error)
+	CompleteIdempotencyKeyFunc       func(key *storage.IdempotencyKey) error
+	DeleteIdempotencyKeyFunc         func(userID, key string) error
+	DeleteExpiredIdempotencyKeysFunc func(now time.Time) (int, error)
+	CreateAPIKeyFunc                 func(key *storage.APIKey) error
+	GetAPIKeyFunc                    func(userID, keyID string) (*storage.APIKey, error)
+	GetAPIKeyByHashFunc              func(hash string) (*storage.APIKey, error)
+	ListAPIKeysFunc                  func(userID string) ([]*storage.APIKey, error)
+	RevokeAPIKeyFunc                 func(userID, keyID string, at time.Time) error
+	TouchAPIKeyFunc                  func(keyID string, at time.Time) error
+	RecordAuditEntryFunc             func(entry *storage.AuditEntry) error
+	ListAuditEntriesFunc             func(query storage.AuditQuery) ([]*storage.AuditEntry, error)
 }
 
 func (m *MockStorage) CreateAccount(account storage.Account) (*storage.Account, error) {
@@ -533,30 +997,183 @@ func (m *MockStorage) CreateTransaction(transaction *storage.Transaction) error
 	return m.CreateTransactionFunc(transaction)
 }
 
-func (m *MockStorage) GetTransactions(userID, accountNumber string, limit, page int) ([]*storage.Transaction, error) {
-	return m.GetTransactionsFunc(userID, accountNumber, limit, page)
+func (m *MockStorage) GetTransactions(query storage.TransactionQuery) (*storage.TransactionPage, error) {
+	return m.GetTransactionsFunc(query)
+}
+
+func (m *MockStorage) SearchTransactions(query storage.TransactionQuery) (*storage.TransactionPage, error) {
+	return m.SearchTransactionsFunc(query)
+}
+
+func (m *MockStorage) FindTransaction(transactionID string) (*storage.Transaction, error) {
+	return m.FindTransactionFunc(transactionID)
 }
 
 func (m *MockStorage) GetAccount(userID string, accountNumber string) (*storage.Account, error) {
 	return m.GetAccountFunc(userID, accountNumber)
 }
 
+func (m *MockStorage) GetAccountByNumber(accountNumber string) (*storage.Account, error) {
+	return m.GetAccountByNumberFunc(accountNumber)
+}
+
+func (m *MockStorage) ListAccounts() ([]*storage.Account, error) {
+	return m.ListAccountsFunc()
+}
+
+func (m *MockStorage) GetAccounts(userID string) ([]*storage.Account, error) {
+	return m.GetAccountsFunc(userID)
+}
+
+func (m *MockStorage) UpdateAccountStatus(userID string, accountNumber string, from string, to string) error {
+	return m.UpdateAccountStatusFunc(userID, accountNumber, from, to)
+}
+
+func (m *MockStorage) LockAccount(userID string, accountNumber string) func() {
+	return m.LockAccountFunc(userID, accountNumber)
+}
+
 func (m *MockStorage) CreateWithdrawal(transaction *storage.Transaction) (*storage.Transaction, error) {
 	return m.CreateWithdrawalFunc(transaction)
 }
 
-func (m *MockStorage) GetBalance(userID string, accountNumber string) (*storage.Balance, error) {
-	return m.GetBalanceFunc(userID, accountNumber)
+func (m *MockStorage) GetBalance(userID string, accountNumber string, currency string) (*storage.Balance, error) {
+	return m.GetBalanceFunc(userID, accountNumber, currency)
+}
+
+func (m *MockStorage) GetBalances(userID string, accountNumber string) ([]*storage.Balance, error) {
+	return m.GetBalancesFunc(userID, accountNumber)
 }
 
-func (m *MockStorage) UpdateBalance(userID string, accountNumber string, amount int64) error {
+func (m *MockStorage) UpdateBalance(userID string, accountNumber string, amount types.Money) error {
 	return m.UpdateBalanceFunc(userID, accountNumber, amount)
 }
 
+func (m *MockStorage) DeriveBalance(userID string, accountNumber string, currency string) (types.Money, error) {
+	return m.DeriveBalanceFunc(userID, accountNumber, currency)
+}
+
+func (m *MockStorage) DeriveBalanceHistory(userID string, accountNumber string, currency string, instants []time.Time) ([]types.Money, error) {
+	return m.DeriveBalanceHistoryFunc(userID, accountNumber, currency, instants)
+}
+
 func (m *MockStorage) GetTransaction(userID, transactionID string) (*storage.Transaction, error) {
 	return m.GetTransactionFunc(userID, transactionID)
 }
 
-func (m *MockStorage) UpdateTransaction(transactionID string, status string) error {
-	return m.UpdateTransactionFunc(transactionID, status)
+func (m *MockStorage) UpdateTransactionStatus(change *storage.StatusChange) error {
+	return m.UpdateTransactionStatusFunc(change)
+}
+
+func (m *MockStorage) GetStatusChanges(transactionID string) ([]*storage.StatusChange, error) {
+	return m.GetStatusChangesFunc(transactionID)
+}
+
+func (m *MockStorage) GetReversals(userID, transactionID string) ([]*storage.Transaction, error) {
+	return m.GetReversalsFunc(userID, transactionID)
+}
+
+func (m *MockStorage) PostJournalEntry(entry *storage.JournalEntry) error {
+	return m.PostJournalEntryFunc(entry)
+}
+
+func (m *MockStorage) GetJournalEntries(reference string) ([]*storage.JournalEntry, error) {
+	return m.GetJournalEntriesFunc(reference)
+}
+
+func (m *MockStorage) GetTrialBalance() ([]*storage.TrialBalanceLine, error) {
+	return m.GetTrialBalanceFunc()
+}
+
+func (m *MockStorage) CreateHold(hold *storage.Hold) error {
+	return m.CreateHoldFunc(hold)
+}
+
+func (m *MockStorage) GetHold(userID string, holdID string) (*storage.Hold, error) {
+	return m.GetHoldFunc(userID, holdID)
+}
+
+func (m *MockStorage) CloseHold(hold *storage.Hold) error {
+	return m.CloseHoldFunc(hold)
+}
+
+func (m *MockStorage) GetHeldAmount(userID string, accountNumber string, currency string, now time.Time) (types.Money, error) {
+	return m.GetHeldAmountFunc(userID, accountNumber, currency, now)
+}
+
+func (m *MockStorage) ListExpiredHolds(now time.Time, limit int) ([]*storage.Hold, error) {
+	return m.ListExpiredHoldsFunc(now, limit)
+}
+
+func (m *MockStorage) EnqueueSettlement(job *storage.SettlementJob) error {
+	return m.EnqueueSettlementFunc(job)
+}
+
+func (m *MockStorage) ClaimSettlements(now time.Time, lease time.Duration, limit int) ([]*storage.SettlementJob, error) {
+	return m.ClaimSettlementsFunc(now, lease, limit)
+}
+
+func (m *MockStorage) RetrySettlement(job *storage.SettlementJob) error {
+	return m.RetrySettlementFunc(job)
+}
+
+func (m *MockStorage) RemoveSettlement(transactionID string) error {
+	return m.RemoveSettlementFunc(transactionID)
+}
+
+func (m *MockStorage) CreateIdempotencyKey(key *storage.IdempotencyKey) error {
+	return m.CreateIdempotencyKeyFunc(key)
+}
+
+func (m *MockStorage) GetIdempotencyKey(userID string, key string) (*storage.IdempotencyKey, error) {
+	return m.GetIdempotencyKeyFunc(userID, key)
+}
+
+func (m *MockStorage) CompleteIdempotencyKey(key *storage.IdempotencyKey) error {
+	return m.CompleteIdempotencyKeyFunc(key)
+}
+
+func (m *MockStorage) DeleteIdempotencyKey(userID string, key string) error {
+	return m.DeleteIdempotencyKeyFunc(userID, key)
+}
+
+func (m *MockStorage) DeleteExpiredIdempotencyKeys(now time.Time) (int, error) {
+	return m.DeleteExpiredIdempotencyKeysFunc(now)
+}
+
+func (m *MockStorage) CreateAPIKey(key *storage.APIKey) error {
+	return m.CreateAPIKeyFunc(key)
+}
+
+func (m *MockStorage) GetAPIKey(userID string, keyID string) (*storage.APIKey, error) {
+	return m.GetAPIKeyFunc(userID, keyID)
+}
+
+func (m *MockStorage) GetAPIKeyByHash(hash string) (*storage.APIKey, error) {
+	return m.GetAPIKeyByHashFunc(hash)
+}
+
+func (m *MockStorage) ListAPIKeys(userID string) ([]*storage.APIKey, error) {
+	return m.ListAPIKeysFunc(userID)
+}
+
+func (m *MockStorage) RevokeAPIKey(userID string, keyID string, at time.Time) error {
+	return m.RevokeAPIKeyFunc(userID, keyID, at)
+}
+
+func (m *MockStorage) TouchAPIKey(keyID string, at time.Time) error {
+	return m.TouchAPIKeyFunc(keyID, at)
+}
+
+func (m *MockStorage) RecordAuditEntry(entry *storage.AuditEntry) error {
+	return m.RecordAuditEntryFunc(entry)
+}
+
+func (m *MockStorage) ListAuditEntries(query storage.AuditQuery) ([]*storage.AuditEntry, error) {
+	return m.ListAuditEntriesFunc(query)
+}
+
+// WithTx runs fn directly against the mock since there is nothing to roll back
+func (m *MockStorage) WithTx(fn func(tx storage.Storage) error) error {
+	return fn(m)
 }
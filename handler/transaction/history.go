@@ -0,0 +1,128 @@
+package transaction
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/alienxp03/teya-ledger/types"
+)
+
+const (
+	BalanceIntervalDay  = "day"
+	BalanceIntervalHour = "hour"
+
+	// maxBalanceHistoryPoints bounds a balance history to 31 days of hours
+	maxBalanceHistoryPoints = 744
+)
+
+// GetBalanceAt reconstructs the ledger balances of an account at a past instant from its
+// transactions and their status history
+func (t TransactionHandler) GetBalanceAt(userID string, req GetBalanceAtRequest) (*GetBalanceAtResponse, error) {
+	if req.AsOf.After(time.Now()) {
+		return nil, types.NewBadRequest(types.ErrorInvalidParams, "asOf is in the future")
+	}
+	currencies, err := t.balanceCurrencies(userID, req.AccountNumber, "")
+	if err != nil {
+		return nil, err
+	}
+
+	result := &GetBalanceAtResponse{AsOf: req.AsOf, Balances: []types.Money{}}
+	for _, currency := range currencies {
+		history, err := t.storage.DeriveBalanceHistory(userID, req.AccountNumber, currency, []time.Time{req.AsOf})
+		if err != nil {
+			return nil, err
+		}
+		result.Balances = append(result.Balances, history[0])
+	}
+	return result, nil
+}
+
+// GetBalanceHistory returns the closing balance of each period between req.From and req.To.
+// The last period ends at req.To and may be shorter than the others. A period still running
+// closes with the balance now and periods yet to start are left out.
+func (t TransactionHandler) GetBalanceHistory(userID string, req GetBalanceHistoryRequest) (*GetBalanceHistoryResponse, error) {
+	if req.Interval == "" {
+		req.Interval = BalanceIntervalDay
+	}
+	step := 24 * time.Hour
+	switch req.Interval {
+	case BalanceIntervalDay:
+	case BalanceIntervalHour:
+		step = time.Hour
+	default:
+		return nil, types.NewBadRequest(types.ErrorInvalidParams, fmt.Sprintf("unknown interval %q", req.Interval))
+	}
+	if req.From.IsZero() || req.To.IsZero() || !req.From.Before(req.To) {
+		return nil, types.NewBadRequest(types.ErrorInvalidParams, "from and to are required and from must be before to")
+	}
+	if req.From.After(time.Now()) {
+		return nil, types.NewBadRequest(types.ErrorInvalidParams, "from is in the future")
+	}
+	if points := (req.To.Sub(req.From) + step - 1) / step; points > maxBalanceHistoryPoints {
+		return nil, types.NewBadRequest(types.ErrorInvalidParams,
+			fmt.Sprintf("%d periods requested, at most %d are allowed", points, maxBalanceHistoryPoints))
+	}
+
+	currencies, err := t.balanceCurrencies(userID, req.AccountNumber, req.Currency)
+	if err != nil {
+		return nil, err
+	}
+
+	// A period closes just before the next one opens, and no later than now
+	now := time.Now()
+	periods := []BalancePoint{}
+	closings := []time.Time{}
+	for from := req.From; from.Before(req.To) && !from.After(now); from = from.Add(step) {
+		to := from.Add(step)
+		if to.After(req.To) {
+			to = req.To
+		}
+		if to.After(now) {
+			closings = append(closings, now)
+		} else {
+			closings = append(closings, to.Add(-time.Nanosecond))
+		}
+		periods = append(periods, BalancePoint{From: from, To: to})
+	}
+
+	result := &GetBalanceHistoryResponse{Interval: req.Interval, Series: []BalanceSeries{}}
+	for _, currency := range currencies {
+		history, err := t.storage.DeriveBalanceHistory(userID, req.AccountNumber, currency, closings)
+		if err != nil {
+			return nil, err
+		}
+
+		series := BalanceSeries{Currency: currency, Points: make([]BalancePoint, len(periods))}
+		for i, period := range periods {
+			period.Closing = history[i]
+			series.Points[i] = period
+		}
+		result.Series = append(result.Series, series)
+	}
+	return result, nil
+}
+
+// balanceCurrencies returns the currencies of the balances of an account, ordered by currency,
+// or only currency when it is set
+func (t TransactionHandler) balanceCurrencies(userID string, accountNumber string, currency string) ([]string, error) {
+	account, err := t.storage.GetAccount(userID, accountNumber)
+	if err != nil {
+		return nil, types.NewNotFound(err.Error())
+	}
+	if currency != "" {
+		if !account.HoldsCurrency(currency) {
+			return nil, currencyMismatch(account, currency)
+		}
+		return []string{currency}, nil
+	}
+
+	balances, err := t.storage.GetBalances(userID, accountNumber)
+	if err != nil {
+		return nil, err
+	}
+	currencies := []string{}
+	for _, balance := range balances {
+		currencies = append(currencies, balance.Amount.Currency)
+	}
+	return currencies, nil
+}
@@ -0,0 +1,241 @@
+package transaction
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/alienxp03/teya-ledger/storage"
+	"github.com/alienxp03/teya-ledger/types"
+)
+
+// defaultHoldTTL is how long a hold reserves funds unless configured with WithHoldTTL
+const defaultHoldTTL = 7 * 24 * time.Hour
+
+// CreateHold reserves funds of an account, e.g. for a card authorization, reducing its
+// available balance until the hold is captured, voided or expires
+func (t TransactionHandler) CreateHold(userID string, req CreateHoldRequest) (*CreateHoldResponse, error) {
+	account, err := t.storage.GetAccount(userID, req.AccountNumber)
+	if err != nil {
+		return nil, types.NewNotFound(err.Error())
+	}
+	if err := checkDebit(account); err != nil {
+		return nil, err
+	}
+	if !account.HoldsCurrency(req.Amount.Currency) {
+		return nil, currencyMismatch(account, req.Amount.Currency)
+	}
+
+	// Hold the account so concurrent debits cannot spend the funds being reserved
+	unlock := t.storage.LockAccount(userID, req.AccountNumber)
+	defer unlock()
+
+	if err := checkLocked(t.storage, account, checkDebit); err != nil {
+		return nil, err
+	}
+
+	available, err := availableBalance(t.storage, userID, req.AccountNumber, req.Amount.Currency)
+	if err != nil {
+		return nil, err
+	}
+	if err := checkFunds(available, req.Amount); err != nil {
+		return nil, err
+	}
+
+	hold := &storage.Hold{
+		HoldID:        req.HoldID,
+		UserID:        userID,
+		AccountNumber: req.AccountNumber,
+		Amount:        req.Amount,
+		Status:        storage.HoldStatusActive,
+		Description:   req.Description,
+		ExpiresAt:     time.Now().Add(t.holdTTL),
+	}
+	if err := t.storage.CreateHold(hold); err != nil {
+		return nil, err
+	}
+
+	return &CreateHoldResponse{Hold: newHold(hold)}, nil
+}
+
+func (t TransactionHandler) GetHold(userID string, holdID string) (*Hold, error) {
+	hold, err := t.storage.GetHold(userID, holdID)
+	if err != nil {
+		return nil, types.NewNotFound("hold not found")
+	}
+
+	result := newHold(hold)
+	return &result, nil
+}
+
+// CaptureHold takes the final amount of a hold from the balance as a completed capture
+// transaction. The rest of the hold is released.
+func (t TransactionHandler) CaptureHold(userID string, holdID string, req CaptureHoldRequest) (*CaptureHoldResponse, error) {
+	hold, err := t.storage.GetHold(userID, holdID)
+	if err != nil {
+		return nil, types.NewNotFound("hold not found")
+	}
+
+	unlock := t.storage.LockAccount(userID, hold.AccountNumber)
+	defer unlock()
+
+	var transaction *storage.Transaction
+	err = t.storage.WithTx(func(tx storage.Storage) error {
+		// Read the hold again under the lock, it may have been closed since
+		hold, err := tx.GetHold(userID, holdID)
+		if err != nil {
+			return types.NewNotFound("hold not found")
+		}
+		if err := checkHoldActive(hold); err != nil {
+			return err
+		}
+		account, err := tx.GetAccount(userID, hold.AccountNumber)
+		if err != nil {
+			return err
+		}
+		if err := checkDebit(account); err != nil {
+			return err
+		}
+
+		amount, err := captureAmount(hold, req.Amount)
+		if err != nil {
+			return err
+		}
+		debit, err := negate(amount)
+		if err != nil {
+			return err
+		}
+
+		transaction = &storage.Transaction{
+			TransactionID: req.TransactionID,
+			Type:          storage.TransactionTypeCapture,
+			Status:        storage.TransactionStatusCompleted,
+			Amount:        debit,
+			Description:   req.Description,
+			UserID:        userID,
+			AccountNumber: hold.AccountNumber,
+			HoldID:        holdID,
+		}
+		if err := tx.CreateTransaction(transaction); err != nil {
+			return err
+		}
+		if err := postTransaction(tx, transaction, debit, storage.LedgerAccountCashInTransit); err != nil {
+			return err
+		}
+
+		hold.Status = storage.HoldStatusCaptured
+		hold.Captured = amount
+		return closeHold(tx, hold)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	captured, err := t.storage.GetHold(userID, holdID)
+	if err != nil {
+		return nil, err
+	}
+	return &CaptureHoldResponse{Hold: newHold(captured), Transaction: newTransaction(transaction)}, nil
+}
+
+// VoidHold releases the funds reserved by a hold without taking anything from the balance
+func (t TransactionHandler) VoidHold(userID string, holdID string) (*Hold, error) {
+	hold, err := t.storage.GetHold(userID, holdID)
+	if err != nil {
+		return nil, types.NewNotFound("hold not found")
+	}
+	if err := checkHoldActive(hold); err != nil {
+		return nil, err
+	}
+
+	hold.Status = storage.HoldStatusVoided
+	if err := closeHold(t.storage, hold); err != nil {
+		return nil, err
+	}
+
+	return t.GetHold(userID, holdID)
+}
+
+// ExpireHolds closes the holds that expired by now, releasing their funds, and returns how many it closed.
+// Expired holds stop reserving funds straight away, this only records that they expired.
+func (t TransactionHandler) ExpireHolds(now time.Time) (int, error) {
+	expired := 0
+	for {
+		holds, err := t.storage.ListExpiredHolds(now, 100)
+		if err != nil {
+			return expired, err
+		}
+
+		for _, hold := range holds {
+			hold.Status = storage.HoldStatusExpired
+			err := t.storage.CloseHold(hold)
+			// Captured or voided in the meantime
+			if errors.Is(err, storage.ErrStatusConflict) {
+				continue
+			}
+			if err != nil {
+				return expired, err
+			}
+			expired++
+		}
+
+		if len(holds) < 100 {
+			return expired, nil
+		}
+	}
+}
+
+// checkHoldActive fails when a hold no longer reserves funds
+func checkHoldActive(hold *storage.Hold) error {
+	if hold.Status != storage.HoldStatusActive {
+		return types.NewBadRequest(types.ErrorCodeInvalidStatusTransition, fmt.Sprintf("hold %s is %s", hold.HoldID, hold.Status))
+	}
+	if !hold.Reserves(time.Now()) {
+		return types.NewBadRequest(types.ErrorCodeInvalidStatusTransition, fmt.Sprintf("hold %s is expired", hold.HoldID))
+	}
+
+	return nil
+}
+
+// captureAmount is the amount requested to be captured from a hold, the full amount held when none is
+// requested. A requested amount without a currency is in the currency of the hold.
+func captureAmount(hold *storage.Hold, requested types.Money) (types.Money, error) {
+	if requested.Amount == 0 {
+		return hold.Amount, nil
+	}
+	if requested.Currency == "" {
+		requested.Currency = hold.Amount.Currency
+	}
+
+	cmp, err := requested.Cmp(hold.Amount)
+	if err != nil {
+		return types.Money{}, types.NewBadRequest(types.ErrorCodeCurrencyMismatch, fmt.Sprintf("hold %s is in %s", hold.HoldID, hold.Amount.Currency))
+	}
+	if requested.IsNegative() || cmp > 0 {
+		return types.Money{}, types.NewBadRequest(types.ErrorCodeInvalidAmount, fmt.Sprintf("capture must be between 0 and %s", hold.Amount))
+	}
+
+	return requested, nil
+}
+
+func closeHold(s storage.Storage, hold *storage.Hold) error {
+	err := s.CloseHold(hold)
+	if errors.Is(err, storage.ErrStatusConflict) {
+		return types.NewBadRequest(types.ErrorCodeInvalidStatusTransition, fmt.Sprintf("hold %s is no longer active", hold.HoldID))
+	}
+	return err
+}
+
+func newHold(hold *storage.Hold) Hold {
+	return Hold{
+		HoldID:        hold.HoldID,
+		AccountNumber: hold.AccountNumber,
+		Amount:        hold.Amount,
+		Captured:      hold.Captured,
+		Status:        hold.Status,
+		Description:   hold.Description,
+		ExpiresAt:     hold.ExpiresAt,
+		CreatedAt:     hold.CreatedAt,
+		UpdatedAt:     hold.UpdatedAt,
+	}
+}
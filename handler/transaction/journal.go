@@ -0,0 +1,87 @@
+package transaction
+
+import (
+	"errors"
+	"time"
+
+	"github.com/alienxp03/teya-ledger/storage"
+	"github.com/alienxp03/teya-ledger/types"
+)
+
+// postTransaction applies amount of a customer transaction to its account balance and
+// records the journal entry balancing it against counterAccount. It must run inside a
+// unit of work so the balance and the journal cannot diverge.
+func postTransaction(tx storage.Storage, transaction *storage.Transaction, amount types.Money, counterAccount string) error {
+	if err := updateBalance(tx, transaction.UserID, transaction.AccountNumber, amount); err != nil {
+		return err
+	}
+
+	credit, err := negate(amount)
+	if err != nil {
+		return err
+	}
+
+	// A credit debits the counter account and credits the customer, a debit the reverse
+	return tx.PostJournalEntry(&storage.JournalEntry{
+		Reference:   transaction.TransactionID,
+		Description: transaction.Description,
+		Postings: []storage.Posting{
+			{LedgerAccount: counterAccount, Amount: amount},
+			{LedgerAccount: storage.CustomerLedgerAccount(transaction.UserID, transaction.AccountNumber), Amount: credit},
+		},
+	})
+}
+
+// updateBalance adds amount to an account balance, rejecting a balance that would overflow
+func updateBalance(tx storage.Storage, userID string, accountNumber string, amount types.Money) error {
+	err := tx.UpdateBalance(userID, accountNumber, amount)
+	if errors.Is(err, types.ErrAmountOverflow) {
+		return types.NewBadRequest(types.ErrorCodeInvalidAmount, err.Error())
+	}
+	if err != nil {
+		return types.NewBadRequest(types.BadRequest, err.Error())
+	}
+
+	return nil
+}
+
+// availableBalance is the balance of an account less the funds reserved by its active holds
+func availableBalance(s storage.Storage, userID string, accountNumber string, currency string) (types.Money, error) {
+	balance, err := s.GetBalance(userID, accountNumber, currency)
+	if err != nil {
+		return types.Money{}, types.NewBadRequest(types.BadRequest, err.Error())
+	}
+
+	held, err := s.GetHeldAmount(userID, accountNumber, currency, time.Now())
+	if err != nil {
+		return types.Money{}, err
+	}
+
+	available, err := balance.Amount.Sub(held)
+	if err != nil {
+		return types.Money{}, types.NewBadRequest(types.ErrorCodeInvalidAmount, err.Error())
+	}
+	return available, nil
+}
+
+// checkFunds fails when balance cannot cover amount
+func checkFunds(balance types.Money, amount types.Money) error {
+	cmp, err := balance.Cmp(amount)
+	if err != nil {
+		return types.NewBadRequest(types.ErrorCodeCurrencyMismatch, err.Error())
+	}
+	if cmp < 0 {
+		return types.NewBadRequest(types.ErrorCodeInvalidAmount, "insufficient balance")
+	}
+
+	return nil
+}
+
+func negate(amount types.Money) (types.Money, error) {
+	negated, err := amount.Neg()
+	if err != nil {
+		return types.Money{}, types.NewBadRequest(types.ErrorCodeInvalidAmount, err.Error())
+	}
+
+	return negated, nil
+}
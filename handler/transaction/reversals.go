@@ -0,0 +1,182 @@
+package transaction
+
+import (
+	"errors"
+	"fmt"
+	"slices"
+
+	"github.com/alienxp03/teya-ledger/storage"
+	"github.com/alienxp03/teya-ledger/types"
+)
+
+// reversibleTypes are the transactions that can be reversed on their own. The legs of a
+// transfer or conversion only make sense together.
+var reversibleTypes = []string{
+	storage.TransactionTypeDeposit,
+	storage.TransactionTypeWithdrawal,
+	storage.TransactionTypeCapture,
+}
+
+// ReverseTransaction undoes all or part of a completed transaction with a completed reversal
+// moving funds the opposite way, linked to the original. The original is partially reversed
+// until its reversals add up to its full amount and reversed once they do.
+func (t TransactionHandler) ReverseTransaction(userID string, transactionID string, req CreateReversalRequest) (*CreateReversalResponse, error) {
+	original, err := t.storage.GetTransaction(userID, transactionID)
+	if err != nil {
+		return nil, types.NewNotFound("transaction not found")
+	}
+
+	unlock := t.storage.LockAccount(userID, original.AccountNumber)
+	defer unlock()
+
+	var reversal *storage.Transaction
+	err = t.storage.WithTx(func(tx storage.Storage) error {
+		// Read the transaction again under the lock, it may have been reversed since
+		original, err := tx.GetTransaction(userID, transactionID)
+		if err != nil {
+			return types.NewNotFound("transaction not found")
+		}
+		if err := checkReversible(original); err != nil {
+			return err
+		}
+		account, err := tx.GetAccount(userID, original.AccountNumber)
+		if err != nil {
+			return err
+		}
+		// Reversing a credit takes funds out of the account, reversing a debit pays them back in
+		check := checkCredit
+		if !original.Amount.IsNegative() {
+			check = checkDebit
+		}
+		if err := check(account); err != nil {
+			return err
+		}
+
+		remaining, err := remainingAmount(tx, original)
+		if err != nil {
+			return err
+		}
+		amount, err := reversalAmount(original, remaining, req.Amount)
+		if err != nil {
+			return err
+		}
+
+		// Reversing a credit takes the funds back, which must not overdraw the account
+		posted := amount
+		if !original.Amount.IsNegative() {
+			available, err := availableBalance(tx, userID, original.AccountNumber, amount.Currency)
+			if err != nil {
+				return err
+			}
+			if err := checkFunds(available, amount); err != nil {
+				return err
+			}
+			if posted, err = negate(amount); err != nil {
+				return err
+			}
+		}
+
+		counterAccount, err := counterAccountOf(tx, original)
+		if err != nil {
+			return err
+		}
+
+		reversal = &storage.Transaction{
+			TransactionID: req.TransactionID,
+			Type:          storage.TransactionTypeReversal,
+			Status:        storage.TransactionStatusCompleted,
+			Amount:        posted,
+			Description:   req.Description,
+			UserID:        userID,
+			AccountNumber: original.AccountNumber,
+			ReversalOf:    transactionID,
+		}
+		if err := tx.CreateTransaction(reversal); err != nil {
+			return err
+		}
+		if err := postTransaction(tx, reversal, posted, counterAccount); err != nil {
+			return err
+		}
+
+		status := storage.TransactionStatusPartiallyReversed
+		if amount == remaining {
+			status = storage.TransactionStatusReversed
+		}
+		err = tx.UpdateTransactionStatus(&storage.StatusChange{
+			TransactionID: transactionID,
+			From:          original.Status,
+			To:            status,
+			Reason:        fmt.Sprintf("reversed by %s", req.TransactionID),
+		})
+		if errors.Is(err, storage.ErrStatusConflict) {
+			return types.NewBadRequest(types.ErrorCodeInvalidStatusTransition, err.Error())
+		}
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	reversed, err := t.GetTransaction(userID, transactionID)
+	if err != nil {
+		return nil, err
+	}
+	return &CreateReversalResponse{Reversal: newTransaction(reversal), Original: *reversed}, nil
+}
+
+// checkReversible fails when a transaction cannot be reversed on its own or has nothing left to reverse
+func checkReversible(transaction *storage.Transaction) error {
+	if !slices.Contains(reversibleTypes, transaction.Type) {
+		return types.NewBadRequest(types.ErrorCodeInvalidStatusTransition,
+			fmt.Sprintf("%s transactions cannot be reversed", transaction.Type))
+	}
+	if transaction.Status != storage.TransactionStatusCompleted && transaction.Status != storage.TransactionStatusPartiallyReversed {
+		return types.NewBadRequest(types.ErrorCodeInvalidStatusTransition,
+			fmt.Sprintf("transaction %s is %s", transaction.TransactionID, transaction.Status))
+	}
+
+	return nil
+}
+
+// remainingAmount is the part of a transaction its reversals have not compensated yet, as a positive amount
+func remainingAmount(tx storage.Storage, original *storage.Transaction) (types.Money, error) {
+	reversals, err := tx.GetReversals(original.UserID, original.TransactionID)
+	if err != nil {
+		return types.Money{}, err
+	}
+
+	remaining := original.Amount
+	for _, reversal := range reversals {
+		if remaining, err = remaining.Add(reversal.Amount); err != nil {
+			return types.Money{}, types.NewBadRequest(types.ErrorCodeInvalidAmount, err.Error())
+		}
+	}
+
+	if remaining.IsNegative() {
+		return negate(remaining)
+	}
+	return remaining, nil
+}
+
+// reversalAmount is the amount requested to be reversed, whatever is left to reverse when none is
+// requested. A requested amount without a currency is in the currency of the original.
+func reversalAmount(original *storage.Transaction, remaining types.Money, requested types.Money) (types.Money, error) {
+	if requested.Amount == 0 {
+		return remaining, nil
+	}
+	if requested.Currency == "" {
+		requested.Currency = original.Amount.Currency
+	}
+
+	cmp, err := requested.Cmp(remaining)
+	if err != nil {
+		return types.Money{}, types.NewBadRequest(types.ErrorCodeCurrencyMismatch,
+			fmt.Sprintf("transaction %s is in %s", original.TransactionID, original.Amount.Currency))
+	}
+	if requested.IsNegative() || cmp > 0 {
+		return types.Money{}, types.NewBadRequest(types.ErrorCodeInvalidAmount,
+			fmt.Sprintf("reversal must be between 0 and the %s left to reverse", remaining))
+	}
+
+	return requested, nil
+}
@@ -0,0 +1,180 @@
+package transaction
+
+import (
+	"errors"
+	"fmt"
+	"slices"
+
+	"github.com/alienxp03/teya-ledger/storage"
+	"github.com/alienxp03/teya-ledger/types"
+)
+
+// transitions lists the statuses a transaction can move to from each status.
+// Failed and cancelled transactions are final. Completed transactions only move on
+// when they are reversed, which ReverseTransaction does together with the reversal.
+var transitions = map[string][]string{
+	storage.TransactionStatusPending:    {storage.TransactionStatusProcessing, storage.TransactionStatusFailed, storage.TransactionStatusCancelled},
+	storage.TransactionStatusProcessing: {storage.TransactionStatusCompleted, storage.TransactionStatusFailed},
+}
+
+// UpdateStatus moves a transaction through the status state machine, recording when and why
+// it moved. The balance follows the status: a credit is posted when it completes and a debit
+// is released when it fails or is cancelled.
+func (t TransactionHandler) UpdateStatus(userID string, transactionID string, req UpdateStatusRequest) (*Transaction, error) {
+	return t.updateStatus(userID, transactionID, req, nil)
+}
+
+// updateStatus moves a transaction of the user to req.Status, calling record with the transaction
+// as it was before the move in the same unit of work when record is not nil
+func (t TransactionHandler) updateStatus(userID string, transactionID string, req UpdateStatusRequest, record func(tx storage.Storage, transaction *storage.Transaction) error) (*Transaction, error) {
+	transaction, err := t.storage.GetTransaction(userID, transactionID)
+	if err != nil {
+		return nil, types.NewNotFound("transaction not found")
+	}
+
+	unlock := t.storage.LockAccount(userID, transaction.AccountNumber)
+	defer unlock()
+
+	err = t.storage.WithTx(func(tx storage.Storage) error {
+		// Read the transaction again under the lock, it may have moved on since
+		transaction, err := tx.GetTransaction(userID, transactionID)
+		if err != nil {
+			return types.NewNotFound("transaction not found")
+		}
+
+		if err := validateTransition(transaction, req); err != nil {
+			return err
+		}
+		err = applyTransition(tx, transaction, req.Status)
+		var serviceErr *types.ServiceError
+		if errors.As(err, &serviceErr) && serviceErr.Code == string(types.ErrorCodeAccountClosed) {
+			// The account was closed while the credit was settling, so it can no longer take it
+			// and the transaction fails instead
+			req = UpdateStatusRequest{Status: storage.TransactionStatusFailed, Reason: serviceErr.Message}
+			if err := validateTransition(transaction, req); err != nil {
+				return err
+			}
+			err = applyTransition(tx, transaction, req.Status)
+		}
+		if err != nil {
+			return err
+		}
+
+		err = tx.UpdateTransactionStatus(&storage.StatusChange{
+			TransactionID: transactionID,
+			From:          transaction.Status,
+			To:            req.Status,
+			Reason:        req.Reason,
+		})
+		if errors.Is(err, storage.ErrStatusConflict) {
+			return types.NewBadRequest(types.ErrorCodeInvalidStatusTransition, err.Error())
+		}
+		if err != nil || record == nil {
+			return err
+		}
+		return record(tx, transaction)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return t.GetTransaction(userID, transactionID)
+}
+
+// CancelTransaction cancels a transaction that has not started processing yet
+func (t TransactionHandler) CancelTransaction(userID string, transactionID string, req CancelTransactionRequest) (*Transaction, error) {
+	return t.UpdateStatus(userID, transactionID, UpdateStatusRequest{
+		Status: storage.TransactionStatusCancelled,
+		Reason: req.Reason,
+	})
+}
+
+func validateTransition(transaction *storage.Transaction, req UpdateStatusRequest) error {
+	if !slices.Contains(transitions[transaction.Status], req.Status) {
+		return types.NewBadRequest(types.ErrorCodeInvalidStatusTransition,
+			fmt.Sprintf("transaction %s cannot move from %s to %s", transaction.TransactionID, transaction.Status, req.Status))
+	}
+	if req.Status == storage.TransactionStatusFailed && req.Reason == "" {
+		return types.NewBadRequest(types.ErrorInvalidParams, "a reason is required to fail a transaction")
+	}
+
+	return nil
+}
+
+// applyTransition posts or releases the transaction's amount when moving to status
+// changes whether it counts towards the account balance
+func applyTransition(tx storage.Storage, transaction *storage.Transaction, status string) error {
+	before, after := transaction.AffectsBalance(), storage.AffectsBalance(transaction.Amount, status)
+	if before == after {
+		return nil
+	}
+
+	amount := transaction.Amount
+	if before {
+		var err error
+		if amount, err = negate(amount); err != nil {
+			return err
+		}
+	}
+
+	// A credit is only posted into an account that is still open
+	if !before && amount.IsPositive() {
+		account, err := tx.GetAccount(transaction.UserID, transaction.AccountNumber)
+		if err != nil {
+			return err
+		}
+		if err := checkCredit(account); err != nil {
+			return err
+		}
+	}
+
+	// Taking back a credit must not overdraw the account
+	if amount.IsNegative() {
+		available, err := availableBalance(tx, transaction.UserID, transaction.AccountNumber, amount.Currency)
+		if err != nil {
+			return err
+		}
+		debit, err := negate(amount)
+		if err != nil {
+			return err
+		}
+		if err := checkFunds(available, debit); err != nil {
+			return err
+		}
+	}
+
+	counterAccount, err := counterAccountOf(tx, transaction)
+	if err != nil {
+		return err
+	}
+	return postTransaction(tx, transaction, amount, counterAccount)
+}
+
+// counterAccountOf finds the ledger account a transaction was posted against, which
+// defaults to cash in transit for a transaction that has not been posted yet
+func counterAccountOf(tx storage.Storage, transaction *storage.Transaction) (string, error) {
+	entries, err := tx.GetJournalEntries(transaction.TransactionID)
+	if err != nil {
+		return "", err
+	}
+
+	customer := storage.CustomerLedgerAccount(transaction.UserID, transaction.AccountNumber)
+	for _, entry := range entries {
+		for _, posting := range entry.Postings {
+			if posting.LedgerAccount != customer {
+				return posting.LedgerAccount, nil
+			}
+		}
+	}
+
+	return storage.LedgerAccountCashInTransit, nil
+}
+
+// enqueueSettlement queues a new transaction for the settlement workers, in the same unit
+// of work that creates it so a transaction is never left without a settlement
+func enqueueSettlement(tx storage.Storage, transaction *storage.Transaction) error {
+	return tx.EnqueueSettlement(&storage.SettlementJob{
+		TransactionID: transaction.TransactionID,
+		UserID:        transaction.UserID,
+	})
+}
@@ -0,0 +1,212 @@
+package transaction
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+
+	"github.com/alienxp03/teya-ledger/storage"
+	"github.com/alienxp03/teya-ledger/types"
+)
+
+// CreateTransfer moves funds from one of the user's accounts to any other account.
+// The debit and credit legs share the transfer ID, which is also the idempotency key,
+// and are created together with both balance updates in a single unit of work. A retry
+// gets the transfer made with its ID back.
+func (t TransactionHandler) CreateTransfer(userID string, req CreateTransferRequest) (*CreateTransferResponse, error) {
+	from, err := t.storage.GetAccount(userID, req.FromAccountNumber)
+	if err != nil {
+		return nil, types.NewNotFound(err.Error())
+	}
+
+	to, err := t.storage.GetAccountByNumber(req.ToAccountNumber)
+	if err != nil {
+		return nil, types.NewNotFound(err.Error())
+	}
+
+	// Answer a retry before checking the accounts, which may have changed since the transfer was made
+	if existing, err := t.existingTransfer(from, to, req); existing != nil || err != nil {
+		return existing, err
+	}
+
+	if from.UserID == to.UserID && from.Number == to.Number {
+		return nil, types.NewBadRequest(types.ErrorInvalidParams, "cannot transfer to the same account")
+	}
+	if err := checkDebit(from); err != nil {
+		return nil, err
+	}
+	if err := checkCredit(to); err != nil {
+		return nil, err
+	}
+	for _, account := range []*storage.Account{from, to} {
+		if !account.HoldsCurrency(req.Amount.Currency) {
+			return nil, currencyMismatch(account, req.Amount.Currency)
+		}
+	}
+
+	debitAmount, err := negate(req.Amount)
+	if err != nil {
+		return nil, err
+	}
+
+	unlock := t.lockAccounts(from, to)
+	defer unlock()
+
+	// Check again under the lock, a retry may have made the transfer in the meantime
+	if existing, err := t.existingTransfer(from, to, req); existing != nil || err != nil {
+		return existing, err
+	}
+
+	var debit, credit *storage.Transaction
+	err = t.storage.WithTx(func(tx storage.Storage) error {
+		// Read both accounts again under the lock, they may have been frozen or closed since
+		if err := checkLocked(tx, from, checkDebit); err != nil {
+			return err
+		}
+		if err := checkLocked(tx, to, checkCredit); err != nil {
+			return err
+		}
+
+		available, err := availableBalance(tx, from.UserID, from.Number, req.Amount.Currency)
+		if err != nil {
+			return err
+		}
+
+		if err := checkFunds(available, req.Amount); err != nil {
+			return err
+		}
+
+		debit = &storage.Transaction{
+			TransactionID: req.TransferID + "-debit",
+			Type:          storage.TransactionTypeTransferOut,
+			Status:        storage.TransactionStatusCompleted,
+			Amount:        debitAmount,
+			Description:   req.Description,
+			UserID:        from.UserID,
+			AccountNumber: from.Number,
+			TransferID:    req.TransferID,
+		}
+		if err := tx.CreateTransaction(debit); err != nil {
+			return transferIDInUse(err, req.TransferID)
+		}
+
+		credit = &storage.Transaction{
+			TransactionID: req.TransferID + "-credit",
+			Type:          storage.TransactionTypeTransferIn,
+			Status:        storage.TransactionStatusCompleted,
+			Amount:        req.Amount,
+			Description:   req.Description,
+			UserID:        to.UserID,
+			AccountNumber: to.Number,
+			TransferID:    req.TransferID,
+		}
+		if err := tx.CreateTransaction(credit); err != nil {
+			return transferIDInUse(err, req.TransferID)
+		}
+
+		if err := updateBalance(tx, from.UserID, from.Number, debitAmount); err != nil {
+			return err
+		}
+		if err := updateBalance(tx, to.UserID, to.Number, req.Amount); err != nil {
+			return err
+		}
+
+		// Money moves between two customer liabilities, so no system account is involved
+		return tx.PostJournalEntry(&storage.JournalEntry{
+			Reference:   req.TransferID,
+			Description: req.Description,
+			Postings: []storage.Posting{
+				{LedgerAccount: storage.CustomerLedgerAccount(from.UserID, from.Number), Amount: req.Amount},
+				{LedgerAccount: storage.CustomerLedgerAccount(to.UserID, to.Number), Amount: debitAmount},
+			},
+		})
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return &CreateTransferResponse{
+		TransferID: req.TransferID,
+		Debit:      newTransaction(debit),
+		Credit:     newTransaction(credit),
+	}, nil
+}
+
+// existingTransfer returns the transfer made with the transfer ID of req, nil when there is none.
+// A transfer made with the same ID between other accounts or of another amount is rejected.
+func (t TransactionHandler) existingTransfer(from *storage.Account, to *storage.Account, req CreateTransferRequest) (*CreateTransferResponse, error) {
+	debit, err := t.storage.GetTransaction(from.UserID, req.TransferID+"-debit")
+	if errors.Is(err, storage.ErrNotFound) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if debit.TransferID != req.TransferID {
+		return nil, transferIDReused(req.TransferID)
+	}
+
+	credit, err := t.storage.GetTransaction(to.UserID, req.TransferID+"-credit")
+	if errors.Is(err, storage.ErrNotFound) {
+		return nil, transferIDReused(req.TransferID)
+	}
+	if err != nil {
+		return nil, err
+	}
+	if debit.AccountNumber != from.Number || credit.AccountNumber != to.Number || credit.TransferID != req.TransferID || credit.Amount != req.Amount {
+		return nil, transferIDReused(req.TransferID)
+	}
+
+	return &CreateTransferResponse{
+		TransferID: req.TransferID,
+		Debit:      newTransaction(debit),
+		Credit:     newTransaction(credit),
+	}, nil
+}
+
+// transferIDInUse turns the failure to create a leg whose ID another transaction of any user
+// already has into transferIDReused, as transaction IDs are unique across users
+func transferIDInUse(err error, transferID string) error {
+	if errors.Is(err, storage.ErrTransactionExists) {
+		return transferIDReused(transferID)
+	}
+	return err
+}
+
+func transferIDReused(transferID string) error {
+	return types.NewUnprocessableEntity(types.ErrorCodeIdempotencyKeyReused,
+		fmt.Sprintf("transfer ID %s was already used for a different request", transferID))
+}
+
+// checkLocked reads an account again once it is locked and runs check against it, as the account
+// may have been frozen or closed since it was first read
+func checkLocked(tx storage.Storage, account *storage.Account, check func(*storage.Account) error) error {
+	current, err := tx.GetAccount(account.UserID, account.Number)
+	if err != nil {
+		return types.NewNotFound(err.Error())
+	}
+	return check(current)
+}
+
+// lockAccounts locks several accounts in a fixed order so that two transfers
+// between the same accounts in opposite directions cannot deadlock
+func (t TransactionHandler) lockAccounts(accounts ...*storage.Account) func() {
+	sorted := append([]*storage.Account{}, accounts...)
+	sort.Slice(sorted, func(i, j int) bool {
+		if sorted[i].UserID != sorted[j].UserID {
+			return sorted[i].UserID < sorted[j].UserID
+		}
+		return sorted[i].Number < sorted[j].Number
+	})
+
+	unlocks := []func(){}
+	for _, account := range sorted {
+		unlocks = append(unlocks, t.storage.LockAccount(account.UserID, account.Number))
+	}
+
+	return func() {
+		for i := len(unlocks) - 1; i >= 0; i-- {
+			unlocks[i]()
+		}
+	}
+}
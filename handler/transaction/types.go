@@ -1,49 +1,170 @@
 package transaction
 
-import "time"
+import (
+	"time"
+
+	"github.com/alienxp03/teya-ledger/storage"
+	"github.com/alienxp03/teya-ledger/types"
+)
 
 type GetTransactionsRequest struct {
 	AccountNumber string
-	Limit         int
-	Page          int
+	Status        string
+	Type          string
+	MinAmount     *int64
+	MaxAmount     *int64
+	CreatedFrom   time.Time
+	CreatedTo     time.Time
+	Description   string
+	// Tag, Metadata, ExternalReference, CounterpartyName and CategoryCode filter on the details of transactions
+	Tag               string
+	Metadata          map[string]string
+	ExternalReference string
+	CounterpartyName  string
+	CategoryCode      string
+	SortBy            string
+	SortOrder         string
+	Limit             int
+	Page              int
+	Cursor            string
 }
 
 type GetTransactionsResponse struct {
 	Transactions []Transaction
+	NextCursor   string
+	HasMore      bool
 }
 
 type CreateDepositRequest struct {
 	TransactionID string
 	AccountNumber string
-	Amount        int64
-	Currency      string
+	Amount        types.Money
 	Description   string
+	storage.Details
 }
 
 type CreateDepositResponse struct {
 	Transaction Transaction
 }
 
+// CreateWithdrawalRequest amounts are negative
 type CreateWithdrawalRequest struct {
 	TransactionID string
 	AccountNumber string
-	Amount        int64
-	Currency      string
+	Amount        types.Money
 	Description   string
+	storage.Details
 }
 
 type CreateWithdrawalResponse struct {
 	Transaction Transaction
 }
 
+type CreateTransferRequest struct {
+	TransferID        string
+	FromAccountNumber string
+	ToAccountNumber   string
+	Amount            types.Money
+	Description       string
+}
+
+type CreateTransferResponse struct {
+	TransferID string
+	Debit      Transaction
+	Credit     Transaction
+}
+
+// CreateQuoteRequest asks for the price of converting Amount into currency To
+type CreateQuoteRequest struct {
+	AccountNumber string
+	Amount        types.Money
+	To            string
+}
+
+type CreateQuoteResponse struct {
+	Quote Quote
+}
+
+// Quote Spread is in basis points
+type Quote struct {
+	QuoteID       string
+	AccountNumber string
+	Source        types.Money
+	Target        types.Money
+	Rate          string
+	Spread        int64
+	ExpiresAt     time.Time
+}
+
+type CreateConversionRequest struct {
+	ConversionID string
+	QuoteID      string
+	Description  string
+}
+
+type CreateConversionResponse struct {
+	ConversionID string
+	Debit        Transaction
+	Credit       Transaction
+}
+
 type Transaction struct {
 	TransactionID string
+	Type          string
 	Status        string
-	Amount        int64
-	Currency      string
+	StatusReason  string
+	Amount        types.Money
 	Description   string
+	TransferID    string
+	ConversionID  string
+	Rate          string
+	Spread        int64
+	HoldID        string
+	ReversalOf    string
+	storage.Details
+	CreatedAt time.Time
+	UpdatedAt time.Time
+	// StatusHistory and Reversals are only filled in when a single transaction is retrieved
+	StatusHistory []StatusChange
+	Reversals     []Reversal
+}
+
+// Reversal is a transaction compensating all or part of the transaction it reverses
+type Reversal struct {
+	TransactionID string
+	Amount        types.Money
 	CreatedAt     time.Time
-	UpdatedAt     time.Time
+}
+
+// StatusChange is a transaction moving between statuses. The change creating the transaction has an empty From.
+type StatusChange struct {
+	From      string
+	To        string
+	Reason    string
+	CreatedAt time.Time
+}
+
+// UpdateStatusRequest moves a transaction to Status. Reason is required when failing a transaction.
+type UpdateStatusRequest struct {
+	Status string
+	Reason string
+}
+
+// CreateReversalRequest reverses Amount of a transaction, whatever is left to reverse when Amount
+// is zero. Amount is positive whichever way the original moved funds and defaults to its currency.
+type CreateReversalRequest struct {
+	TransactionID string
+	Amount        types.Money
+	Description   string
+}
+
+type CreateReversalResponse struct {
+	Reversal Transaction
+	Original Transaction
+}
+
+type CancelTransactionRequest struct {
+	Reason string
 }
 
 type GetBalanceRequest struct {
@@ -51,6 +172,161 @@ type GetBalanceRequest struct {
 }
 
 type GetBalanceResponse struct {
-	Amount   int64  `json:"amount"`
-	Currency string `json:"currency"`
+	Balances []Balance
+}
+
+// Balance of an account in one currency. Ledger is the posted balance, Available is
+// what can be spent: the ledger balance less the funds reserved by active holds.
+type Balance struct {
+	Ledger    types.Money
+	Available types.Money
+}
+
+// GetBalanceAtRequest asks for the balances of an account as they were at AsOf
+type GetBalanceAtRequest struct {
+	AccountNumber string
+	AsOf          time.Time
+}
+
+// GetBalanceAtResponse holds the ledger balance in each currency the account holds, ordered by currency
+type GetBalanceAtResponse struct {
+	AsOf     time.Time
+	Balances []types.Money
+}
+
+// GetBalanceHistoryRequest asks for the closing balances of an account over [From, To), one per
+// Interval. Currency is optional, every currency the account holds is returned without it.
+type GetBalanceHistoryRequest struct {
+	AccountNumber string
+	Currency      string
+	From          time.Time
+	To            time.Time
+	// Interval is BalanceIntervalDay (default) or BalanceIntervalHour
+	Interval string
+}
+
+type GetBalanceHistoryResponse struct {
+	Interval string
+	Series   []BalanceSeries
+}
+
+// BalanceSeries is the history of the balance of an account in one currency, oldest first
+type BalanceSeries struct {
+	Currency string
+	Points   []BalancePoint
+}
+
+// BalancePoint is the ledger balance at the close of the period [From, To)
+type BalancePoint struct {
+	From    time.Time
+	To      time.Time
+	Closing types.Money
+}
+
+type CreateHoldRequest struct {
+	HoldID        string
+	AccountNumber string
+	Amount        types.Money
+	Description   string
+}
+
+type CreateHoldResponse struct {
+	Hold Hold
+}
+
+// CaptureHoldRequest takes Amount of a hold from the balance, the full amount held when Amount is zero.
+// Amount defaults to the currency of the hold.
+type CaptureHoldRequest struct {
+	TransactionID string
+	Amount        types.Money
+	Description   string
+}
+
+type CaptureHoldResponse struct {
+	Hold        Hold
+	Transaction Transaction
+}
+
+type Hold struct {
+	HoldID        string
+	AccountNumber string
+	Amount        types.Money
+	Captured      types.Money
+	Status        string
+	Description   string
+	ExpiresAt     time.Time
+	CreatedAt     time.Time
+	UpdatedAt     time.Time
+}
+
+// Operator is a support or admin user acting on data of other users through the admin API
+type Operator struct {
+	UserID string
+	Role   string
+}
+
+// SearchTransactionsRequest filters the transactions of every user, narrowed down to a
+// single user or account when UserID or AccountNumber is set
+type SearchTransactionsRequest struct {
+	UserID string
+	GetTransactionsRequest
+}
+
+type SearchTransactionsResponse struct {
+	Transactions []AccountTransaction
+	NextCursor   string
+	HasMore      bool
+}
+
+// AccountTransaction is a transaction together with the user and account it belongs to
+type AccountTransaction struct {
+	Transaction
+	UserID        string
+	AccountNumber string
+}
+
+// ChangeAccountStatusRequest freezes or unfreezes an account. Reason is required and kept in the audit log.
+type ChangeAccountStatusRequest struct {
+	Reason string
+}
+
+// OpenAccountRequest lists the ISO 4217 currencies a new account holds, storage.DefaultCurrency when empty
+type OpenAccountRequest struct {
+	Currencies []string
+}
+
+type GetAccountsResponse struct {
+	Accounts []Account
+}
+
+type Account struct {
+	Number     string
+	UserID     string
+	Status     string
+	Currencies []string
+	CreatedAt  time.Time
+	UpdatedAt  time.Time
+}
+
+type GetAuditEntriesRequest struct {
+	OperatorID string
+	TargetType string
+	TargetID   string
+	Limit      int
+}
+
+type GetAuditEntriesResponse struct {
+	Entries []AuditEntry
+}
+
+type AuditEntry struct {
+	ID         int
+	OperatorID string
+	Role       string
+	Action     string
+	TargetType string
+	TargetID   string
+	Reason     string
+	Details    string
+	CreatedAt  time.Time
 }
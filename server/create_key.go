@@ -0,0 +1,49 @@
+package server
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/alienxp03/teya-ledger/db"
+	"github.com/alienxp03/teya-ledger/handler/apikey"
+	"github.com/alienxp03/teya-ledger/types"
+)
+
+// CreateKey runs the `create-key` subcommand, which issues an API key straight into the SQLite
+// database. It is how the first operator keys are created, as the API only lets a caller create
+// keys for itself.
+func CreateKey(args []string) error {
+	flags := flag.NewFlagSet("create-key", flag.ContinueOnError)
+	dbPath := flags.String("db", "ledger.db", "SQLite database file")
+	userID := flags.String("user", "", "User the key authenticates as")
+	role := flags.String("role", types.RoleCustomer, "Role of the key: customer, support or admin")
+	name := flags.String("name", "", "Name of the key")
+	scopes := flags.String("scopes", strings.Join(types.AllScopes, ","), "Comma separated scopes of the key")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+	if *userID == "" || *name == "" {
+		return errors.New("-user and -name are required")
+	}
+
+	database := db.NewSQLiteStorage(*dbPath)
+	if err := database.Initialize(); err != nil {
+		return err
+	}
+	defer database.Close()
+
+	created, err := apikey.New(database.GetStorage()).CreateKey(*userID, apikey.CreateKeyRequest{
+		Name:   *name,
+		Role:   *role,
+		Scopes: strings.Split(*scopes, ","),
+	})
+	if err != nil {
+		return err
+	}
+
+	fmt.Fprintf(os.Stdout, "created %s for %s with the %s role, its secret is only shown once:\n%s\n", created.Key.KeyID, *userID, created.Key.Role, created.Secret)
+	return nil
+}
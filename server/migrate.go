@@ -0,0 +1,103 @@
+package server
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"text/tabwriter"
+	"time"
+
+	"github.com/alienxp03/teya-ledger/db"
+)
+
+const migrateUsage = `Usage: ledger migrate [-db path] <command>
+
+Commands:
+  status          List every migration and whether it has been applied
+  up              Apply all pending migrations
+  down-to <ver>   Roll back applied migrations newer than <ver> (0 rolls back everything)
+`
+
+// Migrate runs the `migrate` subcommand against the SQLite database
+func Migrate(args []string) error {
+	flags := flag.NewFlagSet("migrate", flag.ContinueOnError)
+	dbPath := flags.String("db", "ledger.db", "SQLite database file")
+	flags.Usage = func() {
+		fmt.Fprint(flags.Output(), migrateUsage)
+		flags.PrintDefaults()
+	}
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+	if flags.NArg() == 0 {
+		flags.Usage()
+		return errors.New("missing migrate command")
+	}
+
+	database := db.NewSQLiteStorage(*dbPath)
+	if err := database.Open(); err != nil {
+		return err
+	}
+	defer database.Close()
+
+	migrator, err := database.Migrator()
+	if err != nil {
+		return err
+	}
+
+	switch command := flags.Arg(0); command {
+	case "status":
+		statuses, err := migrator.Status()
+		if err != nil {
+			return err
+		}
+		printMigrationStatus(os.Stdout, statuses)
+	case "up":
+		applied, err := migrator.Up()
+		for _, migration := range applied {
+			fmt.Printf("applied %04d_%s\n", migration.Version, migration.Name)
+		}
+		if err != nil {
+			return err
+		}
+		if len(applied) == 0 {
+			fmt.Println("database is up to date")
+		}
+	case "down-to":
+		if flags.NArg() != 2 {
+			return errors.New("down-to requires a target version")
+		}
+		version, err := strconv.Atoi(flags.Arg(1))
+		if err != nil {
+			return fmt.Errorf("invalid version %q", flags.Arg(1))
+		}
+		rolledBack, err := migrator.DownTo(version)
+		for _, migration := range rolledBack {
+			fmt.Printf("rolled back %04d_%s\n", migration.Version, migration.Name)
+		}
+		if err != nil {
+			return err
+		}
+	default:
+		flags.Usage()
+		return fmt.Errorf("unknown migrate command %q", command)
+	}
+
+	return nil
+}
+
+func printMigrationStatus(w io.Writer, statuses []db.MigrationStatus) {
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "VERSION\tNAME\tSTATUS\tAPPLIED AT")
+	for _, status := range statuses {
+		state, appliedAt := "pending", "-"
+		if status.Applied {
+			state, appliedAt = "applied", status.AppliedAt.Format(time.RFC3339)
+		}
+		fmt.Fprintf(tw, "%04d\t%s\t%s\t%s\n", status.Version, status.Name, state, appliedAt)
+	}
+	tw.Flush()
+}
@@ -0,0 +1,61 @@
+package server
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"text/tabwriter"
+
+	"github.com/alienxp03/teya-ledger/db"
+	"github.com/alienxp03/teya-ledger/handler/reconcile"
+)
+
+// Reconcile runs the `reconcile` subcommand against the SQLite database. It fails when
+// a drifted balance is found and -repair is not set, so it can run as a scheduled check.
+func Reconcile(args []string) error {
+	flags := flag.NewFlagSet("reconcile", flag.ContinueOnError)
+	dbPath := flags.String("db", "ledger.db", "SQLite database file")
+	repair := flags.Bool("repair", false, "Overwrite drifted balances with the amount derived from the transactions")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+
+	database := db.NewSQLiteStorage(*dbPath)
+	if err := database.Open(); err != nil {
+		return err
+	}
+	defer database.Close()
+
+	report, err := reconcile.New(database.GetStorage()).Run(*repair)
+	if report != nil {
+		printReconcileReport(os.Stdout, report)
+	}
+	if err != nil {
+		return err
+	}
+
+	if len(report.Drifts) > 0 && !*repair {
+		return fmt.Errorf("%d of %d balances drifted, rerun with -repair to fix them", len(report.Drifts), report.Balances)
+	}
+
+	return nil
+}
+
+func printReconcileReport(w io.Writer, report *reconcile.Report) {
+	fmt.Fprintf(w, "checked %d balances across %d accounts, %d drifted\n", report.Balances, report.Accounts, len(report.Drifts))
+	if len(report.Drifts) == 0 {
+		return
+	}
+
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "USER ID\tACCOUNT NUMBER\tCURRENCY\tSTORED\tDERIVED\tDIFFERENCE\tREPAIRED")
+	for _, drift := range report.Drifts {
+		difference := "overflow"
+		if amount, err := drift.Difference(); err == nil {
+			difference = amount.Major()
+		}
+		fmt.Fprintf(tw, "%s\t%s\t%s\t%s\t%s\t%s\t%t\n", drift.UserID, drift.AccountNumber, drift.Stored.Currency, drift.Stored.Major(), drift.Derived.Major(), difference, drift.Repaired)
+	}
+	tw.Flush()
+}
@@ -3,17 +3,25 @@ package server
 import (
 	"context"
 	"flag"
+	"fmt"
 	"log"
 	"log/slog"
 	"net"
 	"net/http"
 	"os"
 	"os/signal"
+	"strings"
 	"time"
 
 	"github.com/alienxp03/teya-ledger/api"
 	"github.com/alienxp03/teya-ledger/db"
+	"github.com/alienxp03/teya-ledger/handler/account"
+	"github.com/alienxp03/teya-ledger/handler/apikey"
+	"github.com/alienxp03/teya-ledger/handler/fx"
+	"github.com/alienxp03/teya-ledger/handler/jwt"
+	"github.com/alienxp03/teya-ledger/handler/settlement"
 	"github.com/alienxp03/teya-ledger/handler/transaction"
+	"github.com/alienxp03/teya-ledger/storage"
 )
 
 func Start() {
@@ -24,6 +32,32 @@ func Start() {
 	}()
 
 	addr := flag.String("addr", "0.0.0.0:8080", "HTTP network address")
+	storageType := flag.String("storage", "memory", "Storage backend: memory or sqlite")
+	dbPath := flag.String("db", "ledger.db", "SQLite database file, used when -storage=sqlite")
+	seedData := flag.Bool("seed", false, "Seed the development accounts and customer keys into the SQLite database, the memory backend is always seeded")
+	ratesPath := flag.String("rates", "rates.json", "JSON file of exchange rates keyed by FROM/TO, conversions are disabled when missing")
+	fxSpread := flag.Int64("fx-spread", 50, "Margin taken from the exchange rate on conversions, in basis points")
+	quoteTTL := flag.Duration("quote-ttl", 30*time.Second, "How long a conversion quote can be executed")
+	settlementWorkers := flag.Int("settlement-workers", 4, "Number of transactions settled at the same time")
+	settlementDelay := flag.Duration("settlement-delay", 200*time.Millisecond, "How long the fake settler takes to settle a transaction")
+	settlementAttempts := flag.Int("settlement-max-attempts", 5, "Attempts to settle a transaction before it fails")
+	holdTTL := flag.Duration("hold-ttl", 7*24*time.Hour, "How long a hold reserves funds before it expires")
+	holdExpiryInterval := flag.Duration("hold-expiry-interval", time.Minute, "How often expired holds are closed")
+	idempotencyTTL := flag.Duration("idempotency-ttl", 24*time.Hour, "How long an idempotency key and its stored response are kept")
+	idempotencyPurgeInterval := flag.Duration("idempotency-purge-interval", time.Hour, "How often expired idempotency keys are deleted")
+	jwksPath := flag.String("jwks", "", "JSON Web Key Set file of the keys JWTs are signed with, JWTs are not accepted when empty")
+	jwtIssuer := flag.String("jwt-issuer", "", "Issuer JWTs must be issued by, required with -jwks")
+	jwtAudience := flag.String("jwt-audience", "", "Audience JWTs must be issued for, required with -jwks")
+	jwtLeeway := flag.Duration("jwt-leeway", 30*time.Second, "Clock skew allowed when checking JWT expiry")
+	accountPrefix := flag.String("account-prefix", account.DefaultConfig().Prefix, "Upper case letters starting every new account number")
+	accountCheck := flag.String("account-check", string(account.DefaultConfig().Algorithm), "Check digit algorithm of new account numbers: mod97 or luhn")
+	accountLegacy := flag.String("account-legacy", strings.Join(account.DefaultConfig().Legacy, ","), "Comma separated account numbers issued without check digits, which are accepted as they are")
+	flag.Parse()
+
+	if *fxSpread < 0 || *fxSpread >= 10_000 {
+		log.Fatalf("-fx-spread must be between 0 and 9999 basis points, got %d", *fxSpread)
+	}
+
 	logger := slog.New(slog.NewTextHandler(os.Stdout, nil))
 
 	lis, err := net.Listen("tcp", *addr)
@@ -32,30 +66,94 @@ func Start() {
 		os.Exit(1)
 	}
 
-	db := db.NewMemoryStorage()
+	db, err := newDB(*storageType, *dbPath)
+	if err != nil {
+		log.Fatalf("Could not create database %v", err)
+	}
 	if err := db.Initialize(); err != nil {
 		log.Fatalf("Could not initialize database %v", err)
 	}
+	defer db.Close()
 
-	if err := db.SeedData(); err != nil {
-		log.Fatalf("failed to seed data: %v", err)
+	// The memory backend starts empty on every run, a database file is only seeded when asked to
+	if *storageType == "memory" || *seedData {
+		if err := db.SeedData(); err != nil {
+			log.Fatalf("failed to seed data: %v", err)
+		}
 	}
 
 	storage := db.GetStorage()
 
-	transactioner := transaction.New(storage)
-	api_impl := api.New(transactioner)
+	accountConfig := account.DefaultConfig()
+	accountConfig.Prefix = *accountPrefix
+	accountConfig.Algorithm = account.Algorithm(*accountCheck)
+	accountConfig.Legacy = strings.FieldsFunc(*accountLegacy, func(r rune) bool { return r == ',' })
+	accountNumbers, err := account.NewScheme(accountConfig)
+	if err != nil {
+		log.Fatalf("Invalid account numbers %v", err)
+	}
+
+	opts := []transaction.Option{transaction.WithHoldTTL(*holdTTL), transaction.WithAccountNumbers(accountNumbers)}
+	rates, err := fx.LoadStaticProvider(*ratesPath)
+	if err != nil {
+		logger.Warn("Currency conversions disabled", "rates", *ratesPath, "error", err)
+	} else {
+		opts = append(opts, transaction.WithQuoter(fx.NewQuoter(rates, *fxSpread, *quoteTTL)))
+	}
+
+	transactioner := transaction.New(storage, opts...)
+	apiOpts := []api.Option{api.WithIdempotency(storage, *idempotencyTTL), api.WithAdministrator(transactioner), api.WithAccountNumbers(accountNumbers)}
+	if *jwksPath != "" {
+		if *jwtIssuer == "" || *jwtAudience == "" {
+			log.Fatalf("-jwt-issuer and -jwt-audience are required with -jwks")
+		}
+		keys, err := jwt.LoadKeySet(*jwksPath)
+		if err != nil {
+			log.Fatalf("Could not load JWT keys %v", err)
+		}
+		apiOpts = append(apiOpts, api.WithJWT(jwt.NewVerifier(keys, jwt.Config{Issuer: *jwtIssuer, Audience: *jwtAudience, Leeway: *jwtLeeway})))
+	}
+	api_impl := api.New(transactioner, apikey.New(storage), apiOpts...)
+
+	settlementConfig := settlement.DefaultConfig()
+	settlementConfig.Workers = *settlementWorkers
+	settlementConfig.MaxAttempts = *settlementAttempts
+	settler := settlement.NewFakeSettler(*settlementDelay)
+	pool := settlement.NewPool(storage, transactioner, settler, settlementConfig, logger)
+	pool.Start()
+
+	expiryDone := make(chan struct{})
+	go func() {
+		defer close(expiryDone)
+		expireHolds(ctx, transactioner, *holdExpiryInterval, logger)
+	}()
+
+	purgeDone := make(chan struct{})
+	go func() {
+		defer close(purgeDone)
+		purgeIdempotencyKeys(ctx, storage, *idempotencyPurgeInterval, logger)
+	}()
 
 	srv := &http.Server{
 		Handler: api_impl,
 	}
 
+	shutdown := make(chan struct{})
 	go func() {
+		defer close(shutdown)
 		<-ctx.Done()
 		logger.Info("Shutting down server")
 		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
 		defer cancel()
 		_ = srv.Shutdown(ctx)
+
+		// Let the settlements in flight finish, unfinished ones are picked up on the next start
+		logger.Info("Draining settlement workers")
+		if err := pool.Shutdown(ctx); err != nil {
+			logger.Warn("Settlements left unfinished", "error", err)
+		}
+		<-expiryDone
+		<-purgeDone
 	}()
 
 	// Start the server
@@ -64,4 +162,58 @@ func Start() {
 		logger.Error("Could not start server", "error", err)
 		os.Exit(1)
 	}
+	<-shutdown
+}
+
+// expireHolds closes the holds that expired every interval until ctx is done
+func expireHolds(ctx context.Context, transactioner *transaction.TransactionHandler, interval time.Duration, logger *slog.Logger) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case now := <-ticker.C:
+			expired, err := transactioner.ExpireHolds(now)
+			if err != nil {
+				logger.Error("Could not expire holds", "error", err)
+			}
+			if expired > 0 {
+				logger.Info("Expired holds", "count", expired)
+			}
+		}
+	}
+}
+
+// purgeIdempotencyKeys deletes the idempotency keys that expired every interval until ctx is done
+func purgeIdempotencyKeys(ctx context.Context, store storage.Storage, interval time.Duration, logger *slog.Logger) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case now := <-ticker.C:
+			purged, err := store.DeleteExpiredIdempotencyKeys(now)
+			if err != nil {
+				logger.Error("Could not purge idempotency keys", "error", err)
+			}
+			if purged > 0 {
+				logger.Info("Purged idempotency keys", "count", purged)
+			}
+		}
+	}
+}
+
+func newDB(storageType, dbPath string) (db.DB, error) {
+	switch storageType {
+	case "memory":
+		return db.NewMemoryStorage(), nil
+	case "sqlite":
+		return db.NewSQLiteStorage(dbPath), nil
+	default:
+		return nil, fmt.Errorf("unknown storage %q", storageType)
+	}
 }
@@ -0,0 +1,79 @@
+package server
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"text/tabwriter"
+
+	"github.com/alienxp03/teya-ledger/db"
+	"github.com/alienxp03/teya-ledger/storage"
+	"github.com/alienxp03/teya-ledger/types"
+)
+
+// TrialBalance runs the `trial-balance` subcommand, printing the totals of every
+// ledger account in the SQLite database followed by the totals per currency
+func TrialBalance(args []string) error {
+	flags := flag.NewFlagSet("trial-balance", flag.ContinueOnError)
+	dbPath := flags.String("db", "ledger.db", "SQLite database file")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+
+	database := db.NewSQLiteStorage(*dbPath)
+	if err := database.Open(); err != nil {
+		return err
+	}
+	defer database.Close()
+
+	lines, err := database.GetStorage().GetTrialBalance()
+	if err != nil {
+		return err
+	}
+	return printTrialBalance(os.Stdout, lines)
+}
+
+// printTrialBalance prints amounts in major units of their currency
+func printTrialBalance(w io.Writer, lines []*storage.TrialBalanceLine) error {
+	totals := map[string]*storage.TrialBalanceLine{}
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "LEDGER ACCOUNT\tCURRENCY\tDEBITS\tCREDITS\tBALANCE")
+	for _, line := range lines {
+		printTrialBalanceLine(tw, line)
+
+		currency := line.Balance.Currency
+		total, ok := totals[currency]
+		if !ok {
+			zero := types.NewMoney(0, currency)
+			total = &storage.TrialBalanceLine{LedgerAccount: "TOTAL", Debits: zero, Credits: zero, Balance: zero}
+			totals[currency] = total
+		}
+
+		var err error
+		if total.Debits, err = total.Debits.Add(line.Debits); err != nil {
+			return err
+		}
+		if total.Credits, err = total.Credits.Add(line.Credits); err != nil {
+			return err
+		}
+		if total.Balance, err = total.Balance.Add(line.Balance); err != nil {
+			return err
+		}
+	}
+
+	currencies := []string{}
+	for currency := range totals {
+		currencies = append(currencies, currency)
+	}
+	sort.Strings(currencies)
+	for _, currency := range currencies {
+		printTrialBalanceLine(tw, totals[currency])
+	}
+	return tw.Flush()
+}
+
+func printTrialBalanceLine(w io.Writer, line *storage.TrialBalanceLine) {
+	fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\n", line.LedgerAccount, line.Balance.Currency, line.Debits.Major(), line.Credits.Major(), line.Balance.Major())
+}
@@ -1,32 +1,144 @@
 package storage
 
 import (
-	"errors"
+	"slices"
+	"sort"
 	"time"
+
+	"github.com/alienxp03/teya-ledger/types"
 )
 
 // CreateTransaction creates a new transaction
 func (m *MemoryStorage) CreateAccount(account Account) (*Account, error) {
-	// Ideally should be handled by a unique constraint
-	for _, accountData := range m.accounts {
-		if account.UserID == account.UserID && accountData.Number == account.Number {
-			return nil, errors.New("account already exists")
-		}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	key := accountKey{userID: account.UserID, accountNumber: account.Number}
+	if _, ok := m.accounts[key]; ok {
+		return nil, ErrAccountExists
 	}
-	now := time.Now()
+	now := createdAt(account.CreatedAt)
 	account.CreatedAt = now
 	account.UpdatedAt = now
+	account.Currencies = account.currencies()
+	if account.Status == "" {
+		account.Status = AccountStatusActive
+	}
+
+	stored := copyAccount(&account)
+	m.accounts[key] = stored
+	if _, ok := m.accountsByNumber[account.Number]; !ok {
+		m.accountsByNumber[account.Number] = stored
+	}
 
-	m.accounts = append(m.accounts, &account)
+	m.balances[key] = map[string]*Balance{}
+	for _, currency := range account.Currencies {
+		m.balances[key][currency] = &Balance{
+			UserID:        account.UserID,
+			AccountNumber: account.Number,
+			Amount:        types.NewMoney(0, currency),
+		}
+	}
 	return &account, nil
 }
 
 func (m *MemoryStorage) GetAccount(userID string, accountNumber string) (*Account, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	account, ok := m.accounts[accountKey{userID: userID, accountNumber: accountNumber}]
+	if !ok {
+		return nil, ErrNotFound
+	}
+
+	return copyAccount(account), nil
+}
+
+func (m *MemoryStorage) GetAccountByNumber(accountNumber string) (*Account, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	account, ok := m.accountsByNumber[accountNumber]
+	if !ok {
+		return nil, ErrNotFound
+	}
+
+	return copyAccount(account), nil
+}
+
+func (m *MemoryStorage) ListAccounts() ([]*Account, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	result := []*Account{}
 	for _, account := range m.accounts {
-		if account.UserID == userID && account.Number == accountNumber {
-			return account, nil
+		result = append(result, copyAccount(account))
+	}
+	sort.Slice(result, func(i, j int) bool {
+		if result[i].UserID != result[j].UserID {
+			return result[i].UserID < result[j].UserID
 		}
+		return result[i].Number < result[j].Number
+	})
+
+	return result, nil
+}
+
+func (m *MemoryStorage) GetAccounts(userID string) ([]*Account, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	result := []*Account{}
+	for _, account := range m.accounts {
+		if account.UserID == userID {
+			result = append(result, copyAccount(account))
+		}
+	}
+	sort.Slice(result, func(i, j int) bool {
+		if !result[i].CreatedAt.Equal(result[j].CreatedAt) {
+			return result[i].CreatedAt.Before(result[j].CreatedAt)
+		}
+		return result[i].Number < result[j].Number
+	})
+
+	return result, nil
+}
+
+func (m *MemoryStorage) UpdateAccountStatus(userID string, accountNumber string, from string, to string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	account, ok := m.accounts[accountKey{userID: userID, accountNumber: accountNumber}]
+	if !ok {
+		return ErrNotFound
+	}
+	if account.Status != from {
+		return ErrStatusConflict
+	}
+
+	account.Status = to
+	account.UpdatedAt = time.Now()
+	return nil
+}
+
+func (m *MemoryStorage) removeAccount(userID string, accountNumber string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	key := accountKey{userID: userID, accountNumber: accountNumber}
+	if m.accountsByNumber[accountNumber] == m.accounts[key] {
+		delete(m.accountsByNumber, accountNumber)
 	}
+	delete(m.accounts, key)
+	delete(m.balances, key)
+}
+
+func copyAccount(account *Account) *Account {
+	copied := *account
+	copied.Currencies = slices.Clone(account.Currencies)
+	return &copied
+}
 
-	return nil, ErrNotFound
+func (m *MemoryStorage) LockAccount(userID string, accountNumber string) func() {
+	return m.accountLocks.lock(userID, accountNumber)
 }
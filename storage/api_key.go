@@ -0,0 +1,127 @@
+package storage
+
+import (
+	"slices"
+	"sort"
+	"time"
+
+	"github.com/alienxp03/teya-ledger/types"
+)
+
+func (m *MemoryStorage) CreateAPIKey(key *APIKey) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if _, ok := m.apiKeys[key.KeyID]; ok {
+		return ErrAPIKeyExists
+	}
+	if _, ok := m.apiKeysByHash[key.Hash]; ok {
+		return ErrAPIKeyExists
+	}
+
+	if key.Role == "" {
+		key.Role = types.RoleCustomer
+	}
+	key.CreatedAt = time.Now()
+	stored := *key
+	stored.Scopes = slices.Clone(key.Scopes)
+	m.apiKeys[key.KeyID] = &stored
+	m.apiKeysByHash[key.Hash] = &stored
+	return nil
+}
+
+func (m *MemoryStorage) GetAPIKey(userID string, keyID string) (*APIKey, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	key, ok := m.apiKeys[keyID]
+	if !ok || key.UserID != userID {
+		return nil, ErrNotFound
+	}
+
+	result := *key
+	return &result, nil
+}
+
+func (m *MemoryStorage) GetAPIKeyByHash(hash string) (*APIKey, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	key, ok := m.apiKeysByHash[hash]
+	if !ok {
+		return nil, ErrNotFound
+	}
+
+	result := *key
+	return &result, nil
+}
+
+func (m *MemoryStorage) ListAPIKeys(userID string) ([]*APIKey, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	result := []*APIKey{}
+	for _, key := range m.apiKeys {
+		if key.UserID == userID {
+			copied := *key
+			result = append(result, &copied)
+		}
+	}
+	sort.Slice(result, func(i, j int) bool {
+		if !result[i].CreatedAt.Equal(result[j].CreatedAt) {
+			return result[i].CreatedAt.Before(result[j].CreatedAt)
+		}
+		return result[i].KeyID < result[j].KeyID
+	})
+
+	return result, nil
+}
+
+func (m *MemoryStorage) RevokeAPIKey(userID string, keyID string, at time.Time) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	key, ok := m.apiKeys[keyID]
+	if !ok || key.UserID != userID {
+		return ErrNotFound
+	}
+	if key.Revoked() {
+		return ErrStatusConflict
+	}
+
+	key.RevokedAt = at
+	return nil
+}
+
+func (m *MemoryStorage) TouchAPIKey(keyID string, at time.Time) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	key, ok := m.apiKeys[keyID]
+	if !ok {
+		return ErrNotFound
+	}
+
+	key.LastUsedAt = at
+	return nil
+}
+
+func (m *MemoryStorage) removeAPIKey(keyID string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if key, ok := m.apiKeys[keyID]; ok {
+		delete(m.apiKeysByHash, key.Hash)
+		delete(m.apiKeys, keyID)
+	}
+}
+
+// unrevokeAPIKey makes a key active again after its revocation is rolled back
+func (m *MemoryStorage) unrevokeAPIKey(keyID string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if key, ok := m.apiKeys[keyID]; ok {
+		key.RevokedAt = time.Time{}
+	}
+}
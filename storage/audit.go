@@ -0,0 +1,57 @@
+package storage
+
+import "time"
+
+func (m *MemoryStorage) RecordAuditEntry(entry *AuditEntry) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.lastAuditEntryID++
+	entry.ID = m.lastAuditEntryID
+	entry.CreatedAt = time.Now()
+
+	stored := *entry
+	m.auditEntries = append(m.auditEntries, &stored)
+	return nil
+}
+
+func (m *MemoryStorage) ListAuditEntries(query AuditQuery) ([]*AuditEntry, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	limit := auditLimit(query.Limit)
+	result := []*AuditEntry{}
+	for i := len(m.auditEntries) - 1; i >= 0 && len(result) < limit; i-- {
+		entry := m.auditEntries[i]
+		if query.OperatorID != "" && entry.OperatorID != query.OperatorID ||
+			query.TargetType != "" && entry.TargetType != query.TargetType ||
+			query.TargetID != "" && entry.TargetID != query.TargetID {
+			continue
+		}
+
+		copied := *entry
+		result = append(result, &copied)
+	}
+
+	return result, nil
+}
+
+func (m *MemoryStorage) removeAuditEntry(id int) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for i, entry := range m.auditEntries {
+		if entry.ID == id {
+			m.auditEntries = append(m.auditEntries[:i], m.auditEntries[i+1:]...)
+			return
+		}
+	}
+}
+
+// auditLimit applies the default and maximum number of audit entries listed at once
+func auditLimit(limit int) int {
+	if limit <= 0 {
+		return DefaultTransactionsLimit
+	}
+	return min(limit, MaxTransactionsLimit)
+}
@@ -1,29 +1,105 @@
 package storage
 
-func (m *MemoryStorage) GetBalance(userID string, accountNumber string) (*Balance, error) {
-	for _, balance := range m.balances {
-		if balance.UserID == userID && balance.AccountNumber == accountNumber {
-			return balance, nil
-		}
+import (
+	"slices"
+	"sort"
+	"time"
+
+	"github.com/alienxp03/teya-ledger/types"
+)
+
+func (m *MemoryStorage) GetBalance(userID string, accountNumber string, currency string) (*Balance, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	balance, ok := m.balances[accountKey{userID: userID, accountNumber: accountNumber}][currency]
+	if !ok {
+		return nil, ErrNotFound
 	}
 
-	// If no balance exists, create one with 0 amount
-	balance := &Balance{
-		UserID:        userID,
-		AccountNumber: accountNumber,
-		Amount:        0,
-		Currency:      "MYR",
+	result := *balance
+	return &result, nil
+}
+
+func (m *MemoryStorage) GetBalances(userID string, accountNumber string) ([]*Balance, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	result := []*Balance{}
+	for _, balance := range m.balances[accountKey{userID: userID, accountNumber: accountNumber}] {
+		copied := *balance
+		result = append(result, &copied)
 	}
-	m.balances = append(m.balances, balance)
-	return balance, nil
+	sort.Slice(result, func(i, j int) bool { return result[i].Amount.Currency < result[j].Amount.Currency })
+
+	return result, nil
 }
 
-func (m *MemoryStorage) UpdateBalance(userID string, accountNumber string, amount int64) error {
-	balance, err := m.GetBalance(userID, accountNumber)
+func (m *MemoryStorage) UpdateBalance(userID string, accountNumber string, amount types.Money) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	balance, ok := m.balances[accountKey{userID: userID, accountNumber: accountNumber}][amount.Currency]
+	if !ok {
+		return ErrNotFound
+	}
+
+	updated, err := balance.Amount.Add(amount)
 	if err != nil {
 		return err
 	}
 
-	balance.Amount += amount
+	balance.Amount = updated
 	return nil
 }
+
+// revertBalance takes back an amount added by UpdateBalance, which cannot overflow
+func (m *MemoryStorage) revertBalance(userID string, accountNumber string, amount types.Money) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	balance, ok := m.balances[accountKey{userID: userID, accountNumber: accountNumber}][amount.Currency]
+	if !ok {
+		return
+	}
+	if reverted, err := balance.Amount.Sub(amount); err == nil {
+		balance.Amount = reverted
+	}
+}
+
+func (m *MemoryStorage) DeriveBalanceHistory(userID string, accountNumber string, currency string, instants []time.Time) ([]types.Money, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	events := []statusEvent{}
+	for _, transaction := range m.accountTransactions[accountKey{userID: userID, accountNumber: accountNumber}] {
+		if transaction.Amount.Currency != currency {
+			continue
+		}
+		for _, change := range m.statusChanges[transaction.TransactionID] {
+			events = append(events, statusEvent{transactionID: transaction.TransactionID, amount: transaction.Amount, status: change.To, at: change.CreatedAt})
+		}
+	}
+	// Changes of a transaction are appended in order, a stable sort keeps them that way
+	slices.SortStableFunc(events, func(a, b statusEvent) int { return a.at.Compare(b.at) })
+
+	return replayBalances(events, currency, instants)
+}
+
+func (m *MemoryStorage) DeriveBalance(userID string, accountNumber string, currency string) (types.Money, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	result := types.NewMoney(0, currency)
+	for _, transaction := range m.accountTransactions[accountKey{userID: userID, accountNumber: accountNumber}] {
+		if transaction.Amount.Currency != currency || !transaction.AffectsBalance() {
+			continue
+		}
+
+		var err error
+		if result, err = result.Add(transaction.Amount); err != nil {
+			return types.Money{}, err
+		}
+	}
+	return result, nil
+}
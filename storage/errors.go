@@ -3,5 +3,16 @@ package storage
 import "errors"
 
 var (
-	ErrNotFound = errors.New("not found")
+	ErrNotFound          = errors.New("not found")
+	ErrAccountExists     = errors.New("account already exists")
+	ErrTransactionExists = errors.New("transaction already exists")
+	ErrHoldExists        = errors.New("hold already exists")
+	// ErrIdempotencyKeyExists means a user already made a request with an idempotency key that has not expired
+	ErrIdempotencyKeyExists = errors.New("idempotency key already exists")
+	ErrAPIKeyExists         = errors.New("api key already exists")
+	ErrInvalidCursor        = errors.New("invalid cursor")
+	ErrInvalidQuery         = errors.New("invalid query")
+	ErrUnbalancedEntry      = errors.New("unbalanced journal entry")
+	// ErrStatusConflict means a transaction is no longer in the status a change was made from
+	ErrStatusConflict = errors.New("transaction status changed concurrently")
 )
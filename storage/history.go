@@ -0,0 +1,47 @@
+package storage
+
+import (
+	"time"
+
+	"github.com/alienxp03/teya-ledger/types"
+)
+
+// statusEvent is a transaction moving to a status, as recorded in its status history
+type statusEvent struct {
+	transactionID string
+	amount        types.Money
+	status        string
+	at            time.Time
+}
+
+// replayBalances walks events, ordered by time, and returns the balance in currency as of each of
+// instants. A transaction counts towards a balance when the status it had at that instant does.
+func replayBalances(events []statusEvent, currency string, instants []time.Time) ([]types.Money, error) {
+	balance := types.NewMoney(0, currency)
+	counted := map[string]bool{}
+	result := make([]types.Money, 0, len(instants))
+
+	next := 0
+	for _, instant := range instants {
+		for ; next < len(events) && !events[next].at.After(instant); next++ {
+			event := events[next]
+			counts := AffectsBalance(event.amount, event.status)
+			if counts == counted[event.transactionID] {
+				continue
+			}
+			counted[event.transactionID] = counts
+
+			var err error
+			if counts {
+				balance, err = balance.Add(event.amount)
+			} else {
+				balance, err = balance.Sub(event.amount)
+			}
+			if err != nil {
+				return nil, err
+			}
+		}
+		result = append(result, balance)
+	}
+	return result, nil
+}
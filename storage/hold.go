@@ -0,0 +1,124 @@
+package storage
+
+import (
+	"sort"
+	"time"
+
+	"github.com/alienxp03/teya-ledger/types"
+)
+
+func (m *MemoryStorage) CreateHold(hold *Hold) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if _, ok := m.holds[hold.HoldID]; ok {
+		return ErrHoldExists
+	}
+
+	now := time.Now()
+	hold.CreatedAt = now
+	hold.UpdatedAt = now
+	hold.Captured = types.NewMoney(0, hold.Amount.Currency)
+
+	m.lastHoldID++
+	hold.ID = m.lastHoldID
+
+	stored := *hold
+	m.holds[hold.HoldID] = &stored
+	return nil
+}
+
+func (m *MemoryStorage) GetHold(userID string, holdID string) (*Hold, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	hold, ok := m.holds[holdID]
+	if !ok || hold.UserID != userID {
+		return nil, ErrNotFound
+	}
+
+	result := *hold
+	return &result, nil
+}
+
+func (m *MemoryStorage) CloseHold(hold *Hold) error {
+	_, err := m.closeHold(hold)
+	return err
+}
+
+// closeHold closes a hold and returns it as it was before
+func (m *MemoryStorage) closeHold(hold *Hold) (Hold, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	stored, ok := m.holds[hold.HoldID]
+	if !ok {
+		return Hold{}, ErrNotFound
+	}
+	if stored.Status != HoldStatusActive {
+		return Hold{}, ErrStatusConflict
+	}
+
+	previous := *stored
+	hold.UpdatedAt = time.Now()
+	stored.Status = hold.Status
+	stored.Captured = hold.Captured
+	stored.UpdatedAt = hold.UpdatedAt
+	return previous, nil
+}
+
+func (m *MemoryStorage) GetHeldAmount(userID string, accountNumber string, currency string, now time.Time) (types.Money, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	result := types.NewMoney(0, currency)
+	for _, hold := range m.holds {
+		if hold.UserID != userID || hold.AccountNumber != accountNumber || hold.Amount.Currency != currency || !hold.Reserves(now) {
+			continue
+		}
+
+		var err error
+		if result, err = result.Add(hold.Amount); err != nil {
+			return types.Money{}, err
+		}
+	}
+	return result, nil
+}
+
+func (m *MemoryStorage) ListExpiredHolds(now time.Time, limit int) ([]*Hold, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	result := []*Hold{}
+	for _, hold := range m.holds {
+		if hold.Status == HoldStatusActive && !now.Before(hold.ExpiresAt) {
+			copied := *hold
+			result = append(result, &copied)
+		}
+	}
+	sort.Slice(result, func(i, j int) bool {
+		if !result[i].ExpiresAt.Equal(result[j].ExpiresAt) {
+			return result[i].ExpiresAt.Before(result[j].ExpiresAt)
+		}
+		return result[i].ID < result[j].ID
+	})
+
+	return result[:min(limit, len(result))], nil
+}
+
+func (m *MemoryStorage) removeHold(holdID string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	delete(m.holds, holdID)
+}
+
+// restoreHold puts back a hold as it was before it was closed
+func (m *MemoryStorage) restoreHold(hold Hold) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if stored, ok := m.holds[hold.HoldID]; ok {
+		*stored = hold
+	}
+}
@@ -0,0 +1,84 @@
+package storage
+
+import (
+	"slices"
+	"time"
+)
+
+// idempotencyRef identifies an idempotency key, which is scoped to the user who sent it
+type idempotencyRef struct {
+	userID string
+	key    string
+}
+
+func (m *MemoryStorage) CreateIdempotencyKey(key *IdempotencyKey) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	now := time.Now()
+	ref := idempotencyRef{userID: key.UserID, key: key.Key}
+	if stored, ok := m.idempotencyKeys[ref]; ok && now.Before(stored.ExpiresAt) {
+		return ErrIdempotencyKeyExists
+	}
+
+	key.CreatedAt = now
+	stored := *key
+	stored.Body = slices.Clone(key.Body)
+	m.idempotencyKeys[ref] = &stored
+	return nil
+}
+
+func (m *MemoryStorage) GetIdempotencyKey(userID string, key string) (*IdempotencyKey, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	stored, ok := m.idempotencyKeys[idempotencyRef{userID: userID, key: key}]
+	if !ok {
+		return nil, ErrNotFound
+	}
+
+	result := *stored
+	result.Body = slices.Clone(stored.Body)
+	return &result, nil
+}
+
+func (m *MemoryStorage) CompleteIdempotencyKey(key *IdempotencyKey) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	stored, ok := m.idempotencyKeys[idempotencyRef{userID: key.UserID, key: key.Key}]
+	if !ok {
+		return ErrNotFound
+	}
+
+	stored.StatusCode = key.StatusCode
+	stored.ContentType = key.ContentType
+	stored.Body = slices.Clone(key.Body)
+	return nil
+}
+
+func (m *MemoryStorage) DeleteIdempotencyKey(userID string, key string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	ref := idempotencyRef{userID: userID, key: key}
+	if _, ok := m.idempotencyKeys[ref]; !ok {
+		return ErrNotFound
+	}
+	delete(m.idempotencyKeys, ref)
+	return nil
+}
+
+func (m *MemoryStorage) DeleteExpiredIdempotencyKeys(now time.Time) (int, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	deleted := 0
+	for ref, key := range m.idempotencyKeys {
+		if !now.Before(key.ExpiresAt) {
+			delete(m.idempotencyKeys, ref)
+			deleted++
+		}
+	}
+	return deleted, nil
+}
@@ -0,0 +1,183 @@
+package storage
+
+import (
+	"fmt"
+	"sort"
+
+	"github.com/alienxp03/teya-ledger/types"
+)
+
+type ledgerKey struct {
+	ledgerAccount string
+	currency      string
+}
+
+// validate enforces the double-entry invariant: at least two non-zero postings
+// that sum to zero in every currency
+func (e *JournalEntry) validate() error {
+	if len(e.Postings) < 2 {
+		return fmt.Errorf("%w: at least two postings are required", ErrUnbalancedEntry)
+	}
+
+	sums := map[string]types.Money{}
+	for _, posting := range e.Postings {
+		if posting.LedgerAccount == "" || posting.Amount.Currency == "" || posting.Amount.IsZero() {
+			return fmt.Errorf("%w: postings need a ledger account, a currency and a non-zero amount", ErrUnbalancedEntry)
+		}
+
+		sum, ok := sums[posting.Amount.Currency]
+		if !ok {
+			sum = types.NewMoney(0, posting.Amount.Currency)
+		}
+		sum, err := sum.Add(posting.Amount)
+		if err != nil {
+			return fmt.Errorf("%w: %w", ErrUnbalancedEntry, err)
+		}
+		sums[posting.Amount.Currency] = sum
+	}
+
+	for _, sum := range sums {
+		if !sum.IsZero() {
+			return fmt.Errorf("%w: %s postings sum to %s", ErrUnbalancedEntry, sum.Currency, sum)
+		}
+	}
+
+	return nil
+}
+
+func (m *MemoryStorage) PostJournalEntry(entry *JournalEntry) error {
+	if err := entry.validate(); err != nil {
+		return err
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.lastJournalEntryID++
+	entry.ID = m.lastJournalEntryID
+	entry.CreatedAt = createdAt(entry.CreatedAt)
+
+	stored := copyJournalEntry(entry)
+	if err := m.applyPostings(stored.Postings, false); err != nil {
+		return err
+	}
+	m.journalEntries[stored.Reference] = append(m.journalEntries[stored.Reference], stored)
+	return nil
+}
+
+func (m *MemoryStorage) GetJournalEntries(reference string) ([]*JournalEntry, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	result := []*JournalEntry{}
+	for _, entry := range m.journalEntries[reference] {
+		result = append(result, copyJournalEntry(entry))
+	}
+	return result, nil
+}
+
+func (m *MemoryStorage) GetTrialBalance() ([]*TrialBalanceLine, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	result := []*TrialBalanceLine{}
+	for _, line := range m.trialBalance {
+		copied := *line
+		result = append(result, &copied)
+	}
+	sort.Slice(result, func(i, j int) bool {
+		if result[i].LedgerAccount != result[j].LedgerAccount {
+			return result[i].LedgerAccount < result[j].LedgerAccount
+		}
+		return result[i].Balance.Currency < result[j].Balance.Currency
+	})
+
+	return result, nil
+}
+
+// applyPostings adds postings to the running trial balance, or removes them when remove is set.
+// The trial balance is left untouched when a total would overflow.
+// The caller must hold m.mu for writing.
+func (m *MemoryStorage) applyPostings(postings []Posting, remove bool) error {
+	updated := map[ledgerKey]TrialBalanceLine{}
+	for _, posting := range postings {
+		key := ledgerKey{ledgerAccount: posting.LedgerAccount, currency: posting.Amount.Currency}
+		line, ok := updated[key]
+		if !ok {
+			line = m.trialBalanceLine(key)
+		}
+
+		if err := line.apply(posting.Amount, remove); err != nil {
+			return err
+		}
+		updated[key] = line
+	}
+
+	for key, line := range updated {
+		if line.Debits.IsZero() && line.Credits.IsZero() {
+			delete(m.trialBalance, key)
+			continue
+		}
+		m.trialBalance[key] = &line
+	}
+	return nil
+}
+
+// trialBalanceLine returns a copy of the running total of key, or an empty line.
+// The caller must hold m.mu.
+func (m *MemoryStorage) trialBalanceLine(key ledgerKey) TrialBalanceLine {
+	if line, ok := m.trialBalance[key]; ok {
+		return *line
+	}
+
+	zero := types.NewMoney(0, key.currency)
+	return TrialBalanceLine{LedgerAccount: key.ledgerAccount, Debits: zero, Credits: zero, Balance: zero}
+}
+
+// apply adds a posting amount to the line, or takes it away when remove is set
+func (l *TrialBalanceLine) apply(amount types.Money, remove bool) error {
+	// Credits are totalled as a positive amount
+	credit, err := amount.Neg()
+	if err != nil {
+		return err
+	}
+
+	total, change := &l.Debits, amount
+	if amount.IsNegative() {
+		total, change = &l.Credits, credit
+	}
+	update := types.Money.Add
+	if remove {
+		update = types.Money.Sub
+	}
+
+	if *total, err = update(*total, change); err != nil {
+		return err
+	}
+	l.Balance, err = update(l.Balance, amount)
+	return err
+}
+
+func (m *MemoryStorage) removeJournalEntry(reference string, id int) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	entries := m.journalEntries[reference]
+	for i, entry := range entries {
+		if entry.ID == id {
+			// Removing postings that were applied before cannot overflow
+			_ = m.applyPostings(entry.Postings, true)
+			m.journalEntries[reference] = append(entries[:i], entries[i+1:]...)
+			break
+		}
+	}
+	if len(m.journalEntries[reference]) == 0 {
+		delete(m.journalEntries, reference)
+	}
+}
+
+func copyJournalEntry(entry *JournalEntry) *JournalEntry {
+	copied := *entry
+	copied.Postings = append([]Posting{}, entry.Postings...)
+	return &copied
+}
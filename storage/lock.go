@@ -0,0 +1,56 @@
+package storage
+
+import "sync"
+
+type accountKey struct {
+	userID        string
+	accountNumber string
+}
+
+// accountLocks hands out one mutex per account. Entries are reference counted and
+// removed once nobody holds or waits for them, so the map only grows with contention.
+type accountLocks struct {
+	mu    sync.Mutex
+	locks map[accountKey]*accountLock
+}
+
+type accountLock struct {
+	sync.Mutex
+	refs int
+}
+
+func newAccountLocks() *accountLocks {
+	return &accountLocks{
+		locks: map[accountKey]*accountLock{},
+	}
+}
+
+// lock blocks until the account is exclusively held and returns the function releasing it
+func (a *accountLocks) lock(userID, accountNumber string) func() {
+	key := accountKey{userID: userID, accountNumber: accountNumber}
+
+	a.mu.Lock()
+	l, ok := a.locks[key]
+	if !ok {
+		l = &accountLock{}
+		a.locks[key] = l
+	}
+	l.refs++
+	a.mu.Unlock()
+
+	l.Lock()
+
+	var once sync.Once
+	return func() {
+		once.Do(func() {
+			l.Unlock()
+
+			a.mu.Lock()
+			l.refs--
+			if l.refs == 0 {
+				delete(a.locks, key)
+			}
+			a.mu.Unlock()
+		})
+	}
+}
@@ -0,0 +1,112 @@
+package storage_test
+
+import (
+	"fmt"
+	"sync"
+	"testing"
+
+	"github.com/alienxp03/teya-ledger/storage"
+	"github.com/alienxp03/teya-ledger/types"
+)
+
+const (
+	benchmarkAccounts     = 1_000
+	benchmarkTransactions = 1_000_000
+)
+
+// benchmarkStorage is shared between benchmarks so the million transactions are only inserted once
+var benchmarkStorage = sync.OnceValue(func() *storage.MemoryStorage {
+	s := storage.NewMemoryStorage()
+	for i := range benchmarkAccounts {
+		s.CreateAccount(storage.Account{UserID: benchmarkUserID(i), Number: benchmarkAccountNumber(i)})
+	}
+	for i := range benchmarkTransactions {
+		account := i % benchmarkAccounts
+		s.CreateTransaction(&storage.Transaction{
+			TransactionID: fmt.Sprintf("TRANSACTION_%d", i),
+			UserID:        benchmarkUserID(account),
+			AccountNumber: benchmarkAccountNumber(account),
+			Status:        "completed",
+			Amount:        types.NewMoney(100, "MYR"),
+		})
+		s.UpdateBalance(benchmarkUserID(account), benchmarkAccountNumber(account), types.NewMoney(100, "MYR"))
+	}
+	return s
+})
+
+func benchmarkUserID(i int) string        { return fmt.Sprintf("USER_ID_%d", i) }
+func benchmarkAccountNumber(i int) string { return fmt.Sprintf("ACCOUNT_NUMBER_%d", i) }
+
+func BenchmarkMemoryGetAccount(b *testing.B) {
+	s := benchmarkStorage()
+	b.ResetTimer()
+
+	for i := 0; i < b.N; i++ {
+		account := i % benchmarkAccounts
+		if _, err := s.GetAccount(benchmarkUserID(account), benchmarkAccountNumber(account)); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkMemoryGetBalance(b *testing.B) {
+	s := benchmarkStorage()
+	b.ResetTimer()
+
+	for i := 0; i < b.N; i++ {
+		account := i % benchmarkAccounts
+		if _, err := s.GetBalance(benchmarkUserID(account), benchmarkAccountNumber(account), "MYR"); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkMemoryGetTransaction(b *testing.B) {
+	s := benchmarkStorage()
+	b.ResetTimer()
+
+	for i := 0; i < b.N; i++ {
+		n := i % benchmarkTransactions
+		if _, err := s.GetTransaction(benchmarkUserID(n%benchmarkAccounts), fmt.Sprintf("TRANSACTION_%d", n)); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkMemoryCreateDepositDuplicate(b *testing.B) {
+	s := benchmarkStorage()
+	b.ResetTimer()
+
+	for i := 0; i < b.N; i++ {
+		n := i % benchmarkTransactions
+		_, err := s.CreateDeposit(&storage.Transaction{
+			TransactionID: fmt.Sprintf("TRANSACTION_%d", n),
+			UserID:        benchmarkUserID(n % benchmarkAccounts),
+			AccountNumber: benchmarkAccountNumber(n % benchmarkAccounts),
+			Amount:        types.NewMoney(100, "MYR"),
+		})
+		if err != storage.ErrTransactionExists {
+			b.Fatalf("expected duplicate, got %v", err)
+		}
+	}
+}
+
+func BenchmarkMemoryGetTransactionsCursor(b *testing.B) {
+	s := benchmarkStorage()
+	first, err := s.GetTransactions(storage.TransactionQuery{UserID: benchmarkUserID(0), AccountNumber: benchmarkAccountNumber(0), Limit: 20})
+	if err != nil {
+		b.Fatal(err)
+	}
+	b.ResetTimer()
+
+	for i := 0; i < b.N; i++ {
+		if _, err := s.GetTransactions(storage.TransactionQuery{
+			UserID:        benchmarkUserID(0),
+			AccountNumber: benchmarkAccountNumber(0),
+			Limit:         20,
+			Cursor:        first.NextCursor,
+		}); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
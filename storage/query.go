@@ -0,0 +1,149 @@
+package storage
+
+import (
+	"encoding/base64"
+	"fmt"
+	"slices"
+	"strings"
+)
+
+// cursor identifies a position in the (sort value, ID) ordering of transactions
+type cursor struct {
+	sortBy    string
+	sortOrder string
+	// value is the CreatedAt in Unix nanoseconds or the Amount, depending on sortBy
+	value int64
+	id    int
+}
+
+func (c cursor) encode() string {
+	raw := fmt.Sprintf("%s:%s:%d:%d", c.sortBy, c.sortOrder, c.value, c.id)
+	return base64.RawURLEncoding.EncodeToString([]byte(raw))
+}
+
+// decodeCursor parses a cursor and checks it was issued for the same sort as query
+func decodeCursor(query TransactionQuery) (cursor, error) {
+	raw, err := base64.RawURLEncoding.DecodeString(query.Cursor)
+	if err != nil {
+		return cursor{}, ErrInvalidCursor
+	}
+
+	var c cursor
+	parts := strings.SplitN(string(raw), ":", 3)
+	if len(parts) != 3 {
+		return cursor{}, ErrInvalidCursor
+	}
+	c.sortBy, c.sortOrder = parts[0], parts[1]
+	if _, err := fmt.Sscanf(parts[2], "%d:%d", &c.value, &c.id); err != nil {
+		return cursor{}, ErrInvalidCursor
+	}
+
+	if c.sortBy != query.SortBy || c.sortOrder != query.SortOrder {
+		return cursor{}, ErrInvalidCursor
+	}
+
+	return c, nil
+}
+
+func cursorOf(query TransactionQuery, transaction *Transaction) cursor {
+	return cursor{
+		sortBy:    query.SortBy,
+		sortOrder: query.SortOrder,
+		value:     sortValue(query.SortBy, transaction),
+		id:        transaction.ID,
+	}
+}
+
+func sortValue(sortBy string, transaction *Transaction) int64 {
+	if sortBy == SortByAmount {
+		return transaction.Amount.Amount
+	}
+	return transaction.CreatedAt.UnixNano()
+}
+
+// normalize applies the default sort, page size and page number
+func (q TransactionQuery) normalize() TransactionQuery {
+	if q.SortBy == "" {
+		q.SortBy = SortByCreatedAt
+	}
+	if q.SortOrder == "" {
+		q.SortOrder = SortDescending
+	}
+	if q.Limit <= 0 {
+		q.Limit = DefaultTransactionsLimit
+	}
+	if q.Limit > MaxTransactionsLimit {
+		q.Limit = MaxTransactionsLimit
+	}
+	if q.Page <= 0 {
+		q.Page = 1
+	}
+	return q
+}
+
+func (q TransactionQuery) validate() error {
+	if q.SortBy != SortByCreatedAt && q.SortBy != SortByAmount {
+		return fmt.Errorf("%w: unknown sort %q", ErrInvalidQuery, q.SortBy)
+	}
+	if q.SortOrder != SortAscending && q.SortOrder != SortDescending {
+		return fmt.Errorf("%w: unknown sort order %q", ErrInvalidQuery, q.SortOrder)
+	}
+	return nil
+}
+
+// filtered reports whether any filter is set
+func (q TransactionQuery) filtered() bool {
+	return q.Status != "" || q.Type != "" || q.MinAmount != nil || q.MaxAmount != nil ||
+		!q.CreatedFrom.IsZero() || !q.CreatedTo.IsZero() || q.Description != "" ||
+		q.Tag != "" || len(q.Metadata) > 0 || q.ExternalReference != "" || q.CounterpartyName != "" || q.CategoryCode != ""
+}
+
+// matches applies the filters of q to transaction
+func (q TransactionQuery) matches(transaction *Transaction) bool {
+	switch {
+	case q.Status != "" && transaction.Status != q.Status:
+		return false
+	case q.Type != "" && transaction.Type != q.Type:
+		return false
+	case q.MinAmount != nil && transaction.Amount.Amount < *q.MinAmount:
+		return false
+	case q.MaxAmount != nil && transaction.Amount.Amount > *q.MaxAmount:
+		return false
+	case !q.CreatedFrom.IsZero() && transaction.CreatedAt.Before(q.CreatedFrom):
+		return false
+	case !q.CreatedTo.IsZero() && !transaction.CreatedAt.Before(q.CreatedTo):
+		return false
+	case q.Description != "" && !containsFold(transaction.Description, q.Description):
+		return false
+	case q.Tag != "" && !slices.Contains(transaction.Tags, q.Tag):
+		return false
+	case q.ExternalReference != "" && transaction.ExternalReference != q.ExternalReference:
+		return false
+	case q.CounterpartyName != "" && !containsFold(transaction.Counterparty.Name, q.CounterpartyName):
+		return false
+	case q.CategoryCode != "" && transaction.Counterparty.CategoryCode != q.CategoryCode:
+		return false
+	}
+	for key, value := range q.Metadata {
+		if got, ok := transaction.Metadata[key]; !ok || got != value {
+			return false
+		}
+	}
+	return true
+}
+
+// containsFold reports whether substr is within s ignoring the case of ASCII letters only, the way
+// SQLite's LIKE compares text, so both backends filter alike: "cafe" matches "CAFE" but "é" does
+// not match "É"
+func containsFold(s string, substr string) bool {
+	return strings.Contains(lowerASCII(s), lowerASCII(substr))
+}
+
+func lowerASCII(s string) string {
+	return strings.Map(func(r rune) rune {
+		if 'A' <= r && r <= 'Z' {
+			return r + 'a' - 'A'
+		}
+		return r
+	}, s)
+}
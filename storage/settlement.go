@@ -0,0 +1,79 @@
+package storage
+
+import (
+	"sort"
+	"time"
+)
+
+type queuedSettlement struct {
+	job          SettlementJob
+	claimedUntil time.Time
+}
+
+func (m *MemoryStorage) EnqueueSettlement(job *SettlementJob) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if _, ok := m.settlements[job.TransactionID]; ok {
+		return ErrTransactionExists
+	}
+
+	now := time.Now()
+	job.CreatedAt = now
+	job.NextAttemptAt = now
+	m.settlements[job.TransactionID] = &queuedSettlement{job: *job}
+	return nil
+}
+
+func (m *MemoryStorage) ClaimSettlements(now time.Time, lease time.Duration, limit int) ([]*SettlementJob, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	due := []*queuedSettlement{}
+	for _, queued := range m.settlements {
+		if !queued.job.NextAttemptAt.After(now) && !queued.claimedUntil.After(now) {
+			due = append(due, queued)
+		}
+	}
+	sort.Slice(due, func(i, j int) bool {
+		if !due[i].job.NextAttemptAt.Equal(due[j].job.NextAttemptAt) {
+			return due[i].job.NextAttemptAt.Before(due[j].job.NextAttemptAt)
+		}
+		return due[i].job.TransactionID < due[j].job.TransactionID
+	})
+
+	result := []*SettlementJob{}
+	for _, queued := range due[:min(limit, len(due))] {
+		queued.claimedUntil = now.Add(lease)
+		job := queued.job
+		result = append(result, &job)
+	}
+	return result, nil
+}
+
+func (m *MemoryStorage) RetrySettlement(job *SettlementJob) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	queued, ok := m.settlements[job.TransactionID]
+	if !ok {
+		return ErrNotFound
+	}
+
+	queued.job.Attempts = job.Attempts
+	queued.job.NextAttemptAt = job.NextAttemptAt
+	queued.job.LastError = job.LastError
+	queued.claimedUntil = time.Time{}
+	return nil
+}
+
+func (m *MemoryStorage) RemoveSettlement(transactionID string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if _, ok := m.settlements[transactionID]; !ok {
+		return ErrNotFound
+	}
+	delete(m.settlements, transactionID)
+	return nil
+}
@@ -0,0 +1,46 @@
+package storage
+
+import (
+	"database/sql"
+	"errors"
+
+	"modernc.org/sqlite"
+	sqlite3 "modernc.org/sqlite/lib"
+)
+
+// querier is the subset of *sql.DB and *sql.Tx used by SQLiteStorage
+type querier interface {
+	Exec(query string, args ...any) (sql.Result, error)
+	Query(query string, args ...any) (*sql.Rows, error)
+	QueryRow(query string, args ...any) *sql.Row
+}
+
+// SQLiteStorage is a Storage implementation backed by an SQLite database.
+// The schema is owned by the db package and must be migrated before use.
+type SQLiteStorage struct {
+	db *sql.DB
+	q  querier
+	// tx is set when the storage is scoped to a WithTx callback
+	tx *sql.Tx
+
+	accountLocks *accountLocks
+}
+
+func NewSQLiteStorage(db *sql.DB) *SQLiteStorage {
+	return &SQLiteStorage{
+		db:           db,
+		q:            db,
+		accountLocks: newAccountLocks(),
+	}
+}
+
+// isUniqueViolation reports whether err was caused by a UNIQUE or PRIMARY KEY constraint
+func isUniqueViolation(err error) bool {
+	var sqliteErr *sqlite.Error
+	if !errors.As(err, &sqliteErr) {
+		return false
+	}
+
+	code := sqliteErr.Code()
+	return code == sqlite3.SQLITE_CONSTRAINT_UNIQUE || code == sqlite3.SQLITE_CONSTRAINT_PRIMARYKEY
+}
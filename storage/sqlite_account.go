@@ -0,0 +1,175 @@
+package storage
+
+import (
+	"database/sql"
+	"errors"
+	"slices"
+	"strings"
+	"time"
+)
+
+// accountColumns selects an account together with the comma separated currencies of its balances
+const accountColumns = `id, number, user_id, status, created_at, updated_at,
+	(SELECT GROUP_CONCAT(currency) FROM balances WHERE balances.user_id = accounts.user_id AND balances.account_number = accounts.number)`
+
+func (s *SQLiteStorage) CreateAccount(account Account) (*Account, error) {
+	now := createdAt(account.CreatedAt).UTC()
+	account.CreatedAt = now
+	account.UpdatedAt = now
+	account.Currencies = account.currencies()
+	if account.Status == "" {
+		account.Status = AccountStatusActive
+	}
+
+	err := s.WithTx(func(tx Storage) error {
+		q := tx.(*SQLiteStorage).q
+
+		result, err := q.Exec(
+			`INSERT INTO accounts (number, user_id, status, created_at, updated_at) VALUES (?, ?, ?, ?, ?)`,
+			account.Number, account.UserID, account.Status, account.CreatedAt, account.UpdatedAt,
+		)
+		if err != nil {
+			if isUniqueViolation(err) {
+				return ErrAccountExists
+			}
+			return err
+		}
+
+		id, err := result.LastInsertId()
+		if err != nil {
+			return err
+		}
+		account.ID = int(id)
+
+		for _, currency := range account.Currencies {
+			if _, err := q.Exec(
+				`INSERT INTO balances (user_id, account_number, amount, currency) VALUES (?, ?, 0, ?)`,
+				account.UserID, account.Number, currency,
+			); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return &account, nil
+}
+
+func (s *SQLiteStorage) GetAccount(userID string, accountNumber string) (*Account, error) {
+	account, err := scanAccount(s.q.QueryRow(
+		`SELECT `+accountColumns+` FROM accounts WHERE user_id = ? AND number = ?`,
+		userID, accountNumber,
+	))
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return account, nil
+}
+
+func (s *SQLiteStorage) GetAccountByNumber(accountNumber string) (*Account, error) {
+	account, err := scanAccount(s.q.QueryRow(
+		`SELECT `+accountColumns+` FROM accounts WHERE number = ? ORDER BY id LIMIT 1`,
+		accountNumber,
+	))
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return account, nil
+}
+
+func (s *SQLiteStorage) ListAccounts() ([]*Account, error) {
+	rows, err := s.q.Query(`SELECT ` + accountColumns + ` FROM accounts ORDER BY user_id, number`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	result := []*Account{}
+	for rows.Next() {
+		account, err := scanAccount(rows)
+		if err != nil {
+			return nil, err
+		}
+		result = append(result, account)
+	}
+
+	return result, rows.Err()
+}
+
+func (s *SQLiteStorage) GetAccounts(userID string) ([]*Account, error) {
+	rows, err := s.q.Query(`SELECT `+accountColumns+` FROM accounts WHERE user_id = ? ORDER BY created_at, number`, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	result := []*Account{}
+	for rows.Next() {
+		account, err := scanAccount(rows)
+		if err != nil {
+			return nil, err
+		}
+		result = append(result, account)
+	}
+
+	return result, rows.Err()
+}
+
+func (s *SQLiteStorage) UpdateAccountStatus(userID string, accountNumber string, from string, to string) error {
+	return s.WithTx(func(tx Storage) error {
+		q := tx.(*SQLiteStorage).q
+		result, err := q.Exec(
+			`UPDATE accounts SET status = ?, updated_at = ? WHERE user_id = ? AND number = ? AND status = ?`,
+			to, time.Now().UTC(), userID, accountNumber, from,
+		)
+		if err != nil {
+			return err
+		}
+
+		affected, err := result.RowsAffected()
+		if err != nil {
+			return err
+		}
+		if affected == 0 {
+			if _, err := tx.GetAccount(userID, accountNumber); err != nil {
+				return err
+			}
+			return ErrStatusConflict
+		}
+
+		return nil
+	})
+}
+
+// scanAccount scans a row selected with accountColumns
+func scanAccount(row interface{ Scan(dest ...any) error }) (*Account, error) {
+	var account Account
+	var currencies sql.NullString
+	if err := row.Scan(&account.ID, &account.Number, &account.UserID, &account.Status, &account.CreatedAt, &account.UpdatedAt, &currencies); err != nil {
+		return nil, err
+	}
+
+	account.Currencies = []string{}
+	if currencies.String != "" {
+		account.Currencies = strings.Split(currencies.String, ",")
+		slices.Sort(account.Currencies)
+	}
+
+	return &account, nil
+}
+
+// LockAccount uses in-process locks, so it only serializes callers sharing this SQLiteStorage
+func (s *SQLiteStorage) LockAccount(userID string, accountNumber string) func() {
+	return s.accountLocks.lock(userID, accountNumber)
+}
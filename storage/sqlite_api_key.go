@@ -0,0 +1,137 @@
+package storage
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"time"
+
+	"github.com/alienxp03/teya-ledger/types"
+)
+
+const apiKeyColumns = `key_id, user_id, role, scopes, name, prefix, hash, created_at, last_used_at, revoked_at`
+
+func (s *SQLiteStorage) CreateAPIKey(key *APIKey) error {
+	if key.Role == "" {
+		key.Role = types.RoleCustomer
+	}
+
+	scopes, err := json.Marshal(key.Scopes)
+	if err != nil {
+		return err
+	}
+	if key.Scopes == nil {
+		scopes = []byte("[]")
+	}
+
+	now := time.Now().UTC()
+	_, err = s.q.Exec(
+		`INSERT INTO api_keys (key_id, user_id, role, scopes, name, prefix, hash, created_at) VALUES (?, ?, ?, ?, ?, ?, ?, ?)`,
+		key.KeyID, key.UserID, key.Role, string(scopes), key.Name, key.Prefix, key.Hash, now,
+	)
+	if isUniqueViolation(err) {
+		return ErrAPIKeyExists
+	}
+	if err != nil {
+		return err
+	}
+
+	key.CreatedAt = now
+	return nil
+}
+
+func (s *SQLiteStorage) GetAPIKey(userID string, keyID string) (*APIKey, error) {
+	return s.getAPIKey(`SELECT `+apiKeyColumns+` FROM api_keys WHERE user_id = ? AND key_id = ?`, userID, keyID)
+}
+
+func (s *SQLiteStorage) GetAPIKeyByHash(hash string) (*APIKey, error) {
+	return s.getAPIKey(`SELECT `+apiKeyColumns+` FROM api_keys WHERE hash = ?`, hash)
+}
+
+func (s *SQLiteStorage) getAPIKey(query string, args ...any) (*APIKey, error) {
+	key, err := scanAPIKey(s.q.QueryRow(query, args...))
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return key, nil
+}
+
+func (s *SQLiteStorage) ListAPIKeys(userID string) ([]*APIKey, error) {
+	rows, err := s.q.Query(`SELECT `+apiKeyColumns+` FROM api_keys WHERE user_id = ? ORDER BY created_at, key_id`, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	result := []*APIKey{}
+	for rows.Next() {
+		key, err := scanAPIKey(rows)
+		if err != nil {
+			return nil, err
+		}
+		result = append(result, key)
+	}
+
+	return result, rows.Err()
+}
+
+func (s *SQLiteStorage) RevokeAPIKey(userID string, keyID string, at time.Time) error {
+	return s.WithTx(func(tx Storage) error {
+		q := tx.(*SQLiteStorage).q
+		result, err := q.Exec(
+			`UPDATE api_keys SET revoked_at = ? WHERE user_id = ? AND key_id = ? AND revoked_at IS NULL`,
+			at.UTC(), userID, keyID,
+		)
+		if err != nil {
+			return err
+		}
+
+		affected, err := result.RowsAffected()
+		if err != nil {
+			return err
+		}
+		if affected == 0 {
+			if _, err := tx.GetAPIKey(userID, keyID); err != nil {
+				return err
+			}
+			return ErrStatusConflict
+		}
+
+		return nil
+	})
+}
+
+func (s *SQLiteStorage) TouchAPIKey(keyID string, at time.Time) error {
+	return checkAffected(s.q.Exec(`UPDATE api_keys SET last_used_at = ? WHERE key_id = ?`, at.UTC(), keyID))
+}
+
+func scanAPIKey(row scanner) (*APIKey, error) {
+	var key APIKey
+	var scopes string
+	var lastUsedAt, revokedAt sql.NullTime
+	if err := row.Scan(
+		&key.KeyID,
+		&key.UserID,
+		&key.Role,
+		&scopes,
+		&key.Name,
+		&key.Prefix,
+		&key.Hash,
+		&key.CreatedAt,
+		&lastUsedAt,
+		&revokedAt,
+	); err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal([]byte(scopes), &key.Scopes); err != nil {
+		return nil, err
+	}
+	key.LastUsedAt = lastUsedAt.Time
+	key.RevokedAt = revokedAt.Time
+
+	return &key, nil
+}
@@ -0,0 +1,64 @@
+package storage
+
+import (
+	"strings"
+	"time"
+)
+
+func (s *SQLiteStorage) RecordAuditEntry(entry *AuditEntry) error {
+	now := time.Now().UTC()
+	result, err := s.q.Exec(
+		`INSERT INTO audit_entries (operator_id, role, action, target_type, target_id, reason, details, created_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?)`,
+		entry.OperatorID, entry.Role, entry.Action, entry.TargetType, entry.TargetID, entry.Reason, entry.Details, now,
+	)
+	if err != nil {
+		return err
+	}
+
+	id, err := result.LastInsertId()
+	if err != nil {
+		return err
+	}
+	entry.ID = int(id)
+	entry.CreatedAt = now
+	return nil
+}
+
+func (s *SQLiteStorage) ListAuditEntries(query AuditQuery) ([]*AuditEntry, error) {
+	conditions, args := []string{`1 = 1`}, []any{}
+	if query.OperatorID != "" {
+		conditions = append(conditions, `operator_id = ?`)
+		args = append(args, query.OperatorID)
+	}
+	if query.TargetType != "" {
+		conditions = append(conditions, `target_type = ?`)
+		args = append(args, query.TargetType)
+	}
+	if query.TargetID != "" {
+		conditions = append(conditions, `target_id = ?`)
+		args = append(args, query.TargetID)
+	}
+	args = append(args, auditLimit(query.Limit))
+
+	rows, err := s.q.Query(
+		`SELECT id, operator_id, role, action, target_type, target_id, reason, details, created_at
+		FROM audit_entries WHERE `+strings.Join(conditions, " AND ")+` ORDER BY id DESC LIMIT ?`,
+		args...,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	result := []*AuditEntry{}
+	for rows.Next() {
+		var entry AuditEntry
+		if err := rows.Scan(&entry.ID, &entry.OperatorID, &entry.Role, &entry.Action, &entry.TargetType, &entry.TargetID, &entry.Reason, &entry.Details, &entry.CreatedAt); err != nil {
+			return nil, err
+		}
+		result = append(result, &entry)
+	}
+
+	return result, rows.Err()
+}
@@ -0,0 +1,124 @@
+package storage
+
+import (
+	"database/sql"
+	"errors"
+	"time"
+
+	"github.com/alienxp03/teya-ledger/types"
+)
+
+func (s *SQLiteStorage) GetBalance(userID string, accountNumber string, currency string) (*Balance, error) {
+	balance := Balance{
+		UserID:        userID,
+		AccountNumber: accountNumber,
+		Amount:        types.NewMoney(0, currency),
+	}
+
+	err := s.q.QueryRow(
+		`SELECT amount FROM balances WHERE user_id = ? AND account_number = ? AND currency = ?`,
+		userID, accountNumber, currency,
+	).Scan(&balance.Amount.Amount)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return &balance, nil
+}
+
+func (s *SQLiteStorage) GetBalances(userID string, accountNumber string) ([]*Balance, error) {
+	rows, err := s.q.Query(
+		`SELECT amount, currency FROM balances WHERE user_id = ? AND account_number = ? ORDER BY currency`,
+		userID, accountNumber,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	result := []*Balance{}
+	for rows.Next() {
+		balance := Balance{
+			UserID:        userID,
+			AccountNumber: accountNumber,
+		}
+		if err := rows.Scan(&balance.Amount.Amount, &balance.Amount.Currency); err != nil {
+			return nil, err
+		}
+		result = append(result, &balance)
+	}
+
+	return result, rows.Err()
+}
+
+// UpdateBalance reads the balance and writes the sum back in one unit of work, since
+// SQLite would silently turn an overflowing `amount + ?` into a floating point value
+func (s *SQLiteStorage) UpdateBalance(userID string, accountNumber string, amount types.Money) error {
+	return s.WithTx(func(tx Storage) error {
+		balance, err := tx.GetBalance(userID, accountNumber, amount.Currency)
+		if err != nil {
+			return err
+		}
+
+		updated, err := balance.Amount.Add(amount)
+		if err != nil {
+			return err
+		}
+
+		_, err = tx.(*SQLiteStorage).q.Exec(
+			`UPDATE balances SET amount = ? WHERE user_id = ? AND account_number = ? AND currency = ?`,
+			updated.Amount, userID, accountNumber, amount.Currency,
+		)
+		return err
+	})
+}
+
+func (s *SQLiteStorage) DeriveBalanceHistory(userID string, accountNumber string, currency string, instants []time.Time) ([]types.Money, error) {
+	if len(instants) == 0 {
+		return []types.Money{}, nil
+	}
+
+	rows, err := s.q.Query(
+		`SELECT t.transaction_id, t.amount, c.to_status, c.created_at FROM transaction_status_changes c
+		JOIN transactions t ON t.transaction_id = c.transaction_id
+		WHERE t.user_id = ? AND t.account_number = ? AND t.currency = ? AND c.created_at <= ?
+		ORDER BY c.created_at, c.id`,
+		userID, accountNumber, currency, instants[len(instants)-1].UTC(),
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	events := []statusEvent{}
+	for rows.Next() {
+		event := statusEvent{amount: types.NewMoney(0, currency)}
+		if err := rows.Scan(&event.transactionID, &event.amount.Amount, &event.status, &event.at); err != nil {
+			return nil, err
+		}
+		events = append(events, event)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return replayBalances(events, currency, instants)
+}
+
+// DeriveBalance fails rather than overflowing, as SQLite's SUM reports integer overflow as an error.
+// The status filter mirrors Transaction.AffectsBalance.
+func (s *SQLiteStorage) DeriveBalance(userID string, accountNumber string, currency string) (types.Money, error) {
+	result := types.NewMoney(0, currency)
+	err := s.q.QueryRow(
+		`SELECT COALESCE(SUM(amount), 0) FROM transactions WHERE user_id = ? AND account_number = ? AND currency = ?
+		AND (status IN ('completed', 'partially_reversed', 'reversed') OR (status IN ('pending', 'processing') AND amount < 0))`,
+		userID, accountNumber, currency,
+	).Scan(&result.Amount)
+	if err != nil {
+		return types.Money{}, err
+	}
+	return result, nil
+}
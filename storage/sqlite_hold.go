@@ -0,0 +1,154 @@
+package storage
+
+import (
+	"database/sql"
+	"errors"
+	"time"
+
+	"github.com/alienxp03/teya-ledger/types"
+)
+
+const holdColumns = `id, hold_id, user_id, account_number, amount, currency, captured_amount, status, description, expires_at, created_at, updated_at`
+
+func (s *SQLiteStorage) CreateHold(hold *Hold) error {
+	now := time.Now().UTC()
+	result, err := s.q.Exec(
+		`INSERT INTO holds (hold_id, user_id, account_number, amount, currency, status, description, expires_at, created_at, updated_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+		hold.HoldID, hold.UserID, hold.AccountNumber, hold.Amount.Amount, hold.Amount.Currency,
+		hold.Status, hold.Description, hold.ExpiresAt.UTC(), now, now,
+	)
+	if err != nil {
+		if isUniqueViolation(err) {
+			return ErrHoldExists
+		}
+		return err
+	}
+
+	id, err := result.LastInsertId()
+	if err != nil {
+		return err
+	}
+	hold.ID = int(id)
+	hold.Captured = types.NewMoney(0, hold.Amount.Currency)
+	hold.CreatedAt = now
+	hold.UpdatedAt = now
+	return nil
+}
+
+func (s *SQLiteStorage) GetHold(userID string, holdID string) (*Hold, error) {
+	hold, err := scanHold(s.q.QueryRow(
+		`SELECT `+holdColumns+` FROM holds WHERE user_id = ? AND hold_id = ?`,
+		userID, holdID,
+	))
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return hold, nil
+}
+
+func (s *SQLiteStorage) CloseHold(hold *Hold) error {
+	hold.UpdatedAt = time.Now().UTC()
+
+	return s.WithTx(func(tx Storage) error {
+		q := tx.(*SQLiteStorage).q
+		result, err := q.Exec(
+			`UPDATE holds SET status = ?, captured_amount = ?, updated_at = ? WHERE hold_id = ? AND status = ?`,
+			hold.Status, hold.Captured.Amount, hold.UpdatedAt, hold.HoldID, HoldStatusActive,
+		)
+		if err != nil {
+			return err
+		}
+
+		affected, err := result.RowsAffected()
+		if err != nil {
+			return err
+		}
+		if affected == 0 {
+			var exists bool
+			if err := q.QueryRow(`SELECT EXISTS (SELECT 1 FROM holds WHERE hold_id = ?)`, hold.HoldID).Scan(&exists); err != nil {
+				return err
+			}
+			if !exists {
+				return ErrNotFound
+			}
+			return ErrStatusConflict
+		}
+
+		return nil
+	})
+}
+
+func (s *SQLiteStorage) GetHeldAmount(userID string, accountNumber string, currency string, now time.Time) (types.Money, error) {
+	rows, err := s.q.Query(
+		`SELECT amount FROM holds WHERE user_id = ? AND account_number = ? AND currency = ? AND status = ? AND expires_at > ?`,
+		userID, accountNumber, currency, HoldStatusActive, now.UTC(),
+	)
+	if err != nil {
+		return types.Money{}, err
+	}
+	defer rows.Close()
+
+	// Summed in Go rather than SQL so an overflow is reported instead of turning into a float
+	result := types.NewMoney(0, currency)
+	for rows.Next() {
+		amount := types.NewMoney(0, currency)
+		if err := rows.Scan(&amount.Amount); err != nil {
+			return types.Money{}, err
+		}
+		if result, err = result.Add(amount); err != nil {
+			return types.Money{}, err
+		}
+	}
+
+	return result, rows.Err()
+}
+
+func (s *SQLiteStorage) ListExpiredHolds(now time.Time, limit int) ([]*Hold, error) {
+	rows, err := s.q.Query(
+		`SELECT `+holdColumns+` FROM holds WHERE status = ? AND expires_at <= ? ORDER BY expires_at, id LIMIT ?`,
+		HoldStatusActive, now.UTC(), limit,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	result := []*Hold{}
+	for rows.Next() {
+		hold, err := scanHold(rows)
+		if err != nil {
+			return nil, err
+		}
+		result = append(result, hold)
+	}
+
+	return result, rows.Err()
+}
+
+func scanHold(row scanner) (*Hold, error) {
+	var hold Hold
+	if err := row.Scan(
+		&hold.ID,
+		&hold.HoldID,
+		&hold.UserID,
+		&hold.AccountNumber,
+		&hold.Amount.Amount,
+		&hold.Amount.Currency,
+		&hold.Captured.Amount,
+		&hold.Status,
+		&hold.Description,
+		&hold.ExpiresAt,
+		&hold.CreatedAt,
+		&hold.UpdatedAt,
+	); err != nil {
+		return nil, err
+	}
+	hold.Captured.Currency = hold.Amount.Currency
+
+	return &hold, nil
+}
@@ -0,0 +1,82 @@
+package storage
+
+import (
+	"database/sql"
+	"errors"
+	"time"
+)
+
+func (s *SQLiteStorage) CreateIdempotencyKey(key *IdempotencyKey) error {
+	now := time.Now().UTC()
+
+	return s.WithTx(func(tx Storage) error {
+		q := tx.(*SQLiteStorage).q
+		if _, err := q.Exec(
+			`DELETE FROM idempotency_keys WHERE user_id = ? AND idempotency_key = ? AND expires_at <= ?`,
+			key.UserID, key.Key, now,
+		); err != nil {
+			return err
+		}
+
+		_, err := q.Exec(
+			`INSERT INTO idempotency_keys (user_id, idempotency_key, fingerprint, created_at, expires_at) VALUES (?, ?, ?, ?, ?)`,
+			key.UserID, key.Key, key.Fingerprint, now, key.ExpiresAt.UTC(),
+		)
+		if isUniqueViolation(err) {
+			return ErrIdempotencyKeyExists
+		}
+		if err != nil {
+			return err
+		}
+
+		key.CreatedAt = now
+		return nil
+	})
+}
+
+func (s *SQLiteStorage) GetIdempotencyKey(userID string, key string) (*IdempotencyKey, error) {
+	var result IdempotencyKey
+	err := s.q.QueryRow(
+		`SELECT user_id, idempotency_key, fingerprint, status_code, content_type, body, created_at, expires_at
+		FROM idempotency_keys WHERE user_id = ? AND idempotency_key = ?`,
+		userID, key,
+	).Scan(&result.UserID, &result.Key, &result.Fingerprint, &result.StatusCode, &result.ContentType, &result.Body, &result.CreatedAt, &result.ExpiresAt)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return &result, nil
+}
+
+func (s *SQLiteStorage) CompleteIdempotencyKey(key *IdempotencyKey) error {
+	// A nil slice would be stored as NULL
+	body := key.Body
+	if body == nil {
+		body = []byte{}
+	}
+
+	return checkAffected(s.q.Exec(
+		`UPDATE idempotency_keys SET status_code = ?, content_type = ?, body = ? WHERE user_id = ? AND idempotency_key = ?`,
+		key.StatusCode, key.ContentType, body, key.UserID, key.Key,
+	))
+}
+
+func (s *SQLiteStorage) DeleteIdempotencyKey(userID string, key string) error {
+	return checkAffected(s.q.Exec(
+		`DELETE FROM idempotency_keys WHERE user_id = ? AND idempotency_key = ?`,
+		userID, key,
+	))
+}
+
+func (s *SQLiteStorage) DeleteExpiredIdempotencyKeys(now time.Time) (int, error) {
+	result, err := s.q.Exec(`DELETE FROM idempotency_keys WHERE expires_at <= ?`, now.UTC())
+	if err != nil {
+		return 0, err
+	}
+
+	deleted, err := result.RowsAffected()
+	return int(deleted), err
+}
@@ -0,0 +1,99 @@
+package storage
+
+func (s *SQLiteStorage) PostJournalEntry(entry *JournalEntry) error {
+	if err := entry.validate(); err != nil {
+		return err
+	}
+
+	return s.WithTx(func(tx Storage) error {
+		q := tx.(*SQLiteStorage).q
+
+		created := createdAt(entry.CreatedAt).UTC()
+		result, err := q.Exec(
+			`INSERT INTO journal_entries (reference, description, created_at) VALUES (?, ?, ?)`,
+			entry.Reference, entry.Description, created,
+		)
+		if err != nil {
+			return err
+		}
+		id, err := result.LastInsertId()
+		if err != nil {
+			return err
+		}
+
+		for _, posting := range entry.Postings {
+			if _, err := q.Exec(
+				`INSERT INTO postings (entry_id, ledger_account, amount, currency) VALUES (?, ?, ?, ?)`,
+				id, posting.LedgerAccount, posting.Amount.Amount, posting.Amount.Currency,
+			); err != nil {
+				return err
+			}
+		}
+
+		entry.ID = int(id)
+		entry.CreatedAt = created
+		return nil
+	})
+}
+
+func (s *SQLiteStorage) GetJournalEntries(reference string) ([]*JournalEntry, error) {
+	rows, err := s.q.Query(
+		`SELECT e.id, e.reference, e.description, e.created_at, p.ledger_account, p.amount, p.currency
+		FROM journal_entries e JOIN postings p ON p.entry_id = e.id
+		WHERE e.reference = ?
+		ORDER BY e.id, p.id`,
+		reference,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	result := []*JournalEntry{}
+	for rows.Next() {
+		var entry JournalEntry
+		var posting Posting
+		if err := rows.Scan(&entry.ID, &entry.Reference, &entry.Description, &entry.CreatedAt, &posting.LedgerAccount, &posting.Amount.Amount, &posting.Amount.Currency); err != nil {
+			return nil, err
+		}
+
+		if len(result) == 0 || result[len(result)-1].ID != entry.ID {
+			result = append(result, &entry)
+		}
+		last := result[len(result)-1]
+		last.Postings = append(last.Postings, posting)
+	}
+
+	return result, rows.Err()
+}
+
+func (s *SQLiteStorage) GetTrialBalance() ([]*TrialBalanceLine, error) {
+	rows, err := s.q.Query(
+		`SELECT ledger_account, currency,
+			SUM(CASE WHEN amount > 0 THEN amount ELSE 0 END),
+			SUM(CASE WHEN amount < 0 THEN -amount ELSE 0 END)
+		FROM postings
+		GROUP BY ledger_account, currency
+		ORDER BY ledger_account, currency`,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	result := []*TrialBalanceLine{}
+	for rows.Next() {
+		var line TrialBalanceLine
+		if err := rows.Scan(&line.LedgerAccount, &line.Debits.Currency, &line.Debits.Amount, &line.Credits.Amount); err != nil {
+			return nil, err
+		}
+		line.Credits.Currency = line.Debits.Currency
+
+		if line.Balance, err = line.Debits.Sub(line.Credits); err != nil {
+			return nil, err
+		}
+		result = append(result, &line)
+	}
+
+	return result, rows.Err()
+}
@@ -0,0 +1,95 @@
+package storage
+
+import (
+	"database/sql"
+	"time"
+)
+
+func (s *SQLiteStorage) EnqueueSettlement(job *SettlementJob) error {
+	now := time.Now().UTC()
+	if _, err := s.q.Exec(
+		`INSERT INTO settlements (transaction_id, user_id, attempts, next_attempt_at, last_error, created_at) VALUES (?, ?, ?, ?, ?, ?)`,
+		job.TransactionID, job.UserID, job.Attempts, now, job.LastError, now,
+	); err != nil {
+		if isUniqueViolation(err) {
+			return ErrTransactionExists
+		}
+		return err
+	}
+
+	job.NextAttemptAt = now
+	job.CreatedAt = now
+	return nil
+}
+
+func (s *SQLiteStorage) ClaimSettlements(now time.Time, lease time.Duration, limit int) ([]*SettlementJob, error) {
+	now = now.UTC()
+	result := []*SettlementJob{}
+
+	err := s.WithTx(func(tx Storage) error {
+		q := tx.(*SQLiteStorage).q
+		rows, err := q.Query(
+			`SELECT transaction_id, user_id, attempts, next_attempt_at, last_error, created_at FROM settlements
+			WHERE next_attempt_at <= ? AND (claimed_until IS NULL OR claimed_until <= ?)
+			ORDER BY next_attempt_at, transaction_id
+			LIMIT ?`,
+			now, now, limit,
+		)
+		if err != nil {
+			return err
+		}
+		defer rows.Close()
+
+		for rows.Next() {
+			var job SettlementJob
+			if err := rows.Scan(&job.TransactionID, &job.UserID, &job.Attempts, &job.NextAttemptAt, &job.LastError, &job.CreatedAt); err != nil {
+				return err
+			}
+			result = append(result, &job)
+		}
+		if err := rows.Err(); err != nil {
+			return err
+		}
+
+		for _, job := range result {
+			if _, err := q.Exec(`UPDATE settlements SET claimed_until = ? WHERE transaction_id = ?`, now.Add(lease), job.TransactionID); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return result, nil
+}
+
+func (s *SQLiteStorage) RetrySettlement(job *SettlementJob) error {
+	result, err := s.q.Exec(
+		`UPDATE settlements SET attempts = ?, next_attempt_at = ?, last_error = ?, claimed_until = NULL WHERE transaction_id = ?`,
+		job.Attempts, job.NextAttemptAt.UTC(), job.LastError, job.TransactionID,
+	)
+	return checkAffected(result, err)
+}
+
+func (s *SQLiteStorage) RemoveSettlement(transactionID string) error {
+	result, err := s.q.Exec(`DELETE FROM settlements WHERE transaction_id = ?`, transactionID)
+	return checkAffected(result, err)
+}
+
+// checkAffected turns a statement that matched no rows into ErrNotFound
+func checkAffected(result sql.Result, err error) error {
+	if err != nil {
+		return err
+	}
+
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if affected == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
@@ -0,0 +1,420 @@
+package storage
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+)
+
+const transactionColumns = `id, transaction_id, type, status, status_reason, amount, currency, user_id, description, account_number, transfer_id, conversion_id, rate, spread, hold_id, reversal_of,
+	metadata, tags, counterparty_name, counterparty_reference, counterparty_category_code, external_reference, created_at, updated_at`
+
+func (s *SQLiteStorage) CreateDeposit(transaction *Transaction) (*Transaction, error) {
+	if err := s.CreateTransaction(transaction); err != nil {
+		return nil, err
+	}
+
+	return transaction, nil
+}
+
+func (s *SQLiteStorage) CreateWithdrawal(transaction *Transaction) (*Transaction, error) {
+	if err := s.CreateTransaction(transaction); err != nil {
+		return nil, err
+	}
+
+	return transaction, nil
+}
+
+// CreateTransaction creates a new transaction together with the first entry of its status history
+func (s *SQLiteStorage) CreateTransaction(transaction *Transaction) error {
+	now := createdAt(transaction.CreatedAt).UTC()
+	transaction.CreatedAt = now
+	transaction.UpdatedAt = now
+
+	metadata, tags, err := encodeDetails(transaction.Details)
+	if err != nil {
+		return err
+	}
+
+	return s.WithTx(func(tx Storage) error {
+		q := tx.(*SQLiteStorage).q
+		result, err := q.Exec(
+			`INSERT INTO transactions (transaction_id, type, status, status_reason, amount, currency, user_id, description, account_number, transfer_id, conversion_id, rate, spread, hold_id, reversal_of,
+				metadata, tags, counterparty_name, counterparty_reference, counterparty_category_code, external_reference, created_at, updated_at)
+			VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+			transaction.TransactionID, transaction.Type, transaction.Status, transaction.StatusReason, transaction.Amount.Amount, transaction.Amount.Currency, transaction.UserID,
+			transaction.Description, transaction.AccountNumber, transaction.TransferID,
+			transaction.ConversionID, transaction.Rate, transaction.Spread, transaction.HoldID, transaction.ReversalOf,
+			metadata, tags, transaction.Counterparty.Name, transaction.Counterparty.Reference, transaction.Counterparty.CategoryCode, transaction.ExternalReference,
+			transaction.CreatedAt, transaction.UpdatedAt,
+		)
+		if err != nil {
+			if isUniqueViolation(err) {
+				return ErrTransactionExists
+			}
+			return err
+		}
+
+		id, err := result.LastInsertId()
+		if err != nil {
+			return err
+		}
+		transaction.ID = int(id)
+
+		return insertStatusChange(q, &StatusChange{
+			TransactionID: transaction.TransactionID,
+			To:            transaction.Status,
+			Reason:        transaction.StatusReason,
+			CreatedAt:     now,
+		})
+	})
+}
+
+func (s *SQLiteStorage) GetTransactions(query TransactionQuery) (*TransactionPage, error) {
+	return s.queryTransactions(query, []string{`user_id = ?`, `account_number = ?`}, []any{query.UserID, query.AccountNumber})
+}
+
+func (s *SQLiteStorage) SearchTransactions(query TransactionQuery) (*TransactionPage, error) {
+	conditions, args := []string{`1 = 1`}, []any{}
+	if query.UserID != "" {
+		conditions = append(conditions, `user_id = ?`)
+		args = append(args, query.UserID)
+	}
+	if query.AccountNumber != "" {
+		conditions = append(conditions, `account_number = ?`)
+		args = append(args, query.AccountNumber)
+	}
+	return s.queryTransactions(query, conditions, args)
+}
+
+// queryTransactions pages through the transactions matching conditions and the filters of query
+func (s *SQLiteStorage) queryTransactions(query TransactionQuery, conditions []string, args []any) (*TransactionPage, error) {
+	query = query.normalize()
+	if err := query.validate(); err != nil {
+		return nil, err
+	}
+
+	if query.Status != "" {
+		conditions = append(conditions, `status = ?`)
+		args = append(args, query.Status)
+	}
+	if query.Type != "" {
+		conditions = append(conditions, `type = ?`)
+		args = append(args, query.Type)
+	}
+	if query.MinAmount != nil {
+		conditions = append(conditions, `amount >= ?`)
+		args = append(args, *query.MinAmount)
+	}
+	if query.MaxAmount != nil {
+		conditions = append(conditions, `amount <= ?`)
+		args = append(args, *query.MaxAmount)
+	}
+	if !query.CreatedFrom.IsZero() {
+		conditions = append(conditions, `created_at >= ?`)
+		args = append(args, query.CreatedFrom.UTC())
+	}
+	if !query.CreatedTo.IsZero() {
+		conditions = append(conditions, `created_at < ?`)
+		args = append(args, query.CreatedTo.UTC())
+	}
+	if query.Description != "" {
+		conditions = append(conditions, `description LIKE ? ESCAPE '\'`)
+		args = append(args, "%"+escapeLike(query.Description)+"%")
+	}
+	if query.Tag != "" {
+		conditions = append(conditions, `EXISTS (SELECT 1 FROM json_each(tags) WHERE value = ?)`)
+		args = append(args, query.Tag)
+	}
+	for key, value := range query.Metadata {
+		conditions = append(conditions, `EXISTS (SELECT 1 FROM json_each(metadata) WHERE key = ? AND value = ?)`)
+		args = append(args, key, value)
+	}
+	if query.ExternalReference != "" {
+		conditions = append(conditions, `external_reference = ?`)
+		args = append(args, query.ExternalReference)
+	}
+	if query.CounterpartyName != "" {
+		conditions = append(conditions, `counterparty_name LIKE ? ESCAPE '\'`)
+		args = append(args, "%"+escapeLike(query.CounterpartyName)+"%")
+	}
+	if query.CategoryCode != "" {
+		conditions = append(conditions, `counterparty_category_code = ?`)
+		args = append(args, query.CategoryCode)
+	}
+
+	column, direction, comparison := "created_at", "DESC", "<"
+	if query.SortBy == SortByAmount {
+		column = "amount"
+	}
+	if query.SortOrder == SortAscending {
+		direction, comparison = "ASC", ">"
+	}
+
+	offset := (query.Page - 1) * query.Limit
+	if query.Cursor != "" {
+		c, err := decodeCursor(query)
+		if err != nil {
+			return nil, err
+		}
+		conditions = append(conditions, `(`+column+`, id) `+comparison+` (?, ?)`)
+		if query.SortBy == SortByAmount {
+			args = append(args, c.value, c.id)
+		} else {
+			args = append(args, time.Unix(0, c.value).UTC(), c.id)
+		}
+		offset = 0
+	}
+
+	// Fetch one extra row to find out whether there is a next page
+	args = append(args, query.Limit+1, offset)
+	rows, err := s.q.Query(
+		`SELECT `+transactionColumns+` FROM transactions WHERE `+strings.Join(conditions, " AND ")+
+			` ORDER BY `+column+` `+direction+`, id `+direction+` LIMIT ? OFFSET ?`,
+		args...,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	page := &TransactionPage{Transactions: []*Transaction{}}
+	for rows.Next() {
+		transaction, err := scanTransaction(rows)
+		if err != nil {
+			return nil, err
+		}
+		page.Transactions = append(page.Transactions, transaction)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	if len(page.Transactions) > query.Limit {
+		page.Transactions = page.Transactions[:query.Limit]
+		page.HasMore = true
+		page.NextCursor = cursorOf(query, page.Transactions[query.Limit-1]).encode()
+	}
+
+	return page, nil
+}
+
+func (s *SQLiteStorage) FindTransaction(transactionID string) (*Transaction, error) {
+	transaction, err := scanTransaction(s.q.QueryRow(
+		`SELECT `+transactionColumns+` FROM transactions WHERE transaction_id = ?`,
+		transactionID,
+	))
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return transaction, nil
+}
+
+func (s *SQLiteStorage) GetTransaction(userID, transactionID string) (*Transaction, error) {
+	row := s.q.QueryRow(
+		`SELECT `+transactionColumns+` FROM transactions WHERE user_id = ? AND transaction_id = ?`,
+		userID, transactionID,
+	)
+
+	transaction, err := scanTransaction(row)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return transaction, nil
+}
+
+func (s *SQLiteStorage) UpdateTransactionStatus(change *StatusChange) error {
+	change.CreatedAt = time.Now().UTC()
+
+	return s.WithTx(func(tx Storage) error {
+		q := tx.(*SQLiteStorage).q
+		result, err := q.Exec(
+			`UPDATE transactions SET status = ?, status_reason = ?, updated_at = ? WHERE transaction_id = ? AND status = ?`,
+			change.To, change.Reason, change.CreatedAt, change.TransactionID, change.From,
+		)
+		if err != nil {
+			return err
+		}
+
+		affected, err := result.RowsAffected()
+		if err != nil {
+			return err
+		}
+		if affected == 0 {
+			var exists bool
+			if err := q.QueryRow(`SELECT EXISTS (SELECT 1 FROM transactions WHERE transaction_id = ?)`, change.TransactionID).Scan(&exists); err != nil {
+				return err
+			}
+			if !exists {
+				return ErrNotFound
+			}
+			return ErrStatusConflict
+		}
+
+		return insertStatusChange(q, change)
+	})
+}
+
+func (s *SQLiteStorage) GetStatusChanges(transactionID string) ([]*StatusChange, error) {
+	var exists bool
+	if err := s.q.QueryRow(`SELECT EXISTS (SELECT 1 FROM transactions WHERE transaction_id = ?)`, transactionID).Scan(&exists); err != nil {
+		return nil, err
+	}
+	if !exists {
+		return nil, ErrNotFound
+	}
+
+	rows, err := s.q.Query(
+		`SELECT transaction_id, from_status, to_status, reason, created_at FROM transaction_status_changes
+		WHERE transaction_id = ? ORDER BY id`,
+		transactionID,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	result := []*StatusChange{}
+	for rows.Next() {
+		var change StatusChange
+		if err := rows.Scan(&change.TransactionID, &change.From, &change.To, &change.Reason, &change.CreatedAt); err != nil {
+			return nil, err
+		}
+		result = append(result, &change)
+	}
+
+	return result, rows.Err()
+}
+
+func (s *SQLiteStorage) GetReversals(userID, transactionID string) ([]*Transaction, error) {
+	var exists bool
+	if err := s.q.QueryRow(`SELECT EXISTS (SELECT 1 FROM transactions WHERE user_id = ? AND transaction_id = ?)`, userID, transactionID).Scan(&exists); err != nil {
+		return nil, err
+	}
+	if !exists {
+		return nil, ErrNotFound
+	}
+
+	rows, err := s.q.Query(
+		`SELECT `+transactionColumns+` FROM transactions WHERE user_id = ? AND reversal_of = ? ORDER BY id`,
+		userID, transactionID,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	result := []*Transaction{}
+	for rows.Next() {
+		transaction, err := scanTransaction(rows)
+		if err != nil {
+			return nil, err
+		}
+		result = append(result, transaction)
+	}
+
+	return result, rows.Err()
+}
+
+func insertStatusChange(q querier, change *StatusChange) error {
+	_, err := q.Exec(
+		`INSERT INTO transaction_status_changes (transaction_id, from_status, to_status, reason, created_at) VALUES (?, ?, ?, ?, ?)`,
+		change.TransactionID, change.From, change.To, change.Reason, change.CreatedAt,
+	)
+	return err
+}
+
+// scanner is implemented by both *sql.Row and *sql.Rows
+type scanner interface {
+	Scan(dest ...any) error
+}
+
+func scanTransaction(row scanner) (*Transaction, error) {
+	var transaction Transaction
+	var metadata, tags string
+	if err := row.Scan(
+		&transaction.ID,
+		&transaction.TransactionID,
+		&transaction.Type,
+		&transaction.Status,
+		&transaction.StatusReason,
+		&transaction.Amount.Amount,
+		&transaction.Amount.Currency,
+		&transaction.UserID,
+		&transaction.Description,
+		&transaction.AccountNumber,
+		&transaction.TransferID,
+		&transaction.ConversionID,
+		&transaction.Rate,
+		&transaction.Spread,
+		&transaction.HoldID,
+		&transaction.ReversalOf,
+		&metadata,
+		&tags,
+		&transaction.Counterparty.Name,
+		&transaction.Counterparty.Reference,
+		&transaction.Counterparty.CategoryCode,
+		&transaction.ExternalReference,
+		&transaction.CreatedAt,
+		&transaction.UpdatedAt,
+	); err != nil {
+		return nil, err
+	}
+
+	if err := decodeDetails(&transaction.Details, metadata, tags); err != nil {
+		return nil, err
+	}
+	return &transaction, nil
+}
+
+// encodeDetails turns the metadata and tags of details into the JSON stored in their columns
+func encodeDetails(details Details) (string, string, error) {
+	if details.Metadata == nil {
+		details.Metadata = map[string]string{}
+	}
+	if details.Tags == nil {
+		details.Tags = []string{}
+	}
+	metadata, err := json.Marshal(details.Metadata)
+	if err != nil {
+		return "", "", err
+	}
+	tags, err := json.Marshal(details.Tags)
+	if err != nil {
+		return "", "", err
+	}
+	return string(metadata), string(tags), nil
+}
+
+// decodeDetails reads the JSON metadata and tags columns into details, leaving them nil when empty
+func decodeDetails(details *Details, metadata, tags string) error {
+	if err := json.Unmarshal([]byte(metadata), &details.Metadata); err != nil {
+		return fmt.Errorf("could not decode metadata: %w", err)
+	}
+	if err := json.Unmarshal([]byte(tags), &details.Tags); err != nil {
+		return fmt.Errorf("could not decode tags: %w", err)
+	}
+	if len(details.Metadata) == 0 {
+		details.Metadata = nil
+	}
+	if len(details.Tags) == 0 {
+		details.Tags = nil
+	}
+	return nil
+}
+
+// escapeLike escapes the LIKE wildcards in value so it is matched literally
+func escapeLike(value string) string {
+	return strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`).Replace(value)
+}
@@ -0,0 +1,30 @@
+package storage
+
+import "database/sql"
+
+func (s *SQLiteStorage) WithTx(fn func(tx Storage) error) error {
+	if s.tx != nil {
+		return fn(s)
+	}
+
+	sqlTx, err := s.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer sqlTx.Rollback()
+
+	if err := fn(s.withQuerier(sqlTx)); err != nil {
+		return err
+	}
+
+	return sqlTx.Commit()
+}
+
+func (s *SQLiteStorage) withQuerier(tx *sql.Tx) *SQLiteStorage {
+	return &SQLiteStorage{
+		db:           s.db,
+		q:            tx,
+		tx:           tx,
+		accountLocks: s.accountLocks,
+	}
+}
@@ -1,31 +1,205 @@
 package storage
 
+import (
+	"sync"
+	"time"
+
+	"github.com/alienxp03/teya-ledger/types"
+)
+
 type Storage interface {
+	// CreateAccount creates the account together with a zero balance in each of its currencies.
+	// Like CreateTransaction and PostJournalEntry, it keeps a CreatedAt that is already set.
 	CreateAccount(account Account) (*Account, error)
 	GetAccount(userID string, accountNumber string) (*Account, error)
+	// GetAccountByNumber finds an account regardless of its owner, e.g. the destination of a transfer
+	GetAccountByNumber(accountNumber string) (*Account, error)
+	// ListAccounts returns every account ordered by user and account number
+	ListAccounts() ([]*Account, error)
+	// GetAccounts returns the accounts of a user ordered by when they were opened
+	GetAccounts(userID string) ([]*Account, error)
+	// UpdateAccountStatus moves an account from status from to status to. It fails with
+	// ErrStatusConflict when the account is no longer in from.
+	UpdateAccountStatus(userID string, accountNumber string, from string, to string) error
+
+	// LockAccount serializes read-modify-write sequences on a single account,
+	// e.g. a withdrawal's balance check and its balance update.
+	// The returned function releases the lock.
+	LockAccount(userID string, accountNumber string) (unlock func())
 
 	CreateTransaction(transaction *Transaction) error
-	GetTransactions(userID, accountNumber string, limit, page int) ([]*Transaction, error)
+	GetTransactions(query TransactionQuery) (*TransactionPage, error)
 	GetTransaction(userID, transactionID string) (*Transaction, error)
-	UpdateTransaction(transactionID string, status string) error
+	// SearchTransactions is GetTransactions across every account. UserID and AccountNumber
+	// are filters like the others, matching every user and account when empty.
+	SearchTransactions(query TransactionQuery) (*TransactionPage, error)
+	// FindTransaction finds a transaction regardless of its owner, e.g. for operators
+	FindTransaction(transactionID string) (*Transaction, error)
+	// UpdateTransactionStatus moves a transaction from change.From to change.To, storing
+	// change.Reason as its status reason, and records the change in its status history.
+	// It fails with ErrStatusConflict when the transaction is no longer in change.From.
+	UpdateTransactionStatus(change *StatusChange) error
+	// GetStatusChanges returns the status history of a transaction, oldest first
+	GetStatusChanges(transactionID string) ([]*StatusChange, error)
+	// GetReversals returns the transactions reversing a transaction of the user, oldest first.
+	// It fails with ErrNotFound when the user has no such transaction.
+	GetReversals(userID, transactionID string) ([]*Transaction, error)
 
 	CreateDeposit(transaction *Transaction) (*Transaction, error)
 	CreateWithdrawal(transaction *Transaction) (*Transaction, error)
 
-	GetBalance(userID string, accountNumber string) (*Balance, error)
-	UpdateBalance(userID string, accountNumber string, amount int64) error
+	// GetBalance and UpdateBalance return ErrNotFound when the account does not hold the currency
+	GetBalance(userID string, accountNumber string, currency string) (*Balance, error)
+	// GetBalances returns the balances of an account in every currency it holds, ordered by currency
+	GetBalances(userID string, accountNumber string) ([]*Balance, error)
+	// UpdateBalance adds amount to the balance in amount's currency. It fails with
+	// types.ErrAmountOverflow instead of wrapping around.
+	UpdateBalance(userID string, accountNumber string, amount types.Money) error
+	// DeriveBalance recomputes the balance of an account in currency from its transaction history,
+	// counting the transactions that affect the balance in their current status.
+	// It matches GetBalance whenever every balance change was made together with its transaction.
+	DeriveBalance(userID string, accountNumber string, currency string) (types.Money, error)
+	// DeriveBalanceHistory recomputes the balance of an account in currency as of each of instants,
+	// which must be in ascending order, counting each transaction in the status it had at that instant.
+	// Transactions created before status history was recorded count in their status at the time of migration.
+	DeriveBalanceHistory(userID string, accountNumber string, currency string, instants []time.Time) ([]types.Money, error)
+
+	// PostJournalEntry records a journal entry. Entries with fewer than two postings
+	// or whose postings do not sum to zero per currency are rejected with ErrUnbalancedEntry.
+	PostJournalEntry(entry *JournalEntry) error
+	// GetJournalEntries returns the entries recorded for a reference in posting order
+	GetJournalEntries(reference string) ([]*JournalEntry, error)
+	// GetTrialBalance totals every ledger account per currency, ordered by ledger account and currency
+	GetTrialBalance() ([]*TrialBalanceLine, error)
+
+	// CreateHold places a new active hold. It fails with ErrHoldExists when HoldID is taken.
+	CreateHold(hold *Hold) error
+	GetHold(userID string, holdID string) (*Hold, error)
+	// CloseHold moves an active hold to hold.Status, recording hold.Captured. It fails with
+	// ErrStatusConflict when the hold is no longer active.
+	CloseHold(hold *Hold) error
+	// GetHeldAmount totals the holds reserving funds of an account in currency at now
+	GetHeldAmount(userID string, accountNumber string, currency string, now time.Time) (types.Money, error)
+	// ListExpiredHolds returns up to limit holds still active after expiring by now, oldest expiry first
+	ListExpiredHolds(now time.Time, limit int) ([]*Hold, error)
+
+	// EnqueueSettlement adds a transaction to the settlement queue, due straight away.
+	// It fails with ErrTransactionExists when the transaction is already queued.
+	EnqueueSettlement(job *SettlementJob) error
+	// ClaimSettlements hands out up to limit jobs due at now, oldest due first. A claimed
+	// job is hidden from further claims until now+lease, so a job claimed by a process
+	// that stopped is handed out again once its lease expires.
+	ClaimSettlements(now time.Time, lease time.Duration, limit int) ([]*SettlementJob, error)
+	// RetrySettlement records a failed attempt of a claimed job, making it due again at job.NextAttemptAt
+	RetrySettlement(job *SettlementJob) error
+	// RemoveSettlement takes a settled or failed transaction off the queue
+	RemoveSettlement(transactionID string) error
+
+	// CreateIdempotencyKey records the first request made with a key, replacing the key
+	// when it has expired. It fails with ErrIdempotencyKeyExists when the user made a
+	// request with the key before and it has not expired.
+	CreateIdempotencyKey(key *IdempotencyKey) error
+	GetIdempotencyKey(userID string, key string) (*IdempotencyKey, error)
+	// CompleteIdempotencyKey stores the response to the request made with a key
+	CompleteIdempotencyKey(key *IdempotencyKey) error
+	// DeleteIdempotencyKey forgets a key, e.g. so a request that failed can be retried
+	DeleteIdempotencyKey(userID string, key string) error
+	// DeleteExpiredIdempotencyKeys forgets the keys expired by now and returns how many it deleted
+	DeleteExpiredIdempotencyKeys(now time.Time) (int, error)
+
+	// CreateAPIKey stores a new key. It fails with ErrAPIKeyExists when KeyID or Hash is taken.
+	CreateAPIKey(key *APIKey) error
+	GetAPIKey(userID string, keyID string) (*APIKey, error)
+	// GetAPIKeyByHash finds the key, revoked or not, whose secret hashes to hash
+	GetAPIKeyByHash(hash string) (*APIKey, error)
+	// ListAPIKeys returns the keys of a user, revoked ones included, oldest first
+	ListAPIKeys(userID string) ([]*APIKey, error)
+	// RevokeAPIKey revokes a key of the user at at. It fails with ErrStatusConflict
+	// when the key was already revoked.
+	RevokeAPIKey(userID string, keyID string, at time.Time) error
+	// TouchAPIKey records that a key authenticated a request at at
+	TouchAPIKey(keyID string, at time.Time) error
+
+	// RecordAuditEntry appends an entry to the audit log
+	RecordAuditEntry(entry *AuditEntry) error
+	// ListAuditEntries returns the audit entries matching query, newest first
+	ListAuditEntries(query AuditQuery) ([]*AuditEntry, error)
+
+	// WithTx runs fn as a single unit of work: every change made through tx is
+	// committed when fn returns nil and rolled back when it returns an error.
+	// Calling WithTx on tx joins the running unit of work.
+	// Account locks must be acquired before calling WithTx, never inside fn.
+	WithTx(fn func(tx Storage) error) error
 }
 
+// MemoryStorage is safe for concurrent use. mu guards the indexes below and is only
+// held for the duration of a single method call; values handed out are copies so
+// callers never observe a record while it is being modified.
 type MemoryStorage struct {
-	accounts     []*Account
-	transactions []*Transaction
-	balances     []*Balance
+	mu       sync.RWMutex
+	accounts map[accountKey]*Account
+	// accountsByNumber holds the first account created with each number
+	accountsByNumber map[string]*Account
+	// balances holds the balance of each account per currency
+	balances map[accountKey]map[string]*Balance
+	// transactions indexes every transaction by its TransactionID
+	transactions map[string]*Transaction
+	// accountTransactions holds the transactions of each account in creation order
+	accountTransactions map[accountKey][]*Transaction
+
+	lastTransactionID int
+	// statusChanges holds the status history of each transaction by TransactionID
+	statusChanges map[string][]*StatusChange
+
+	// journalEntries indexes journal entries by reference, trialBalance keeps running totals per ledger account
+	journalEntries     map[string][]*JournalEntry
+	trialBalance       map[ledgerKey]*TrialBalanceLine
+	lastJournalEntryID int
+
+	// holds by HoldID
+	holds      map[string]*Hold
+	lastHoldID int
+
+	// settlements is the settlement queue by TransactionID
+	settlements map[string]*queuedSettlement
+
+	idempotencyKeys map[idempotencyRef]*IdempotencyKey
+
+	// apiKeys by KeyID, apiKeysByHash indexes the same keys by Hash
+	apiKeys       map[string]*APIKey
+	apiKeysByHash map[string]*APIKey
+
+	// auditEntries in the order they were recorded
+	auditEntries     []*AuditEntry
+	lastAuditEntryID int
+
+	accountLocks *accountLocks
 }
 
 func NewMemoryStorage() *MemoryStorage {
 	return &MemoryStorage{
-		accounts:     []*Account{},
-		transactions: []*Transaction{},
-		balances:     []*Balance{},
+		accounts:            map[accountKey]*Account{},
+		accountsByNumber:    map[string]*Account{},
+		balances:            map[accountKey]map[string]*Balance{},
+		transactions:        map[string]*Transaction{},
+		accountTransactions: map[accountKey][]*Transaction{},
+		statusChanges:       map[string][]*StatusChange{},
+		journalEntries:      map[string][]*JournalEntry{},
+		trialBalance:        map[ledgerKey]*TrialBalanceLine{},
+		holds:               map[string]*Hold{},
+		settlements:         map[string]*queuedSettlement{},
+		idempotencyKeys:     map[idempotencyRef]*IdempotencyKey{},
+		apiKeys:             map[string]*APIKey{},
+		apiKeysByHash:       map[string]*APIKey{},
+		accountLocks:        newAccountLocks(),
+	}
+}
+
+// createdAt is the creation time of a new record: the one it was given, so seeded records keep
+// their original time, or now
+func createdAt(given time.Time) time.Time {
+	if given.IsZero() {
+		return time.Now()
 	}
+	return given
 }
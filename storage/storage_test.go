@@ -0,0 +1,976 @@
+package storage_test
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/alienxp03/teya-ledger/db"
+	"github.com/alienxp03/teya-ledger/storage"
+	"github.com/alienxp03/teya-ledger/types"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// backends returns a freshly initialized instance of every storage implementation
+func backends(t *testing.T) map[string]storage.Storage {
+	t.Helper()
+
+	memoryDB := db.NewMemoryStorage()
+	require.NoError(t, memoryDB.Initialize())
+
+	sqliteDB := db.NewSQLiteStorage(filepath.Join(t.TempDir(), "ledger.db"))
+	require.NoError(t, sqliteDB.Initialize())
+	t.Cleanup(func() { sqliteDB.Close() })
+
+	return map[string]storage.Storage{
+		"memory": memoryDB.GetStorage(),
+		"sqlite": sqliteDB.GetStorage(),
+	}
+}
+
+func TestAccounts(t *testing.T) {
+	for name, s := range backends(t) {
+		t.Run(name, func(t *testing.T) {
+			account, err := s.CreateAccount(storage.Account{Number: "ACCOUNT_NUMBER_1", UserID: "USER_ID_1"})
+			require.NoError(t, err)
+			assert.False(t, account.CreatedAt.IsZero())
+
+			_, err = s.CreateAccount(storage.Account{Number: "ACCOUNT_NUMBER_1", UserID: "USER_ID_1"})
+			assert.ErrorIs(t, err, storage.ErrAccountExists)
+
+			_, err = s.CreateAccount(storage.Account{Number: "ACCOUNT_NUMBER_1", UserID: "USER_ID_2"})
+			assert.NoError(t, err)
+
+			got, err := s.GetAccount("USER_ID_1", "ACCOUNT_NUMBER_1")
+			require.NoError(t, err)
+			assert.Equal(t, "USER_ID_1", got.UserID)
+			assert.Equal(t, storage.AccountStatusActive, got.Status)
+
+			require.NoError(t, s.UpdateAccountStatus("USER_ID_1", "ACCOUNT_NUMBER_1", storage.AccountStatusActive, storage.AccountStatusFrozen))
+			assert.ErrorIs(t, s.UpdateAccountStatus("USER_ID_1", "ACCOUNT_NUMBER_1", storage.AccountStatusActive, storage.AccountStatusFrozen), storage.ErrStatusConflict)
+			assert.ErrorIs(t, s.UpdateAccountStatus("USER_ID_3", "ACCOUNT_NUMBER_1", storage.AccountStatusActive, storage.AccountStatusFrozen), storage.ErrNotFound)
+			got, err = s.GetAccount("USER_ID_1", "ACCOUNT_NUMBER_1")
+			require.NoError(t, err)
+			assert.Equal(t, storage.AccountStatusFrozen, got.Status)
+
+			// a status change is rolled back with its unit of work
+			err = s.WithTx(func(tx storage.Storage) error {
+				require.NoError(t, tx.UpdateAccountStatus("USER_ID_1", "ACCOUNT_NUMBER_1", storage.AccountStatusFrozen, storage.AccountStatusActive))
+				return errors.New("rollback")
+			})
+			require.Error(t, err)
+			got, err = s.GetAccount("USER_ID_1", "ACCOUNT_NUMBER_1")
+			require.NoError(t, err)
+			assert.Equal(t, storage.AccountStatusFrozen, got.Status)
+
+			_, err = s.GetAccount("USER_ID_3", "ACCOUNT_NUMBER_1")
+			assert.ErrorIs(t, err, storage.ErrNotFound)
+
+			got, err = s.GetAccountByNumber("ACCOUNT_NUMBER_1")
+			require.NoError(t, err)
+			assert.Equal(t, "ACCOUNT_NUMBER_1", got.Number)
+
+			_, err = s.GetAccountByNumber("ACCOUNT_NUMBER_3")
+			assert.ErrorIs(t, err, storage.ErrNotFound)
+
+			accounts, err := s.ListAccounts()
+			require.NoError(t, err)
+			require.Len(t, accounts, 2)
+			assert.Equal(t, "USER_ID_1", accounts[0].UserID)
+			assert.Equal(t, "USER_ID_2", accounts[1].UserID)
+
+			accounts, err = s.GetAccounts("USER_ID_2")
+			require.NoError(t, err)
+			require.Len(t, accounts, 1)
+			assert.Equal(t, "ACCOUNT_NUMBER_1", accounts[0].Number)
+			accounts, err = s.GetAccounts("USER_ID_3")
+			require.NoError(t, err)
+			assert.Empty(t, accounts)
+		})
+	}
+}
+
+func TestTransactions(t *testing.T) {
+	for name, s := range backends(t) {
+		t.Run(name, func(t *testing.T) {
+			deposit, err := s.CreateDeposit(&storage.Transaction{
+				TransactionID: "TRANSACTION_ID_1",
+				UserID:        "USER_ID_1",
+				AccountNumber: "ACCOUNT_NUMBER_1",
+				Status:        "pending",
+				Amount:        types.NewMoney(100, "MYR"),
+				Description:   "deposit",
+			})
+			require.NoError(t, err)
+			assert.NotZero(t, deposit.ID)
+
+			_, err = s.CreateWithdrawal(&storage.Transaction{
+				TransactionID: "TRANSACTION_ID_1",
+				UserID:        "USER_ID_1",
+				AccountNumber: "ACCOUNT_NUMBER_1",
+				Status:        "pending",
+				Amount:        types.NewMoney(-100, "MYR"),
+				Description:   "withdrawal",
+			})
+			assert.ErrorIs(t, err, storage.ErrTransactionExists)
+
+			require.NoError(t, s.UpdateTransactionStatus(&storage.StatusChange{TransactionID: "TRANSACTION_ID_1", From: "pending", To: "failed", Reason: "declined"}))
+			assert.ErrorIs(t, s.UpdateTransactionStatus(&storage.StatusChange{TransactionID: "TRANSACTION_ID_1", From: "pending", To: "completed"}), storage.ErrStatusConflict)
+			assert.ErrorIs(t, s.UpdateTransactionStatus(&storage.StatusChange{TransactionID: "TRANSACTION_ID_2", From: "pending", To: "completed"}), storage.ErrNotFound)
+
+			got, err := s.GetTransaction("USER_ID_1", "TRANSACTION_ID_1")
+			require.NoError(t, err)
+			assert.Equal(t, "failed", got.Status)
+			assert.Equal(t, "declined", got.StatusReason)
+			assert.Equal(t, types.NewMoney(100, "MYR"), got.Amount)
+			assert.Equal(t, "deposit", got.Description)
+
+			changes, err := s.GetStatusChanges("TRANSACTION_ID_1")
+			require.NoError(t, err)
+			require.Len(t, changes, 2)
+			assert.Equal(t, "", changes[0].From)
+			assert.Equal(t, "pending", changes[0].To)
+			assert.Equal(t, "pending", changes[1].From)
+			assert.Equal(t, "failed", changes[1].To)
+			assert.Equal(t, "declined", changes[1].Reason)
+			assert.False(t, changes[1].CreatedAt.Before(changes[0].CreatedAt))
+
+			_, err = s.GetStatusChanges("TRANSACTION_ID_2")
+			assert.ErrorIs(t, err, storage.ErrNotFound)
+
+			_, err = s.GetTransaction("USER_ID_2", "TRANSACTION_ID_1")
+			assert.ErrorIs(t, err, storage.ErrNotFound)
+
+			page, err := s.GetTransactions(storage.TransactionQuery{UserID: "USER_ID_1", AccountNumber: "ACCOUNT_NUMBER_1"})
+			require.NoError(t, err)
+			assert.Len(t, page.Transactions, 1)
+			assert.False(t, page.HasMore)
+
+			page, err = s.GetTransactions(storage.TransactionQuery{UserID: "USER_ID_1", AccountNumber: "ACCOUNT_NUMBER_2"})
+			require.NoError(t, err)
+			assert.Empty(t, page.Transactions)
+
+			require.NoError(t, s.CreateTransaction(&storage.Transaction{TransactionID: "TRANSACTION_ID_2", UserID: "USER_ID_2", AccountNumber: "ACCOUNT_NUMBER_2", Status: "pending", Amount: types.NewMoney(200, "MYR")}))
+
+			found, err := s.FindTransaction("TRANSACTION_ID_2")
+			require.NoError(t, err)
+			assert.Equal(t, "USER_ID_2", found.UserID)
+			_, err = s.FindTransaction("TRANSACTION_ID_3")
+			assert.ErrorIs(t, err, storage.ErrNotFound)
+
+			// searches span every user unless narrowed down
+			page, err = s.SearchTransactions(storage.TransactionQuery{})
+			require.NoError(t, err)
+			require.Len(t, page.Transactions, 2)
+			page, err = s.SearchTransactions(storage.TransactionQuery{UserID: "USER_ID_2", Status: "pending"})
+			require.NoError(t, err)
+			require.Len(t, page.Transactions, 1)
+			assert.Equal(t, "TRANSACTION_ID_2", page.Transactions[0].TransactionID)
+			page, err = s.SearchTransactions(storage.TransactionQuery{AccountNumber: "ACCOUNT_NUMBER_1"})
+			require.NoError(t, err)
+			require.Len(t, page.Transactions, 1)
+			assert.Equal(t, "TRANSACTION_ID_1", page.Transactions[0].TransactionID)
+		})
+	}
+}
+
+func TestReversals(t *testing.T) {
+	for name, s := range backends(t) {
+		t.Run(name, func(t *testing.T) {
+			require.NoError(t, s.CreateTransaction(&storage.Transaction{TransactionID: "TRANSACTION_ID_1", UserID: "USER_ID_1", AccountNumber: "ACCOUNT_NUMBER_1", Type: storage.TransactionTypeDeposit, Status: "completed", Amount: types.NewMoney(500, "MYR")}))
+			require.NoError(t, s.CreateTransaction(&storage.Transaction{TransactionID: "TRANSACTION_ID_2", UserID: "USER_ID_1", AccountNumber: "ACCOUNT_NUMBER_1", Type: storage.TransactionTypeDeposit, Status: "completed", Amount: types.NewMoney(100, "MYR")}))
+
+			reversals, err := s.GetReversals("USER_ID_1", "TRANSACTION_ID_1")
+			require.NoError(t, err)
+			assert.Empty(t, reversals)
+
+			for i, amount := range []int64{-200, -100} {
+				require.NoError(t, s.CreateTransaction(&storage.Transaction{
+					TransactionID: fmt.Sprintf("REVERSAL_ID_%d", i+1),
+					UserID:        "USER_ID_1",
+					AccountNumber: "ACCOUNT_NUMBER_1",
+					Type:          storage.TransactionTypeReversal,
+					Status:        "completed",
+					Amount:        types.NewMoney(amount, "MYR"),
+					ReversalOf:    "TRANSACTION_ID_1",
+				}))
+			}
+
+			reversals, err = s.GetReversals("USER_ID_1", "TRANSACTION_ID_1")
+			require.NoError(t, err)
+			require.Len(t, reversals, 2)
+			assert.Equal(t, "REVERSAL_ID_1", reversals[0].TransactionID)
+			assert.Equal(t, "TRANSACTION_ID_1", reversals[0].ReversalOf)
+			assert.Equal(t, types.NewMoney(-200, "MYR"), reversals[0].Amount)
+			assert.Equal(t, "REVERSAL_ID_2", reversals[1].TransactionID)
+
+			got, err := s.GetTransaction("USER_ID_1", "REVERSAL_ID_2")
+			require.NoError(t, err)
+			assert.Equal(t, "TRANSACTION_ID_1", got.ReversalOf)
+
+			reversals, err = s.GetReversals("USER_ID_1", "TRANSACTION_ID_2")
+			require.NoError(t, err)
+			assert.Empty(t, reversals)
+
+			_, err = s.GetReversals("USER_ID_2", "TRANSACTION_ID_1")
+			assert.ErrorIs(t, err, storage.ErrNotFound)
+		})
+	}
+}
+
+func TestBalances(t *testing.T) {
+	for name, s := range backends(t) {
+		t.Run(name, func(t *testing.T) {
+			_, err := s.GetBalance("USER_ID_1", "ACCOUNT_NUMBER_1", "MYR")
+			assert.ErrorIs(t, err, storage.ErrNotFound)
+			assert.ErrorIs(t, s.UpdateBalance("USER_ID_1", "ACCOUNT_NUMBER_1", types.NewMoney(100, "MYR")), storage.ErrNotFound)
+
+			_, err = s.CreateAccount(storage.Account{Number: "ACCOUNT_NUMBER_1", UserID: "USER_ID_1"})
+			require.NoError(t, err)
+
+			balance, err := s.GetBalance("USER_ID_1", "ACCOUNT_NUMBER_1", "MYR")
+			require.NoError(t, err)
+			assert.Equal(t, types.NewMoney(0, "MYR"), balance.Amount)
+
+			require.NoError(t, s.UpdateBalance("USER_ID_1", "ACCOUNT_NUMBER_1", types.NewMoney(150, "MYR")))
+			require.NoError(t, s.UpdateBalance("USER_ID_1", "ACCOUNT_NUMBER_1", types.NewMoney(-50, "MYR")))
+
+			balance, err = s.GetBalance("USER_ID_1", "ACCOUNT_NUMBER_1", "MYR")
+			require.NoError(t, err)
+			assert.Equal(t, types.NewMoney(100, "MYR"), balance.Amount)
+
+			err = s.UpdateBalance("USER_ID_1", "ACCOUNT_NUMBER_1", types.NewMoney(math.MaxInt64, "MYR"))
+			assert.ErrorIs(t, err, types.ErrAmountOverflow)
+			balance, err = s.GetBalance("USER_ID_1", "ACCOUNT_NUMBER_1", "MYR")
+			require.NoError(t, err)
+			assert.Equal(t, types.NewMoney(100, "MYR"), balance.Amount)
+
+			_, err = s.GetBalance("USER_ID_1", "ACCOUNT_NUMBER_1", "USD")
+			assert.ErrorIs(t, err, storage.ErrNotFound)
+			assert.ErrorIs(t, s.UpdateBalance("USER_ID_1", "ACCOUNT_NUMBER_1", types.NewMoney(100, "USD")), storage.ErrNotFound)
+		})
+	}
+}
+
+func TestMultiCurrencyBalances(t *testing.T) {
+	for name, s := range backends(t) {
+		t.Run(name, func(t *testing.T) {
+			account, err := s.CreateAccount(storage.Account{Number: "ACCOUNT_NUMBER_1", UserID: "USER_ID_1", Currencies: []string{"USD", "MYR", "USD"}})
+			require.NoError(t, err)
+			assert.Equal(t, []string{"MYR", "USD"}, account.Currencies)
+
+			got, err := s.GetAccount("USER_ID_1", "ACCOUNT_NUMBER_1")
+			require.NoError(t, err)
+			assert.Equal(t, []string{"MYR", "USD"}, got.Currencies)
+			assert.True(t, got.HoldsCurrency("USD"))
+			assert.False(t, got.HoldsCurrency("SGD"))
+
+			require.NoError(t, s.UpdateBalance("USER_ID_1", "ACCOUNT_NUMBER_1", types.NewMoney(250, "USD")))
+			require.NoError(t, s.UpdateBalance("USER_ID_1", "ACCOUNT_NUMBER_1", types.NewMoney(100, "MYR")))
+
+			balances, err := s.GetBalances("USER_ID_1", "ACCOUNT_NUMBER_1")
+			require.NoError(t, err)
+			require.Len(t, balances, 2)
+			assert.Equal(t, types.NewMoney(100, "MYR"), balances[0].Amount)
+			assert.Equal(t, types.NewMoney(250, "USD"), balances[1].Amount)
+
+			balances, err = s.GetBalances("USER_ID_1", "ACCOUNT_NUMBER_2")
+			require.NoError(t, err)
+			assert.Empty(t, balances)
+		})
+	}
+}
+
+func TestDeriveBalance(t *testing.T) {
+	for name, s := range backends(t) {
+		t.Run(name, func(t *testing.T) {
+			amount, err := s.DeriveBalance("USER_ID_1", "ACCOUNT_NUMBER_1", "MYR")
+			require.NoError(t, err)
+			assert.Equal(t, types.NewMoney(0, "MYR"), amount)
+
+			for i, amount := range []int64{100, -30, 250} {
+				require.NoError(t, s.CreateTransaction(&storage.Transaction{TransactionID: fmt.Sprintf("TRANSACTION_ID_%d", i), UserID: "USER_ID_1", AccountNumber: "ACCOUNT_NUMBER_1", Status: "completed", Amount: types.NewMoney(amount, "MYR")}))
+			}
+			require.NoError(t, s.CreateTransaction(&storage.Transaction{TransactionID: "TRANSACTION_ID_OTHER", UserID: "USER_ID_2", AccountNumber: "ACCOUNT_NUMBER_1", Status: "completed", Amount: types.NewMoney(999, "MYR")}))
+			require.NoError(t, s.CreateTransaction(&storage.Transaction{TransactionID: "TRANSACTION_ID_USD", UserID: "USER_ID_1", AccountNumber: "ACCOUNT_NUMBER_1", Status: "completed", Amount: types.NewMoney(500, "USD")}))
+
+			amount, err = s.DeriveBalance("USER_ID_1", "ACCOUNT_NUMBER_1", "MYR")
+			require.NoError(t, err)
+			assert.Equal(t, types.NewMoney(320, "MYR"), amount)
+
+			// pending debits hold their funds, pending credits and settled failures do not count,
+			// reversed transactions keep counting next to their reversals
+			for status, amount := range map[string]int64{"pending": -20, "processing": 70, "failed": -40, "cancelled": 80, "reversed": -50, "partially_reversed": 30} {
+				require.NoError(t, s.CreateTransaction(&storage.Transaction{TransactionID: "TRANSACTION_ID_" + status, UserID: "USER_ID_1", AccountNumber: "ACCOUNT_NUMBER_1", Status: status, Amount: types.NewMoney(amount, "MYR")}))
+			}
+
+			amount, err = s.DeriveBalance("USER_ID_1", "ACCOUNT_NUMBER_1", "MYR")
+			require.NoError(t, err)
+			assert.Equal(t, types.NewMoney(280, "MYR"), amount)
+		})
+	}
+}
+
+func TestDeriveBalanceHistory(t *testing.T) {
+	for name, s := range backends(t) {
+		t.Run(name, func(t *testing.T) {
+			// mark returns an instant strictly between the changes made before and after it
+			mark := func() time.Time {
+				time.Sleep(time.Millisecond)
+				defer time.Sleep(time.Millisecond)
+				return time.Now()
+			}
+			create := func(id string, amount int64) {
+				require.NoError(t, s.CreateTransaction(&storage.Transaction{TransactionID: id, UserID: "USER_ID_1", AccountNumber: "ACCOUNT_NUMBER_1", Status: storage.TransactionStatusPending, Amount: types.NewMoney(amount, "MYR")}))
+			}
+			move := func(id string, from, to string) {
+				require.NoError(t, s.UpdateTransactionStatus(&storage.StatusChange{TransactionID: id, From: from, To: to}))
+			}
+
+			before := mark()
+			create("DEPOSIT_1", 100)
+			pending := mark()
+			move("DEPOSIT_1", storage.TransactionStatusPending, storage.TransactionStatusCompleted)
+			create("WITHDRAWAL_1", -30)
+			require.NoError(t, s.CreateTransaction(&storage.Transaction{TransactionID: "DEPOSIT_USD", UserID: "USER_ID_1", AccountNumber: "ACCOUNT_NUMBER_1", Status: storage.TransactionStatusCompleted, Amount: types.NewMoney(500, "USD")}))
+			completed := mark()
+			move("WITHDRAWAL_1", storage.TransactionStatusPending, storage.TransactionStatusFailed)
+			failed := mark()
+
+			// pending credits do not count yet, pending debits already do and stop counting once failed
+			history, err := s.DeriveBalanceHistory("USER_ID_1", "ACCOUNT_NUMBER_1", "MYR", []time.Time{before, pending, completed, failed})
+			require.NoError(t, err)
+			assert.Equal(t, []types.Money{types.NewMoney(0, "MYR"), types.NewMoney(0, "MYR"), types.NewMoney(70, "MYR"), types.NewMoney(100, "MYR")}, history)
+
+			current, err := s.DeriveBalance("USER_ID_1", "ACCOUNT_NUMBER_1", "MYR")
+			require.NoError(t, err)
+			assert.Equal(t, current, history[len(history)-1])
+
+			history, err = s.DeriveBalanceHistory("USER_ID_1", "ACCOUNT_NUMBER_1", "USD", []time.Time{pending, failed})
+			require.NoError(t, err)
+			assert.Equal(t, []types.Money{types.NewMoney(0, "USD"), types.NewMoney(500, "USD")}, history)
+
+			history, err = s.DeriveBalanceHistory("USER_ID_1", "ACCOUNT_NUMBER_1", "MYR", nil)
+			require.NoError(t, err)
+			assert.Empty(t, history)
+		})
+	}
+}
+
+func TestWithTx(t *testing.T) {
+	for name, s := range backends(t) {
+		t.Run(name, func(t *testing.T) {
+			_, err := s.CreateAccount(storage.Account{Number: "ACCOUNT_NUMBER_1", UserID: "USER_ID_1"})
+			require.NoError(t, err)
+
+			err = s.WithTx(func(tx storage.Storage) error {
+				if err := tx.CreateTransaction(&storage.Transaction{TransactionID: "TRANSACTION_ID_1", UserID: "USER_ID_1", AccountNumber: "ACCOUNT_NUMBER_1", Status: "pending", Amount: types.NewMoney(100, "MYR")}); err != nil {
+					return err
+				}
+				return tx.UpdateBalance("USER_ID_1", "ACCOUNT_NUMBER_1", types.NewMoney(100, "MYR"))
+			})
+			require.NoError(t, err)
+
+			rollbackErr := errors.New("rollback")
+			err = s.WithTx(func(tx storage.Storage) error {
+				if _, err := tx.CreateAccount(storage.Account{Number: "ACCOUNT_NUMBER_2", UserID: "USER_ID_1"}); err != nil {
+					return err
+				}
+				if err := tx.CreateTransaction(&storage.Transaction{TransactionID: "TRANSACTION_ID_2", UserID: "USER_ID_1", AccountNumber: "ACCOUNT_NUMBER_1", Status: "pending", Amount: types.NewMoney(-40, "MYR")}); err != nil {
+					return err
+				}
+				if err := tx.UpdateBalance("USER_ID_1", "ACCOUNT_NUMBER_1", types.NewMoney(-40, "MYR")); err != nil {
+					return err
+				}
+				// nested units of work join the outer one
+				if err := tx.WithTx(func(tx storage.Storage) error {
+					return tx.UpdateTransactionStatus(&storage.StatusChange{TransactionID: "TRANSACTION_ID_1", From: "pending", To: "processing"})
+				}); err != nil {
+					return err
+				}
+				return rollbackErr
+			})
+			assert.ErrorIs(t, err, rollbackErr)
+
+			_, err = s.GetAccount("USER_ID_1", "ACCOUNT_NUMBER_2")
+			assert.ErrorIs(t, err, storage.ErrNotFound)
+
+			_, err = s.GetBalance("USER_ID_1", "ACCOUNT_NUMBER_2", "MYR")
+			assert.ErrorIs(t, err, storage.ErrNotFound)
+
+			_, err = s.GetTransaction("USER_ID_1", "TRANSACTION_ID_2")
+			assert.ErrorIs(t, err, storage.ErrNotFound)
+
+			transaction, err := s.GetTransaction("USER_ID_1", "TRANSACTION_ID_1")
+			require.NoError(t, err)
+			assert.Equal(t, "pending", transaction.Status)
+
+			changes, err := s.GetStatusChanges("TRANSACTION_ID_1")
+			require.NoError(t, err)
+			assert.Len(t, changes, 1)
+
+			balance, err := s.GetBalance("USER_ID_1", "ACCOUNT_NUMBER_1", "MYR")
+			require.NoError(t, err)
+			assert.Equal(t, types.NewMoney(100, "MYR"), balance.Amount)
+		})
+	}
+}
+
+func TestJournal(t *testing.T) {
+	customer := storage.CustomerLedgerAccount("USER_ID_1", "ACCOUNT_NUMBER_1")
+
+	for name, s := range backends(t) {
+		t.Run(name, func(t *testing.T) {
+			entry := &storage.JournalEntry{
+				Reference:   "TRANSACTION_ID_1",
+				Description: "deposit",
+				Postings: []storage.Posting{
+					{LedgerAccount: storage.LedgerAccountCashInTransit, Amount: types.NewMoney(100, "MYR")},
+					{LedgerAccount: customer, Amount: types.NewMoney(-100, "MYR")},
+				},
+			}
+			require.NoError(t, s.PostJournalEntry(entry))
+			assert.NotZero(t, entry.ID)
+
+			err := s.PostJournalEntry(&storage.JournalEntry{
+				Reference: "TRANSACTION_ID_2",
+				Postings: []storage.Posting{
+					{LedgerAccount: storage.LedgerAccountCashInTransit, Amount: types.NewMoney(100, "MYR")},
+					{LedgerAccount: customer, Amount: types.NewMoney(-90, "MYR")},
+				},
+			})
+			assert.ErrorIs(t, err, storage.ErrUnbalancedEntry)
+
+			err = s.PostJournalEntry(&storage.JournalEntry{
+				Reference: "TRANSACTION_ID_2",
+				Postings: []storage.Posting{
+					{LedgerAccount: storage.LedgerAccountCashInTransit, Amount: types.NewMoney(100, "MYR")},
+					{LedgerAccount: customer, Amount: types.NewMoney(-100, "USD")},
+				},
+			})
+			assert.ErrorIs(t, err, storage.ErrUnbalancedEntry)
+
+			err = s.PostJournalEntry(&storage.JournalEntry{
+				Reference: "TRANSACTION_ID_2",
+				Postings:  []storage.Posting{{LedgerAccount: customer, Amount: types.NewMoney(0, "MYR")}},
+			})
+			assert.ErrorIs(t, err, storage.ErrUnbalancedEntry)
+
+			rollbackErr := errors.New("rollback")
+			err = s.WithTx(func(tx storage.Storage) error {
+				if err := tx.PostJournalEntry(&storage.JournalEntry{
+					Reference: "TRANSACTION_ID_3",
+					Postings: []storage.Posting{
+						{LedgerAccount: customer, Amount: types.NewMoney(40, "MYR")},
+						{LedgerAccount: storage.LedgerAccountCashInTransit, Amount: types.NewMoney(-40, "MYR")},
+					},
+				}); err != nil {
+					return err
+				}
+				return rollbackErr
+			})
+			assert.ErrorIs(t, err, rollbackErr)
+
+			entries, err := s.GetJournalEntries("TRANSACTION_ID_1")
+			require.NoError(t, err)
+			require.Len(t, entries, 1)
+			assert.Equal(t, entry.Postings, entries[0].Postings)
+
+			entries, err = s.GetJournalEntries("TRANSACTION_ID_3")
+			require.NoError(t, err)
+			assert.Empty(t, entries)
+
+			trialBalance, err := s.GetTrialBalance()
+			require.NoError(t, err)
+			assert.Equal(t, []*storage.TrialBalanceLine{
+				{LedgerAccount: customer, Debits: types.NewMoney(0, "MYR"), Credits: types.NewMoney(100, "MYR"), Balance: types.NewMoney(-100, "MYR")},
+				{LedgerAccount: storage.LedgerAccountCashInTransit, Debits: types.NewMoney(100, "MYR"), Credits: types.NewMoney(0, "MYR"), Balance: types.NewMoney(100, "MYR")},
+			}, trialBalance)
+		})
+	}
+}
+
+func TestTransactionsPagination(t *testing.T) {
+	for name, s := range backends(t) {
+		t.Run(name, func(t *testing.T) {
+			for i := range 25 {
+				require.NoError(t, s.CreateTransaction(&storage.Transaction{
+					TransactionID: fmt.Sprintf("TRANSACTION_ID_%02d", i),
+					UserID:        "USER_ID_1",
+					AccountNumber: "ACCOUNT_NUMBER_1",
+					Status:        "completed",
+					Amount:        types.NewMoney(int64(i), "MYR"),
+				}))
+			}
+
+			ids := func(page *storage.TransactionPage) []string {
+				result := []string{}
+				for _, transaction := range page.Transactions {
+					result = append(result, transaction.TransactionID)
+				}
+				return result
+			}
+
+			// offset pagination, newest first
+			page, err := s.GetTransactions(storage.TransactionQuery{UserID: "USER_ID_1", AccountNumber: "ACCOUNT_NUMBER_1", Limit: 10, Page: 2})
+			require.NoError(t, err)
+			assert.Equal(t, "TRANSACTION_ID_14", page.Transactions[0].TransactionID)
+			assert.Equal(t, "TRANSACTION_ID_05", page.Transactions[9].TransactionID)
+			assert.True(t, page.HasMore)
+
+			page, err = s.GetTransactions(storage.TransactionQuery{UserID: "USER_ID_1", AccountNumber: "ACCOUNT_NUMBER_1", Limit: 10, Page: 3})
+			require.NoError(t, err)
+			assert.Len(t, page.Transactions, 5)
+			assert.False(t, page.HasMore)
+			assert.Empty(t, page.NextCursor)
+
+			page, err = s.GetTransactions(storage.TransactionQuery{UserID: "USER_ID_1", AccountNumber: "ACCOUNT_NUMBER_1", Limit: 10, Page: 4})
+			require.NoError(t, err)
+			assert.Empty(t, page.Transactions)
+
+			// walking the cursors visits every transaction exactly once
+			seen := []string{}
+			query := storage.TransactionQuery{UserID: "USER_ID_1", AccountNumber: "ACCOUNT_NUMBER_1", Limit: 7}
+			for {
+				page, err := s.GetTransactions(query)
+				require.NoError(t, err)
+				seen = append(seen, ids(page)...)
+				if !page.HasMore {
+					break
+				}
+				query.Cursor = page.NextCursor
+			}
+			require.Len(t, seen, 25)
+			assert.Equal(t, "TRANSACTION_ID_24", seen[0])
+			assert.Equal(t, "TRANSACTION_ID_00", seen[24])
+
+			_, err = s.GetTransactions(storage.TransactionQuery{UserID: "USER_ID_1", AccountNumber: "ACCOUNT_NUMBER_1", Cursor: "not a cursor"})
+			assert.ErrorIs(t, err, storage.ErrInvalidCursor)
+		})
+	}
+}
+
+func TestTransactionsFilterAndSort(t *testing.T) {
+	amounts := []int64{300, -50, 100, -200, 100, 50}
+	for name, s := range backends(t) {
+		t.Run(name, func(t *testing.T) {
+			for i, amount := range amounts {
+				transactionType, status, description := storage.TransactionTypeDeposit, "completed", "Salary"
+				if amount < 0 {
+					transactionType, status, description = storage.TransactionTypeWithdrawal, "pending", "Coffee 50% off"
+				}
+				require.NoError(t, s.CreateTransaction(&storage.Transaction{
+					TransactionID: fmt.Sprintf("TRANSACTION_ID_%d", i),
+					Type:          transactionType,
+					UserID:        "USER_ID_1",
+					AccountNumber: "ACCOUNT_NUMBER_1",
+					Status:        status,
+					Amount:        types.NewMoney(amount, "MYR"),
+					Description:   description,
+				}))
+			}
+
+			amountsOf := func(query storage.TransactionQuery) []int64 {
+				query.UserID, query.AccountNumber = "USER_ID_1", "ACCOUNT_NUMBER_1"
+				result := []int64{}
+				for {
+					page, err := s.GetTransactions(query)
+					require.NoError(t, err)
+					for _, transaction := range page.Transactions {
+						result = append(result, transaction.Amount.Amount)
+					}
+					if !page.HasMore {
+						return result
+					}
+					query.Cursor = page.NextCursor
+				}
+			}
+			minAmount, maxAmount := int64(0), int64(100)
+
+			assert.Equal(t, []int64{50, 100, -200, 100, -50, 300}, amountsOf(storage.TransactionQuery{Limit: 4}))
+			assert.Equal(t, []int64{300, -50, 100, -200, 100, 50}, amountsOf(storage.TransactionQuery{SortOrder: storage.SortAscending, Limit: 4}))
+			assert.Equal(t, []int64{300, 100, 100, 50, -50, -200}, amountsOf(storage.TransactionQuery{SortBy: storage.SortByAmount, Limit: 2}))
+			assert.Equal(t, []int64{-200, -50, 50, 100, 100, 300}, amountsOf(storage.TransactionQuery{SortBy: storage.SortByAmount, SortOrder: storage.SortAscending, Limit: 2}))
+			assert.Equal(t, []int64{50, 100, 100, 300}, amountsOf(storage.TransactionQuery{Type: storage.TransactionTypeDeposit, Status: "completed", Limit: 2}))
+			assert.Equal(t, []int64{50, 100, 100}, amountsOf(storage.TransactionQuery{SortBy: storage.SortByAmount, SortOrder: storage.SortAscending, MinAmount: &minAmount, MaxAmount: &maxAmount}))
+			assert.Equal(t, []int64{-200, -50}, amountsOf(storage.TransactionQuery{Description: "50%", SortBy: storage.SortByAmount, SortOrder: storage.SortAscending}))
+			assert.Equal(t, []int64{50, 100, -200, 100, -50, 300}, amountsOf(storage.TransactionQuery{CreatedFrom: time.Now().Add(-time.Hour), CreatedTo: time.Now().Add(time.Hour)}))
+			assert.Empty(t, amountsOf(storage.TransactionQuery{CreatedFrom: time.Now().Add(time.Hour)}))
+
+			page, err := s.GetTransactions(storage.TransactionQuery{UserID: "USER_ID_1", AccountNumber: "ACCOUNT_NUMBER_1", Limit: 1})
+			require.NoError(t, err)
+			_, err = s.GetTransactions(storage.TransactionQuery{UserID: "USER_ID_1", AccountNumber: "ACCOUNT_NUMBER_1", SortBy: storage.SortByAmount, Cursor: page.NextCursor})
+			assert.ErrorIs(t, err, storage.ErrInvalidCursor)
+
+			_, err = s.GetTransactions(storage.TransactionQuery{UserID: "USER_ID_1", AccountNumber: "ACCOUNT_NUMBER_1", SortBy: "description"})
+			assert.ErrorIs(t, err, storage.ErrInvalidQuery)
+		})
+	}
+}
+
+func TestTransactionDetails(t *testing.T) {
+	for name, s := range backends(t) {
+		t.Run(name, func(t *testing.T) {
+			details := []storage.Details{
+				{
+					Metadata:          map[string]string{"orderID": "ORDER_1", "channel": "web"},
+					Tags:              []string{"groceries", "card"},
+					Counterparty:      storage.Counterparty{Name: "Corner Shop", Reference: "MERCHANT_1", CategoryCode: "5411"},
+					ExternalReference: "EXTERNAL_1",
+				},
+				{
+					Metadata:     map[string]string{"orderID": "ORDER_2", "channel": "web"},
+					Tags:         []string{"travel"},
+					Counterparty: storage.Counterparty{Name: "Airline", CategoryCode: "4511"},
+				},
+				{},
+				{Counterparty: storage.Counterparty{Name: "Café Étoile 100%_Bio"}},
+			}
+			for i, detail := range details {
+				require.NoError(t, s.CreateTransaction(&storage.Transaction{
+					TransactionID: fmt.Sprintf("TRANSACTION_ID_%d", i),
+					Type:          storage.TransactionTypeDeposit,
+					UserID:        "USER_ID_1",
+					AccountNumber: "ACCOUNT_NUMBER_1",
+					Status:        storage.TransactionStatusPending,
+					Amount:        types.NewMoney(100, "MYR"),
+					Description:   "description",
+					Details:       detail,
+				}))
+			}
+
+			for i, detail := range details {
+				transaction, err := s.GetTransaction("USER_ID_1", fmt.Sprintf("TRANSACTION_ID_%d", i))
+				require.NoError(t, err)
+				assert.Equal(t, detail, transaction.Details)
+			}
+
+			idsOf := func(query storage.TransactionQuery) []string {
+				query.UserID, query.AccountNumber, query.SortOrder = "USER_ID_1", "ACCOUNT_NUMBER_1", storage.SortAscending
+				page, err := s.GetTransactions(query)
+				require.NoError(t, err)
+				ids := []string{}
+				for _, transaction := range page.Transactions {
+					ids = append(ids, transaction.TransactionID)
+				}
+				return ids
+			}
+			assert.Equal(t, []string{"TRANSACTION_ID_0"}, idsOf(storage.TransactionQuery{Tag: "card"}))
+			assert.Empty(t, idsOf(storage.TransactionQuery{Tag: "car"}))
+			assert.Equal(t, []string{"TRANSACTION_ID_0", "TRANSACTION_ID_1"}, idsOf(storage.TransactionQuery{Metadata: map[string]string{"channel": "web"}}))
+			assert.Equal(t, []string{"TRANSACTION_ID_1"}, idsOf(storage.TransactionQuery{Metadata: map[string]string{"channel": "web", "orderID": "ORDER_2"}}))
+			assert.Empty(t, idsOf(storage.TransactionQuery{Metadata: map[string]string{"channel": "ORDER_2"}}))
+			assert.Equal(t, []string{"TRANSACTION_ID_0"}, idsOf(storage.TransactionQuery{ExternalReference: "EXTERNAL_1"}))
+			assert.Equal(t, []string{"TRANSACTION_ID_0"}, idsOf(storage.TransactionQuery{CounterpartyName: "corner"}))
+			// LIKE wildcards are matched literally
+			assert.Equal(t, []string{"TRANSACTION_ID_3"}, idsOf(storage.TransactionQuery{CounterpartyName: "%"}))
+			assert.Equal(t, []string{"TRANSACTION_ID_3"}, idsOf(storage.TransactionQuery{CounterpartyName: "0%_b"}))
+			assert.Empty(t, idsOf(storage.TransactionQuery{CounterpartyName: "1_0"}))
+			// only ASCII letters are case folded
+			assert.Equal(t, []string{"TRANSACTION_ID_3"}, idsOf(storage.TransactionQuery{CounterpartyName: "CAFé"}))
+			assert.Equal(t, []string{"TRANSACTION_ID_3"}, idsOf(storage.TransactionQuery{CounterpartyName: "Étoile"}))
+			assert.Empty(t, idsOf(storage.TransactionQuery{CounterpartyName: "étoile"}))
+			assert.Equal(t, []string{"TRANSACTION_ID_1"}, idsOf(storage.TransactionQuery{CategoryCode: "4511"}))
+		})
+	}
+}
+
+func TestSettlementQueue(t *testing.T) {
+	for name, s := range backends(t) {
+		t.Run(name, func(t *testing.T) {
+			require.NoError(t, s.EnqueueSettlement(&storage.SettlementJob{TransactionID: "TRANSACTION_ID_1", UserID: "USER_ID_1"}))
+			require.NoError(t, s.EnqueueSettlement(&storage.SettlementJob{TransactionID: "TRANSACTION_ID_2", UserID: "USER_ID_1"}))
+			assert.ErrorIs(t, s.EnqueueSettlement(&storage.SettlementJob{TransactionID: "TRANSACTION_ID_1", UserID: "USER_ID_1"}), storage.ErrTransactionExists)
+
+			rollbackErr := errors.New("rollback")
+			err := s.WithTx(func(tx storage.Storage) error {
+				if err := tx.EnqueueSettlement(&storage.SettlementJob{TransactionID: "TRANSACTION_ID_3", UserID: "USER_ID_1"}); err != nil {
+					return err
+				}
+				return rollbackErr
+			})
+			assert.ErrorIs(t, err, rollbackErr)
+
+			now := time.Now()
+			jobs, err := s.ClaimSettlements(now, time.Minute, 1)
+			require.NoError(t, err)
+			require.Len(t, jobs, 1)
+			assert.Equal(t, "TRANSACTION_ID_1", jobs[0].TransactionID)
+			assert.Equal(t, "USER_ID_1", jobs[0].UserID)
+
+			// claimed jobs are leased out until the lease expires
+			jobs, err = s.ClaimSettlements(now, time.Minute, 10)
+			require.NoError(t, err)
+			require.Len(t, jobs, 1)
+			assert.Equal(t, "TRANSACTION_ID_2", jobs[0].TransactionID)
+
+			jobs, err = s.ClaimSettlements(now, time.Minute, 10)
+			require.NoError(t, err)
+			assert.Empty(t, jobs)
+
+			jobs, err = s.ClaimSettlements(now.Add(2*time.Minute), time.Minute, 10)
+			require.NoError(t, err)
+			assert.Len(t, jobs, 2)
+
+			retry := jobs[0]
+			retry.Attempts = 1
+			retry.LastError = "timeout"
+			retry.NextAttemptAt = now.Add(time.Hour)
+			require.NoError(t, s.RetrySettlement(retry))
+			require.NoError(t, s.RemoveSettlement(jobs[1].TransactionID))
+			assert.ErrorIs(t, s.RemoveSettlement(jobs[1].TransactionID), storage.ErrNotFound)
+			assert.ErrorIs(t, s.RetrySettlement(jobs[1]), storage.ErrNotFound)
+
+			jobs, err = s.ClaimSettlements(now.Add(30*time.Minute), time.Minute, 10)
+			require.NoError(t, err)
+			assert.Empty(t, jobs)
+
+			jobs, err = s.ClaimSettlements(now.Add(2*time.Hour), time.Minute, 10)
+			require.NoError(t, err)
+			require.Len(t, jobs, 1)
+			assert.Equal(t, retry.TransactionID, jobs[0].TransactionID)
+			assert.Equal(t, 1, jobs[0].Attempts)
+			assert.Equal(t, "timeout", jobs[0].LastError)
+		})
+	}
+}
+
+func TestHolds(t *testing.T) {
+	for name, s := range backends(t) {
+		t.Run(name, func(t *testing.T) {
+			now := time.Now()
+			for _, hold := range []*storage.Hold{
+				{HoldID: "HOLD_ID_1", Amount: types.NewMoney(100, "MYR"), ExpiresAt: now.Add(time.Hour)},
+				{HoldID: "HOLD_ID_2", Amount: types.NewMoney(30, "MYR"), ExpiresAt: now.Add(2 * time.Hour)},
+				{HoldID: "HOLD_ID_3", Amount: types.NewMoney(50, "USD"), ExpiresAt: now.Add(time.Hour)},
+			} {
+				hold.UserID = "USER_ID_1"
+				hold.AccountNumber = "ACCOUNT_NUMBER_1"
+				hold.Status = storage.HoldStatusActive
+				hold.Description = "authorization"
+				require.NoError(t, s.CreateHold(hold))
+				assert.NotZero(t, hold.ID)
+			}
+			assert.ErrorIs(t, s.CreateHold(&storage.Hold{HoldID: "HOLD_ID_1", UserID: "USER_ID_1", AccountNumber: "ACCOUNT_NUMBER_1", Status: storage.HoldStatusActive, Amount: types.NewMoney(1, "MYR"), ExpiresAt: now}), storage.ErrHoldExists)
+
+			hold, err := s.GetHold("USER_ID_1", "HOLD_ID_1")
+			require.NoError(t, err)
+			assert.Equal(t, types.NewMoney(100, "MYR"), hold.Amount)
+			assert.Equal(t, types.NewMoney(0, "MYR"), hold.Captured)
+			assert.Equal(t, storage.HoldStatusActive, hold.Status)
+			assert.Equal(t, "authorization", hold.Description)
+			assert.WithinDuration(t, now.Add(time.Hour), hold.ExpiresAt, time.Millisecond)
+
+			_, err = s.GetHold("USER_ID_2", "HOLD_ID_1")
+			assert.ErrorIs(t, err, storage.ErrNotFound)
+
+			held, err := s.GetHeldAmount("USER_ID_1", "ACCOUNT_NUMBER_1", "MYR", now)
+			require.NoError(t, err)
+			assert.Equal(t, types.NewMoney(130, "MYR"), held)
+
+			// expired holds no longer reserve funds, even before they are closed
+			held, err = s.GetHeldAmount("USER_ID_1", "ACCOUNT_NUMBER_1", "MYR", now.Add(90*time.Minute))
+			require.NoError(t, err)
+			assert.Equal(t, types.NewMoney(30, "MYR"), held)
+
+			expired, err := s.ListExpiredHolds(now.Add(90*time.Minute), 10)
+			require.NoError(t, err)
+			require.Len(t, expired, 2)
+			assert.Equal(t, "HOLD_ID_1", expired[0].HoldID)
+			assert.Equal(t, "HOLD_ID_3", expired[1].HoldID)
+
+			hold.Status = storage.HoldStatusCaptured
+			hold.Captured = types.NewMoney(80, "MYR")
+			require.NoError(t, s.CloseHold(hold))
+			assert.ErrorIs(t, s.CloseHold(hold), storage.ErrStatusConflict)
+			assert.ErrorIs(t, s.CloseHold(&storage.Hold{HoldID: "HOLD_ID_4", Status: storage.HoldStatusVoided}), storage.ErrNotFound)
+
+			hold, err = s.GetHold("USER_ID_1", "HOLD_ID_1")
+			require.NoError(t, err)
+			assert.Equal(t, storage.HoldStatusCaptured, hold.Status)
+			assert.Equal(t, types.NewMoney(80, "MYR"), hold.Captured)
+
+			held, err = s.GetHeldAmount("USER_ID_1", "ACCOUNT_NUMBER_1", "MYR", now)
+			require.NoError(t, err)
+			assert.Equal(t, types.NewMoney(30, "MYR"), held)
+
+			rollbackErr := errors.New("rollback")
+			err = s.WithTx(func(tx storage.Storage) error {
+				if err := tx.CloseHold(&storage.Hold{HoldID: "HOLD_ID_2", Status: storage.HoldStatusVoided, Captured: types.NewMoney(0, "MYR")}); err != nil {
+					return err
+				}
+				if err := tx.CreateHold(&storage.Hold{HoldID: "HOLD_ID_5", UserID: "USER_ID_1", AccountNumber: "ACCOUNT_NUMBER_1", Status: storage.HoldStatusActive, Amount: types.NewMoney(10, "MYR"), ExpiresAt: now.Add(time.Hour)}); err != nil {
+					return err
+				}
+				return rollbackErr
+			})
+			assert.ErrorIs(t, err, rollbackErr)
+
+			hold, err = s.GetHold("USER_ID_1", "HOLD_ID_2")
+			require.NoError(t, err)
+			assert.Equal(t, storage.HoldStatusActive, hold.Status)
+			_, err = s.GetHold("USER_ID_1", "HOLD_ID_5")
+			assert.ErrorIs(t, err, storage.ErrNotFound)
+		})
+	}
+}
+
+func TestIdempotencyKeys(t *testing.T) {
+	for name, s := range backends(t) {
+		t.Run(name, func(t *testing.T) {
+			key := &storage.IdempotencyKey{UserID: "USER_ID_1", Key: "KEY_1", Fingerprint: "FINGERPRINT_1", ExpiresAt: time.Now().Add(time.Hour)}
+			require.NoError(t, s.CreateIdempotencyKey(key))
+			assert.False(t, key.CreatedAt.IsZero())
+
+			// keys are scoped to the user
+			assert.ErrorIs(t, s.CreateIdempotencyKey(&storage.IdempotencyKey{UserID: "USER_ID_1", Key: "KEY_1", Fingerprint: "FINGERPRINT_2", ExpiresAt: time.Now().Add(time.Hour)}), storage.ErrIdempotencyKeyExists)
+			require.NoError(t, s.CreateIdempotencyKey(&storage.IdempotencyKey{UserID: "USER_ID_2", Key: "KEY_1", Fingerprint: "FINGERPRINT_2", ExpiresAt: time.Now().Add(time.Hour)}))
+
+			// in flight until the response is stored
+			got, err := s.GetIdempotencyKey("USER_ID_1", "KEY_1")
+			require.NoError(t, err)
+			assert.Equal(t, "FINGERPRINT_1", got.Fingerprint)
+			assert.Zero(t, got.StatusCode)
+			assert.Empty(t, got.Body)
+
+			key.StatusCode = 200
+			key.ContentType = "application/json"
+			key.Body = []byte(`{"ok":true}`)
+			require.NoError(t, s.CompleteIdempotencyKey(key))
+
+			got, err = s.GetIdempotencyKey("USER_ID_1", "KEY_1")
+			require.NoError(t, err)
+			assert.Equal(t, 200, got.StatusCode)
+			assert.Equal(t, "application/json", got.ContentType)
+			assert.Equal(t, []byte(`{"ok":true}`), got.Body)
+
+			_, err = s.GetIdempotencyKey("USER_ID_1", "KEY_2")
+			assert.ErrorIs(t, err, storage.ErrNotFound)
+			assert.ErrorIs(t, s.CompleteIdempotencyKey(&storage.IdempotencyKey{UserID: "USER_ID_1", Key: "KEY_2"}), storage.ErrNotFound)
+
+			require.NoError(t, s.DeleteIdempotencyKey("USER_ID_2", "KEY_1"))
+			assert.ErrorIs(t, s.DeleteIdempotencyKey("USER_ID_2", "KEY_1"), storage.ErrNotFound)
+
+			// an expired key can be used again
+			require.NoError(t, s.CreateIdempotencyKey(&storage.IdempotencyKey{UserID: "USER_ID_1", Key: "KEY_2", Fingerprint: "FINGERPRINT_1", ExpiresAt: time.Now().Add(-time.Second)}))
+			require.NoError(t, s.CreateIdempotencyKey(&storage.IdempotencyKey{UserID: "USER_ID_1", Key: "KEY_2", Fingerprint: "FINGERPRINT_2", ExpiresAt: time.Now().Add(-time.Second)}))
+			got, err = s.GetIdempotencyKey("USER_ID_1", "KEY_2")
+			require.NoError(t, err)
+			assert.Equal(t, "FINGERPRINT_2", got.Fingerprint)
+
+			deleted, err := s.DeleteExpiredIdempotencyKeys(time.Now())
+			require.NoError(t, err)
+			assert.Equal(t, 1, deleted)
+			_, err = s.GetIdempotencyKey("USER_ID_1", "KEY_2")
+			assert.ErrorIs(t, err, storage.ErrNotFound)
+			_, err = s.GetIdempotencyKey("USER_ID_1", "KEY_1")
+			assert.NoError(t, err)
+		})
+	}
+}
+
+func TestAPIKeys(t *testing.T) {
+	for name, s := range backends(t) {
+		t.Run(name, func(t *testing.T) {
+			key := &storage.APIKey{KeyID: "KEY_ID_1", UserID: "USER_ID_1", Scopes: []string{types.ScopeBalancesRead}, Name: "laptop", Prefix: "tlk_abcd", Hash: "HASH_1"}
+			require.NoError(t, s.CreateAPIKey(key))
+			assert.False(t, key.CreatedAt.IsZero())
+			assert.ErrorIs(t, s.CreateAPIKey(&storage.APIKey{KeyID: "KEY_ID_1", UserID: "USER_ID_1", Hash: "HASH_2"}), storage.ErrAPIKeyExists)
+			assert.ErrorIs(t, s.CreateAPIKey(&storage.APIKey{KeyID: "KEY_ID_2", UserID: "USER_ID_1", Hash: "HASH_1"}), storage.ErrAPIKeyExists)
+			require.NoError(t, s.CreateAPIKey(&storage.APIKey{KeyID: "KEY_ID_2", UserID: "USER_ID_1", Name: "server", Hash: "HASH_2"}))
+
+			got, err := s.GetAPIKeyByHash("HASH_1")
+			require.NoError(t, err)
+			assert.Equal(t, "KEY_ID_1", got.KeyID)
+			assert.Equal(t, "tlk_abcd", got.Prefix)
+			assert.Equal(t, types.RoleCustomer, got.Role)
+			assert.Equal(t, []string{types.ScopeBalancesRead}, got.Scopes)
+			assert.True(t, got.LastUsedAt.IsZero())
+			assert.False(t, got.Revoked())
+			_, err = s.GetAPIKeyByHash("HASH_3")
+			assert.ErrorIs(t, err, storage.ErrNotFound)
+
+			// keys are only visible to their user
+			_, err = s.GetAPIKey("USER_ID_2", "KEY_ID_1")
+			assert.ErrorIs(t, err, storage.ErrNotFound)
+			keys, err := s.ListAPIKeys("USER_ID_2")
+			require.NoError(t, err)
+			assert.Empty(t, keys)
+
+			usedAt := time.Now().Add(-time.Minute)
+			require.NoError(t, s.TouchAPIKey("KEY_ID_1", usedAt))
+			got, err = s.GetAPIKey("USER_ID_1", "KEY_ID_1")
+			require.NoError(t, err)
+			assert.WithinDuration(t, usedAt, got.LastUsedAt, time.Millisecond)
+			assert.ErrorIs(t, s.TouchAPIKey("KEY_ID_3", usedAt), storage.ErrNotFound)
+
+			assert.ErrorIs(t, s.RevokeAPIKey("USER_ID_2", "KEY_ID_1", time.Now()), storage.ErrNotFound)
+			require.NoError(t, s.RevokeAPIKey("USER_ID_1", "KEY_ID_1", time.Now()))
+			assert.ErrorIs(t, s.RevokeAPIKey("USER_ID_1", "KEY_ID_1", time.Now()), storage.ErrStatusConflict)
+
+			keys, err = s.ListAPIKeys("USER_ID_1")
+			require.NoError(t, err)
+			require.Len(t, keys, 2)
+			assert.Equal(t, "KEY_ID_1", keys[0].KeyID)
+			assert.True(t, keys[0].Revoked())
+			assert.Equal(t, "KEY_ID_2", keys[1].KeyID)
+			assert.False(t, keys[1].Revoked())
+
+			// a revocation is rolled back with its unit of work
+			err = s.WithTx(func(tx storage.Storage) error {
+				require.NoError(t, tx.CreateAPIKey(&storage.APIKey{KeyID: "KEY_ID_3", UserID: "USER_ID_1", Hash: "HASH_3"}))
+				require.NoError(t, tx.RevokeAPIKey("USER_ID_1", "KEY_ID_2", time.Now()))
+				return errors.New("rollback")
+			})
+			require.Error(t, err)
+			_, err = s.GetAPIKey("USER_ID_1", "KEY_ID_3")
+			assert.ErrorIs(t, err, storage.ErrNotFound)
+			got, err = s.GetAPIKey("USER_ID_1", "KEY_ID_2")
+			require.NoError(t, err)
+			assert.False(t, got.Revoked())
+		})
+	}
+}
+
+func TestAuditEntries(t *testing.T) {
+	for name, s := range backends(t) {
+		t.Run(name, func(t *testing.T) {
+			freeze := &storage.AuditEntry{OperatorID: "ADMIN_ID", Role: types.RoleAdmin, Action: storage.AuditActionAccountFreeze, TargetType: storage.AuditTargetAccount, TargetID: "ACCOUNT_NUMBER_1", Reason: "fraud", Details: "active -> frozen"}
+			require.NoError(t, s.RecordAuditEntry(freeze))
+			assert.NotZero(t, freeze.ID)
+			assert.False(t, freeze.CreatedAt.IsZero())
+			require.NoError(t, s.RecordAuditEntry(&storage.AuditEntry{OperatorID: "ADMIN_ID", Role: types.RoleAdmin, Action: storage.AuditActionStatusOverride, TargetType: storage.AuditTargetTransaction, TargetID: "TRANSACTION_ID_1", Reason: "stuck"}))
+			require.NoError(t, s.RecordAuditEntry(&storage.AuditEntry{OperatorID: "OTHER_ADMIN_ID", Role: types.RoleAdmin, Action: storage.AuditActionAccountUnfreeze, TargetType: storage.AuditTargetAccount, TargetID: "ACCOUNT_NUMBER_1", Reason: "cleared"}))
+
+			entries, err := s.ListAuditEntries(storage.AuditQuery{})
+			require.NoError(t, err)
+			require.Len(t, entries, 3)
+			assert.Equal(t, storage.AuditActionAccountUnfreeze, entries[0].Action)
+			assert.Equal(t, freeze.ID, entries[2].ID)
+			assert.Equal(t, "fraud", entries[2].Reason)
+			assert.Equal(t, "active -> frozen", entries[2].Details)
+
+			entries, err = s.ListAuditEntries(storage.AuditQuery{TargetType: storage.AuditTargetAccount, TargetID: "ACCOUNT_NUMBER_1"})
+			require.NoError(t, err)
+			assert.Len(t, entries, 2)
+			entries, err = s.ListAuditEntries(storage.AuditQuery{OperatorID: "ADMIN_ID", Limit: 1})
+			require.NoError(t, err)
+			require.Len(t, entries, 1)
+			assert.Equal(t, storage.AuditActionStatusOverride, entries[0].Action)
+
+			// an entry is rolled back with the action it records
+			err = s.WithTx(func(tx storage.Storage) error {
+				require.NoError(t, tx.RecordAuditEntry(&storage.AuditEntry{OperatorID: "ADMIN_ID", Role: types.RoleAdmin, Action: storage.AuditActionAccountFreeze, TargetType: storage.AuditTargetAccount, TargetID: "ACCOUNT_NUMBER_2", Reason: "fraud"}))
+				return errors.New("rollback")
+			})
+			require.Error(t, err)
+			entries, err = s.ListAuditEntries(storage.AuditQuery{TargetID: "ACCOUNT_NUMBER_2"})
+			require.NoError(t, err)
+			assert.Empty(t, entries)
+		})
+	}
+}
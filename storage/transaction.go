@@ -1,94 +1,290 @@
 package storage
 
 import (
-	"errors"
+	"cmp"
+	"slices"
+	"sort"
 	"time"
 )
 
 func (m *MemoryStorage) CreateDeposit(transaction *Transaction) (*Transaction, error) {
-	// Ideally should be handled by a unique constraint
-	for _, transactionData := range m.transactions {
-		if transactionData.TransactionID == transaction.TransactionID {
-			return nil, errors.New("transaction already exists")
-		}
+	if err := m.CreateTransaction(transaction); err != nil {
+		return nil, err
 	}
 
-	now := time.Now()
-	transaction.CreatedAt = now
-	transaction.UpdatedAt = now
+	return transaction, nil
+}
 
-	m.transactions = append(m.transactions, transaction)
+func (m *MemoryStorage) GetTransactions(query TransactionQuery) (*TransactionPage, error) {
+	return m.queryTransactions(query, func() []*Transaction {
+		return m.accountTransactions[accountKey{userID: query.UserID, accountNumber: query.AccountNumber}]
+	})
+}
 
-	return transaction, nil
+func (m *MemoryStorage) SearchTransactions(query TransactionQuery) (*TransactionPage, error) {
+	return m.queryTransactions(query, func() []*Transaction {
+		if query.UserID != "" && query.AccountNumber != "" {
+			return m.accountTransactions[accountKey{userID: query.UserID, accountNumber: query.AccountNumber}]
+		}
+
+		result := []*Transaction{}
+		for _, transaction := range m.transactions {
+			if (query.UserID == "" || transaction.UserID == query.UserID) &&
+				(query.AccountNumber == "" || transaction.AccountNumber == query.AccountNumber) {
+				result = append(result, transaction)
+			}
+		}
+		slices.SortFunc(result, func(a, b *Transaction) int { return cmp.Compare(a.ID, b.ID) })
+		return result
+	})
 }
 
-func (m *MemoryStorage) GetTransactions(userID, accountNumber string, limit, page int) ([]*Transaction, error) {
-	if limit <= 0 {
-		limit = 10
+// queryTransactions pages through the transactions returned by candidates, which is called
+// with mu held and returns them in creation order
+func (m *MemoryStorage) queryTransactions(query TransactionQuery, candidates func() []*Transaction) (*TransactionPage, error) {
+	query = query.normalize()
+	if err := query.validate(); err != nil {
+		return nil, err
 	}
 
-	result := []*Transaction{}
+	var after *cursor
+	if query.Cursor != "" {
+		c, err := decodeCursor(query)
+		if err != nil {
+			return nil, err
+		}
+		after = &c
+	}
 
-	for _, transaction := range m.transactions {
-		if transaction.UserID == userID && transaction.AccountNumber == accountNumber {
-			result = append(result, transaction)
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	// transactions are in creation order, so IDs are increasing and the newest is last
+	transactions := candidates()
+	if query.filtered() {
+		matched := []*Transaction{}
+		for _, transaction := range transactions {
+			if query.matches(transaction) {
+				matched = append(matched, transaction)
+			}
 		}
+		transactions = matched
+	}
+	if query.SortBy == SortByAmount {
+		transactions = slices.Clone(transactions)
+		sort.Slice(transactions, func(i, j int) bool {
+			return compareMemoryOrder(query.SortBy, transactions[i], cursorOf(query, transactions[j])) < 0
+		})
 	}
 
-	return result, nil
+	// transactions are now ascending by (sort value, ID); walk them in the requested direction
+	count := len(transactions)
+	offset := (query.Page - 1) * query.Limit
+	page := &TransactionPage{Transactions: []*Transaction{}}
+	if query.SortOrder == SortDescending {
+		end := count - offset
+		if after != nil {
+			end = sort.Search(count, func(i int) bool { return compareMemoryOrder(query.SortBy, transactions[i], *after) >= 0 })
+		}
+		end = max(end, 0)
+		start := max(end-query.Limit, 0)
+		for i := end - 1; i >= start; i-- {
+			copied := *transactions[i]
+			page.Transactions = append(page.Transactions, &copied)
+		}
+		page.HasMore = start > 0
+	} else {
+		start := offset
+		if after != nil {
+			start = sort.Search(count, func(i int) bool { return compareMemoryOrder(query.SortBy, transactions[i], *after) > 0 })
+		}
+		start = min(start, count)
+		end := min(start+query.Limit, count)
+		for i := start; i < end; i++ {
+			copied := *transactions[i]
+			page.Transactions = append(page.Transactions, &copied)
+		}
+		page.HasMore = end < count
+	}
+
+	if page.HasMore {
+		page.NextCursor = cursorOf(query, page.Transactions[len(page.Transactions)-1]).encode()
+	}
+
+	return page, nil
+}
+
+// compareMemoryOrder compares a transaction with a cursor position. Creation order is
+// compared by ID alone since IDs are handed out in creation order and, unlike the wall
+// clock, never go backwards.
+func compareMemoryOrder(sortBy string, transaction *Transaction, c cursor) int {
+	if sortBy == SortByAmount && transaction.Amount.Amount != c.value {
+		return cmp.Compare(transaction.Amount.Amount, c.value)
+	}
+	return cmp.Compare(transaction.ID, c.id)
 }
 
 // CreateTransaction creates a new transaction
 func (m *MemoryStorage) CreateTransaction(transaction *Transaction) error {
-	// Ideally should be handled by a unique constraint
-	for _, transactionData := range m.transactions {
-		if transactionData.ID == transaction.ID {
-			return errors.New("transaction already exists")
-		}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if _, ok := m.transactions[transaction.TransactionID]; ok {
+		return ErrTransactionExists
 	}
 
 	// Set timestamps
-	now := time.Now()
+	now := createdAt(transaction.CreatedAt)
 	transaction.CreatedAt = now
 	transaction.UpdatedAt = now
 
-	m.transactions = append(m.transactions, transaction)
+	m.lastTransactionID++
+	transaction.ID = m.lastTransactionID
+
+	stored := *transaction
+	key := accountKey{userID: stored.UserID, accountNumber: stored.AccountNumber}
+	m.transactions[stored.TransactionID] = &stored
+	m.accountTransactions[key] = append(m.accountTransactions[key], &stored)
+	m.statusChanges[stored.TransactionID] = []*StatusChange{{
+		TransactionID: stored.TransactionID,
+		To:            stored.Status,
+		Reason:        stored.StatusReason,
+		CreatedAt:     now,
+	}}
 	return nil
 }
 
 func (m *MemoryStorage) CreateWithdrawal(transaction *Transaction) (*Transaction, error) {
-	// Ideally should be handled by a unique constraint
-	for _, transactionData := range m.transactions {
-		if transactionData.TransactionID == transaction.TransactionID {
-			return nil, errors.New("transaction already exists")
-		}
+	if err := m.CreateTransaction(transaction); err != nil {
+		return nil, err
 	}
 
-	now := time.Now()
-	transaction.CreatedAt = now
-	transaction.UpdatedAt = now
-
-	m.transactions = append(m.transactions, transaction)
-
 	return transaction, nil
 }
 
 func (m *MemoryStorage) GetTransaction(userID, transactionID string) (*Transaction, error) {
-	for _, transaction := range m.transactions {
-		if transaction.UserID == userID && transaction.TransactionID == transactionID {
-			return transaction, nil
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	transaction, ok := m.transactions[transactionID]
+	if !ok || transaction.UserID != userID {
+		return nil, ErrNotFound
+	}
+
+	result := *transaction
+	return &result, nil
+}
+
+func (m *MemoryStorage) FindTransaction(transactionID string) (*Transaction, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	transaction, ok := m.transactions[transactionID]
+	if !ok {
+		return nil, ErrNotFound
+	}
+
+	result := *transaction
+	return &result, nil
+}
+
+func (m *MemoryStorage) UpdateTransactionStatus(change *StatusChange) error {
+	_, err := m.updateTransactionStatus(change)
+	return err
+}
+
+// updateTransactionStatus applies the change and returns the transaction as it was before it
+func (m *MemoryStorage) updateTransactionStatus(change *StatusChange) (Transaction, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	transaction, ok := m.transactions[change.TransactionID]
+	if !ok {
+		return Transaction{}, ErrNotFound
+	}
+	if transaction.Status != change.From {
+		return Transaction{}, ErrStatusConflict
+	}
+
+	change.CreatedAt = time.Now()
+	previous := *transaction
+	transaction.Status = change.To
+	transaction.StatusReason = change.Reason
+	transaction.UpdatedAt = change.CreatedAt
+
+	stored := *change
+	m.statusChanges[change.TransactionID] = append(m.statusChanges[change.TransactionID], &stored)
+	return previous, nil
+}
+
+func (m *MemoryStorage) GetStatusChanges(transactionID string) ([]*StatusChange, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	if _, ok := m.transactions[transactionID]; !ok {
+		return nil, ErrNotFound
+	}
+
+	result := []*StatusChange{}
+	for _, change := range m.statusChanges[transactionID] {
+		copied := *change
+		result = append(result, &copied)
+	}
+	return result, nil
+}
+
+func (m *MemoryStorage) GetReversals(userID, transactionID string) ([]*Transaction, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	original, ok := m.transactions[transactionID]
+	if !ok || original.UserID != userID {
+		return nil, ErrNotFound
+	}
+
+	// Reversals are posted to the account of the transaction they reverse
+	result := []*Transaction{}
+	for _, transaction := range m.accountTransactions[accountKey{userID: userID, accountNumber: original.AccountNumber}] {
+		if transaction.ReversalOf == transactionID {
+			copied := *transaction
+			result = append(result, &copied)
 		}
 	}
-	return nil, ErrNotFound
+	return result, nil
 }
 
-func (m *MemoryStorage) UpdateTransaction(transactionID string, status string) error {
-	for _, transaction := range m.transactions {
-		if transaction.TransactionID == transactionID {
-			transaction.Status = status
-			transaction.UpdatedAt = time.Now()
-			return nil
+// restoreTransaction overwrites a stored transaction with a previous copy of itself
+// and forgets the status change made since
+func (m *MemoryStorage) restoreTransaction(previous Transaction) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if transaction, ok := m.transactions[previous.TransactionID]; ok {
+		*transaction = previous
+	}
+	if changes := m.statusChanges[previous.TransactionID]; len(changes) > 0 {
+		m.statusChanges[previous.TransactionID] = changes[:len(changes)-1]
+	}
+}
+
+func (m *MemoryStorage) removeTransaction(transactionID string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	transaction, ok := m.transactions[transactionID]
+	if !ok {
+		return
+	}
+	delete(m.transactions, transactionID)
+	delete(m.statusChanges, transactionID)
+
+	// Rolled back transactions are almost always the most recent ones, so search from the end
+	key := accountKey{userID: transaction.UserID, accountNumber: transaction.AccountNumber}
+	transactions := m.accountTransactions[key]
+	for i := len(transactions) - 1; i >= 0; i-- {
+		if transactions[i] == transaction {
+			m.accountTransactions[key] = append(transactions[:i], transactions[i+1:]...)
+			return
 		}
 	}
-	return ErrNotFound
 }
@@ -0,0 +1,178 @@
+package storage
+
+import (
+	"time"
+
+	"github.com/alienxp03/teya-ledger/types"
+)
+
+// memoryTx is the Storage handed to WithTx callbacks of MemoryStorage.
+// Every mutation records how to undo itself; the undo log is replayed in reverse
+// when the callback fails. Changes are visible to other readers before the
+// callback returns, so writers are expected to hold the relevant account locks.
+type memoryTx struct {
+	*MemoryStorage
+	undo []func()
+}
+
+func (m *MemoryStorage) WithTx(fn func(tx Storage) error) (err error) {
+	tx := &memoryTx{MemoryStorage: m}
+	defer func() {
+		if r := recover(); r != nil {
+			tx.rollback()
+			panic(r)
+		}
+	}()
+
+	if err := fn(tx); err != nil {
+		tx.rollback()
+		return err
+	}
+
+	return nil
+}
+
+// WithTx on a running transaction joins it
+func (t *memoryTx) WithTx(fn func(tx Storage) error) error {
+	return fn(t)
+}
+
+func (t *memoryTx) rollback() {
+	for i := len(t.undo) - 1; i >= 0; i-- {
+		t.undo[i]()
+	}
+	t.undo = nil
+}
+
+func (t *memoryTx) CreateAccount(account Account) (*Account, error) {
+	result, err := t.MemoryStorage.CreateAccount(account)
+	if err != nil {
+		return nil, err
+	}
+
+	t.undo = append(t.undo, func() { t.removeAccount(result.UserID, result.Number) })
+	return result, nil
+}
+
+func (t *memoryTx) CreateTransaction(transaction *Transaction) error {
+	if err := t.MemoryStorage.CreateTransaction(transaction); err != nil {
+		return err
+	}
+
+	transactionID := transaction.TransactionID
+	t.undo = append(t.undo, func() { t.removeTransaction(transactionID) })
+	return nil
+}
+
+func (t *memoryTx) CreateDeposit(transaction *Transaction) (*Transaction, error) {
+	if err := t.CreateTransaction(transaction); err != nil {
+		return nil, err
+	}
+
+	return transaction, nil
+}
+
+func (t *memoryTx) CreateWithdrawal(transaction *Transaction) (*Transaction, error) {
+	if err := t.CreateTransaction(transaction); err != nil {
+		return nil, err
+	}
+
+	return transaction, nil
+}
+
+func (t *memoryTx) UpdateTransactionStatus(change *StatusChange) error {
+	previous, err := t.updateTransactionStatus(change)
+	if err != nil {
+		return err
+	}
+
+	t.undo = append(t.undo, func() { t.restoreTransaction(previous) })
+	return nil
+}
+
+func (t *memoryTx) UpdateBalance(userID string, accountNumber string, amount types.Money) error {
+	if err := t.MemoryStorage.UpdateBalance(userID, accountNumber, amount); err != nil {
+		return err
+	}
+
+	t.undo = append(t.undo, func() { t.MemoryStorage.revertBalance(userID, accountNumber, amount) })
+	return nil
+}
+
+func (t *memoryTx) PostJournalEntry(entry *JournalEntry) error {
+	if err := t.MemoryStorage.PostJournalEntry(entry); err != nil {
+		return err
+	}
+
+	reference, id := entry.Reference, entry.ID
+	t.undo = append(t.undo, func() { t.removeJournalEntry(reference, id) })
+	return nil
+}
+
+func (t *memoryTx) EnqueueSettlement(job *SettlementJob) error {
+	if err := t.MemoryStorage.EnqueueSettlement(job); err != nil {
+		return err
+	}
+
+	transactionID := job.TransactionID
+	t.undo = append(t.undo, func() { _ = t.MemoryStorage.RemoveSettlement(transactionID) })
+	return nil
+}
+
+func (t *memoryTx) CreateHold(hold *Hold) error {
+	if err := t.MemoryStorage.CreateHold(hold); err != nil {
+		return err
+	}
+
+	holdID := hold.HoldID
+	t.undo = append(t.undo, func() { t.removeHold(holdID) })
+	return nil
+}
+
+func (t *memoryTx) CloseHold(hold *Hold) error {
+	previous, err := t.closeHold(hold)
+	if err != nil {
+		return err
+	}
+
+	t.undo = append(t.undo, func() { t.restoreHold(previous) })
+	return nil
+}
+
+func (t *memoryTx) CreateAPIKey(key *APIKey) error {
+	if err := t.MemoryStorage.CreateAPIKey(key); err != nil {
+		return err
+	}
+
+	keyID := key.KeyID
+	t.undo = append(t.undo, func() { t.removeAPIKey(keyID) })
+	return nil
+}
+
+func (t *memoryTx) RevokeAPIKey(userID string, keyID string, at time.Time) error {
+	if err := t.MemoryStorage.RevokeAPIKey(userID, keyID, at); err != nil {
+		return err
+	}
+
+	t.undo = append(t.undo, func() { t.unrevokeAPIKey(keyID) })
+	return nil
+}
+
+func (t *memoryTx) UpdateAccountStatus(userID string, accountNumber string, from string, to string) error {
+	if err := t.MemoryStorage.UpdateAccountStatus(userID, accountNumber, from, to); err != nil {
+		return err
+	}
+
+	t.undo = append(t.undo, func() { _ = t.MemoryStorage.UpdateAccountStatus(userID, accountNumber, to, from) })
+	return nil
+}
+
+func (t *memoryTx) RecordAuditEntry(entry *AuditEntry) error {
+	if err := t.MemoryStorage.RecordAuditEntry(entry); err != nil {
+		return err
+	}
+
+	id := entry.ID
+	t.undo = append(t.undo, func() { t.removeAuditEntry(id) })
+	return nil
+}
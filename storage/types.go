@@ -1,6 +1,13 @@
 package storage
 
-import "time"
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"slices"
+	"time"
+
+	"github.com/alienxp03/teya-ledger/types"
+)
 
 type User struct {
 	ID        int
@@ -8,31 +15,373 @@ type User struct {
 	UpdatedAt time.Time
 }
 
+// DefaultCurrency is held by accounts created without any currency
+const DefaultCurrency = "MYR"
+
+// Account statuses. Funds cannot leave a frozen account and cannot move in or out of
+// a closed one. Closed accounts stay closed.
+const (
+	AccountStatusActive = "active"
+	AccountStatusFrozen = "frozen"
+	AccountStatusClosed = "closed"
+)
+
 type Account struct {
 	ID        int
 	Number    string
 	CreatedAt time.Time
 	UpdatedAt time.Time
-	Balance   int
 	UserID    string
+	// Status defaults to AccountStatusActive when the account is created
+	Status string
+	// Currencies are the ISO 4217 codes the account holds a balance in, sorted
+	Currencies []string
+}
+
+// HoldsCurrency reports whether the account has a balance in currency
+func (a *Account) HoldsCurrency(currency string) bool {
+	return slices.Contains(a.Currencies, currency)
 }
 
+// currencies returns the sorted, de-duplicated currencies to open for a new account
+func (a *Account) currencies() []string {
+	if len(a.Currencies) == 0 {
+		return []string{DefaultCurrency}
+	}
+
+	result := slices.Clone(a.Currencies)
+	slices.Sort(result)
+	return slices.Compact(result)
+}
+
+const (
+	TransactionTypeDeposit       = "deposit"
+	TransactionTypeWithdrawal    = "withdrawal"
+	TransactionTypeTransferIn    = "transfer_in"
+	TransactionTypeTransferOut   = "transfer_out"
+	TransactionTypeConversionIn  = "conversion_in"
+	TransactionTypeConversionOut = "conversion_out"
+	TransactionTypeCapture       = "capture"
+	TransactionTypeReversal      = "reversal"
+)
+
+// Transaction statuses. The transitions allowed between them are enforced by the transaction handler.
+const (
+	TransactionStatusPending    = "pending"
+	TransactionStatusProcessing = "processing"
+	TransactionStatusCompleted  = "completed"
+	TransactionStatusFailed     = "failed"
+	TransactionStatusCancelled  = "cancelled"
+	TransactionStatusReversed   = "reversed"
+	// TransactionStatusPartiallyReversed is a completed transaction with reversals
+	// that do not add up to its full amount yet
+	TransactionStatusPartiallyReversed = "partially_reversed"
+)
+
 type Transaction struct {
 	ID            int
 	TransactionID string
+	Type          string
 	Status        string
-	Amount        int64
-	Currency      string
+	// StatusReason explains the current status, e.g. why the transaction failed
+	StatusReason  string
+	Amount        types.Money
 	UserID        string
 	Description   string
 	AccountNumber string
+	// TransferID links the two legs of a transfer between accounts
+	TransferID string
+	// ConversionID links the two legs of a currency conversion
+	ConversionID string
+	// Rate is the mid-market rate a conversion was priced at, as a decimal string
+	Rate string
+	// Spread is the margin taken from Rate on a conversion, in basis points
+	Spread int64
+	// HoldID is the hold a capture was taken from
+	HoldID string
+	// ReversalOf links a reversal to the transaction it compensates
+	ReversalOf string
+	Details
+	CreatedAt time.Time
+	UpdatedAt time.Time
+}
+
+// Details are what the client tells about a transaction besides its description. The ledger
+// keeps them and filters on them but never acts on them.
+type Details struct {
+	Metadata          map[string]string
+	Tags              []string
+	Counterparty      Counterparty
+	ExternalReference string
+}
+
+// Counterparty is the merchant or other party on the far side of a transaction
+type Counterparty struct {
+	Name      string
+	Reference string
+	// CategoryCode is the four digit ISO 18245 merchant category code
+	CategoryCode string
+}
+
+// AffectsBalance reports whether the transaction's amount is part of its account balance.
+// Debits count from the moment they are created so the funds cannot be spent twice,
+// credits only once the transaction completes. A reversed transaction keeps counting,
+// its reversals carry the opposite amount.
+func (t *Transaction) AffectsBalance() bool {
+	return AffectsBalance(t.Amount, t.Status)
+}
+
+func AffectsBalance(amount types.Money, status string) bool {
+	switch status {
+	case TransactionStatusCompleted, TransactionStatusPartiallyReversed, TransactionStatusReversed:
+		return true
+	case TransactionStatusPending, TransactionStatusProcessing:
+		return amount.IsNegative()
+	default:
+		return false
+	}
+}
+
+// StatusChange records a transaction moving from one status to another. The change
+// that creates a transaction has an empty From.
+type StatusChange struct {
+	TransactionID string
+	From          string
+	To            string
+	Reason        string
 	CreatedAt     time.Time
-	UpdatedAt     time.Time
 }
 
+// Hold statuses. An active hold moves to one of the others exactly once.
+const (
+	HoldStatusActive   = "active"
+	HoldStatusCaptured = "captured"
+	HoldStatusVoided   = "voided"
+	HoldStatusExpired  = "expired"
+)
+
+// Hold reserves part of an account's balance, e.g. for a card authorization, until it
+// is captured, voided or expires. The reserved funds are taken from the available
+// balance but stay part of the ledger balance until they are captured.
+type Hold struct {
+	ID            int
+	HoldID        string
+	UserID        string
+	AccountNumber string
+	// Amount is the amount reserved
+	Amount types.Money
+	// Captured is the amount taken from the balance when the hold was captured
+	Captured    types.Money
+	Status      string
+	Description string
+	ExpiresAt   time.Time
+	CreatedAt   time.Time
+	UpdatedAt   time.Time
+}
+
+// Reserves reports whether the hold still reserves funds at now
+func (h *Hold) Reserves(now time.Time) bool {
+	return h.Status == HoldStatusActive && now.Before(h.ExpiresAt)
+}
+
+// SettlementJob is a transaction waiting in the settlement queue. Jobs stay queued
+// until the transaction settles or fails, so no work is lost when the process stops.
+type SettlementJob struct {
+	TransactionID string
+	UserID        string
+	// Attempts counts the failed attempts to settle the transaction so far
+	Attempts int
+	// NextAttemptAt is when the job can be claimed next
+	NextAttemptAt time.Time
+	// LastError is the error of the latest failed attempt
+	LastError string
+	CreatedAt time.Time
+}
+
+// IdempotencyKey is a request made with an idempotency key. Once the request finishes
+// it holds the response to replay to retries of the request with the same key.
+type IdempotencyKey struct {
+	UserID string
+	Key    string
+	// Fingerprint identifies the request the key was first used with
+	Fingerprint string
+	// StatusCode is zero while the first request is still in flight
+	StatusCode  int
+	ContentType string
+	Body        []byte
+	CreatedAt   time.Time
+	ExpiresAt   time.Time
+}
+
+// APIKey authenticates the requests of a user. Only a hash of the secret is stored,
+// the secret itself is shown once when the key is created.
+type APIKey struct {
+	KeyID  string
+	UserID string
+	// Role is granted to the requests the key authenticates, types.RoleCustomer by default
+	Role string
+	// Scopes are granted to the requests the key authenticates
+	Scopes []string
+	Name   string
+	// Prefix is the start of the secret, enough for a user to tell their keys apart
+	Prefix string
+	// Hash is the SHA-256 hash of the secret, hex encoded
+	Hash      string
+	CreatedAt time.Time
+	// LastUsedAt is zero until the key authenticates a request
+	LastUsedAt time.Time
+	// RevokedAt is zero while the key is active
+	RevokedAt time.Time
+}
+
+// HashAPIKeySecret is the hash stored for the secret of an API key
+func HashAPIKeySecret(secret string) string {
+	hash := sha256.Sum256([]byte(secret))
+	return hex.EncodeToString(hash[:])
+}
+
+// Revoked reports whether the key was revoked
+func (k *APIKey) Revoked() bool {
+	return !k.RevokedAt.IsZero()
+}
+
+// AuditEntry records an action taken by an operator on data they do not own
+type AuditEntry struct {
+	ID int
+	// OperatorID is the user who took the action and Role the role they took it with
+	OperatorID string
+	Role       string
+	// Action is what was done, e.g. AuditActionAccountFreeze
+	Action string
+	// TargetType and TargetID identify what the action was taken on
+	TargetType string
+	TargetID   string
+	Reason     string
+	// Details describes the change, e.g. "pending -> failed"
+	Details   string
+	CreatedAt time.Time
+}
+
+const (
+	AuditActionStatusOverride  = "transaction.status_override"
+	AuditActionAccountFreeze   = "account.freeze"
+	AuditActionAccountUnfreeze = "account.unfreeze"
+
+	AuditTargetTransaction = "transaction"
+	AuditTargetAccount     = "account"
+)
+
+// AuditQuery selects the most recent audit entries. Zero values match everything.
+type AuditQuery struct {
+	OperatorID string
+	TargetType string
+	TargetID   string
+	// Limit defaults to DefaultTransactionsLimit and is capped at MaxTransactionsLimit
+	Limit int
+}
+
+// System ledger accounts hold the other side of money entering or leaving the ledger
+const (
+	LedgerAccountCashInTransit = "system:cash_in_transit"
+	LedgerAccountFees          = "system:fees"
+	// LedgerAccountOpeningBalances is the equity account funding balances that existed before the ledger
+	LedgerAccountOpeningBalances = "system:opening_balances"
+	// LedgerAccountFXPosition buys the currency a customer sells and sells the one they buy
+	LedgerAccountFXPosition = "system:fx_position"
+)
+
+// CustomerLedgerAccount is the ledger account of a customer account.
+// Customer ledger accounts are liabilities, so a positive balance is held as a credit.
+func CustomerLedgerAccount(userID string, accountNumber string) string {
+	return "customer:" + userID + ":" + accountNumber
+}
+
+// JournalEntry is a set of postings recorded together. The postings of an entry
+// always sum to zero in every currency. Reference is the ID of the transaction or
+// transfer that produced the entry.
+type JournalEntry struct {
+	ID          int
+	Reference   string
+	Description string
+	Postings    []Posting
+	CreatedAt   time.Time
+}
+
+// Posting is one line of a journal entry. Debits are positive and credits negative.
+type Posting struct {
+	LedgerAccount string
+	Amount        types.Money
+}
+
+// TrialBalanceLine totals the postings of one ledger account in one currency.
+// Debits and Credits are both positive and Balance is Debits - Credits.
+type TrialBalanceLine struct {
+	LedgerAccount string
+	Debits        types.Money
+	Credits       types.Money
+	Balance       types.Money
+}
+
+// Balance is the amount an account holds in one currency
 type Balance struct {
 	UserID        string
 	AccountNumber string
-	Amount        int64
-	Currency      string
+	Amount        types.Money
+}
+
+const (
+	DefaultTransactionsLimit = 10
+	MaxTransactionsLimit     = 100
+)
+
+const (
+	SortByCreatedAt = "createdAt"
+	SortByAmount    = "amount"
+
+	SortAscending  = "asc"
+	SortDescending = "desc"
+)
+
+// TransactionQuery selects a filtered, sorted page of an account's transactions, or of
+// every account for SearchTransactions. Cursor takes precedence over Page when both are set.
+type TransactionQuery struct {
+	UserID        string
+	AccountNumber string
+
+	// Filters, zero values match everything
+	Status      string
+	Type        string
+	MinAmount   *int64
+	MaxAmount   *int64
+	CreatedFrom time.Time // inclusive
+	CreatedTo   time.Time // exclusive
+	// Description matches transactions whose description contains it, ignoring the case of ASCII letters
+	Description string
+	// Tag matches transactions tagged with it
+	Tag string
+	// Metadata matches transactions having every one of its keys set to the same value
+	Metadata          map[string]string
+	ExternalReference string
+	// CounterpartyName matches transactions whose counterparty name contains it, ignoring the case of ASCII letters
+	CounterpartyName string
+	CategoryCode     string
+
+	// SortBy is SortByCreatedAt (default) or SortByAmount. Ties are broken by ID.
+	SortBy string
+	// SortOrder is SortDescending (default) or SortAscending
+	SortOrder string
+
+	// Limit is the page size, defaults to DefaultTransactionsLimit and is capped at MaxTransactionsLimit
+	Limit int
+	// Page is the 1-based page number for offset pagination
+	Page int
+	// Cursor is the NextCursor of a previous page requested with the same sort
+	Cursor string
+}
+
+type TransactionPage struct {
+	Transactions []*Transaction
+	// NextCursor points after the last transaction of this page. It is empty when HasMore is false.
+	NextCursor string
+	HasMore    bool
 }
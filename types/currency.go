@@ -0,0 +1,45 @@
+package types
+
+// Currency is an ISO 4217 currency. Amounts are always stored in minor units;
+// Exponent is the number of minor unit digits, e.g. 2 for MYR (1 ringgit = 100 sen)
+// and 0 for JPY.
+type Currency struct {
+	Code     string
+	Exponent int
+}
+
+// currencies holds the ISO 4217 currencies the ledger accepts
+var currencies = map[string]Currency{
+	"AUD": {Code: "AUD", Exponent: 2},
+	"BHD": {Code: "BHD", Exponent: 3},
+	"BND": {Code: "BND", Exponent: 2},
+	"CAD": {Code: "CAD", Exponent: 2},
+	"CHF": {Code: "CHF", Exponent: 2},
+	"CNY": {Code: "CNY", Exponent: 2},
+	"EUR": {Code: "EUR", Exponent: 2},
+	"GBP": {Code: "GBP", Exponent: 2},
+	"HKD": {Code: "HKD", Exponent: 2},
+	"IDR": {Code: "IDR", Exponent: 2},
+	"INR": {Code: "INR", Exponent: 2},
+	"ISK": {Code: "ISK", Exponent: 0},
+	"JOD": {Code: "JOD", Exponent: 3},
+	"JPY": {Code: "JPY", Exponent: 0},
+	"KRW": {Code: "KRW", Exponent: 0},
+	"KWD": {Code: "KWD", Exponent: 3},
+	"MYR": {Code: "MYR", Exponent: 2},
+	"NZD": {Code: "NZD", Exponent: 2},
+	"OMR": {Code: "OMR", Exponent: 3},
+	"PHP": {Code: "PHP", Exponent: 2},
+	"SGD": {Code: "SGD", Exponent: 2},
+	"THB": {Code: "THB", Exponent: 2},
+	"TND": {Code: "TND", Exponent: 3},
+	"TWD": {Code: "TWD", Exponent: 2},
+	"USD": {Code: "USD", Exponent: 2},
+	"VND": {Code: "VND", Exponent: 0},
+}
+
+// LookupCurrency returns the currency for an upper case ISO 4217 code
+func LookupCurrency(code string) (Currency, bool) {
+	currency, ok := currencies[code]
+	return currency, ok
+}
@@ -0,0 +1,165 @@
+package types
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+)
+
+var (
+	ErrCurrencyMismatch = errors.New("currency mismatch")
+	ErrAmountOverflow   = errors.New("amount overflow")
+	ErrUnknownCurrency  = errors.New("unsupported currency")
+)
+
+// Money is an amount in minor units of an ISO 4217 currency. Arithmetic and comparison
+// between amounts of different currencies fail instead of mixing them.
+type Money struct {
+	Amount   int64
+	Currency string
+}
+
+func NewMoney(amount int64, currency string) Money {
+	return Money{Amount: amount, Currency: currency}
+}
+
+// CheckedMoney is NewMoney for amounts coming from outside the ledger. It fails for a currency
+// the ledger does not know, whose exponent would be guessed, and for the smallest int64 amount,
+// which overflows as soon as it is negated.
+func CheckedMoney(amount int64, currency string) (Money, error) {
+	if _, ok := LookupCurrency(currency); !ok {
+		return Money{}, fmt.Errorf("%w %q", ErrUnknownCurrency, currency)
+	}
+	if amount == math.MinInt64 {
+		return Money{}, fmt.Errorf("%w: %d %s", ErrAmountOverflow, amount, currency)
+	}
+	return Money{Amount: amount, Currency: currency}, nil
+}
+
+// Add returns m + other. It fails when the currencies differ or the sum overflows.
+func (m Money) Add(other Money) (Money, error) {
+	if err := m.sameCurrency(other); err != nil {
+		return Money{}, err
+	}
+
+	sum := m.Amount + other.Amount
+	if (other.Amount > 0 && sum < m.Amount) || (other.Amount < 0 && sum > m.Amount) {
+		return Money{}, fmt.Errorf("%w: %s + %s", ErrAmountOverflow, m, other)
+	}
+	return Money{Amount: sum, Currency: m.Currency}, nil
+}
+
+// Sub returns m - other. It fails when the currencies differ or the difference overflows.
+func (m Money) Sub(other Money) (Money, error) {
+	if err := m.sameCurrency(other); err != nil {
+		return Money{}, err
+	}
+
+	difference := m.Amount - other.Amount
+	if (other.Amount > 0 && difference > m.Amount) || (other.Amount < 0 && difference < m.Amount) {
+		return Money{}, fmt.Errorf("%w: %s - %s", ErrAmountOverflow, m, other)
+	}
+	return Money{Amount: difference, Currency: m.Currency}, nil
+}
+
+// Neg returns -m. It fails for the smallest int64 amount, which has no positive counterpart.
+func (m Money) Neg() (Money, error) {
+	if m.Amount == math.MinInt64 {
+		return Money{}, fmt.Errorf("%w: -%s", ErrAmountOverflow, m)
+	}
+	return Money{Amount: -m.Amount, Currency: m.Currency}, nil
+}
+
+// Cmp returns -1, 0 or +1 when m is less than, equal to or greater than other.
+// Amounts of different currencies cannot be compared.
+func (m Money) Cmp(other Money) (int, error) {
+	if err := m.sameCurrency(other); err != nil {
+		return 0, err
+	}
+
+	switch {
+	case m.Amount < other.Amount:
+		return -1, nil
+	case m.Amount > other.Amount:
+		return 1, nil
+	default:
+		return 0, nil
+	}
+}
+
+func (m Money) IsZero() bool {
+	return m.Amount == 0
+}
+
+func (m Money) IsPositive() bool {
+	return m.Amount > 0
+}
+
+func (m Money) IsNegative() bool {
+	return m.Amount < 0
+}
+
+// Major formats the amount in major units of its currency, e.g. 1234 MYR is "12.34"
+// and 1234 JPY is "1234". Unknown currencies are formatted with two minor unit digits.
+func (m Money) Major() string {
+	exponent := 2
+	if currency, ok := LookupCurrency(m.Currency); ok {
+		exponent = currency.Exponent
+	}
+
+	// Go through uint64 so the smallest int64 amount can be negated
+	sign, abs := "", uint64(m.Amount)
+	if m.Amount < 0 {
+		sign, abs = "-", -abs
+	}
+	digits := strconv.FormatUint(abs, 10)
+	if exponent == 0 {
+		return sign + digits
+	}
+
+	if len(digits) <= exponent {
+		digits = strings.Repeat("0", exponent-len(digits)+1) + digits
+	}
+	return sign + digits[:len(digits)-exponent] + "." + digits[len(digits)-exponent:]
+}
+
+// String formats m for display, e.g. "12.34 MYR"
+func (m Money) String() string {
+	return m.Major() + " " + m.Currency
+}
+
+type moneyJSON struct {
+	Amount   int64  `json:"amount"`
+	Currency string `json:"currency"`
+}
+
+// MarshalJSON encodes m as {"amount": <minor units>, "currency": "<ISO 4217 code>"}
+func (m Money) MarshalJSON() ([]byte, error) {
+	return json.Marshal(moneyJSON{Amount: m.Amount, Currency: m.Currency})
+}
+
+// UnmarshalJSON decodes {"amount": <minor units>, "currency": "<ISO 4217 code>"}
+// through CheckedMoney
+func (m *Money) UnmarshalJSON(data []byte) error {
+	var decoded moneyJSON
+	if err := json.Unmarshal(data, &decoded); err != nil {
+		return err
+	}
+
+	checked, err := CheckedMoney(decoded.Amount, decoded.Currency)
+	if err != nil {
+		return err
+	}
+	*m = checked
+	return nil
+}
+
+func (m Money) sameCurrency(other Money) error {
+	if m.Currency != other.Currency {
+		return fmt.Errorf("%w: %s and %s", ErrCurrencyMismatch, m.Currency, other.Currency)
+	}
+	return nil
+}
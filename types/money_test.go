@@ -0,0 +1,114 @@
+package types
+
+import (
+	"encoding/json"
+	"math"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMoneyArithmetic(t *testing.T) {
+	myr := func(amount int64) Money { return NewMoney(amount, "MYR") }
+
+	sum, err := myr(1000).Add(myr(-250))
+	require.NoError(t, err)
+	assert.Equal(t, myr(750), sum)
+
+	difference, err := myr(1000).Sub(myr(1250))
+	require.NoError(t, err)
+	assert.Equal(t, myr(-250), difference)
+
+	negated, err := myr(1000).Neg()
+	require.NoError(t, err)
+	assert.Equal(t, myr(-1000), negated)
+
+	tests := []struct {
+		name    string
+		op      func() (Money, error)
+		wantErr error
+	}{
+		{name: "add overflow", op: func() (Money, error) { return myr(math.MaxInt64).Add(myr(1)) }, wantErr: ErrAmountOverflow},
+		{name: "add underflow", op: func() (Money, error) { return myr(math.MinInt64).Add(myr(-1)) }, wantErr: ErrAmountOverflow},
+		{name: "sub overflow", op: func() (Money, error) { return myr(math.MaxInt64).Sub(myr(-1)) }, wantErr: ErrAmountOverflow},
+		{name: "sub underflow", op: func() (Money, error) { return myr(math.MinInt64).Sub(myr(1)) }, wantErr: ErrAmountOverflow},
+		{name: "neg smallest amount", op: func() (Money, error) { return myr(math.MinInt64).Neg() }, wantErr: ErrAmountOverflow},
+		{name: "add currency mismatch", op: func() (Money, error) { return myr(1).Add(NewMoney(1, "USD")) }, wantErr: ErrCurrencyMismatch},
+		{name: "sub currency mismatch", op: func() (Money, error) { return myr(1).Sub(NewMoney(1, "USD")) }, wantErr: ErrCurrencyMismatch},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := tt.op()
+			assert.ErrorIs(t, err, tt.wantErr)
+		})
+	}
+}
+
+func TestMoneyCmp(t *testing.T) {
+	for _, tt := range []struct {
+		a, b int64
+		want int
+	}{
+		{a: 1, b: 2, want: -1},
+		{a: 2, b: 2, want: 0},
+		{a: 3, b: 2, want: 1},
+	} {
+		got, err := NewMoney(tt.a, "MYR").Cmp(NewMoney(tt.b, "MYR"))
+		require.NoError(t, err)
+		assert.Equal(t, tt.want, got)
+	}
+
+	_, err := NewMoney(1, "MYR").Cmp(NewMoney(1, "SGD"))
+	assert.ErrorIs(t, err, ErrCurrencyMismatch)
+}
+
+func TestMoneyMajor(t *testing.T) {
+	tests := []struct {
+		money Money
+		want  string
+	}{
+		{money: NewMoney(1234, "MYR"), want: "12.34"},
+		{money: NewMoney(-1234, "MYR"), want: "-12.34"},
+		{money: NewMoney(5, "MYR"), want: "0.05"},
+		{money: NewMoney(0, "MYR"), want: "0.00"},
+		{money: NewMoney(1234, "JPY"), want: "1234"},
+		{money: NewMoney(1234, "BHD"), want: "1.234"},
+		{money: NewMoney(1234, "XXX"), want: "12.34"},
+		{money: NewMoney(math.MinInt64, "MYR"), want: "-92233720368547758.08"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.money.Currency+" "+tt.want, func(t *testing.T) {
+			assert.Equal(t, tt.want, tt.money.Major())
+		})
+	}
+
+	assert.Equal(t, "12.34 MYR", NewMoney(1234, "MYR").String())
+}
+
+func TestMoneyJSON(t *testing.T) {
+	data, err := json.Marshal(NewMoney(1234, "MYR"))
+	require.NoError(t, err)
+	assert.JSONEq(t, `{"amount": 1234, "currency": "MYR"}`, string(data))
+
+	var money Money
+	require.NoError(t, json.Unmarshal(data, &money))
+	assert.Equal(t, NewMoney(1234, "MYR"), money)
+
+	assert.ErrorIs(t, json.Unmarshal([]byte(`{"amount": 1234, "currency": "XXX"}`), &money), ErrUnknownCurrency)
+	assert.ErrorIs(t, json.Unmarshal([]byte(`{"amount": -9223372036854775808, "currency": "MYR"}`), &money), ErrAmountOverflow)
+	assert.Error(t, json.Unmarshal([]byte(`{"amount": "1234", "currency": "MYR"}`), &money))
+}
+
+func TestCheckedMoney(t *testing.T) {
+	money, err := CheckedMoney(-1234, "JPY")
+	require.NoError(t, err)
+	assert.Equal(t, NewMoney(-1234, "JPY"), money)
+
+	_, err = CheckedMoney(1234, "XXX")
+	assert.ErrorIs(t, err, ErrUnknownCurrency)
+	_, err = CheckedMoney(1234, "myr")
+	assert.ErrorIs(t, err, ErrUnknownCurrency)
+	_, err = CheckedMoney(math.MinInt64, "MYR")
+	assert.ErrorIs(t, err, ErrAmountOverflow)
+}
@@ -0,0 +1,86 @@
+package types
+
+import "slices"
+
+// Scopes limit what an authenticated request may do. Each route requires one scope.
+const (
+	ScopeBalancesRead      = "balances:read"
+	ScopeTransactionsRead  = "transactions:read"
+	ScopeTransactionsWrite = "transactions:write"
+	ScopeDepositsWrite     = "deposits:write"
+	ScopeWithdrawalsWrite  = "withdrawals:write"
+	ScopeTransfersWrite    = "transfers:write"
+	ScopeConversionsWrite  = "conversions:write"
+	ScopeHoldsRead         = "holds:read"
+	ScopeHoldsWrite        = "holds:write"
+	ScopeAPIKeysRead       = "api-keys:read"
+	ScopeAPIKeysWrite      = "api-keys:write"
+	ScopeAccountsRead      = "accounts:read"
+	ScopeAccountsWrite     = "accounts:write"
+	ScopeAdminRead         = "admin:read"
+	ScopeAdminWrite        = "admin:write"
+)
+
+// AllScopes lists every scope
+var AllScopes = []string{
+	ScopeBalancesRead,
+	ScopeTransactionsRead,
+	ScopeTransactionsWrite,
+	ScopeDepositsWrite,
+	ScopeWithdrawalsWrite,
+	ScopeTransfersWrite,
+	ScopeConversionsWrite,
+	ScopeHoldsRead,
+	ScopeHoldsWrite,
+	ScopeAPIKeysRead,
+	ScopeAPIKeysWrite,
+	ScopeAccountsRead,
+	ScopeAccountsWrite,
+	ScopeAdminRead,
+	ScopeAdminWrite,
+}
+
+// ValidScope reports whether scope is a known scope
+func ValidScope(scope string) bool {
+	return slices.Contains(AllScopes, scope)
+}
+
+// Roles say whose data a principal may act on. Customers act on their own accounts,
+// support staff can also look up any account and admins can also change them.
+const (
+	RoleCustomer = "customer"
+	RoleSupport  = "support"
+	RoleAdmin    = "admin"
+)
+
+// roleRanks orders the roles, each role can do everything the roles below it can
+var roleRanks = map[string]int{
+	RoleCustomer: 1,
+	RoleSupport:  2,
+	RoleAdmin:    3,
+}
+
+// ValidRole reports whether role is a known role
+func ValidRole(role string) bool {
+	_, ok := roleRanks[role]
+	return ok
+}
+
+// Principal is who a request is authenticated as and what it may do
+type Principal struct {
+	UserID string
+	Role   string
+	// KeyID is the API key the request was authenticated with, empty for a JWT
+	KeyID  string
+	Scopes []string
+}
+
+// HasRole reports whether the principal has role or a role above it
+func (p *Principal) HasRole(role string) bool {
+	return roleRanks[p.Role] >= roleRanks[role] && ValidRole(p.Role)
+}
+
+// HasScope reports whether the principal was granted scope
+func (p *Principal) HasScope(scope string) bool {
+	return slices.Contains(p.Scopes, scope)
+}
@@ -15,11 +15,24 @@ type ServiceError struct {
 type ErrorCode string
 
 const (
-	NotFound                 ErrorCode = "NOT_FOUND"
-	BadRequest               ErrorCode = "BAD_REQUEST"
-	ErrorCodeInvalidAmount   ErrorCode = "INVALID_AMOUNT"
-	ErrorCodeInvalidCurrency ErrorCode = "INVALID_CURRENCY"
-	ErrorInvalidParams       ErrorCode = "INVALID_PARAMS"
+	NotFound                         ErrorCode = "NOT_FOUND"
+	Unauthorized                     ErrorCode = "UNAUTHORIZED"
+	BadRequest                       ErrorCode = "BAD_REQUEST"
+	ErrorCodeInvalidAmount           ErrorCode = "INVALID_AMOUNT"
+	ErrorCodeInvalidCurrency         ErrorCode = "INVALID_CURRENCY"
+	ErrorCodeCurrencyMismatch        ErrorCode = "CURRENCY_MISMATCH"
+	ErrorInvalidParams               ErrorCode = "INVALID_PARAMS"
+	ErrorCodeRateNotFound            ErrorCode = "RATE_NOT_FOUND"
+	ErrorCodeQuoteExpired            ErrorCode = "QUOTE_EXPIRED"
+	ErrorCodeInvalidStatusTransition ErrorCode = "INVALID_STATUS_TRANSITION"
+	ErrorCodeIdempotencyKeyInUse     ErrorCode = "IDEMPOTENCY_KEY_IN_USE"
+	ErrorCodeIdempotencyKeyReused    ErrorCode = "IDEMPOTENCY_KEY_REUSED"
+	ErrorCodeInsufficientScope       ErrorCode = "INSUFFICIENT_SCOPE"
+	ErrorCodeInsufficientRole        ErrorCode = "INSUFFICIENT_ROLE"
+	ErrorCodeAccountFrozen           ErrorCode = "ACCOUNT_FROZEN"
+	ErrorCodeAccountClosed           ErrorCode = "ACCOUNT_CLOSED"
+	ErrorCodeBalanceNotZero          ErrorCode = "BALANCE_NOT_ZERO"
+	ErrorCodeInvalidAccountNumber    ErrorCode = "INVALID_ACCOUNT_NUMBER"
 )
 
 func (e ServiceError) Error() string {
@@ -58,4 +71,36 @@ var (
 			Message: message,
 		}
 	}
+
+	NewUnauthorized = func(message string) *ServiceError {
+		return &ServiceError{
+			Status:  http.StatusUnauthorized,
+			Code:    string(Unauthorized),
+			Message: message,
+		}
+	}
+
+	NewForbidden = func(code ErrorCode, message string) *ServiceError {
+		return &ServiceError{
+			Status:  http.StatusForbidden,
+			Code:    string(code),
+			Message: message,
+		}
+	}
+
+	NewConflict = func(code ErrorCode, message string) *ServiceError {
+		return &ServiceError{
+			Status:  http.StatusConflict,
+			Code:    string(code),
+			Message: message,
+		}
+	}
+
+	NewUnprocessableEntity = func(code ErrorCode, message string) *ServiceError {
+		return &ServiceError{
+			Status:  http.StatusUnprocessableEntity,
+			Code:    string(code),
+			Message: message,
+		}
+	}
 )